@@ -72,16 +72,23 @@ func replaceSequences(target *core.BuildTarget) string {
 
 // ReplaceSequences replaces escape sequences in the given string.
 func ReplaceSequences(target *core.BuildTarget, command string) string {
-	return replaceSequencesInternal(target, command, false)
+	return replaceSequencesInternal(target, command, false, false)
+}
+
+// ReplaceSequencesFromRepoRoot replaces escape sequences in the given string for running it from
+// the repo root rather than the target's temp directory, so outputs of other targets are referred to
+// by their full paths in plz-out (as $(out_location) does).
+func ReplaceSequencesFromRepoRoot(target *core.BuildTarget, command string) string {
+	return replaceSequencesInternal(target, command, false, true)
 }
 
 // ReplaceTestSequences replaces escape sequences in the given string when running a test.
 func ReplaceTestSequences(target *core.BuildTarget, command string) string {
 	if command == "" {
 		// An empty test command implies running the test binary.
-		return replaceSequencesInternal(target, fmt.Sprintf("$(exe :%s)", target.Label.Name), true)
+		return replaceSequencesInternal(target, fmt.Sprintf("$(exe :%s)", target.Label.Name), true, false)
 	}
-	return replaceSequencesInternal(target, command, true)
+	return replaceSequencesInternal(target, command, true, false)
 }
 
 // workerCommandAndArgs returns the worker & its command (if any) and subsequent local command for the rule.
@@ -93,19 +100,19 @@ func workerCommandAndArgs(target *core.BuildTarget) (string, string, string) {
 		panic("$(worker) replacements cannot have any commands preceding them.")
 	}
 	return replaceSequence(target, core.ExpandHomePath(match[2]), true, false, false, false, false, false),
-		replaceSequencesInternal(target, strings.TrimSpace(match[3]), false),
-		replaceSequencesInternal(target, match[4], false)
+		replaceSequencesInternal(target, strings.TrimSpace(match[3]), false, false),
+		replaceSequencesInternal(target, match[4], false, false)
 }
 
-func replaceSequencesInternal(target *core.BuildTarget, command string, test bool) string {
+func replaceSequencesInternal(target *core.BuildTarget, command string, test, outPrefix bool) string {
 	cmd := locationReplacement.ReplaceAllStringFunc(command, func(in string) string {
-		return replaceSequence(target, in[11:len(in)-1], false, false, false, false, false, test)
+		return replaceSequence(target, in[11:len(in)-1], false, false, false, outPrefix, false, test)
 	})
 	cmd = locationsReplacement.ReplaceAllStringFunc(cmd, func(in string) string {
-		return replaceSequence(target, in[12:len(in)-1], false, true, false, false, false, test)
+		return replaceSequence(target, in[12:len(in)-1], false, true, false, outPrefix, false, test)
 	})
 	cmd = exeReplacement.ReplaceAllStringFunc(cmd, func(in string) string {
-		return replaceSequence(target, in[6:len(in)-1], true, false, false, false, false, test)
+		return replaceSequence(target, in[6:len(in)-1], true, false, false, outPrefix, false, test)
 	})
 	cmd = outReplacement.ReplaceAllStringFunc(cmd, func(in string) string {
 		return replaceSequence(target, in[15:len(in)-1], false, false, false, true, false, test)
@@ -114,7 +121,7 @@ func replaceSequencesInternal(target *core.BuildTarget, command string, test boo
 		return replaceSequence(target, in[10:len(in)-1], true, false, false, true, false, test)
 	})
 	cmd = dirReplacement.ReplaceAllStringFunc(cmd, func(in string) string {
-		return replaceSequence(target, in[6:len(in)-1], false, true, true, false, false, test)
+		return replaceSequence(target, in[6:len(in)-1], false, true, true, outPrefix, false, test)
 	})
 	cmd = hashReplacement.ReplaceAllStringFunc(cmd, func(in string) string {
 		if !target.Stamp {
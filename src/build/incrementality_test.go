@@ -71,6 +71,7 @@ var KnownFields = map[string]bool{
 	"BuildingDescription": true,
 	"ShowProgress":        true,
 	"Progress":            true,
+	"Kind":                true,
 
 	// Used to save the rule hash rather than actually being hashed itself.
 	"RuleHash": true,
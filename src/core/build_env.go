@@ -135,6 +135,9 @@ func BuildEnvironment(state *BuildState, target *BuildTarget, test bool) BuildEn
 		if state.NeedCoverage {
 			env = append(env, "COVERAGE=true", "COVERAGE_FILE="+path.Join(RepoRoot, target.TestDir(), "test.coverage"))
 		}
+		if state.NeedBenchmarks {
+			env = append(env, "BENCHMARK=true")
+		}
 		if len(target.Outputs()) > 0 {
 			env = append(env, "TEST="+path.Join(RepoRoot, target.TestDir(), target.Outputs()[0]))
 		}
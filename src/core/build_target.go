@@ -105,6 +105,8 @@ type BuildTarget struct {
 	IsHashFilegroup bool `print:"false"`
 	// Marks that the target was added in a post-build function.
 	AddedPostBuild bool `print:"false"`
+	// The name of the rule that created this target (e.g. go_library), as called from the BUILD file.
+	Kind string `print:"false"`
 	// If true, the interactive progress display will try to infer the target's progress
 	// via some heuristics on its output.
 	ShowProgress bool `name:"progress"`
@@ -90,12 +90,14 @@ func ReadConfigFiles(filenames []string, profile string) (*Configuration, error)
 	// Default values for these guys depend on config.Please.Location.
 	defaultPath(&config.Go.TestTool, config.Please.Location, "please_go_test")
 	defaultPath(&config.Go.FilterTool, config.Please.Location, "please_go_filter")
+	defaultPath(&config.Go.ModTool, config.Please.Location, "please_go_mod")
 	defaultPath(&config.Python.PexTool, config.Please.Location, "please_pex")
 	defaultPath(&config.Java.JavacWorker, config.Please.Location, "javac_worker")
 	defaultPath(&config.Java.JarCatTool, config.Please.Location, "jarcat")
 	defaultPath(&config.Java.PleaseMavenTool, config.Please.Location, "please_maven")
 	defaultPath(&config.Java.JUnitRunner, config.Please.Location, "junit_runner.jar")
 	defaultPath(&config.Parse.LintTool, config.Please.Location, "linter")
+	defaultPath(&config.Proto.CompatTool, config.Please.Location, "please_proto_compat")
 
 	// Default values for these guys depend on config.Java.JavaHome if that's been set.
 	if config.Java.JavaHome != "" {
@@ -170,8 +172,11 @@ func DefaultConfiguration() *Configuration {
 	config.Docker.Timeout = cli.Duration(20 * time.Minute)
 	config.Docker.ResultsTimeout = cli.Duration(20 * time.Second)
 	config.Docker.RemoveTimeout = cli.Duration(20 * time.Second)
+	config.Gc.PublishedLabel = []string{"published"}
+	config.Gc.BuildLogDays = 30
 	config.Go.GoTool = "go"
 	config.Go.CgoCCTool = "gcc"
+	config.Go.ModuleProxy = "https://proxy.golang.org"
 	config.Go.GoPath = "$TMP_DIR:$TMP_DIR/src:$TMP_DIR/$PKG:$TMP_DIR/third_party/go:$TMP_DIR/third_party/"
 	config.Python.PipTool = "pip"
 	config.Python.DefaultInterpreter = "python3"
@@ -250,8 +255,9 @@ type Configuration struct {
 		Config            string       `help:"The build config to use when one is not chosen on the command line. Defaults to opt." example:"opt | dbg"`
 		FallbackConfig    string       `help:"The build config to use when one is chosen and a required target does not have one by the same name. Also defaults to opt." example:"opt | dbg"`
 		Lang              string       `help:"Sets the language passed to build rules when building. This can be important for some tools (although hopefully not many) - we've mostly observed it with Sass."`
-		Sandbox           bool         `help:"True to sandbox individual build actions, which isolates them using namespaces. Somewhat experimental, only works on Linux and requires please_sandbox to be installed separately." var:"BUILD_SANDBOX"`
+		Sandbox           bool         `help:"True to sandbox individual build actions, which isolates them using namespaces. Somewhat experimental, only works on Linux.\nSandboxed actions can only see their own sources, tools and the system directories; they get a private /tmp and no network access other than loopback." var:"BUILD_SANDBOX"`
 		PleaseSandboxTool string       `help:"The location of the please_sandbox tool to use."`
+		BuiltinSandbox    bool         `help:"True to use the sandbox built into Please instead of the external please_sandbox tool. It requires unprivileged user namespaces but no setuid binary."`
 		Nonce             string       `help:"This is an arbitrary string that is added to the hash of every build target. It provides a way to force a rebuild of everything when it's changed.\nWe will bump the default of this whenever we think it's required - although it's been a pretty long time now and we hope that'll continue."`
 	}
 	BuildConfig map[string]string `help:"A section of arbitrary key-value properties that are made available in the BUILD language. These are often useful for writing custom rules that need some configurable property.\n\n[buildconfig]\nandroid-tools-version = 23.0.2\n\nFor example, the above can be accessed as CONFIG.ANDROID_TOOLS_VERSION."`
@@ -285,7 +291,7 @@ type Configuration struct {
 	Test               struct {
 		Timeout          cli.Duration `help:"Default timeout applied to all tests. Can be overridden on a per-rule basis."`
 		DefaultContainer string       `help:"Sets the default type of containerisation to use for tests that are given container = True.\nCurrently the only available option is 'docker', we expect to add support for more engines in future." options:"none,docker"`
-		Sandbox          bool         `help:"True to sandbox individual tests, which isolates them using namespaces. Somewhat experimental, only works on Linux and requires please_sandbox to be installed separately." var:"TEST_SANDBOX"`
+		Sandbox          bool         `help:"True to sandbox individual tests, which isolates them using namespaces. Somewhat experimental, only works on Linux.\nSee the build section for more details." var:"TEST_SANDBOX"`
 	}
 	Cover struct {
 		FileExtension    []string `help:"Extensions of files to consider for coverage.\nDefaults to a reasonably obvious set for the builtin rules including .go, .py, .java, etc."`
@@ -300,17 +306,22 @@ type Configuration struct {
 		RunArgs            []string     `help:"Arguments passed to docker run when running a test." example:"-e LANG=en_GB"`
 	} `help:"Please supports running individual tests within Docker containers for isolation. This is useful for tests that mutate some global state (such as an embedded database, or open a server on a particular port). To do so, simply mark a test rule with container = True."`
 	Gc struct {
-		Keep      []BuildLabel `help:"Marks targets that gc should always keep. Can include meta-targets such as //test/... and //docs:all."`
-		KeepLabel []string     `help:"Defines a target label to be kept; for example, if you set this to go, no Go targets would ever be considered for deletion." example:"go"`
+		Keep           []BuildLabel `help:"Marks targets that gc should always keep. Can include meta-targets such as //test/... and //docs:all."`
+		KeepLabel      []string     `help:"Defines a target label to be kept; for example, if you set this to go, no Go targets would ever be considered for deletion." example:"go"`
+		PublishedLabel []string     `help:"Defines a target label marking targets that are published for use outside the repo (for example libraries uploaded to a package repository). These are kept along with their dependencies, and tests on them. Defaults to published."`
+		BuildLog       string       `help:"A file recording which targets have been built, typically by CI. Each line is an RFC3339 timestamp and a build label separated by a space. Targets in it that were built within the last BuildLogDays are kept." example:"/var/log/ci/plz_built.log"`
+		BuildLogDays   int          `help:"How many days of the build log to consider. Defaults to 30."`
 	} `help:"Please supports a form of 'garbage collection', by which it means identifying targets that are not used for anything. By default binary targets and all their transitive dependencies are always considered non-garbage, as are any tests directly on those. The config options here allow tweaking this behaviour to retain more things.\n\nNote that it's a very good idea that your BUILD files are in the standard format when running this."`
 	Go struct {
-		GoTool     string `help:"The binary to use to invoke Go & its subtools with." var:"GO_TOOL"`
-		GoRoot     string `help:"If set, will set the GOROOT environment variable appropriately during build actions."`
-		TestTool   string `help:"Sets the location of the please_go_test tool that is used to template the test main for go_test rules." var:"GO_TEST_TOOL"`
-		GoPath     string `help:"If set, will set the GOPATH environment variable appropriately during build actions." var:"GOPATH"`
-		ImportPath string `help:"Sets the default Go import path at the root of this repository.\nFor example, in the Please repo, we might set it to github.com/thought-machine/please to allow imports from that package within the repo." var:"GO_IMPORT_PATH"`
-		CgoCCTool  string `help:"Sets the location of CC while building cgo_library and cgo_test rules. Defaults to gcc" var:"CGO_CC_TOOL"`
-		FilterTool string `help:"Sets the location of the please_go_filter tool that is used to filter source files against build constraints." var:"GO_FILTER_TOOL"`
+		GoTool      string `help:"The binary to use to invoke Go & its subtools with." var:"GO_TOOL"`
+		GoRoot      string `help:"If set, will set the GOROOT environment variable appropriately during build actions."`
+		TestTool    string `help:"Sets the location of the please_go_test tool that is used to template the test main for go_test rules." var:"GO_TEST_TOOL"`
+		GoPath      string `help:"If set, will set the GOPATH environment variable appropriately during build actions." var:"GOPATH"`
+		ImportPath  string `help:"Sets the default Go import path at the root of this repository.\nFor example, in the Please repo, we might set it to github.com/thought-machine/please to allow imports from that package within the repo." var:"GO_IMPORT_PATH"`
+		CgoCCTool   string `help:"Sets the location of CC while building cgo_library and cgo_test rules. Defaults to gcc" var:"CGO_CC_TOOL"`
+		FilterTool  string `help:"Sets the location of the please_go_filter tool that is used to filter source files against build constraints." var:"GO_FILTER_TOOL"`
+		ModTool     string `help:"Sets the location of the please_go_mod tool that is used to download Go modules for go_get rules with a go_sum hash." var:"GO_MOD_TOOL"`
+		ModuleProxy string `help:"The Go module proxy that go_get rules with a go_sum hash download modules from. Defaults to https://proxy.golang.org." var:"GO_MODULE_PROXY"`
 	} `help:"Please has built-in support for compiling Go, and of course is written in Go itself.\nSee the config subfields or the Go rules themselves for more information.\n\nNote that Please is a bit more flexible than Go about directory layout - for example, it is possible to have multiple packages in a directory, but it's not a good idea to push this too far since Go's directory layout is inextricably linked with its import paths."`
 	Python struct {
 		PipTool            string  `help:"The tool that is invoked during pip_library rules." var:"PIP_TOOL"`
@@ -338,6 +349,8 @@ type Configuration struct {
 		JavacFlags         string    `help:"Additional flags to pass to javac when compiling libraries." example:"-Xmx1200M" var:"JAVAC_FLAGS"`
 		JavacTestFlags     string    `help:"Additional flags to pass to javac when compiling tests." example:"-Xmx1200M" var:"JAVAC_TEST_FLAGS"`
 		DefaultMavenRepo   []cli.URL `help:"Default location to load artifacts from in maven_jar rules. Can be overridden on a per-rule basis." var:"DEFAULT_MAVEN_REPO"`
+		MavenSettings      string    `help:"Build label of a Maven settings.xml file that maven_jar and maven_jars rules read mirrors and credentials for private repos from. They're matched to repos by id, which can be given as id::url." example:"//third_party/java:maven_settings" var:"MAVEN_SETTINGS"`
+		MavenCacheDir      string    `help:"Directory that maven_jars rules cache files downloaded from Maven in, so they don't need to be fetched again each time. By default nothing is cached." var:"MAVEN_CACHE_DIR"`
 	} `help:"Please has built-in support for compiling Java.\nIt builds uber-jars for binary and test rules which contain all dependencies and can be easily deployed, and with the help of some of Please's additional tools they are deterministic as well.\n\nWe've only tested support for Java 7 and 8, although it's likely newer versions will work with little or no change."`
 	Cpp struct {
 		CCTool             string `help:"The tool invoked to compile C code. Defaults to gcc but you might want to set it to clang, for example." var:"CC_TOOL"`
@@ -361,6 +374,7 @@ type Configuration struct {
 		GrpcPythonPlugin string   `help:"The plugin invoked to compile Python code for grpc_library.\nDefaults to protoc-gen-grpc-python." var:"GRPC_PYTHON_PLUGIN"`
 		GrpcJavaPlugin   string   `help:"The plugin invoked to compile Java code for grpc_library.\nDefaults to protoc-gen-grpc-java." var:"GRPC_JAVA_PLUGIN"`
 		GrpcCCPlugin     string   `help:"The plugin invoked to compile C++ code for grpc_library.\nDefaults to grpc_cpp_plugin." var:"GRPC_CC_PLUGIN"`
+		CompatTool       string   `help:"The tool used by proto_compat_test to check protos for incompatible changes.\nDefaults to please_proto_compat in the Please install directory." var:"PROTO_COMPAT_TOOL"`
 		Language         []string `help:"Sets the default set of languages that proto rules are built for.\nChosen from the set of {cc, java, go, py}.\nDefaults to all of them!" var:"PROTO_LANGUAGES"`
 		PythonDep        string   `help:"An in-repo dependency that's applied to any Python proto libraries." var:"PROTO_PYTHON_DEP"`
 		JavaDep          string   `help:"An in-repo dependency that's applied to any Java proto libraries." var:"PROTO_JAVA_DEP"`
@@ -375,6 +389,9 @@ type Configuration struct {
 		Accept []string `help:"Licences that are accepted in this repository.\nWhen this is empty licences are ignored. As soon as it's set any licence detected or assigned must be accepted explicitly here.\nThere's no fuzzy matching, so some package managers (especially PyPI and Maven, but shockingly not npm which rather nicely uses SPDX) will generate a lot of slightly different spellings of the same thing, which will all have to be accepted here. We'd rather that than trying to 'cleverly' match them which might result in matching the wrong thing."`
 		Reject []string `help:"Licences that are explicitly rejected in this repository.\nAn astute observer will notice that this is not very different to just not adding it to the accept section, but it does have the advantage of explicitly documenting things that the team aren't allowed to use."`
 	} `help:"Please has some limited support for declaring acceptable licences and detecting them from some libraries. You should not rely on this for complete licence compliance, but it can be a useful check to try to ensure that unacceptable licences do not slip in."`
+	Policy struct {
+		File string `help:"A file defining a dependency layering policy for the repo, which is enforced as targets are built. It uses the same format as this file, with a section for each layer:\n\n[layer \"common\"]\npackage = //common/...\nforbid = services\n\n[layer \"services\"]\npackage = //services/...\nallow = common\n\nTargets belong to the layer with the most specific matching package. They may not depend, directly or transitively, on targets in a layer that theirs forbids, or if it allows any layers, on ones in a layer it doesn't allow." example:"policy.plzconfig"`
+	} `help:"Please can enforce a policy on which parts of the repo may depend on which others. This is complementary to visibility, which is controlled by the dependency and only applies to direct dependencies; policies are controlled centrally and apply to transitive dependencies too."`
 	Aliases map[string]string `help:"It is possible to define aliases for new commands in your .plzconfig file. These are essentially string-string replacements of the command line, for example 'deploy = run //tools:deployer --' makes 'plz deploy' run a particular tool."`
 	Bazel   struct {
 		Compatibility bool `help:"Activates limited Bazel compatibility mode. When this is active several rule arguments are available under different names (e.g. compiler_flags -> copts etc), the WORKSPACE file is interpreted, Makefile-style replacements like $< and $@ are made in genrule commands, etc.\nNote that Skylark is not generally supported and many aspects of compatibility are fairly superficial; it's unlikely this will work for complex setups of either tool." var:"BAZEL_COMPATIBILITY"`
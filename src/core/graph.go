@@ -25,6 +25,10 @@ type BuildGraph struct {
 	revDeps map[BuildLabel][]*BuildTarget
 	// Registered subrepos, as a map of their name to their root.
 	subrepos map[string]*Subrepo
+	// Dependency layering policy to enforce, if there is one, and any violations of it
+	// that haven't yet been reported.
+	policy           *Policy
+	policyViolations []PolicyViolation
 	// Used to arbitrate access to the graph. We parallelise most build operations
 	// and Go maps aren't natively threadsafe so this is needed.
 	mutex sync.RWMutex
@@ -180,6 +184,24 @@ func (graph *BuildGraph) AddDependency(from BuildLabel, to BuildLabel) {
 	}
 }
 
+// SetPolicy sets the dependency layering policy to check as dependencies are added.
+// It must be called before any targets are added to the graph.
+func (graph *BuildGraph) SetPolicy(policy *Policy) {
+	graph.mutex.Lock()
+	defer graph.mutex.Unlock()
+	graph.policy = policy
+}
+
+// PolicyViolations returns any dependencies added since the last call that violate the
+// graph's layering policy.
+func (graph *BuildGraph) PolicyViolations() []PolicyViolation {
+	graph.mutex.Lock()
+	defer graph.mutex.Unlock()
+	violations := graph.policyViolations
+	graph.policyViolations = nil
+	return violations
+}
+
 // NewGraph constructs and returns a new BuildGraph.
 // Users should not attempt to construct one themselves.
 func NewGraph() *BuildGraph {
@@ -227,6 +249,9 @@ func (graph *BuildGraph) linkDependencies(fromTarget, toTarget *BuildTarget) {
 		if present {
 			fromTarget.resolveDependency(toTarget.Label, target)
 			graph.revDeps[label] = append(graph.revDeps[label], fromTarget)
+			if graph.policy != nil {
+				graph.policyViolations = append(graph.policyViolations, graph.policy.addDependency(graph, fromTarget, target)...)
+			}
 		} else {
 			graph.addPendingRevDep(fromTarget.Label, label, toTarget)
 		}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strings"
+)
+
+// OwnersFileName is the name of the files that declare the owners of a directory.
+const OwnersFileName = "OWNERS"
+
+// ReadOwnersFile reads the owners from the OWNERS file in a directory, if there is one.
+// Each line names one owner; blank lines and comments starting with # are ignored.
+func ReadOwnersFile(dir string) []string {
+	f, err := os.Open(path.Join(dir, OwnersFileName))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	owners := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(strings.SplitN(scanner.Text(), "#", 2)[0]); line != "" {
+			owners = append(owners, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Warning("Failed to read %s: %s", path.Join(dir, OwnersFileName), err)
+	}
+	return owners
+}
+
+// Owners returns the owners of a directory, which are those of the closest package or directory
+// at or above it that has any. Directories that aren't packages (or that haven't been parsed)
+// only have owners from their OWNERS file.
+func (graph *BuildGraph) Owners(dir string) []string {
+	for dir = strings.Trim(dir, "/"); ; dir = path.Dir(dir) {
+		if dir == "." {
+			dir = ""
+		}
+		if pkg := graph.Package(dir); pkg != nil {
+			if len(pkg.Owners) > 0 {
+				return pkg.Owners
+			}
+		} else if owners := ReadOwnersFile(dir); len(owners) > 0 {
+			return owners
+		}
+		if dir == "" {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOwnersFile(t *testing.T) {
+	assert.Equal(t, []string{"alice", "bob"}, ReadOwnersFile("src/core/test_data/owners"))
+	assert.Equal(t, []string{"carol"}, ReadOwnersFile("src/core/test_data/owners/lib"))
+	assert.Nil(t, ReadOwnersFile("src/core/test_data/owners/app"))
+}
+
+func TestOwnersInherited(t *testing.T) {
+	graph := NewGraph()
+	assert.Equal(t, []string{"alice", "bob"}, graph.Owners("src/core/test_data/owners/app"))
+	assert.Equal(t, []string{"carol"}, graph.Owners("src/core/test_data/owners/lib/sub"))
+	assert.Nil(t, graph.Owners("src/core/test_data"))
+}
+
+func TestOwnersFromPackage(t *testing.T) {
+	graph := NewGraph()
+	pkg := NewPackage("src/core/test_data/owners/lib")
+	pkg.Owners = []string{"dave"}
+	graph.AddPackage(pkg)
+	graph.AddPackage(NewPackage("src/core/test_data/owners/app"))
+	assert.Equal(t, []string{"dave"}, graph.Owners("src/core/test_data/owners/lib/sub"))
+	assert.Equal(t, []string{"alice", "bob"}, graph.Owners("src/core/test_data/owners/app"))
+}
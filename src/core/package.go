@@ -17,6 +17,9 @@ type Package struct {
 	Filename string
 	// Subincluded build defs files that this package imported
 	Subincludes []BuildLabel
+	// Owners of this package, from its OWNERS file or a call to package() in its BUILD file.
+	// Packages without any inherit them from the directories above; see BuildGraph.Owners.
+	Owners []string
 	// Targets contained within the package
 	targets map[string]*BuildTarget
 	// Set of output files from rules.
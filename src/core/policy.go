@@ -0,0 +1,204 @@
+// Dependency layering policy, which is a repo-wide restriction on which parts of the
+// repo may depend on one another. This complements visibility, which is declared by
+// the dependency rather than the dependent and is only checked for direct dependencies.
+//
+// The policy file uses the same format as .plzconfig, for example:
+//
+// [layer "common"]
+// package = //common/...
+// forbid = services
+//
+// [layer "services"]
+// package = //services/...
+// allow = common
+//
+// Each target belongs to the layer with the most specific package that includes it, if any.
+// A target may not depend on a target in any layer that its layer forbids, or if its layer
+// has any allowed layers, on one in a layer not among them. Targets in no layer are
+// unrestricted and can be depended on by anything, but dependencies are checked transitively
+// through them (so in the example above, //common/... can't depend on something in
+// //third_party/... that depends on //services/...).
+
+package core
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/gcfg.v1"
+)
+
+// A Policy is a set of layers restricting the dependencies between targets.
+// It's checked incrementally as dependencies are added to the build graph.
+type Policy struct {
+	layers []*policyLayer
+	// reachable records, for each target, a target in each layer that it depends on
+	// (directly or transitively). It's only accessed while holding the graph's lock.
+	reachable map[*BuildTarget]map[*policyLayer]*BuildTarget
+}
+
+// A PolicyViolation is a dependency that isn't permitted by the policy.
+type PolicyViolation struct {
+	// The target that isn't allowed to depend on To, and its layer.
+	From      *BuildTarget
+	FromLayer string
+	// The target that From depends on, possibly transitively, and its layer.
+	To      *BuildTarget
+	ToLayer string
+}
+
+// A policyLayer is a single layer within a policy.
+type policyLayer struct {
+	Name     string
+	Packages []BuildLabel
+	Allow    map[*policyLayer]struct{}
+	Forbid   map[*policyLayer]struct{}
+}
+
+// policyFile is the structure of a policy file as read by gcfg.
+type policyFile struct {
+	Layer map[string]*struct {
+		Package []string
+		Allow   []string
+		Forbid  []string
+	}
+}
+
+// ReadPolicyFile reads a policy from the given file.
+func ReadPolicyFile(filename string) (*Policy, error) {
+	f := policyFile{}
+	if err := gcfg.ReadFileInto(&f, filename); err != nil {
+		return nil, err
+	}
+	return newPolicy(&f)
+}
+
+// newPolicy creates a new Policy from a parsed policy file.
+func newPolicy(f *policyFile) (*Policy, error) {
+	p := &Policy{reachable: map[*BuildTarget]map[*policyLayer]*BuildTarget{}}
+	layers := map[string]*policyLayer{}
+	for name := range f.Layer {
+		layer := &policyLayer{Name: name, Allow: map[*policyLayer]struct{}{}, Forbid: map[*policyLayer]struct{}{}}
+		layers[name] = layer
+		p.layers = append(p.layers, layer)
+	}
+	sort.Slice(p.layers, func(i, j int) bool { return p.layers[i].Name < p.layers[j].Name })
+	packages := map[BuildLabel]string{}
+	for _, layer := range p.layers {
+		l := f.Layer[layer.Name]
+		if len(l.Package) == 0 {
+			return nil, fmt.Errorf("Layer %s doesn't define any packages", layer.Name)
+		}
+		for _, pkg := range l.Package {
+			label, err := TryParseBuildLabel(pkg, "")
+			if err != nil {
+				return nil, fmt.Errorf("Invalid package for layer %s: %s", layer.Name, err)
+			} else if existing, present := packages[label]; present {
+				return nil, fmt.Errorf("%s is in both layers %s and %s", pkg, existing, layer.Name)
+			}
+			packages[label] = layer.Name
+			layer.Packages = append(layer.Packages, label)
+		}
+		add := func(names []string, m map[*policyLayer]struct{}) error {
+			for _, name := range names {
+				if other, present := layers[name]; !present {
+					return fmt.Errorf("Unknown layer %s referenced from layer %s", name, layer.Name)
+				} else if other == layer {
+					return fmt.Errorf("Layer %s can't refer to itself", name)
+				} else {
+					m[other] = struct{}{}
+				}
+			}
+			return nil
+		}
+		if err := add(l.Allow, layer.Allow); err != nil {
+			return nil, err
+		} else if err := add(l.Forbid, layer.Forbid); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// layer returns the layer that the given target belongs to, or nil if it isn't in one.
+func (p *Policy) layer(label BuildLabel) *policyLayer {
+	var ret *policyLayer
+	best := -1
+	for _, layer := range p.layers {
+		for _, pkg := range layer.Packages {
+			if pkg.Includes(label) {
+				// Longer package names are more specific, and individual targets or packages
+				// are more specific than /... at the same level.
+				specificity := 2 * len(pkg.PackageName)
+				if !pkg.IsAllSubpackages() {
+					specificity++
+				}
+				if specificity > best {
+					ret, best = layer, specificity
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// allows returns true if this layer is permitted to depend on the given one.
+func (layer *policyLayer) allows(other *policyLayer) bool {
+	if other == nil || other == layer {
+		return true
+	} else if _, present := layer.Forbid[other]; present {
+		return false
+	} else if len(layer.Allow) == 0 {
+		return true
+	}
+	_, present := layer.Allow[other]
+	return present
+}
+
+// addDependency records that one target now depends on another, and returns any violations
+// of the policy that result. It must be called with the graph's lock held.
+func (p *Policy) addDependency(graph *BuildGraph, from, to *BuildTarget) []PolicyViolation {
+	var violations []PolicyViolation
+	p.propagate(graph, from, p.reachableFrom(to), &violations)
+	return violations
+}
+
+// reachableFrom returns the layers that the given target depends on, including its own.
+func (p *Policy) reachableFrom(target *BuildTarget) map[*policyLayer]*BuildTarget {
+	if reachable, present := p.reachable[target]; present {
+		return reachable
+	}
+	reachable := map[*policyLayer]*BuildTarget{}
+	if layer := p.layer(target.Label); layer != nil {
+		reachable[layer] = target
+	}
+	p.reachable[target] = reachable
+	return reachable
+}
+
+// propagate adds the given layers to those reachable from a target and from its reverse
+// dependencies, checking each layered target that they're newly reachable from.
+// Targets in no layer pass them on unchecked, so dependencies are checked through them.
+func (p *Policy) propagate(graph *BuildGraph, target *BuildTarget, layers map[*policyLayer]*BuildTarget, violations *[]PolicyViolation) {
+	reachable := p.reachableFrom(target)
+	added := map[*policyLayer]*BuildTarget{}
+	for layer, dep := range layers {
+		if _, present := reachable[layer]; !present {
+			reachable[layer] = dep
+			added[layer] = dep
+		}
+	}
+	if len(added) == 0 {
+		return // Nothing new, so nothing further up can have changed either.
+	}
+	if layer := p.layer(target.Label); layer != nil {
+		for other, dep := range added {
+			if !layer.allows(other) {
+				*violations = append(*violations, PolicyViolation{From: target, FromLayer: layer.Name, To: dep, ToLayer: other.Name})
+			}
+		}
+	}
+	for _, revdep := range graph.revDeps[target.Label] {
+		p.propagate(graph, revdep, added, violations)
+	}
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyLayers(t *testing.T) {
+	p, err := ReadPolicyFile("src/core/test_data/policy_good.plzconfig")
+	require.NoError(t, err)
+	assert.Equal(t, "common", p.layer(ParseBuildLabel("//common/strings:strings", "")).Name)
+	assert.Equal(t, "services", p.layer(ParseBuildLabel("//services/api:api", "")).Name)
+	assert.Equal(t, "legacy", p.layer(ParseBuildLabel("//services/legacy/api:api", "")).Name)
+	assert.Equal(t, "legacy", p.layer(ParseBuildLabel("//common/legacy:legacy", "")).Name)
+	assert.Equal(t, "common", p.layer(ParseBuildLabel("//common/legacy/sub:sub", "")).Name)
+	assert.Nil(t, p.layer(ParseBuildLabel("//third_party:lib", "")))
+}
+
+func TestPolicyBadFiles(t *testing.T) {
+	_, err := ReadPolicyFile("src/core/test_data/policy_unknown_layer.plzconfig")
+	assert.Error(t, err)
+	_, err = ReadPolicyFile("src/core/test_data/policy_duplicate_package.plzconfig")
+	assert.Error(t, err)
+	_, err = ReadPolicyFile("src/core/test_data/policy_doesnt_exist.plzconfig")
+	assert.Error(t, err)
+}
+
+func TestPolicyCheck(t *testing.T) {
+	p, err := ReadPolicyFile("src/core/test_data/policy_good.plzconfig")
+	require.NoError(t, err)
+	graph := makePolicyGraph(p, map[string][]string{
+		"//common/strings:strings":   nil,
+		"//common/net:net":           {"//common/strings:strings", "//third_party:lib"},
+		"//services/api:api":         {"//common/net:net"},
+		"//third_party:lib":          nil,
+		"//third_party:client":       {"//services/api:api"},
+		"//common/client:client":     {"//third_party:client"},
+		"//services/legacy/old:old":  nil,
+		"//services/new:new":         {"//services/legacy/old:old"},
+		"//services/legacy/old:uses": {"//services/api:api"},
+	})
+	target := func(label string) *BuildTarget {
+		return graph.TargetOrDie(ParseBuildLabel(label, ""))
+	}
+	violations := graph.PolicyViolations()
+	sort.Slice(violations, func(i, j int) bool { return violations[i].From.Label.Less(violations[j].From.Label) })
+	assert.Equal(t, []PolicyViolation{
+		// common forbids services, even transitively via something outside any layer.
+		{From: target("//common/client:client"), FromLayer: "common", To: target("//services/api:api"), ToLayer: "services"},
+		// services only allows common.
+		{From: target("//services/new:new"), FromLayer: "services", To: target("//services/legacy/old:old"), ToLayer: "legacy"},
+	}, violations)
+	// They're only reported once.
+	assert.Equal(t, 0, len(graph.PolicyViolations()))
+}
+
+func TestPolicyCheckPending(t *testing.T) {
+	p, err := ReadPolicyFile("src/core/test_data/policy_good.plzconfig")
+	require.NoError(t, err)
+	graph := NewGraph()
+	graph.SetPolicy(p)
+	// Dependencies are often added before the targets they refer to have been parsed.
+	client := NewBuildTarget(ParseBuildLabel("//common/client:client", ""))
+	graph.AddTarget(client)
+	graph.AddDependency(client.Label, ParseBuildLabel("//third_party:client", ""))
+	lib := NewBuildTarget(ParseBuildLabel("//third_party:client", ""))
+	graph.AddTarget(lib)
+	graph.AddDependency(lib.Label, ParseBuildLabel("//services/api:api", ""))
+	assert.Equal(t, 0, len(graph.PolicyViolations()))
+	api := NewBuildTarget(ParseBuildLabel("//services/api:api", ""))
+	graph.AddTarget(api)
+	assert.Equal(t, []PolicyViolation{
+		{From: client, FromLayer: "common", To: api, ToLayer: "services"},
+	}, graph.PolicyViolations())
+}
+
+func makePolicyGraph(p *Policy, targets map[string][]string) *BuildGraph {
+	graph := NewGraph()
+	graph.SetPolicy(p)
+	for label := range targets {
+		target := NewBuildTarget(ParseBuildLabel(label, ""))
+		for _, dep := range targets[label] {
+			target.AddDependency(ParseBuildLabel(dep, ""))
+		}
+		graph.AddTarget(target)
+	}
+	for _, target := range graph.AllTargets() {
+		for _, dep := range target.DeclaredDependencies() {
+			graph.AddDependency(target.Label, dep)
+		}
+	}
+	return graph
+}
@@ -0,0 +1,41 @@
+// Builtin sandboxing of build and test actions.
+//
+// This is an alternative to the external please_sandbox tool which doesn't need a setuid
+// binary; instead we use unprivileged user namespaces to isolate the subprocess, and give it
+// a filesystem that only contains its own working directory & declared inputs.
+
+package core
+
+import (
+	"strings"
+)
+
+// sandboxInitArg is passed as argv[0] to a process that should set up the sandbox
+// before running the command it was given.
+const sandboxInitArg = "please_sandbox_init"
+
+// sandboxSystemDirs are the directories that are made available read-only within the sandbox,
+// in addition to the declared inputs of the target.
+var sandboxSystemDirs = []string{"/bin", "/sbin", "/usr", "/lib", "/lib32", "/lib64", "/libx32", "/etc"}
+
+// A sandboxSpec describes the filesystem that a sandboxed process can see.
+type sandboxSpec struct {
+	Dir    string   // The working directory, which is mounted read-write.
+	Mounts []string // Further paths which are mounted read-only.
+}
+
+// sandboxMounts returns the paths outside its working directory that a sandboxed target is permitted to read.
+// Its sources have already been copied into its working directory so aren't needed here.
+func sandboxMounts(state *BuildState, target *BuildTarget) []string {
+	mounts := append([]string{}, sandboxSystemDirs...)
+	mounts = append(mounts, state.Config.Build.Path...)
+	if target != nil {
+		for _, tool := range target.AllTools() {
+			mounts = append(mounts, strings.Fields(toolPath(state, tool))...)
+		}
+		for _, secret := range target.Secrets {
+			mounts = append(mounts, ExpandHomePath(secret))
+		}
+	}
+	return mounts
+}
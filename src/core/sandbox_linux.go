@@ -0,0 +1,243 @@
+// +build linux
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"unsafe"
+)
+
+// sandboxCloneFlags are the namespaces that sandboxed processes are started in.
+const sandboxCloneFlags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWNET | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+
+// stRelatime is the statfs flag for a relatime mount. The other flags we care about
+// have the same values as their MS_ counterparts, but this one does not.
+const stRelatime = 0x1000
+
+// sandboxCommand alters the given command to run within the sandbox.
+// The command is re-executed via our own binary which sets up the mounts in the new namespaces
+// (see MaybeEnterSandbox) and then execs the original command.
+// The process runs as root within its user namespace, which maps to the invoking user outside it.
+func sandboxCommand(cmd *exec.Cmd, mounts []string) error {
+	dir, err := filepath.Abs(cmd.Dir)
+	if err != nil {
+		return err
+	}
+	spec, err := json.Marshal(sandboxSpec{Dir: dir, Mounts: mounts})
+	if err != nil {
+		return err
+	}
+	cmd.Path = "/proc/self/exe"
+	cmd.Args = append([]string{sandboxInitArg, string(spec)}, cmd.Args...)
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags = sandboxCloneFlags
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+	return nil
+}
+
+// MaybeEnterSandbox sets up the sandbox and runs the requested command if this process was
+// started by sandboxCommand. In that case it never returns; otherwise it does nothing.
+// It should be called as early as possible in main().
+func MaybeEnterSandbox() {
+	if len(os.Args) < 3 || os.Args[0] != sandboxInitArg {
+		return
+	}
+	if err := enterSandbox(os.Args[1], os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up sandbox: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// enterSandbox builds the sandbox filesystem described by the given spec, pivots into it and execs argv.
+func enterSandbox(specJSON string, argv []string) error {
+	spec := sandboxSpec{}
+	if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+		return err
+	}
+	// Make everything private first so none of our mounts propagate back outside.
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("Failed to make / private: %s", err)
+	}
+	mounts, err := openSandboxMounts(spec)
+	if err != nil {
+		return err
+	}
+	// The new root is a tmpfs over /tmp, which also becomes the private /tmp within the sandbox.
+	// Any mounts that lived under /tmp are still reachable via the files we opened above.
+	const root = "/tmp"
+	if err := syscall.Mount("tmpfs", root, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=0755"); err != nil {
+		return fmt.Errorf("Failed to mount tmpfs: %s", err)
+	}
+	for _, m := range mounts {
+		if err := bindMount(m.file, path.Join(root, m.path), m.readOnly); err != nil {
+			return fmt.Errorf("Failed to mount %s: %s", m.path, err)
+		}
+		m.file.Close()
+	}
+	// This may already exist if some of the mounts were under /tmp.
+	if err := os.MkdirAll(path.Join(root, "tmp"), DirPermissions); err != nil {
+		return err
+	} else if err := os.Chmod(path.Join(root, "tmp"), os.ModeSticky|0777); err != nil {
+		return err
+	}
+	if err := mountProc(path.Join(root, "proc")); err != nil {
+		return err
+	}
+	if err := loopbackUp(); err != nil {
+		return fmt.Errorf("Failed to bring up loopback interface: %s", err)
+	}
+	if err := pivotRoot(root); err != nil {
+		return err
+	}
+	if err := os.Chdir(spec.Dir); err != nil {
+		return err
+	}
+	os.Setenv("TMPDIR", "/tmp")
+	command, err := exec.LookPath(argv[0])
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(command, argv, os.Environ())
+}
+
+// A sandboxMount is a single path to be bind mounted into the sandbox.
+type sandboxMount struct {
+	path     string
+	file     *os.File
+	readOnly bool
+}
+
+// openSandboxMounts opens all the paths that will be mounted into the sandbox.
+// Paths that don't exist are skipped. The result is sorted so parents are mounted before their children.
+func openSandboxMounts(spec sandboxSpec) ([]sandboxMount, error) {
+	mounts := make([]sandboxMount, 0, len(spec.Mounts)+2)
+	add := func(p string, readOnly bool) error {
+		f, err := os.Open(p)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		mounts = append(mounts, sandboxMount{path: path.Clean(p), file: f, readOnly: readOnly})
+		return nil
+	}
+	for _, m := range spec.Mounts {
+		if err := add(m, true); err != nil {
+			return nil, err
+		}
+	}
+	if err := add("/dev", false); err != nil {
+		return nil, err
+	} else if err := add(spec.Dir, false); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(mounts, func(i, j int) bool { return mounts[i].path < mounts[j].path })
+	return mounts, nil
+}
+
+// bindMount bind mounts an open file or directory onto the given path, creating it if needed.
+func bindMount(file *os.File, target string, readOnly bool) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if err := os.MkdirAll(target, DirPermissions); err != nil {
+			return err
+		}
+	} else if err := os.MkdirAll(path.Dir(target), DirPermissions); err != nil {
+		return err
+	} else if !PathExists(target) {
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+	source := fmt.Sprintf("/proc/self/fd/%d", file.Fd())
+	if err := syscall.Mount(source, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return err
+	} else if !readOnly {
+		return nil
+	}
+	// Any restrictive flags on the existing mount must be preserved; we aren't permitted to remove them.
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(target, &st); err != nil {
+		return err
+	}
+	flags := uintptr(syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY) |
+		uintptr(st.Flags)&(syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC|syscall.MS_NOATIME|syscall.MS_NODIRATIME)
+	if st.Flags&stRelatime != 0 {
+		flags |= syscall.MS_RELATIME
+	}
+	return syscall.Mount("", target, "", flags, "")
+}
+
+// mountProc mounts a new /proc for our PID namespace at the given location.
+// This can be forbidden in some environments (e.g. within some containers), in which case we
+// fall back to the existing one.
+func mountProc(target string) error {
+	if err := os.MkdirAll(target, DirPermissions); err != nil {
+		return err
+	}
+	if err := syscall.Mount("proc", target, "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err == nil {
+		return nil
+	}
+	return syscall.Mount("/proc", target, "", syscall.MS_BIND|syscall.MS_REC, "")
+}
+
+// loopbackUp brings up the loopback interface in the new network namespace.
+// It's created with lo but it is down by default.
+func loopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+	// This is struct ifreq, with only the part of the union we need.
+	var req struct {
+		Name  [syscall.IFNAMSIZ]byte
+		Flags uint16
+		_     [22]byte
+	}
+	copy(req.Name[:], "lo")
+	if err := ioctl(fd, syscall.SIOCGIFFLAGS, unsafe.Pointer(&req)); err != nil {
+		return err
+	}
+	req.Flags |= syscall.IFF_UP
+	return ioctl(fd, syscall.SIOCSIFFLAGS, unsafe.Pointer(&req))
+}
+
+func ioctl(fd int, request uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// pivotRoot makes the given directory the root of the filesystem and detaches the old one.
+func pivotRoot(root string) error {
+	if err := os.Chdir(root); err != nil {
+		return err
+	}
+	// Pivoting onto the same directory stacks the old root on top of the new one,
+	// which can then be unmounted without needing a directory to put it in.
+	if err := syscall.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("Failed to pivot root: %s", err)
+	}
+	if err := syscall.Unmount(".", syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("Failed to unmount old root: %s", err)
+	}
+	return os.Chdir("/")
+}
@@ -0,0 +1,13 @@
+// +build !linux
+
+package core
+
+import "os/exec"
+
+// MaybeEnterSandbox is a no-op on this platform since we never start sandbox processes.
+func MaybeEnterSandbox() {}
+
+// sandboxCommand does nothing on platforms that don't support namespaces.
+func sandboxCommand(cmd *exec.Cmd, mounts []string) error {
+	return nil
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	// The sandbox re-execs this binary, which needs to recognise that & set it up.
+	// This is done here rather than in TestMain since that's already defined for this package.
+	MaybeEnterSandbox()
+}
+
+func TestSandboxWorkingDirectory(t *testing.T) {
+	dir, cleanup := sandboxTestDir(t)
+	defer cleanup()
+	out, err := runSandboxed(t, dir, nil, "pwd && echo hello > out.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, dir, strings.TrimSpace(out))
+	b, err := ioutil.ReadFile(path.Join(dir, "out.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", string(b))
+}
+
+func TestSandboxPrivateTmp(t *testing.T) {
+	dir, cleanup := sandboxTestDir(t)
+	defer cleanup()
+	out, err := runSandboxed(t, dir, nil, "echo $TMPDIR && touch /tmp/please_sandbox_test && ls /tmp")
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Equal(t, "/tmp", lines[0])
+	assert.Contains(t, lines, "please_sandbox_test")
+	assert.False(t, PathExists("/tmp/please_sandbox_test"))
+}
+
+func TestSandboxInputs(t *testing.T) {
+	dir, cleanup := sandboxTestDir(t)
+	defer cleanup()
+	inputs, cleanup2 := sandboxTestDir(t)
+	defer cleanup2()
+	declared := path.Join(inputs, "declared.txt")
+	undeclared := path.Join(inputs, "undeclared.txt")
+	assert.NoError(t, ioutil.WriteFile(declared, []byte("declared"), 0644))
+	assert.NoError(t, ioutil.WriteFile(undeclared, []byte("undeclared"), 0644))
+
+	out, err := runSandboxed(t, dir, []string{declared}, "cat "+declared)
+	assert.NoError(t, err)
+	assert.Equal(t, "declared", out)
+	_, err = runSandboxed(t, dir, []string{declared}, "cat "+undeclared)
+	assert.Error(t, err, "Undeclared inputs should not be visible")
+	_, err = runSandboxed(t, dir, []string{declared}, "echo nope > "+declared)
+	assert.Error(t, err, "Declared inputs should be read-only")
+}
+
+func TestSandboxNamespaces(t *testing.T) {
+	dir, cleanup := sandboxTestDir(t)
+	defer cleanup()
+	out, err := runSandboxed(t, dir, nil, "echo $$ && ls /sys/class/net 2>/dev/null || true")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", strings.Split(out, "\n")[0], "Should be the first process in a new PID namespace")
+}
+
+// sandboxTestDir creates a temporary directory for a test, and returns a function to clean it up.
+func sandboxTestDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "sandbox_test")
+	assert.NoError(t, err)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// runSandboxed runs a shell command within the sandbox. It skips the test if the sandbox can't be used here.
+func runSandboxed(t *testing.T, dir string, mounts []string, command string) (string, error) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Sandboxing is only supported on Linux")
+	}
+	cmd := ExecCommand("bash", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = []string{"PATH=/usr/local/bin:/usr/bin:/bin"}
+	assert.NoError(t, sandboxCommand(cmd, append(mounts, sandboxSystemDirs...)))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		t.Skipf("Can't create user namespaces here: %s", err)
+	}
+	err := cmd.Wait()
+	if strings.Contains(stderr.String(), "Failed to set up sandbox") {
+		t.Skipf("Can't set up sandbox here: %s", stderr.String())
+	}
+	return stdout.String(), err
+}
@@ -103,6 +103,8 @@ type BuildState struct {
 	Coverage TestCoverage
 	// True if tests should calculate coverage metrics
 	NeedCoverage bool
+	// True if tests should run benchmarks as well.
+	NeedBenchmarks bool
 	// True if we intend to build targets. False if we're just parsing
 	// (although some may be built if they're needed for parse).
 	NeedBuild bool
@@ -17,10 +17,12 @@ type TestResults struct {
 	Flakes           int // Number of failed attempts to run the test
 	Failures         []TestFailure
 	Passes           []string
-	Output           string        // Stdout / stderr from the test.
-	Cached           bool          // True if the test results were retrieved from cache
-	TimedOut         bool          // True if the test failed because we timed it out.
-	Duration         time.Duration // Length of time this test took
+	Durations        map[string]time.Duration // Durations of individual test cases, where known.
+	Benchmarks       []BenchmarkResult        // Results of any benchmarks that were run.
+	Output           string                   // Stdout / stderr from the test.
+	Cached           bool                     // True if the test results were retrieved from cache
+	TimedOut         bool                     // True if the test failed because we timed it out.
+	Duration         time.Duration            // Length of time this test took
 }
 
 // TestFailure represents information about a test failure.
@@ -32,6 +34,15 @@ type TestFailure struct {
 	Stderr    string // Standard error during test
 }
 
+// A BenchmarkResult is the result of running a single benchmark.
+type BenchmarkResult struct {
+	Name        string  `json:"name"`
+	Iterations  int64   `json:"iterations"`
+	NsPerOp     float64 `json:"ns_per_op"`
+	BytesPerOp  int64   `json:"bytes_per_op"`
+	AllocsPerOp int64   `json:"allocs_per_op"`
+}
+
 // Aggregate aggregates the given results into this one.
 func (results *TestResults) Aggregate(r *TestResults) {
 	results.NumTests += r.NumTests
@@ -42,6 +53,13 @@ func (results *TestResults) Aggregate(r *TestResults) {
 	results.Flakes += r.Flakes
 	results.Failures = append(results.Failures, r.Failures...)
 	results.Passes = append(results.Passes, r.Passes...)
+	results.Benchmarks = append(results.Benchmarks, r.Benchmarks...)
+	if len(r.Durations) > 0 && results.Durations == nil {
+		results.Durations = make(map[string]time.Duration, len(r.Durations))
+	}
+	for name, duration := range r.Durations {
+		results.Durations[name] = duration
+	}
 	results.Duration += r.Duration
 	// Output can't really be aggregated sensibly.
 }
@@ -2,6 +2,7 @@ package core
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -55,3 +56,11 @@ func TestMergeCoverageLines8(t *testing.T) {
 	coverage := MergeCoverageLines(empty, empty)
 	assert.Equal(t, empty, coverage)
 }
+
+func TestAggregateDurations(t *testing.T) {
+	results := TestResults{}
+	results.Aggregate(&TestResults{Durations: map[string]time.Duration{"a": time.Second}})
+	results.Aggregate(&TestResults{})
+	results.Aggregate(&TestResults{Durations: map[string]time.Duration{"b": time.Minute}})
+	assert.Equal(t, map[string]time.Duration{"a": time.Second, "b": time.Minute}, results.Durations)
+}
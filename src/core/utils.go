@@ -276,6 +276,14 @@ func progressMessage(target *BuildTarget) string {
 // If showOutput is true then output will be printed to stderr as well as returned.
 // It returns the stdout only, combined stdout and stderr and any error that occurred.
 func ExecWithTimeout(target *BuildTarget, dir string, env []string, timeout time.Duration, defaultTimeout cli.Duration, showOutput, attachStdStreams bool, argv []string) ([]byte, []byte, error) {
+	cmd := ExecCommand(argv[0], argv[1:]...)
+	cmd.Dir = dir
+	cmd.Env = env
+	return execWithTimeout(cmd, target, timeout, defaultTimeout, showOutput, attachStdStreams)
+}
+
+// execWithTimeout runs an already prepared command with a timeout. Arguments are as ExecWithTimeout.
+func execWithTimeout(cmd *exec.Cmd, target *BuildTarget, timeout time.Duration, defaultTimeout cli.Duration, showOutput, attachStdStreams bool) ([]byte, []byte, error) {
 	if timeout == 0 {
 		if defaultTimeout == 0 {
 			timeout = 10 * time.Minute
@@ -285,9 +293,6 @@ func ExecWithTimeout(target *BuildTarget, dir string, env []string, timeout time
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	cmd := ExecCommand(argv[0], argv[1:]...)
-	cmd.Dir = dir
-	cmd.Env = env
 
 	var out bytes.Buffer
 	var outerr safeBuffer
@@ -350,6 +355,16 @@ func ExecWithTimeoutShell(target *BuildTarget, dir string, env []string, timeout
 // ExecWithTimeoutShellStdStreams is as ExecWithTimeoutShell but optionally attaches stdin to the subprocess.
 func ExecWithTimeoutShellStdStreams(target *BuildTarget, dir string, env []string, timeout time.Duration, defaultTimeout cli.Duration, showOutput bool, cmd string, sandbox, attachStdStreams bool) ([]byte, []byte, error) {
 	c := append([]string{"bash", "-u", "-o", "pipefail", "-c"}, cmd)
+	if sandbox && State.Config.Build.BuiltinSandbox {
+		// Use our own builtin sandbox. This is a no-op on platforms that don't support it.
+		command := ExecCommand(c[0], c[1:]...)
+		command.Dir = dir
+		command.Env = env
+		if err := sandboxCommand(command, sandboxMounts(State, target)); err != nil {
+			return nil, nil, err
+		}
+		return execWithTimeout(command, target, timeout, defaultTimeout, showOutput, attachStdStreams)
+	}
 	// Runtime check is a little ugly, but we know this only works on Linux right now.
 	if sandbox && runtime.GOOS == "linux" {
 		tool, err := LookPath(State.Config.Build.PleaseSandboxTool, State.Config.Build.Path)
@@ -0,0 +1,215 @@
+package edit
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/op/go-logging.v1"
+
+	"core"
+)
+
+var log = logging.MustGetLogger("edit")
+
+// AddDeps adds dependencies to a target. Any it already has are skipped.
+func AddDeps(graph *core.BuildGraph, label core.BuildLabel, deps []core.BuildLabel) error {
+	return editTarget(graph, label, func(f *File) error {
+		return f.EditList(label.Name, "deps", nil, Labels(deps, label.PackageName))
+	})
+}
+
+// RemoveDeps removes dependencies from a target.
+func RemoveDeps(graph *core.BuildGraph, label core.BuildLabel, deps []core.BuildLabel) error {
+	return editTarget(graph, label, func(f *File) error {
+		return f.EditList(label.Name, "deps", Labels(deps, label.PackageName), nil)
+	})
+}
+
+// SetAttr sets an argument of a target to a value, which is an expression in the BUILD language.
+func SetAttr(graph *core.BuildGraph, label core.BuildLabel, attr, value string) error {
+	if attr == "name" {
+		return fmt.Errorf("use rename to change the name of a target")
+	}
+	return editTarget(graph, label, func(f *File) error {
+		return f.SetAttr(label.Name, attr, value)
+	})
+}
+
+// RemoveAttr removes an argument from a target.
+func RemoveAttr(graph *core.BuildGraph, label core.BuildLabel, attr string) error {
+	if attr == "name" {
+		return fmt.Errorf("can't remove the name of a target")
+	}
+	return editTarget(graph, label, func(f *File) error {
+		return f.RemoveAttr(label.Name, attr)
+	})
+}
+
+// Rename renames a target and updates all references to it in the repo.
+// The whole graph must have been parsed so all the BUILD files are known.
+func Rename(graph *core.BuildGraph, label core.BuildLabel, name string) error {
+	if _, err := core.TryParseBuildLabel(":"+name, label.PackageName); err != nil {
+		return fmt.Errorf("invalid target name %s", name)
+	}
+	e := newEditor(graph)
+	f, err := e.Open(label.PackageName)
+	if err != nil {
+		return err
+	} else if err := f.Rename(label.Name, name); err != nil {
+		return err
+	} else if err := e.ReplaceLabel(label, core.BuildLabel{PackageName: label.PackageName, Name: name}); err != nil {
+		return err
+	}
+	return e.Save()
+}
+
+// Move moves a target to another package, along with its source files, and updates all references
+// to it in the repo. The whole graph must have been parsed so all the BUILD files are known.
+// A BUILD file with the given name is created for the new package if needed.
+func Move(graph *core.BuildGraph, label core.BuildLabel, pkgName, buildFileName string) error {
+	pkgName = strings.Trim(pkgName, "/")
+	if pkgName == label.PackageName {
+		return nil
+	} else if pkg := graph.Package(pkgName); pkg != nil && pkg.Target(label.Name) != nil {
+		return fmt.Errorf("%s already exists", pkg.Target(label.Name).Label)
+	}
+	target := graph.TargetOrDie(label)
+	// Work out where the sources are going before changing anything.
+	srcs := map[string]string{}
+	for _, child := range graph.PackageOrDie(label.PackageName).AllChildren(target) {
+		for _, src := range child.AllLocalSources() {
+			dest := path.Join(pkgName, strings.TrimPrefix(src, label.PackageName+"/"))
+			if core.PathExists(dest) {
+				return fmt.Errorf("can't move %s to %s, it already exists", src, dest)
+			}
+			srcs[src] = dest
+		}
+	}
+	e := newEditor(graph)
+	from, err := e.Open(label.PackageName)
+	if err != nil {
+		return err
+	}
+	stmt, err := from.Remove(label.Name)
+	if err != nil {
+		return err
+	}
+	to, err := e.OpenOrCreate(pkgName, buildFileName)
+	if err != nil {
+		return err
+	} else if err := to.Append(Relabel(stmt, label.PackageName, pkgName)); err != nil {
+		return err
+	}
+	newLabel := core.BuildLabel{PackageName: pkgName, Name: label.Name}
+	if err := e.ReplaceLabel(label, newLabel); err != nil {
+		return err
+	} else if err := e.Save(); err != nil {
+		return err
+	}
+	for src, dest := range srcs {
+		log.Notice("Moving %s to %s", src, dest)
+		if err := os.MkdirAll(path.Dir(dest), core.DirPermissions); err != nil {
+			return err
+		} else if err := os.Rename(src, dest); err != nil {
+			return err
+		}
+	}
+	if len(graph.PackageOrDie(label.PackageName).Subincludes) > 0 {
+		log.Warning("%s has subincludes; %s may need some of them too", label.PackageName, to.filename)
+	}
+	return nil
+}
+
+// editTarget opens the BUILD file containing a single target, edits it and saves it again.
+func editTarget(graph *core.BuildGraph, label core.BuildLabel, f func(*File) error) error {
+	e := newEditor(graph)
+	file, err := e.Open(label.PackageName)
+	if err != nil {
+		return err
+	} else if err := f(file); err != nil {
+		return err
+	}
+	return e.Save()
+}
+
+// An editor edits a set of BUILD files together, so they can all be saved once they've been
+// edited successfully.
+type editor struct {
+	graph *core.BuildGraph
+	files map[string]*File
+}
+
+func newEditor(graph *core.BuildGraph) *editor {
+	return &editor{graph: graph, files: map[string]*File{}}
+}
+
+// Open opens the BUILD file for an existing package.
+func (e *editor) Open(pkgName string) (*File, error) {
+	pkg := e.graph.Package(pkgName)
+	if pkg == nil {
+		return nil, fmt.Errorf("unknown package %s", pkgName)
+	}
+	return e.open(pkg.Filename, pkgName)
+}
+
+// OpenOrCreate opens the BUILD file for a package, which is created with the given filename
+// if it doesn't exist already.
+func (e *editor) OpenOrCreate(pkgName, buildFileName string) (*File, error) {
+	if pkg := e.graph.Package(pkgName); pkg != nil {
+		return e.open(pkg.Filename, pkgName)
+	}
+	return e.open(path.Join(pkgName, buildFileName), pkgName)
+}
+
+func (e *editor) open(filename, pkgName string) (*File, error) {
+	if f, present := e.files[filename]; present {
+		return f, nil
+	}
+	f, err := Open(filename, pkgName)
+	if err != nil {
+		return nil, err
+	}
+	e.files[filename] = f
+	return f, nil
+}
+
+// ReplaceLabel replaces all references to one label with another in every package.
+func (e *editor) ReplaceLabel(from, to core.BuildLabel) error {
+	pkgs := []string{}
+	for name := range e.graph.PackageMap() {
+		pkgs = append(pkgs, name)
+	}
+	sort.Strings(pkgs)
+	for _, name := range pkgs {
+		f, err := e.Open(name)
+		if err != nil {
+			return err
+		} else if n, err := f.ReplaceLabel(from, to); err != nil {
+			return err
+		} else if n == 0 && !f.modified() {
+			delete(e.files, f.filename) // No need to keep it around.
+		}
+	}
+	return nil
+}
+
+// Save saves all the files that have been changed.
+func (e *editor) Save() error {
+	filenames := make([]string, 0, len(e.files))
+	for filename, f := range e.files {
+		if f.modified() {
+			filenames = append(filenames, filename)
+		}
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		log.Notice("Rewriting %s...", filename)
+		if err := e.files[filename].Save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
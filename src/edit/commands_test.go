@@ -0,0 +1,104 @@
+package edit
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"core"
+)
+
+func TestAddAndRemoveDeps(t *testing.T) {
+	defer inTempDir(t)()
+	graph := core.NewGraph()
+	addPackage(t, graph, "lib", "go_library(\n    name = 'lib',\n    srcs = ['lib.go'],\n    deps = ['//src/core'],\n)\n", "lib")
+	label := core.ParseBuildLabel("//lib:lib", "")
+	assert.NoError(t, AddDeps(graph, label, []core.BuildLabel{core.ParseBuildLabel("//src/core:core", ""), core.ParseBuildLabel("//lib:util", "")}))
+	assertFile(t, "lib/BUILD", "go_library(\n    name = 'lib',\n    srcs = ['lib.go'],\n    deps = ['//src/core', ':util'],\n)\n")
+	assert.NoError(t, RemoveDeps(graph, label, []core.BuildLabel{core.ParseBuildLabel("//src/core:core", "")}))
+	assertFile(t, "lib/BUILD", "go_library(\n    name = 'lib',\n    srcs = ['lib.go'],\n    deps = [':util'],\n)\n")
+	assert.Error(t, AddDeps(graph, core.ParseBuildLabel("//lib:missing", ""), []core.BuildLabel{label}))
+}
+
+func TestSetAndRemoveAttr(t *testing.T) {
+	defer inTempDir(t)()
+	graph := core.NewGraph()
+	addPackage(t, graph, "lib", "go_library(\n    name = 'lib',\n    srcs = ['lib.go'],\n)\n", "lib")
+	label := core.ParseBuildLabel("//lib:lib", "")
+	assert.NoError(t, SetAttr(graph, label, "visibility", "['PUBLIC']"))
+	assertFile(t, "lib/BUILD", "go_library(\n    name = 'lib',\n    visibility = ['PUBLIC'],\n    srcs = ['lib.go'],\n)\n")
+	assert.NoError(t, RemoveAttr(graph, label, "srcs"))
+	assertFile(t, "lib/BUILD", "go_library(\n    name = 'lib',\n    visibility = ['PUBLIC'],\n)\n")
+	assert.Error(t, SetAttr(graph, label, "name", "'other'"))
+	assert.Error(t, SetAttr(graph, label, "srcs", "["))
+}
+
+func TestRename(t *testing.T) {
+	defer inTempDir(t)()
+	graph := core.NewGraph()
+	addPackage(t, graph, "lib", "go_library(\n    name = 'lib',\n    srcs = ['lib.go'],\n)\n\ngo_test(\n    name = 'lib_test',\n    srcs = ['lib_test.go'],\n    deps = [':lib'],\n)\n", "lib", "lib_test")
+	addPackage(t, graph, "app", "go_binary(\n    name = 'app',\n    deps = ['//lib'],\n)\n", "app")
+	addPackage(t, graph, "other", "go_binary(\n    name = 'other',\n    deps = ['//app'],\n)\n", "other")
+	assert.Error(t, Rename(graph, core.ParseBuildLabel("//lib:lib", ""), "lib_test"))
+	assert.NoError(t, Rename(graph, core.ParseBuildLabel("//lib:lib", ""), "util"))
+	assertFile(t, "lib/BUILD", "go_library(\n    name = 'util',\n    srcs = ['lib.go'],\n)\n\ngo_test(\n    name = 'lib_test',\n    srcs = ['lib_test.go'],\n    deps = [':util'],\n)\n")
+	assertFile(t, "app/BUILD", "go_binary(\n    name = 'app',\n    deps = ['//lib:util'],\n)\n")
+	assertFile(t, "other/BUILD", "go_binary(\n    name = 'other',\n    deps = ['//app'],\n)\n")
+}
+
+func TestMove(t *testing.T) {
+	defer inTempDir(t)()
+	graph := core.NewGraph()
+	addPackage(t, graph, "lib", "# The utilities.\ngo_library(\n    name = 'util',\n    srcs = ['util.go'],\n    deps = [':lib'],\n)\n\ngo_library(\n    name = 'lib',\n    srcs = ['lib.go'],\n)\n", "util", "lib")
+	addPackage(t, graph, "app", "go_binary(\n    name = 'app',\n    deps = ['//lib:util'],\n)\n", "app")
+	writeFile(t, "lib/util.go", "package util\n")
+	graph.TargetOrDie(core.ParseBuildLabel("//lib:util", "")).AddSource(core.FileLabel{File: "util.go", Package: "lib"})
+
+	assert.NoError(t, Move(graph, core.ParseBuildLabel("//lib:util", ""), "//util", "BUILD"))
+	assertFile(t, "lib/BUILD", "go_library(\n    name = 'lib',\n    srcs = ['lib.go'],\n)\n")
+	assertFile(t, "util/BUILD", "# The utilities.\ngo_library(\n    name = 'util',\n    srcs = ['util.go'],\n    deps = ['//lib'],\n)\n")
+	assertFile(t, "app/BUILD", "go_binary(\n    name = 'app',\n    deps = ['//util'],\n)\n")
+	assertFile(t, "util/util.go", "package util\n")
+	assert.False(t, core.PathExists("lib/util.go"))
+}
+
+// inTempDir changes to a new temporary directory and returns a function to change back & clean it up.
+func inTempDir(t *testing.T) func() {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "edit_test")
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	return func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+func writeFile(t *testing.T, filename, contents string) {
+	require.NoError(t, os.MkdirAll(path.Dir(filename), core.DirPermissions))
+	require.NoError(t, ioutil.WriteFile(filename, []byte(contents), 0644))
+}
+
+func assertFile(t *testing.T, filename, expected string) {
+	b, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(b))
+}
+
+// addPackage writes a BUILD file and adds a package for it to the graph, with the given targets.
+func addPackage(t *testing.T, graph *core.BuildGraph, pkgName, contents string, targets ...string) {
+	writeFile(t, path.Join(pkgName, "BUILD"), contents)
+	pkg := core.NewPackage(pkgName)
+	pkg.Filename = path.Join(pkgName, "BUILD")
+	for _, name := range targets {
+		target := core.NewBuildTarget(core.BuildLabel{PackageName: pkgName, Name: name})
+		pkg.AddTarget(target)
+		graph.AddTarget(target)
+	}
+	graph.AddPackage(pkg)
+}
@@ -0,0 +1,504 @@
+// Package edit makes changes to BUILD files in place.
+//
+// Changes are made to the original text of the file at the positions the parser reports for
+// each statement, so formatting and comments elsewhere in the file are left alone. The file is
+// reparsed after each change, which also checks that it's still valid.
+package edit
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"core"
+	"parse/asp"
+)
+
+// A File is a BUILD file that's being edited.
+type File struct {
+	filename string
+	pkgName  string
+	lines    [][]byte
+	stmts    []*asp.Statement
+	original []byte
+}
+
+// Open opens a BUILD file for editing. It's not an error if the file doesn't exist yet;
+// it'll be created when it's saved.
+func Open(filename, pkgName string) (*File, error) {
+	f := &File{filename: filename, pkgName: pkgName}
+	if !core.PathExists(filename) {
+		return f, nil
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	f.original = b
+	return f, f.update(bytes.Split(b, []byte{'\n'}))
+}
+
+// update replaces the lines of the file and reparses it. If they don't parse the file is left unchanged.
+func (f *File) update(lines [][]byte) error {
+	stmts, err := asp.NewParser(nil).ParseData(bytes.Join(lines, []byte{'\n'}), f.filename)
+	if err != nil {
+		return fmt.Errorf("edit would make %s invalid: %s", f.filename, err)
+	}
+	f.lines = lines
+	f.stmts = stmts
+	return nil
+}
+
+// replace replaces part of the file, from the given start position up to (but not including) the end.
+func (f *File) replace(startLine, startCol, endLine, endCol int, s string) error {
+	b := append(append(append([]byte{}, f.lines[startLine][:startCol]...), s...), f.lines[endLine][endCol:]...)
+	lines := append(append([][]byte{}, f.lines[:startLine]...), bytes.Split(b, []byte{'\n'})...)
+	return f.update(append(lines, f.lines[endLine+1:]...))
+}
+
+// HasTarget returns true if the file contains a call to a build rule with the given name.
+// Targets created by macros or in loops can't be found this way.
+func (f *File) HasTarget(name string) bool {
+	return asp.FindTarget(f.stmts, name) != nil
+}
+
+// findTarget returns the statement for the given target, or an error if there isn't one.
+func (f *File) findTarget(name string) (*asp.Statement, error) {
+	if stmt := asp.FindTarget(f.stmts, name); stmt != nil {
+		return stmt, nil
+	}
+	return nil, fmt.Errorf("can't find target %s in %s; it may be created by a macro", name, f.filename)
+}
+
+// EditList edits a list of strings passed as an argument to the given target, removing the
+// given values and appending the new ones. Values that are build labels are compared as labels,
+// so ':core' matches '//src/core:core' in package src/core.
+// Values to add that are already present are skipped. If the argument doesn't exist yet, it's added.
+func (f *File) EditList(target, attr string, remove, add []string) error {
+	if len(remove) == 0 && len(add) == 0 {
+		return nil
+	}
+	stmt, err := f.findTarget(target)
+	if err != nil {
+		return err
+	}
+	arg := asp.FindArgument(stmt, attr)
+	if arg != nil && arg.Value.Val != nil && arg.Value.Val.List != nil {
+		if add = f.missing(arg.Value.Val.List.Values, add); len(remove) == 0 && len(add) == 0 {
+			return nil
+		}
+	}
+	if arg == nil {
+		if len(add) == 0 {
+			return nil
+		}
+		elems := make([]string, len(add))
+		for i, s := range add {
+			elems[i] = quoted(s, f.quote(stmt))
+		}
+		return f.addArgument(stmt, attr, "["+strings.Join(elems, ", ")+"]")
+	} else if arg.Value.Val == nil || arg.Value.Val.List == nil {
+		return fmt.Errorf("%s of %s isn't a list literal", attr, target)
+	}
+	values := arg.Value.Val.List.Values
+	for _, v := range values {
+		if v.Val == nil || v.Val.String == "" {
+			return fmt.Errorf("%s of %s contains something other than string literals", attr, target)
+		}
+	}
+	removed := func(v *asp.Expression) bool {
+		for _, s := range remove {
+			if f.matches(v, s) {
+				return true
+			}
+		}
+		return false
+	}
+	// New values are quoted the same way as the first existing one.
+	quote := f.quote(stmt)
+	if len(values) > 0 {
+		quote = f.lines[values[0].Pos.Line-1][values[0].Pos.Column-1]
+	}
+	line := arg.Value.Pos.Line - 1
+	if len(values) == 0 || values[len(values)-1].Pos.Line-1 == line {
+		return f.rewriteList(line, arg.Value.Pos.Column-1, values, removed, add, quote)
+	}
+	// The list spans multiple lines; we assume it has one value per line.
+	deleted := map[int]bool{}
+	for _, v := range values {
+		if removed(v) {
+			i := v.Pos.Line - 1
+			if s := strings.TrimSuffix(strings.TrimSpace(string(f.lines[i])), ","); len(s) != len(v.Val.String) {
+				return fmt.Errorf("%s isn't on a line by itself", s)
+			}
+			deleted[i] = true
+		}
+	}
+	last := values[len(values)-1].Pos.Line - 1
+	lines := make([][]byte, 0, len(f.lines)+len(add))
+	for i, l := range f.lines {
+		if !deleted[i] {
+			if i == last && len(add) > 0 && !bytes.HasSuffix(bytes.TrimSpace(l), []byte{','}) {
+				l = append(append([]byte{}, l...), ',')
+			}
+			lines = append(lines, l)
+		}
+		if i == last {
+			indent := leadingWhitespace(f.lines[last])
+			for _, s := range add {
+				lines = append(lines, []byte(indent+quoted(s, quote)+","))
+			}
+		}
+	}
+	return f.update(lines)
+}
+
+// rewriteList rewrites a list that's on a single line, starting at the given column.
+func (f *File) rewriteList(line, start int, values []*asp.Expression, removed func(*asp.Expression) bool, add []string, quote byte) error {
+	end := bytes.IndexByte(f.lines[line][start:], ']')
+	if end == -1 {
+		return fmt.Errorf("can't find end of list")
+	}
+	elems := []string{}
+	for _, v := range values {
+		if !removed(v) {
+			col := v.Pos.Column - 1
+			elems = append(elems, string(f.lines[line][col:col+len(v.Val.String)]))
+		}
+	}
+	for _, s := range add {
+		elems = append(elems, quoted(s, quote))
+	}
+	return f.replace(line, start, line, start+end+1, "["+strings.Join(elems, ", ")+"]")
+}
+
+// SetAttr sets an argument of the given target to the given value, which is an expression in
+// the BUILD language (e.g. "['PUBLIC']"). The argument is added if it's not already there.
+func (f *File) SetAttr(target, attr, value string) error {
+	stmt, err := f.findTarget(target)
+	if err != nil {
+		return err
+	}
+	arg := asp.FindArgument(stmt, attr)
+	if arg == nil {
+		return f.addArgument(stmt, attr, value)
+	}
+	line, col := arg.Value.Pos.Line-1, arg.Value.Pos.Column-1
+	endLine, endCol, err := f.exprEnd(line, col)
+	if err != nil {
+		return err
+	}
+	return f.replace(line, col, endLine, endCol, value)
+}
+
+// RemoveAttr removes an argument from the given target. It's not an error if it doesn't have it.
+func (f *File) RemoveAttr(target, attr string) error {
+	stmt, err := f.findTarget(target)
+	if err != nil {
+		return err
+	}
+	arg := asp.FindArgument(stmt, attr)
+	if arg == nil {
+		return nil
+	}
+	line, col := arg.Expr.Pos.Line-1, arg.Expr.Pos.Column-1
+	endLine, endCol, err := f.exprEnd(arg.Value.Pos.Line-1, arg.Value.Pos.Column-1)
+	if err != nil {
+		return err
+	}
+	rest := f.lines[endLine][endCol:]
+	code := rest
+	if idx := bytes.IndexByte(code, '#'); idx != -1 {
+		code = code[:idx]
+	}
+	if trimmed := bytes.TrimSpace(code); len(bytes.TrimSpace(f.lines[line][:col])) == 0 && (len(trimmed) == 0 || string(trimmed) == ",") {
+		// The argument is on line(s) by itself, so remove them entirely (including any comment after it).
+		return f.update(append(append([][]byte{}, f.lines[:line]...), f.lines[endLine+1:]...))
+	} else if after := bytes.TrimLeft(rest, " "); bytes.HasPrefix(after, []byte{','}) {
+		// Remove the argument along with the comma & space following it.
+		endCol += len(rest) - len(bytes.TrimLeft(after[1:], " "))
+		return f.replace(line, col, endLine, endCol, "")
+	}
+	// It's the last argument; remove the comma & space preceding it instead.
+	prefix := bytes.TrimRight(bytes.TrimRight(bytes.TrimRight(f.lines[line][:col], " "), ","), " ")
+	return f.replace(line, len(prefix), endLine, endCol, "")
+}
+
+// addArgument adds a new argument to a call. In a multi-line call it goes on a new line after
+// the name; in a single-line call it goes at the end.
+func (f *File) addArgument(stmt *asp.Statement, attr, value string) error {
+	name := asp.FindArgument(stmt, "name")
+	line := name.Expr.Pos.Line - 1
+	if line != stmt.Pos.Line-1 {
+		lines := append(append([][]byte{}, f.lines[:line+1]...), []byte(leadingWhitespace(f.lines[line])+attr+" = "+value+","))
+		return f.update(append(lines, f.lines[line+1:]...))
+	}
+	endLine, endCol, err := f.exprEnd(stmt.Pos.Line-1, stmt.Pos.Column-1)
+	if err != nil {
+		return err
+	} else if endLine != line {
+		return fmt.Errorf("can't add %s; the arguments of the call aren't one per line", attr)
+	}
+	// endCol is just after the closing bracket; insert before it (and any trailing comma).
+	prefix := bytes.TrimRight(bytes.TrimRight(f.lines[line][:endCol-1], " "), ",")
+	return f.replace(line, len(prefix), line, len(prefix), ", "+attr+" = "+value)
+}
+
+// Rename changes the name of a target. It doesn't change any references to it.
+func (f *File) Rename(target, name string) error {
+	if f.HasTarget(name) {
+		return fmt.Errorf("%s already contains a target named %s", f.filename, name)
+	}
+	stmt, err := f.findTarget(target)
+	if err != nil {
+		return err
+	}
+	return f.SetAttr(target, "name", quoted(name, f.quote(stmt)))
+}
+
+// Remove removes a target from the file and returns its definition, including any comments
+// immediately above it.
+func (f *File) Remove(target string) (string, error) {
+	stmt, err := f.findTarget(target)
+	if err != nil {
+		return "", err
+	}
+	start := stmt.Pos.Line - 1
+	for start > 0 && bytes.HasPrefix(bytes.TrimSpace(f.lines[start-1]), []byte{'#'}) {
+		start--
+	}
+	end, _, err := f.exprEnd(stmt.Pos.Line-1, stmt.Pos.Column-1)
+	if err != nil {
+		return "", err
+	}
+	text := string(bytes.Join(f.lines[start:end+1], []byte{'\n'}))
+	// Take a blank line with it so we don't leave two next to one another.
+	if end+1 < len(f.lines)-1 && len(bytes.TrimSpace(f.lines[end+1])) == 0 {
+		end++
+	} else if start > 0 && len(bytes.TrimSpace(f.lines[start-1])) == 0 {
+		start--
+	}
+	return text, f.update(append(append([][]byte{}, f.lines[:start]...), f.lines[end+1:]...))
+}
+
+// Append adds a new statement to the end of the file, separated from the one before by a blank line.
+func (f *File) Append(stmt string) error {
+	lines := f.lines
+	for len(lines) > 0 && len(bytes.TrimSpace(lines[len(lines)-1])) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	lines = append([][]byte{}, lines...)
+	if len(lines) > 0 {
+		lines = append(lines, nil)
+	}
+	lines = append(lines, bytes.Split([]byte(strings.TrimSpace(stmt)), []byte{'\n'})...)
+	return f.update(append(lines, nil))
+}
+
+var stringLiteralRegex = regexp.MustCompile(`'[^'\n]*'|"[^"\n]*"`)
+
+// ReplaceLabel replaces all string literals referring to one build label with another.
+// It returns the number of literals it replaced.
+func (f *File) ReplaceLabel(from, to core.BuildLabel) (int, error) {
+	return f.replaceLabels(func(lit string, label core.BuildLabel) string {
+		if label == from {
+			return Label(to, f.pkgName)
+		}
+		return ""
+	})
+}
+
+// RewriteLabels rewrites all string literals that are absolute build labels (e.g. '//src/core')
+// using the given function, which returns their replacement or the empty string to leave them
+// alone. Labels relative to the package (e.g. ':core') are never rewritten.
+// It returns the number of literals it rewrote.
+func (f *File) RewriteLabels(rewrite func(label core.BuildLabel) string) (int, error) {
+	return f.replaceLabels(func(lit string, label core.BuildLabel) string {
+		if strings.HasPrefix(lit, ":") {
+			return ""
+		}
+		return rewrite(label)
+	})
+}
+
+// replaceLabels replaces string literals that are build labels with the result of the given function,
+// unless it returns the empty string. It returns the number of literals it replaced.
+func (f *File) replaceLabels(replace func(lit string, label core.BuildLabel) string) (int, error) {
+	n := 0
+	lines := make([][]byte, len(f.lines))
+	for i, line := range f.lines {
+		lines[i] = stringLiteralRegex.ReplaceAllFunc(line, func(lit []byte) []byte {
+			s := string(lit[1 : len(lit)-1])
+			if label, err := core.TryParseBuildLabel(s, f.pkgName); err == nil {
+				if replacement := replace(s, label); replacement != "" {
+					n++
+					return []byte(quoted(replacement, lit[0]))
+				}
+			}
+			return lit
+		})
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, f.update(lines)
+}
+
+// Relabel rewrites the build labels in a statement from one package so they're correct in another;
+// labels relative to the original package (e.g. ':lib') become absolute, and labels in the new
+// package become relative. Others are left as they are.
+func Relabel(stmt, from, to string) string {
+	return stringLiteralRegex.ReplaceAllStringFunc(stmt, func(lit string) string {
+		if label, err := core.TryParseBuildLabel(lit[1:len(lit)-1], from); err == nil && (lit[1] == ':' || label.PackageName == to) {
+			return quoted(Label(label, to), lit[0])
+		}
+		return lit
+	})
+}
+
+// exprEnd returns the position just after the end of the expression starting at the given position.
+// The expression ends at a comma or closing bracket that's not inside it, or at the end of a line
+// once all its brackets are closed.
+func (f *File) exprEnd(line, col int) (int, int, error) {
+	depth := 0
+	var quote byte
+	endLine, endCol := -1, 0
+	for ; line < len(f.lines); line, col = line+1, 0 {
+		l := f.lines[line]
+		for ; col < len(l); col++ {
+			c := l[col]
+			if quote != 0 {
+				if c == '\\' {
+					col++
+				} else if c == quote {
+					quote = 0
+				}
+				endLine, endCol = line, col+1
+				continue
+			}
+			switch c {
+			case ' ', '\t', '\r':
+				continue
+			case '#':
+				col = len(l)
+				continue
+			case '\'', '"':
+				quote = c
+			case '(', '[', '{':
+				depth++
+			case ')', ']', '}', ',':
+				if depth == 0 {
+					return endLine, endCol, nil
+				} else if c != ',' {
+					depth--
+				}
+			}
+			endLine, endCol = line, col+1
+		}
+		if depth == 0 && quote == 0 && endLine == line {
+			return endLine, endCol, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("unterminated expression in %s", f.filename)
+}
+
+// quote returns the quote character used for a target's name.
+func (f *File) quote(stmt *asp.Statement) byte {
+	if name := asp.FindArgument(stmt, "name"); name != nil {
+		return f.lines[name.Value.Pos.Line-1][name.Value.Pos.Column-1]
+	}
+	return '\''
+}
+
+// missing returns the given values that aren't already in a list.
+func (f *File) missing(values []*asp.Expression, add []string) []string {
+	ret := []string{}
+outer:
+	for _, s := range add {
+		for _, v := range values {
+			if v.Val != nil && v.Val.String != "" && f.matches(v, s) {
+				continue outer
+			}
+		}
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+// matches returns true if the given string literal matches the given value.
+func (f *File) matches(v *asp.Expression, s string) bool {
+	lit := strings.Trim(v.Val.String, `"`)
+	if l1, err := core.TryParseBuildLabel(lit, f.pkgName); err == nil {
+		if l2, err := core.TryParseBuildLabel(s, f.pkgName); err == nil {
+			return l1 == l2
+		}
+	}
+	return lit == s
+}
+
+// Bytes returns the edited contents of the file.
+func (f *File) Bytes() []byte {
+	return bytes.Join(f.lines, []byte{'\n'})
+}
+
+// modified returns true if the file has been changed since it was opened.
+func (f *File) modified() bool {
+	return !bytes.Equal(f.Bytes(), f.original)
+}
+
+// Save writes the edited file back to disk.
+func (f *File) Save() error {
+	if err := os.MkdirAll(path.Dir(f.filename), core.DirPermissions); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f.filename, f.Bytes(), 0664)
+}
+
+// Label returns the shortest form of a build label when written in the given package,
+// e.g. ':core' in src/core, or '//src/core' elsewhere.
+func Label(label core.BuildLabel, pkgName string) string {
+	if label.PackageName == pkgName {
+		return ":" + label.Name
+	} else if label.Name == path.Base(label.PackageName) {
+		return "//" + label.PackageName
+	}
+	return label.String()
+}
+
+// Labels returns the shortest forms of a set of build labels when written in the given package.
+func Labels(labels []core.BuildLabel, pkgName string) []string {
+	ret := make([]string, len(labels))
+	for i, label := range labels {
+		ret[i] = Label(label, pkgName)
+	}
+	return ret
+}
+
+// List formats a list of strings for a new statement in the conventional style: inline if
+// it has a single element, otherwise one element per line at the given indent.
+func List(values []string, indent string) string {
+	if len(values) == 1 {
+		return "['" + values[0] + "']"
+	}
+	var buf bytes.Buffer
+	buf.WriteString("[\n")
+	for _, v := range values {
+		buf.WriteString(indent + "    '" + v + "',\n")
+	}
+	buf.WriteString(indent + "]")
+	return buf.String()
+}
+
+// quoted returns a string literal for the given value.
+func quoted(s string, quote byte) string {
+	return string(quote) + s + string(quote)
+}
+
+// leadingWhitespace returns the whitespace at the start of a line.
+func leadingWhitespace(line []byte) string {
+	return string(line[:len(line)-len(bytes.TrimLeft(line, " \t"))])
+}
@@ -0,0 +1,233 @@
+package edit
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"core"
+)
+
+const testDepsBuildFile = `go_library(
+    name = 'multi',
+    srcs = ['multi.go'],
+    deps = [
+        ':local',
+        '//src/core',
+        "//third_party/go:logging",
+    ],
+)
+
+go_library(
+    name = 'single',
+    srcs = ['single.go'],
+    deps = [':local', '//src/core'],
+    visibility = ['PUBLIC'],
+)
+
+go_library(
+    name = 'none',
+    srcs = ['none.go'],
+)
+
+go_library(name = 'oneline', srcs = ['oneline.go'])
+`
+
+const expectedDepsBuildFile = `go_library(
+    name = 'multi',
+    srcs = ['multi.go'],
+    deps = [
+        ':local',
+        "//third_party/go:logging",
+        '//src/build',
+    ],
+)
+
+go_library(
+    name = 'single',
+    srcs = ['single.go'],
+    deps = [':local', '//third_party/go:testify'],
+    visibility = ['PUBLIC'],
+)
+
+go_library(
+    name = 'none',
+    deps = ['//src/utils', ':local'],
+    srcs = ['none.go'],
+)
+
+go_library(name = 'oneline', srcs = ['oneline.go'], deps = ['//src/core'])
+`
+
+func TestEditList(t *testing.T) {
+	filename := writeTempFile(t, testDepsBuildFile)
+	defer os.Remove(filename)
+
+	labels := func(labels ...string) []string {
+		ret := make([]string, len(labels))
+		for i, label := range labels {
+			ret[i] = Label(core.ParseBuildLabel(label, "src/test"), "src/test")
+		}
+		return ret
+	}
+	f, err := Open(filename, "src/test")
+	require.NoError(t, err)
+	assert.NoError(t, f.EditList("multi", "deps", labels("//src/core:core"), labels("//src/build:build")))
+	assert.NoError(t, f.EditList("single", "deps", labels("//src/core:core"), labels("//third_party/go:testify")))
+	assert.NoError(t, f.EditList("none", "deps", nil, labels("//src/utils:utils", ":local")))
+	assert.NoError(t, f.EditList("oneline", "deps", nil, labels("//src/core:core")))
+	assert.Error(t, f.EditList("missing", "deps", nil, labels("//src/core:core")))
+	assert.False(t, f.HasTarget("missing"))
+	require.NoError(t, f.Save())
+	b, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, expectedDepsBuildFile, string(b))
+}
+
+func TestEditListNotLiteral(t *testing.T) {
+	filename := writeTempFile(t, "go_library(\n    name = 'lib',\n    srcs = glob(['*.go']),\n)\n")
+	defer os.Remove(filename)
+	f, err := Open(filename, "src/test")
+	require.NoError(t, err)
+	assert.Error(t, f.EditList("lib", "srcs", nil, []string{"new.go"}))
+}
+
+func TestAppend(t *testing.T) {
+	filename := writeTempFile(t, "go_library(name = 'lib', srcs = ['lib.go'])\n\n")
+	defer os.Remove(filename)
+	f, err := Open(filename, "src/test")
+	require.NoError(t, err)
+	assert.NoError(t, f.Append("go_test(\n    name = 'lib_test',\n    srcs = "+List([]string{"lib_test.go"}, "    ")+",\n    deps = "+List([]string{":lib", "//third_party/go:testify"}, "    ")+",\n)\n"))
+	assert.Equal(t, `go_library(name = 'lib', srcs = ['lib.go'])
+
+go_test(
+    name = 'lib_test',
+    srcs = ['lib_test.go'],
+    deps = [
+        ':lib',
+        '//third_party/go:testify',
+    ],
+)
+`, string(f.Bytes()))
+}
+
+func TestAppendNewFile(t *testing.T) {
+	f, err := Open("/nonexistent/BUILD", "src/test")
+	require.NoError(t, err)
+	assert.NoError(t, f.Append("go_library(name = 'lib')"))
+	assert.Equal(t, "go_library(name = 'lib')\n", string(f.Bytes()))
+}
+
+const testAttrBuildFile = `# A library.
+go_library(
+    name = 'lib',
+    srcs = glob(
+        ['*.go'],
+        exclude = ['*_test.go'],
+    ),
+    visibility = ['PUBLIC'],  # Everyone can use it.
+)
+
+go_test(name = 'lib_test', srcs = ['lib_test.go'], deps = [':lib'])
+`
+
+func TestSetAttr(t *testing.T) {
+	f := openString(t, testAttrBuildFile)
+	assert.NoError(t, f.SetAttr("lib", "srcs", "['lib.go']"))
+	assert.NoError(t, f.SetAttr("lib", "test_only", "True"))
+	assert.NoError(t, f.SetAttr("lib_test", "srcs", "glob(['*_test.go'])"))
+	assert.NoError(t, f.SetAttr("lib_test", "flags", "'-v'"))
+	assert.Error(t, f.SetAttr("lib", "visibility", "['PUBLIC'"))
+	assert.Equal(t, `# A library.
+go_library(
+    name = 'lib',
+    test_only = True,
+    srcs = ['lib.go'],
+    visibility = ['PUBLIC'],  # Everyone can use it.
+)
+
+go_test(name = 'lib_test', srcs = glob(['*_test.go']), deps = [':lib'], flags = '-v')
+`, string(f.Bytes()))
+}
+
+func TestRemoveAttr(t *testing.T) {
+	f := openString(t, testAttrBuildFile)
+	assert.NoError(t, f.RemoveAttr("lib", "srcs"))
+	assert.NoError(t, f.RemoveAttr("lib", "visibility"))
+	assert.NoError(t, f.RemoveAttr("lib", "deps"))
+	assert.NoError(t, f.RemoveAttr("lib_test", "srcs"))
+	assert.NoError(t, f.RemoveAttr("lib_test", "deps"))
+	assert.Equal(t, `# A library.
+go_library(
+    name = 'lib',
+)
+
+go_test(name = 'lib_test')
+`, string(f.Bytes()))
+}
+
+func TestRenameAndRemove(t *testing.T) {
+	f := openString(t, testAttrBuildFile)
+	assert.Error(t, f.Rename("lib", "lib_test"))
+	assert.NoError(t, f.Rename("lib", "core"))
+	n, err := f.ReplaceLabel(core.ParseBuildLabel("//src/test:lib", ""), core.ParseBuildLabel("//src/test:core", ""))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	stmt, err := f.Remove("core")
+	assert.NoError(t, err)
+	assert.Equal(t, `# A library.
+go_library(
+    name = 'core',
+    srcs = glob(
+        ['*.go'],
+        exclude = ['*_test.go'],
+    ),
+    visibility = ['PUBLIC'],  # Everyone can use it.
+)`, stmt)
+	assert.Equal(t, "go_test(name = 'lib_test', srcs = ['lib_test.go'], deps = [':core'])\n", string(f.Bytes()))
+}
+
+func TestRewriteLabels(t *testing.T) {
+	f := openString(t, "go_test(name = 'lib_test', deps = [':lib', '//src/test', '//src/test:lib', '//third_party/go:testify'])\n")
+	n, err := f.RewriteLabels(func(label core.BuildLabel) string {
+		if label.PackageName == "src/test" {
+			return "//test:" + label.Name
+		}
+		return ""
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, "go_test(name = 'lib_test', deps = [':lib', '//test:test', '//test:lib', '//third_party/go:testify'])\n", string(f.Bytes()))
+}
+
+func TestRelabel(t *testing.T) {
+	assert.Equal(t, "deps = [':lib', '//src/core', '//src/other:other', \"src.go\"]",
+		Relabel("deps = ['//src/test:lib', ':core', '//src/other:other', \"src.go\"]", "src/core", "src/test"))
+}
+
+func TestLabel(t *testing.T) {
+	assert.Equal(t, ":core", Label(core.ParseBuildLabel("//src/core:core", ""), "src/core"))
+	assert.Equal(t, "//src/core", Label(core.ParseBuildLabel("//src/core:core", ""), "src/query"))
+	assert.Equal(t, "//third_party/go:testify", Label(core.ParseBuildLabel("//third_party/go:testify", ""), "src/query"))
+}
+
+// openString opens a temporary file with the given contents for editing.
+func openString(t *testing.T, contents string) *File {
+	filename := writeTempFile(t, contents)
+	defer os.Remove(filename)
+	f, err := Open(filename, "src/test")
+	require.NoError(t, err)
+	return f
+}
+
+func writeTempFile(t *testing.T, contents string) string {
+	f, err := ioutil.TempFile("", "BUILD")
+	require.NoError(t, err)
+	_, err = f.Write([]byte(contents))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	return f.Name()
+}
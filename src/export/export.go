@@ -4,60 +4,120 @@
 package export
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"regexp"
 	"strings"
 
 	"gopkg.in/op/go-logging.v1"
 
 	"core"
+	"edit"
 	"gc"
 )
 
 var log = logging.MustGetLogger("export")
 
-// ToDir exports a set of targets to the given directory.
+// prunedConfigSections are sections of the config that describe the repo's own infrastructure
+// rather than how to build it, so aren't exported.
+var prunedConfigSections = map[string]bool{
+	"cache":   true,
+	"gc":      true,
+	"metrics": true,
+	"policy":  true,
+}
+
+// configSectionRe matches the header of a section in the config.
+var configSectionRe = regexp.MustCompile(`^\s*\[\s*([A-Za-z]+)`)
+
+// configValueRe matches a single setting in the config.
+var configValueRe = regexp.MustCompile(`^\s*[A-Za-z][A-Za-z0-9_-]*\s*=\s*(.*?)\s*$`)
+
+// ToDir exports a set of targets to the given directory, along with everything needed to build
+// them standalone: their transitive dependencies and subincludes, the subrepos they use and the
+// repo config. If trim is true, targets that aren't needed are removed from the exported
+// BUILD files. If stripPrefix is given, packages under it are moved to the root of the export
+// and labels referring to them are rewritten to match.
 // It dies on any errors.
-func ToDir(state *core.BuildState, dir string, targets []core.BuildLabel) {
+func ToDir(state *core.BuildState, dir string, targets []core.BuildLabel, trim bool, stripPrefix string) {
+	stripPrefix = strings.Trim(stripPrefix, "/")
 	done := map[*core.BuildTarget]bool{}
 	for _, target := range targets {
-		export(state.Graph, dir, state.Graph.TargetOrDie(target), done)
+		export(state.Graph, dir, stripPrefix, state.Graph.TargetOrDie(target), done)
+	}
+	for _, filename := range state.Config.Parse.PreloadBuildDefs {
+		copyFile(filename, dir, stripPrefix)
 	}
 	// Now write all the build files
 	packages := map[*core.Package]bool{}
 	for target := range done {
 		packages[state.Graph.PackageOrDie(target.Label.PackageName)] = true
 	}
+	if err := checkRelocation(packages, stripPrefix); err != nil {
+		log.Fatalf("%s\n", err)
+	}
 	for pkg := range packages {
-		dest := path.Join(dir, pkg.Filename)
+		dest := path.Join(dir, relocate(pkg.Filename, stripPrefix))
 		if err := core.RecursiveCopyFile(pkg.Filename, dest, 0, false, false); err != nil {
 			log.Fatalf("Failed to copy BUILD file: %s\n", pkg.Filename)
 		}
-		// Now rewrite the unused targets out of it
-		victims := []string{}
-		for _, target := range pkg.AllTargets() {
-			if !done[target] {
-				victims = append(victims, target.Label.Name)
+		if trim {
+			// Now rewrite the unused targets out of it
+			victims := []string{}
+			for _, target := range pkg.AllTargets() {
+				if !done[target] && !target.Label.HasParent() {
+					victims = append(victims, target.Label.Name)
+				}
+			}
+			if err := gc.RewriteFile(state, dest, victims); err != nil {
+				log.Fatalf("Failed to rewrite BUILD file: %s\n", err)
 			}
 		}
-		if err := gc.RewriteFile(state, dest, victims); err != nil {
-			log.Fatalf("Failed to rewrite BUILD file: %s\n", err)
+		if err := rewriteLabels(dest, pkg.Name, stripPrefix); err != nil {
+			log.Fatalf("Failed to rewrite labels in %s: %s\n", pkg.Filename, err)
+		}
+	}
+	if err := exportConfig(core.ConfigFileName, path.Join(dir, core.ConfigFileName), packages, stripPrefix); err != nil {
+		log.Fatalf("Failed to export config: %s\n", err)
+	}
+}
+
+// ConfigTargets returns the targets that settings in the repo config refer to (e.g. tools),
+// which need to be exported alongside any others for the exported config to work.
+// It dies on any errors.
+func ConfigTargets(filename string) []core.BuildLabel {
+	lines, err := readConfig(filename)
+	if err != nil {
+		log.Fatalf("Failed to read config: %s\n", err)
+	}
+	labels := []core.BuildLabel{}
+	for _, line := range lines {
+		if line.Label != nil && !line.Pruned {
+			labels = append(labels, *line.Label)
 		}
 	}
+	return labels
 }
 
 // export implements the logic of ToDir, but prevents repeating targets.
-func export(graph *core.BuildGraph, dir string, target *core.BuildTarget, done map[*core.BuildTarget]bool) {
+func export(graph *core.BuildGraph, dir, stripPrefix string, target *core.BuildTarget, done map[*core.BuildTarget]bool) {
 	if done[target] {
 		return
 	}
-	for _, src := range target.AllSources() {
-		if src.Label() == nil { // We'll handle these dependencies later
-			for _, p := range src.FullPaths(graph) {
-				if !strings.HasPrefix(p, "/") { // Don't copy system file deps.
-					if err := core.RecursiveCopyFile(p, path.Join(dir, p), 0, false, false); err != nil {
-						log.Fatalf("Error copying file: %s\n", err)
-					}
+	if subrepo := graph.SubrepoFor(target.Label.PackageName); subrepo != nil {
+		// Subrepos aren't part of this repo; we export whatever creates them instead.
+		if subrepo.Target != nil {
+			export(graph, dir, stripPrefix, subrepo.Target, done)
+		}
+		return
+	}
+	for _, inputs := range [][]core.BuildInput{target.AllSources(), target.Data, target.Tools} {
+		for _, input := range inputs {
+			if input.Label() == nil { // We'll handle these dependencies later
+				for _, p := range input.FullPaths(graph) {
+					copyFile(p, dir, stripPrefix)
 				}
 			}
 		}
@@ -65,14 +125,156 @@ func export(graph *core.BuildGraph, dir string, target *core.BuildTarget, done m
 	done[target] = true
 	for _, dep := range target.Dependencies() {
 		if parent := dep.Parent(graph); parent != nil && parent != target.Parent(graph) && parent != target {
-			export(graph, dir, parent, done)
+			export(graph, dir, stripPrefix, parent, done)
 		} else {
-			export(graph, dir, dep, done)
+			export(graph, dir, stripPrefix, dep, done)
 		}
 	}
 	for _, subinclude := range graph.PackageOrDie(target.Label.PackageName).Subincludes {
-		export(graph, dir, graph.TargetOrDie(subinclude), done)
+		export(graph, dir, stripPrefix, graph.TargetOrDie(subinclude), done)
+	}
+}
+
+// copyFile copies a file in the repo into the same place in the given directory,
+// less any prefix being stripped.
+func copyFile(filename, dir, stripPrefix string) {
+	if strings.HasPrefix(filename, "/") { // Don't copy system file deps.
+		return
+	}
+	if err := core.RecursiveCopyFile(filename, path.Join(dir, relocate(filename, stripPrefix)), 0, false, false); err != nil {
+		log.Fatalf("Error copying file: %s\n", err)
+	}
+}
+
+// relocate returns the path a file or package is exported to, which is the same as it is in
+// the repo unless it's under the prefix being stripped.
+func relocate(name, stripPrefix string) string {
+	if stripPrefix == "" {
+		return name
+	} else if name == stripPrefix {
+		return ""
+	}
+	return strings.TrimPrefix(name, stripPrefix+"/")
+}
+
+// relocateLabel returns the label that the given one becomes once exported, or the empty string
+// if it isn't under the prefix being stripped and hence doesn't change.
+func relocateLabel(label core.BuildLabel, stripPrefix string) string {
+	pkgName := relocate(label.PackageName, stripPrefix)
+	if pkgName == label.PackageName {
+		return ""
+	}
+	label.PackageName = pkgName
+	if pkgName != "" && label.Name == path.Base(pkgName) {
+		return "//" + pkgName
+	}
+	return label.String()
+}
+
+// checkRelocation checks that stripping the prefix doesn't move any packages on top of one another.
+func checkRelocation(packages map[*core.Package]bool, stripPrefix string) error {
+	if stripPrefix == "" {
+		return nil
+	}
+	names := map[string]string{}
+	for pkg := range packages {
+		name := relocate(pkg.Name, stripPrefix)
+		if existing, present := names[name]; present {
+			return fmt.Errorf("Can't strip prefix %s; packages %s and %s would both be exported to //%s", stripPrefix, existing, pkg.Name, name)
+		}
+		names[name] = pkg.Name
+	}
+	return nil
+}
+
+// rewriteLabels rewrites any labels in an exported BUILD file that refer to packages under the
+// prefix being stripped.
+func rewriteLabels(filename, pkgName, stripPrefix string) error {
+	if stripPrefix == "" {
+		return nil
+	}
+	f, err := edit.Open(filename, pkgName)
+	if err != nil {
+		return err
+	}
+	if n, err := f.RewriteLabels(func(label core.BuildLabel) string {
+		return relocateLabel(label, stripPrefix)
+	}); err != nil || n == 0 {
+		return err
+	}
+	return f.Save()
+}
+
+// A configLine is a single line of the repo config.
+type configLine struct {
+	Text string
+	// True if the line is in a section that isn't exported.
+	Pruned bool
+	// The build label that the line sets, if any.
+	Label *core.BuildLabel
+	// The value of the setting, if it's a build label.
+	Value string
+}
+
+// readConfig reads the repo config, returning nothing if it doesn't exist.
+func readConfig(filename string) ([]configLine, error) {
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(b), "\n")
+	ret := make([]configLine, len(lines))
+	section := ""
+	for i, line := range lines {
+		ret[i].Text = line
+		if match := configSectionRe.FindStringSubmatch(line); match != nil {
+			section = strings.ToLower(match[1])
+		} else if match := configValueRe.FindStringSubmatch(line); match != nil && strings.HasPrefix(match[1], "//") {
+			if label, err := core.TryParseBuildLabel(match[1], ""); err == nil {
+				ret[i].Label = &label
+				ret[i].Value = match[1]
+			}
+		}
+		ret[i].Pruned = prunedConfigSections[section]
+	}
+	return ret, nil
+}
+
+// exportConfig copies the repo config, pruning sections that are specific to this repo's
+// infrastructure and rewriting labels under the prefix being stripped. It's an error for any
+// remaining setting to refer to a target in a package that isn't exported.
+func exportConfig(filename, dest string, packages map[*core.Package]bool, stripPrefix string) error {
+	lines, err := readConfig(filename)
+	if err != nil || lines == nil {
+		return err
+	}
+	pkgNames := map[string]bool{}
+	for pkg := range packages {
+		pkgNames[pkg.Name] = true
+	}
+	ret := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line.Pruned {
+			if configSectionRe.MatchString(line.Text) {
+				log.Notice("Not exporting %s section of config", strings.TrimSpace(line.Text))
+			}
+			continue
+		} else if line.Label != nil {
+			if !pkgNames[line.Label.PackageName] {
+				return fmt.Errorf("Config setting %s refers to %s, which isn't being exported", strings.TrimSpace(line.Text), line.Label)
+			} else if relocated := relocateLabel(*line.Label, stripPrefix); relocated != "" {
+				idx := strings.LastIndex(line.Text, line.Value)
+				line.Text = line.Text[:idx] + relocated + line.Text[idx+len(line.Value):]
+			}
+		}
+		ret = append(ret, line.Text)
+	}
+	if err := os.MkdirAll(path.Dir(dest), core.DirPermissions); err != nil {
+		return err
 	}
+	return ioutil.WriteFile(dest, []byte(strings.Join(ret, "\n")), 0644)
 }
 
 // Outputs exports the outputs of a target.
@@ -0,0 +1,134 @@
+package export
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"core"
+)
+
+const testConfig = `[please]
+version = 12.0.0
+
+[cache]
+dir = .plz-cache
+httpurl = https://cache.internal.example.com
+
+[go]
+testtool = //tools/please_go_test
+cgocctool = gcc
+
+[proto]
+pythondep = //third_party/python:protobuf
+godep = //third_party/go:protobuf
+`
+
+const expectedConfig = `[please]
+version = 12.0.0
+
+[go]
+testtool = //tools/please_go_test
+cgocctool = gcc
+
+[proto]
+pythondep = //third_party/python:protobuf
+godep = //third_party/go:protobuf
+`
+
+const expectedStrippedConfig = `[please]
+version = 12.0.0
+
+[go]
+testtool = //please_go_test
+cgocctool = gcc
+
+[proto]
+pythondep = //third_party/python:protobuf
+godep = //third_party/go:protobuf
+`
+
+func TestExportConfig(t *testing.T) {
+	assert.Equal(t, expectedConfig, exportTestConfig(t, ""))
+}
+
+func TestExportConfigStripPrefix(t *testing.T) {
+	assert.Equal(t, expectedStrippedConfig, exportTestConfig(t, "tools"))
+}
+
+func TestExportConfigUnexportedTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, ".plzconfig"), []byte(testConfig), 0644))
+	assert.Error(t, exportConfig(path.Join(dir, ".plzconfig"), path.Join(dir, "export/.plzconfig"), testPackages(false), ""))
+}
+
+func TestExportConfigMissing(t *testing.T) {
+	assert.NoError(t, exportConfig("/nonexistent/.plzconfig", "/nonexistent/export/.plzconfig", nil, ""))
+}
+
+func TestConfigTargets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, ".plzconfig"), []byte(testConfig), 0644))
+	assert.Equal(t, []core.BuildLabel{
+		core.ParseBuildLabel("//tools/please_go_test", ""),
+		core.ParseBuildLabel("//third_party/python:protobuf", ""),
+		core.ParseBuildLabel("//third_party/go:protobuf", ""),
+	}, ConfigTargets(path.Join(dir, ".plzconfig")))
+}
+
+func TestRelocate(t *testing.T) {
+	assert.Equal(t, "src/lib/lib.go", relocate("src/lib/lib.go", ""))
+	assert.Equal(t, "lib/lib.go", relocate("src/lib/lib.go", "src"))
+	assert.Equal(t, "", relocate("src", "src"))
+	assert.Equal(t, "srcs/lib.go", relocate("srcs/lib.go", "src"))
+}
+
+func TestRelocateLabel(t *testing.T) {
+	assert.Equal(t, "", relocateLabel(core.ParseBuildLabel("//third_party/go:logging", ""), "src"))
+	assert.Equal(t, "//lib", relocateLabel(core.ParseBuildLabel("//src/lib", ""), "src"))
+	assert.Equal(t, "//lib:lib_test", relocateLabel(core.ParseBuildLabel("//src/lib:lib_test", ""), "src"))
+	assert.Equal(t, "//:src", relocateLabel(core.ParseBuildLabel("//src", ""), "src"))
+}
+
+func TestCheckRelocation(t *testing.T) {
+	packages := map[*core.Package]bool{
+		core.NewPackage("src/lib"): true,
+		core.NewPackage("tools"):   true,
+	}
+	assert.NoError(t, checkRelocation(packages, "src"))
+	packages[core.NewPackage("lib")] = true
+	assert.Error(t, checkRelocation(packages, "src"))
+}
+
+// exportTestConfig writes out the test config and exports it, returning the result.
+func exportTestConfig(t *testing.T, stripPrefix string) string {
+	dir, err := ioutil.TempDir("", "export_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, ".plzconfig"), []byte(testConfig), 0644))
+	dest := path.Join(dir, "export/.plzconfig")
+	require.NoError(t, exportConfig(path.Join(dir, ".plzconfig"), dest, testPackages(true), stripPrefix))
+	b, err := ioutil.ReadFile(dest)
+	require.NoError(t, err)
+	return string(b)
+}
+
+// testPackages returns the packages referred to by the test config.
+func testPackages(includePython bool) map[*core.Package]bool {
+	packages := map[*core.Package]bool{
+		core.NewPackage("tools/please_go_test"): true,
+		core.NewPackage("third_party/go"):       true,
+	}
+	if includePython {
+		packages[core.NewPackage("third_party/python")] = true
+	}
+	return packages
+}
@@ -4,16 +4,20 @@
 // targets in the repo that are no longer needed.
 // The definition of "needed" is a bit unclear; we define it as non-test binaries, but the
 // command accepts an argument to add extra ones just in case (for example, if you have a repo which
-// is primarily a library, you might have to tell it that).
+// is primarily a library, you might have to tell it that). Targets with certain labels, those in
+// subrepos and those recorded in a build log as being built recently are needed too.
 package gc
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/Songmu/prompter"
 	"gopkg.in/op/go-logging.v1"
@@ -27,18 +31,37 @@ var log = logging.MustGetLogger("gc")
 type targetMap map[*core.BuildTarget]bool
 
 // GarbageCollect initiates the garbage collection logic.
-func GarbageCollect(state *core.BuildState, filter, targets, keepTargets []core.BuildLabel, keepLabels []string, conservative, targetsOnly, srcsOnly, noPrompt, dryRun, git bool) {
+func GarbageCollect(state *core.BuildState, filter, targets, keepTargets []core.BuildLabel, keepLabels []string, conservative, targetsOnly, srcsOnly, noPrompt, dryRun, git, patch bool) {
+	if state.Config.Gc.BuildLog != "" {
+		built, err := recentlyBuilt(state.Graph, state.Config.Gc.BuildLog, time.Now().AddDate(0, 0, -state.Config.Gc.BuildLogDays))
+		if err != nil {
+			log.Fatalf("Failed to read build log: %s", err)
+		}
+		keepTargets = append(keepTargets, built...)
+	}
 	if targets, srcs := targetsToRemove(state.Graph, filter, targets, keepTargets, keepLabels, conservative); len(targets) > 0 {
-		if !srcsOnly {
-			fmt.Fprintf(os.Stderr, "Targets to remove (total %d of %d):\n", len(targets), state.Graph.Len())
-			for _, target := range targets {
-				fmt.Printf("  %s\n", target)
+		packages := byPackage(state.Graph, targets, srcs)
+		if patch {
+			if err := writePatch(os.Stdout, packages, targetsOnly, srcsOnly); err != nil {
+				log.Fatalf("Failed to write patch: %s", err)
 			}
+			return
 		}
-		if !targetsOnly && len(srcs) > 0 {
-			fmt.Fprintf(os.Stderr, "Corresponding source files to remove:\n")
-			for _, src := range srcs {
-				fmt.Printf("  %s\n", src)
+		fmt.Fprintf(os.Stderr, "Targets to remove (total %d of %d) and their source files, by package:\n", len(targets), state.Graph.Len())
+		for _, pkg := range packages {
+			if (srcsOnly && len(pkg.Srcs) == 0) || (targetsOnly && len(pkg.Targets) == 0) {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "%s:\n", pkg.Filename)
+			if !srcsOnly {
+				for _, target := range pkg.Targets {
+					fmt.Printf("  %s\n", target)
+				}
+			}
+			if !targetsOnly {
+				for _, src := range pkg.Srcs {
+					fmt.Printf("  %s\n", src)
+				}
 			}
 		}
 		if dryRun {
@@ -95,6 +118,19 @@ func targetsToRemove(graph *core.BuildGraph, filter, targets, targetsToKeep []co
 			addTarget(graph, keepTargets, graph.TargetOrDie(subinclude))
 		}
 	}
+	// Anything in a subrepo is a root too; it isn't ours to remove, and we can't tell what uses it.
+	// That also keeps anything in this repo that they depend on.
+	for _, pkg := range graph.PackageMap() {
+		if subrepo := graph.SubrepoFor(pkg.Name); subrepo != nil {
+			if subrepo.Target != nil {
+				addTarget(graph, keepTargets, subrepo.Target)
+			}
+			for _, target := range pkg.AllTargets() {
+				log.Debug("GC root: %s", target.Label)
+				addTarget(graph, keepTargets, target)
+			}
+		}
+	}
 	log.Notice("%d targets to keep from initial scan", len(keepTargets))
 	for _, target := range targets {
 		if target.IsAllSubpackages() {
@@ -207,35 +243,44 @@ func publicDependencies(graph *core.BuildGraph, target *core.BuildTarget) []*cor
 
 // RewriteFile rewrites a BUILD file to exclude a set of targets.
 func RewriteFile(state *core.BuildState, filename string, targets []string) error {
+	lines, linesToDelete, err := targetLines(filename, targets)
+	if err != nil {
+		return err
+	}
+	lines2 := make([][]byte, 0, len(lines))
+	for i, line := range lines {
+		if !linesToDelete[i] {
+			lines2 = append(lines2, line)
+		}
+	}
+	return ioutil.WriteFile(filename, bytes.Join(lines2, []byte{'\n'}), 0664)
+}
+
+// targetLines returns the lines of a BUILD file and the (0-indexed) set of them that define
+// the given targets.
+func targetLines(filename string, targets []string) ([][]byte, map[int]bool, error) {
 	p := asp.NewParser(nil)
 	stmts, err := p.ParseFileOnly(filename)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	b, err := ioutil.ReadFile(filename)
 	if err != nil {
-		return err // This is very unlikely since we already read it once above, but y'know...
+		return nil, nil, err // This is very unlikely since we already read it once above, but y'know...
 	}
 	lines := bytes.Split(b, []byte{'\n'})
 	linesToDelete := map[int]bool{}
 	for _, target := range targets {
 		stmt := asp.FindTarget(stmts, target)
 		if stmt == nil {
-			return fmt.Errorf("Can't find target %s in %s", target, filename)
+			return nil, nil, fmt.Errorf("Can't find target %s in %s", target, filename)
 		}
 		start, end := asp.GetExtents(stmts, stmt, len(lines))
 		for i := start; i <= end; i++ {
 			linesToDelete[i-1] = true // -1 because the extents are 1-indexed
 		}
 	}
-	// Now rewrite the actual file
-	lines2 := make([][]byte, 0, len(lines))
-	for i, line := range lines {
-		if !linesToDelete[i] {
-			lines2 = append(lines2, line)
-		}
-	}
-	return ioutil.WriteFile(filename, bytes.Join(lines2, []byte{'\n'}), 0664)
+	return lines, linesToDelete, nil
 }
 
 // removeTargets rewrites the given set of targets out of their BUILD files.
@@ -267,3 +312,79 @@ func gcSibling(graph *core.BuildGraph, t *core.BuildTarget) *core.BuildTarget {
 	}
 	return t
 }
+
+// packageGarbage is the set of targets and sources to be removed from a single package.
+type packageGarbage struct {
+	Name, Filename string
+	Targets        core.BuildLabels
+	Srcs           []string
+}
+
+// byPackage groups the given targets and sources by the package that owns them.
+// They're assumed to be sorted already.
+func byPackage(graph *core.BuildGraph, targets core.BuildLabels, srcs []string) []*packageGarbage {
+	packages := map[string]*packageGarbage{}
+	ret := []*packageGarbage{}
+	for _, target := range targets {
+		pkg, present := packages[target.PackageName]
+		if !present {
+			pkg = &packageGarbage{Name: target.PackageName, Filename: graph.PackageOrDie(target.PackageName).Filename}
+			packages[target.PackageName] = pkg
+			ret = append(ret, pkg)
+		}
+		pkg.Targets = append(pkg.Targets, target)
+	}
+	for _, src := range srcs {
+		// Sources belong to the most specific package containing them.
+		for dir := path.Dir(src); ; dir = path.Dir(dir) {
+			if dir == "." {
+				dir = ""
+			}
+			if pkg, present := packages[dir]; present {
+				pkg.Srcs = append(pkg.Srcs, src)
+				break
+			} else if dir == "" {
+				log.Warning("Can't find package for %s", src)
+				break
+			}
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// recentlyBuilt returns the targets that a build log says have been built since the given time.
+// Each line of the log is an RFC3339 timestamp and a build label, separated by whitespace.
+// Targets that no longer exist are ignored.
+func recentlyBuilt(graph *core.BuildGraph, filename string, since time.Time) ([]core.BuildLabel, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ret := []core.BuildLabel{}
+	seen := map[core.BuildLabel]bool{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		} else if len(fields) != 2 {
+			return nil, fmt.Errorf("Invalid line in %s: %s", filename, scanner.Text())
+		}
+		t, err := time.Parse(time.RFC3339, fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid timestamp in %s: %s", filename, err)
+		}
+		label, err := core.TryParseBuildLabel(fields[1], "")
+		if err != nil {
+			return nil, fmt.Errorf("Invalid build label in %s: %s", filename, err)
+		}
+		if t.After(since) && !seen[label] && graph.Target(label) != nil {
+			log.Debug("GC root: %s (built at %s)", label, t)
+			ret = append(ret, label)
+			seen[label] = true
+		}
+	}
+	return ret, scanner.Err()
+}
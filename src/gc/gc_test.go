@@ -2,6 +2,7 @@ package gc
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -42,6 +43,66 @@ func TestTargetsToRemoveFiltered(t *testing.T) {
 	}, labels)
 }
 
+func TestTargetsToRemoveSubrepo(t *testing.T) {
+	graph := createGraph()
+	graph.AddSubrepo(&core.Subrepo{Name: "third_party", Root: "plz-out/gen/third_party"})
+	pkg := core.NewPackage("third_party/lib")
+	pkg.AddTarget(createTarget(graph, "//third_party/lib:lib", "//src/parse:parse"))
+	graph.AddPackage(pkg)
+	labels, _ := targetsToRemove(graph, nil, nil, nil, nil, false)
+	assert.EqualValues(t, []core.BuildLabel{
+		bl("//src/cli:cli"),
+	}, labels)
+}
+
+func TestTargetsToRemoveKeepLabels(t *testing.T) {
+	graph := createGraph()
+	graph.TargetOrDie(bl("//src/parse:parse")).AddLabel("published")
+	labels, _ := targetsToRemove(graph, nil, nil, nil, []string{"published"}, false)
+	assert.EqualValues(t, []core.BuildLabel{
+		bl("//src/cli:cli"),
+	}, labels)
+}
+
+func TestRecentlyBuilt(t *testing.T) {
+	graph := createGraph()
+	since, _ := time.Parse(time.RFC3339, "2018-03-01T00:00:00Z")
+	labels, err := recentlyBuilt(graph, "src/gc/test_data/build.log", since)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []core.BuildLabel{
+		bl("//src/cli:cli"),
+		bl("//src:please"),
+	}, labels)
+}
+
+func TestByPackage(t *testing.T) {
+	graph := createGraph()
+	for _, name := range []string{"src/cli", "src/parse", "src/parse/asp"} {
+		pkg := core.NewPackage(name)
+		pkg.Filename = name + "/BUILD"
+		graph.AddPackage(pkg)
+	}
+	packages := byPackage(graph, core.BuildLabels{bl("//src/cli:cli"), bl("//src/parse:parse")}, []string{
+		"src/cli/cli.go",
+		"src/parse/asp/grammar.go",
+		"src/parse/parse.go",
+	})
+	assert.Equal(t, []*packageGarbage{
+		{
+			Name:     "src/cli",
+			Filename: "src/cli/BUILD",
+			Targets:  core.BuildLabels{bl("//src/cli:cli")},
+			Srcs:     []string{"src/cli/cli.go"},
+		},
+		{
+			Name:     "src/parse",
+			Filename: "src/parse/BUILD",
+			Targets:  core.BuildLabels{bl("//src/parse:parse")},
+			Srcs:     []string{"src/parse/asp/grammar.go", "src/parse/parse.go"},
+		},
+	}, packages)
+}
+
 func createGraph() *core.BuildGraph {
 	graph := core.NewGraph()
 	createTarget(graph, "//src/core:core")
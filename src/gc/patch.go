@@ -0,0 +1,138 @@
+// +build !bootstrap
+
+package gc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// contextLines is the number of lines of context we put around each change in a patch.
+const contextLines = 3
+
+// writePatch writes a patch to the given writer that removes the given targets from their BUILD
+// files and deletes the given source files. It can be applied with git apply or patch -p1.
+func writePatch(w io.Writer, packages []*packageGarbage, targetsOnly, srcsOnly bool) error {
+	for _, pkg := range packages {
+		if !srcsOnly && len(pkg.Targets) > 0 {
+			names := make([]string, len(pkg.Targets))
+			for i, target := range pkg.Targets {
+				names[i] = target.Name
+			}
+			lines, linesToDelete, err := targetLines(pkg.Filename, names)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "diff --git a/%s b/%s\n--- a/%s\n+++ b/%s\n", pkg.Filename, pkg.Filename, pkg.Filename, pkg.Filename)
+			writeHunks(w, lines, linesToDelete)
+		}
+		if !targetsOnly {
+			for _, src := range pkg.Srcs {
+				if err := writeDeletion(w, src); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeHunks writes the hunks of a unified diff that deletes the given lines.
+// lines is the file split on newlines, so ends with an empty element if it has a trailing newline.
+func writeHunks(w io.Writer, lines [][]byte, linesToDelete map[int]bool) {
+	noNewline := len(lines) > 0 && len(lines[len(lines)-1]) > 0
+	if !noNewline && len(lines) > 0 {
+		lines = lines[:len(lines)-1]
+	}
+	deleted := make([]int, 0, len(linesToDelete))
+	for line := range linesToDelete {
+		if line < len(lines) {
+			deleted = append(deleted, line)
+		}
+	}
+	sort.Ints(deleted)
+	offset := 0 // Number of lines deleted before the current hunk
+	for i := 0; i < len(deleted); {
+		start := max(deleted[i]-contextLines, 0)
+		end := deleted[i]
+		n := 0
+		// Extend the hunk over any further deletions whose context overlaps it.
+		for ; i < len(deleted) && deleted[i]-end <= 2*contextLines; i++ {
+			end = deleted[i]
+			n++
+		}
+		end = min(end+contextLines, len(lines)-1)
+		oldLen := end - start + 1
+		fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(start+1, oldLen), hunkRange(start+1-offset, oldLen-n))
+		for j := start; j <= end; j++ {
+			if linesToDelete[j] {
+				fmt.Fprintf(w, "-%s\n", lines[j])
+			} else {
+				fmt.Fprintf(w, " %s\n", lines[j])
+			}
+			if noNewline && j == len(lines)-1 {
+				fmt.Fprintf(w, "\\ No newline at end of file\n")
+			}
+		}
+		offset += n
+	}
+}
+
+// writeDeletion writes a patch deleting the given file.
+func writeDeletion(w io.Writer, filename string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	mode := 0100644
+	if info.Mode()&0111 != 0 {
+		mode = 0100755
+	}
+	fmt.Fprintf(w, "diff --git a/%s b/%s\ndeleted file mode %o\n", filename, filename, mode)
+	if bytes.IndexByte(b, 0) != -1 {
+		fmt.Fprintf(w, "Binary files a/%s and /dev/null differ\n", filename)
+		return nil
+	} else if len(b) == 0 {
+		return nil
+	}
+	fmt.Fprintf(w, "--- a/%s\n+++ /dev/null\n", filename)
+	lines := bytes.Split(b, []byte{'\n'})
+	linesToDelete := make(map[int]bool, len(lines))
+	for i := range lines {
+		linesToDelete[i] = true
+	}
+	writeHunks(w, lines, linesToDelete)
+	return nil
+}
+
+// hunkRange formats one side of a hunk header.
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	} else if length == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,31 @@
+package gc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"core"
+)
+
+func TestWritePatch(t *testing.T) {
+	packages := []*packageGarbage{{
+		Name:     "src/gc/test_data",
+		Filename: "src/gc/test_data/before.build",
+		Targets:  core.BuildLabels{core.ParseBuildLabel("//src/gc/test_data:cover", ""), core.ParseBuildLabel("//src/gc/test_data:prometheus", "")},
+		Srcs:     []string{"src/gc/test_data/build.log"},
+	}}
+	var buf bytes.Buffer
+	assert.NoError(t, writePatch(&buf, packages, false, false))
+	expected, err := ioutil.ReadFile("src/gc/test_data/gc.patch")
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), buf.String())
+}
+
+func TestWriteHunks(t *testing.T) {
+	var buf bytes.Buffer
+	writeHunks(&buf, bytes.Split([]byte("a\nb\nc"), []byte{'\n'}), map[int]bool{1: true})
+	assert.Equal(t, "@@ -1,3 +1,2 @@\n a\n-b\n c\n\\ No newline at end of file\n", buf.String())
+}
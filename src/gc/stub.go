@@ -5,7 +5,7 @@ package gc
 import "core"
 
 // GarbageCollect is a stub used at initial bootstrap time to avoid requiring us to run go-bindata yet again.
-func GarbageCollect(state *core.BuildState, filter, targets, keepTargets []core.BuildLabel, keepLabels []string, conservative, targetsOnly, srcsOnly, noPrompt, dryRun, git bool) {
+func GarbageCollect(state *core.BuildState, filter, targets, keepTargets []core.BuildLabel, keepLabels []string, conservative, targetsOnly, srcsOnly, noPrompt, dryRun, git, patch bool) {
 }
 
 // RewriteFile is also a stub used at boostrap time that does nothing.
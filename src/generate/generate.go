@@ -0,0 +1,468 @@
+// Package generate creates and updates BUILD targets for Go and Python sources, based on
+// the files in each directory and what they import.
+//
+// New files go into the conventional target for their directory: a go_library named after it
+// with a go_test for the tests next to it, or a python_library with a python_test per test file.
+// Imports are resolved to the targets that provide them in the parsed graph, and the deps of
+// existing targets are updated to match. Anything else in the BUILD files is left alone.
+package generate
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/op/go-logging.v1"
+
+	"core"
+	"edit"
+	"imports"
+)
+
+var log = logging.MustGetLogger("generate")
+
+// ruleExtensions maps the rules we know how to generate to the extension of their sources.
+var ruleExtensions = map[string]string{
+	"go_library":     ".go",
+	"go_test":        ".go",
+	"python_library": ".py",
+	"python_test":    ".py",
+}
+
+// Generate creates or updates targets for the sources in the given packages.
+// The whole graph must have been parsed so imports can be resolved to the targets that provide them.
+// It returns true if all the BUILD files were updated successfully.
+func Generate(state *core.BuildState, labels []core.BuildLabel) bool {
+	g := newGenerator(state.Graph, state.Config.Parse.BuildFileName[0])
+	success := true
+	for _, dir := range packageDirs(labels) {
+		if err := g.Generate(dir); err != nil {
+			log.Error("Failed to generate targets in %s: %s", dir, err)
+			success = false
+		}
+	}
+	return success
+}
+
+// packageDirs returns the directories for the given package labels, walking any subpackages
+// for labels like //src/... but skipping plz-out and hidden directories.
+func packageDirs(labels []core.BuildLabel) []string {
+	ret := []string{}
+	done := map[string]bool{}
+	add := func(dir string) {
+		if !done[dir] {
+			done[dir] = true
+			ret = append(ret, dir)
+		}
+	}
+	for _, label := range labels {
+		dir := label.PackageName
+		if dir == "" {
+			dir = "."
+		}
+		if !label.IsAllSubpackages() {
+			add(dir)
+			continue
+		}
+		filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+			if err != nil || !info.IsDir() {
+				return nil
+			} else if base := path.Base(name); name != dir && (strings.HasPrefix(base, ".") || base == "plz-out") {
+				return filepath.SkipDir
+			}
+			add(name)
+			return nil
+		})
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// A generator generates targets for a directory at a time.
+type generator struct {
+	graph         *core.BuildGraph
+	buildFileName string
+	resolver      *imports.Resolver
+	owned         map[string]bool
+	index         map[*imports.Language]map[string]core.BuildLabels
+}
+
+func newGenerator(graph *core.BuildGraph, buildFileName string) *generator {
+	g := &generator{
+		graph:         graph,
+		buildFileName: buildFileName,
+		resolver:      imports.NewResolver(),
+		owned:         map[string]bool{},
+		index:         map[*imports.Language]map[string]core.BuildLabels{},
+	}
+	for _, target := range graph.AllTargets() {
+		for _, src := range target.AllLocalSources() {
+			g.owned[src] = true
+		}
+	}
+	return g
+}
+
+// A genTarget is a target that we're creating or updating.
+type genTarget struct {
+	Label core.BuildLabel
+	Kind  string
+	Lang  *imports.Language
+	// All the target's sources, relative to the repo root.
+	Srcs []string
+	// Sources that need to be added to it, relative to its package.
+	NewSrcs []string
+	// Dependencies it already declares.
+	Deps []core.BuildLabel
+	// True if the target doesn't exist yet.
+	New bool
+	// Import paths that the target provides itself.
+	own map[string]struct{}
+}
+
+// Generate creates or updates the targets for a single directory.
+func (g *generator) Generate(dir string) error {
+	pkgName := path.Clean(dir)
+	if pkgName == "." {
+		pkgName = ""
+	}
+	targets, err := g.targets(pkgName)
+	if err != nil || len(targets) == 0 {
+		return err
+	}
+	filename := path.Join(dir, g.buildFileName)
+	if pkg := g.graph.Package(pkgName); pkg != nil {
+		filename = pkg.Filename
+	}
+	f, err := edit.Open(filename, pkgName)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, target := range targets {
+		add, remove := g.deps(target, targets)
+		name := target.Label.Name
+		if target.New {
+			log.Notice("Creating %s", target.Label)
+			if err := f.Append(target.String(add)); err != nil {
+				return err
+			}
+			changed = true
+			continue
+		} else if len(target.NewSrcs) == 0 && len(add) == 0 && len(remove) == 0 {
+			continue
+		} else if !f.HasTarget(name) {
+			log.Warning("Can't find %s in %s; it may be created by a macro", target.Label, filename)
+			continue
+		}
+		log.Notice("Updating %s", target.Label)
+		if err := f.EditList(name, "srcs", nil, target.NewSrcs); err != nil {
+			log.Warning("Can't add %s to %s: %s", strings.Join(target.NewSrcs, ", "), target.Label, err)
+		}
+		if err := f.EditList(name, "deps", edit.Labels(remove, pkgName), edit.Labels(add, pkgName)); err != nil {
+			log.Warning("Can't update dependencies of %s: %s", target.Label, err)
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return f.Save()
+}
+
+// targets returns the existing targets in a package that we know how to generate, plus any
+// new ones needed for source files in its directory that don't belong to a target yet.
+func (g *generator) targets(pkgName string) ([]*genTarget, error) {
+	pkg := g.graph.Package(pkgName)
+	targets := []*genTarget{}
+	byName := map[string]*genTarget{}
+	if pkg != nil {
+		for _, target := range pkg.AllTargets() {
+			if ext := ruleExtensions[target.Kind]; ext != "" && !target.Label.HasParent() {
+				t := g.existingTarget(pkg, target, ext)
+				targets = append(targets, t)
+				byName[t.Label.Name] = t
+			}
+		}
+	}
+	dir := pkgName
+	if dir == "" {
+		dir = "."
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		filename := path.Join(pkgName, file.Name())
+		kind := conventionalKind(file.Name())
+		if file.IsDir() || g.owned[filename] || kind == "" {
+			continue
+		}
+		name := conventionalName(pkgName, file.Name())
+		if kind == "go_library" && isGoMain(filename) {
+			log.Notice("Not generating a target for %s since it's a main package; add it to a go_binary", filename)
+			continue
+		}
+		t, present := byName[name]
+		if !present {
+			if pkg != nil && pkg.Target(name) != nil {
+				log.Warning("Can't add %s to %s, it's not a %s", filename, pkg.Target(name).Label, kind)
+				continue
+			}
+			t = &genTarget{
+				Label: core.BuildLabel{PackageName: pkgName, Name: name},
+				Kind:  kind,
+				Lang:  imports.ForFile(filename),
+				New:   true,
+			}
+			targets = append(targets, t)
+			byName[name] = t
+		} else if t.Kind != kind {
+			log.Warning("Can't add %s to %s, it's a %s not a %s", filename, t.Label, t.Kind, kind)
+			continue
+		}
+		t.Srcs = append(t.Srcs, filename)
+		t.NewSrcs = append(t.NewSrcs, file.Name())
+	}
+	for _, t := range targets {
+		t.own = ownImports(t)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Label.Name < targets[j].Label.Name })
+	return targets, nil
+}
+
+// existingTarget returns a genTarget for a target that's already in the graph.
+func (g *generator) existingTarget(pkg *core.Package, target *core.BuildTarget, ext string) *genTarget {
+	t := &genTarget{Label: target.Label, Kind: target.Kind, Lang: imports.ForFile(ext)}
+	done := map[core.BuildLabel]bool{}
+	doneSrcs := map[string]bool{}
+	for _, child := range pkg.AllChildren(target) {
+		for _, src := range child.AllLocalSources() {
+			if path.Ext(src) == ext && !doneSrcs[src] {
+				doneSrcs[src] = true
+				t.Srcs = append(t.Srcs, src)
+			}
+		}
+		for _, dep := range child.DeclaredDependenciesStrict() {
+			if dep.Parent() != target.Label && !done[dep] {
+				done[dep] = true
+				t.Deps = append(t.Deps, dep)
+			}
+		}
+	}
+	return t
+}
+
+// deps returns the dependencies to add to and remove from a target.
+// Only dependencies that provide something for its language and that none of its sources import
+// are removed, and dependencies within the same package are always left alone.
+func (g *generator) deps(target *genTarget, targets []*genTarget) (add, remove []core.BuildLabel) {
+	imps := imports.Unsatisfied(g.imports(target), target.own)
+	declared := map[core.BuildLabel]bool{}
+	for _, dep := range target.Deps {
+		declared[dep] = true
+		provided := g.provides(target.Lang, dep)
+		if len(provided) > 0 && len(imports.Unsatisfied(imps, provided)) == len(imps) && dep.PackageName != target.Label.PackageName {
+			remove = append(remove, dep)
+		}
+		imps = imports.Unsatisfied(imps, provided)
+	}
+	addDep := func(label core.BuildLabel) {
+		if !declared[label] {
+			declared[label] = true
+			add = append(add, label)
+		}
+	}
+	// Go tests are conventionally in the same package as the library they test.
+	if target.Kind == "go_test" {
+		for _, t := range targets {
+			if t.Kind == "go_library" && t.Label.Name == path.Base(target.Label.PackageName) {
+				addDep(t.Label)
+			}
+		}
+	}
+	for _, imp := range imps {
+		if label, found := g.resolve(target, targets, imp); found {
+			addDep(label)
+		} else {
+			log.Debug("Can't find a target providing %s for %s", imp[0], target.Label)
+		}
+	}
+	sortDeps(add, target.Label.PackageName)
+	return add, remove
+}
+
+// imports returns all the imports of a target's sources.
+func (g *generator) imports(target *genTarget) []imports.Import {
+	ret := []imports.Import{}
+	for _, src := range target.Srcs {
+		imps, err := target.Lang.Imports(src)
+		if err != nil {
+			log.Warning("Failed to read imports from %s: %s", src, err)
+		}
+		ret = append(ret, imps...)
+	}
+	return ret
+}
+
+// provides returns the import paths provided by a dependency, including anything it exports.
+func (g *generator) provides(lang *imports.Language, label core.BuildLabel) map[string]struct{} {
+	ret := map[string]struct{}{}
+	target := g.graph.Target(label)
+	if target == nil {
+		return ret
+	}
+	for _, child := range g.graph.PackageOrDie(label.PackageName).AllChildren(target) {
+		for p := range g.resolver.Provides(lang, child) {
+			ret[p] = struct{}{}
+		}
+		for _, exported := range child.ExportedDependencies() {
+			for p := range g.provides(lang, exported) {
+				ret[p] = struct{}{}
+			}
+		}
+	}
+	return ret
+}
+
+// resolve finds the target that provides an import. Other targets being generated in the
+// same directory are preferred, then anything else in the graph.
+func (g *generator) resolve(target *genTarget, targets []*genTarget, imp imports.Import) (core.BuildLabel, bool) {
+	for _, t := range targets {
+		if t != target && t.Lang == target.Lang && !strings.HasSuffix(t.Kind, "_test") && imports.Unsatisfied([]imports.Import{imp}, t.own) == nil {
+			return t.Label, true
+		}
+	}
+	index := g.langIndex(target.Lang)
+	for _, alternative := range imp {
+		candidates := core.BuildLabels{}
+		for _, label := range index[alternative] {
+			if label != target.Label {
+				candidates = append(candidates, label)
+			}
+		}
+		if len(candidates) > 1 {
+			log.Warning("%s is provided by several targets (%s); using %s for %s", alternative, candidates, candidates[0], target.Label)
+		}
+		if len(candidates) > 0 {
+			return candidates[0], true
+		}
+	}
+	return core.BuildLabel{}, false
+}
+
+// langIndex returns an index of import paths to the targets providing them for a language.
+// Tests and binaries are skipped since nothing can depend on them for imports.
+func (g *generator) langIndex(lang *imports.Language) map[string]core.BuildLabels {
+	if index, present := g.index[lang]; present {
+		return index
+	}
+	index := map[string]core.BuildLabels{}
+	for _, target := range g.graph.AllTargets() {
+		if target.IsTest || target.IsBinary {
+			continue
+		}
+		label := target.Label.Parent()
+		for p := range g.resolver.Provides(lang, target) {
+			if labels := index[p]; len(labels) == 0 || labels[len(labels)-1] != label {
+				index[p] = append(labels, label)
+			}
+		}
+	}
+	for _, labels := range index {
+		sort.Sort(labels)
+	}
+	g.index[lang] = index
+	return index
+}
+
+// String returns the definition of a new target with the given dependencies.
+func (t *genTarget) String(deps []core.BuildLabel) string {
+	srcs := append([]string{}, t.NewSrcs...)
+	sort.Strings(srcs)
+	s := fmt.Sprintf("%s(\n    name = '%s',\n    srcs = %s,\n", t.Kind, t.Label.Name, edit.List(srcs, "    "))
+	if len(deps) > 0 {
+		s += fmt.Sprintf("    deps = %s,\n", edit.List(edit.Labels(deps, t.Label.PackageName), "    "))
+	}
+	if t.Kind == "go_library" || t.Kind == "python_library" {
+		s += "    visibility = ['PUBLIC'],\n"
+	}
+	return s + ")\n"
+}
+
+// ownImports returns the import paths that a target provides itself, so imports of them
+// (e.g. between Python modules in the same library) don't need a dependency.
+func ownImports(t *genTarget) map[string]struct{} {
+	switch t.Kind {
+	case "go_library":
+		return t.Lang.Provides(path.Join(t.Label.PackageName, t.Label.Name+".a"), false)
+	case "python_library", "python_test":
+		ret := map[string]struct{}{}
+		for _, src := range t.Srcs {
+			for p := range t.Lang.Provides(src, false) {
+				ret[p] = struct{}{}
+			}
+		}
+		return ret
+	}
+	return map[string]struct{}{}
+}
+
+// conventionalKind returns the kind of rule that a new source file conventionally belongs to.
+func conventionalKind(filename string) string {
+	switch path.Ext(filename) {
+	case ".go":
+		if strings.HasSuffix(filename, "_test.go") {
+			return "go_test"
+		}
+		return "go_library"
+	case ".py":
+		if stem := strings.TrimSuffix(filename, ".py"); strings.HasPrefix(stem, "test_") || strings.HasSuffix(stem, "_test") {
+			return "python_test"
+		}
+		return "python_library"
+	}
+	return ""
+}
+
+// conventionalName returns the name of the target that a new source file conventionally belongs to.
+// Go libraries & Python libraries are named after their directory, Go tests are named after the
+// library, and each Python test gets its own target.
+func conventionalName(pkgName, filename string) string {
+	base := path.Base(pkgName)
+	if pkgName == "" {
+		base = path.Base(core.RepoRoot)
+	}
+	switch conventionalKind(filename) {
+	case "go_test":
+		return base + "_test"
+	case "python_test":
+		return strings.TrimSuffix(filename, ".py")
+	}
+	return base
+}
+
+// isGoMain returns true if the given Go file is in package main.
+func isGoMain(filename string) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), filename, nil, parser.PackageClauseOnly)
+	return err == nil && f.Name.Name == "main"
+}
+
+// sortDeps sorts dependencies with those in the given package first, as they're conventionally written.
+func sortDeps(deps []core.BuildLabel, pkgName string) {
+	sort.Slice(deps, func(i, j int) bool {
+		if local := deps[i].PackageName == pkgName; local != (deps[j].PackageName == pkgName) {
+			return local
+		} else if deps[i].PackageName == deps[j].PackageName {
+			return deps[i].Name < deps[j].Name
+		}
+		return deps[i].PackageName < deps[j].PackageName
+	})
+}
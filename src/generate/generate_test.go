@@ -0,0 +1,170 @@
+package generate
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"core"
+)
+
+const expectedGoBuildFile = `go_library(
+    name = 'foo',
+    srcs = [
+        'bar.go',
+        'foo.go',
+    ],
+    deps = ['//lib/a'],
+    visibility = ['PUBLIC'],
+)
+
+go_test(
+    name = 'foo_test',
+    srcs = ['foo_test.go'],
+    deps = [':foo'],
+)
+`
+
+func TestGenerateGo(t *testing.T) {
+	defer inTempDir(t)()
+	graph := core.NewGraph()
+	addTarget(graph, "//lib/a:a", "go_library", []string{"a.a"}, nil)
+	writeFile(t, "src/foo/foo.go", "package foo\n\nimport (\n\t\"fmt\"\n\n\t\"lib/a\"\n)\n")
+	writeFile(t, "src/foo/bar.go", "package foo\n")
+	writeFile(t, "src/foo/foo_test.go", "package foo\n\nimport \"testing\"\n")
+	writeFile(t, "src/foo/main.go", "package main\n")
+
+	require.NoError(t, newGenerator(graph, "BUILD").Generate("src/foo"))
+	assertFile(t, "src/foo/BUILD", expectedGoBuildFile)
+}
+
+const testPythonBuildFile = `# The library.
+python_library(
+    name = 'pkg',
+    srcs = ['a.py'],
+    deps = [
+        '//lib:unused',
+        '//third_party/python:six',
+    ],
+    visibility = ['PUBLIC'],
+)
+`
+
+const expectedPythonBuildFile = `# The library.
+python_library(
+    name = 'pkg',
+    srcs = ['a.py', 'b.py'],
+    deps = [
+        '//third_party/python:six',
+        '//lib:strings',
+    ],
+    visibility = ['PUBLIC'],
+)
+
+python_test(
+    name = 'test_b',
+    srcs = ['test_b.py'],
+    deps = [':pkg'],
+)
+`
+
+func TestGeneratePython(t *testing.T) {
+	defer inTempDir(t)()
+	graph := core.NewGraph()
+	addTarget(graph, "//third_party/python:six", "pip_library", []string{"six"}, nil)
+	addTarget(graph, "//lib:strings", "python_library", []string{"strings.py"}, nil)
+	addTarget(graph, "//lib:unused", "python_library", []string{"unused.py"}, nil)
+	writeFile(t, "pkg/BUILD", testPythonBuildFile)
+	writeFile(t, "pkg/a.py", "import six\nfrom pkg import b\n")
+	writeFile(t, "pkg/b.py", "import os\nfrom lib import strings\n")
+	writeFile(t, "pkg/test_b.py", "import unittest\nfrom pkg.b import thing\n")
+	addTarget(graph, "//pkg:pkg", "python_library", []string{"a.py"}, []string{"a.py"}, "//lib:unused", "//third_party/python:six")
+	graph.PackageOrDie("pkg").Filename = "pkg/BUILD"
+
+	require.NoError(t, newGenerator(graph, "BUILD").Generate("pkg"))
+	assertFile(t, "pkg/BUILD", expectedPythonBuildFile)
+}
+
+func TestGenerateNothingToDo(t *testing.T) {
+	defer inTempDir(t)()
+	graph := core.NewGraph()
+	writeFile(t, "pkg/BUILD", "python_library(name = 'pkg', srcs = ['a.py'])\n")
+	writeFile(t, "pkg/a.py", "import os\n")
+	writeFile(t, "pkg/README.md", "")
+	addTarget(graph, "//pkg:pkg", "python_library", []string{"a.py"}, []string{"a.py"})
+	graph.PackageOrDie("pkg").Filename = "pkg/BUILD"
+
+	require.NoError(t, newGenerator(graph, "BUILD").Generate("pkg"))
+	assertFile(t, "pkg/BUILD", "python_library(name = 'pkg', srcs = ['a.py'])\n")
+}
+
+func TestConventionalName(t *testing.T) {
+	assert.Equal(t, "foo", conventionalName("src/foo", "foo.go"))
+	assert.Equal(t, "foo_test", conventionalName("src/foo", "bar_test.go"))
+	assert.Equal(t, "foo", conventionalName("src/foo", "bar.py"))
+	assert.Equal(t, "test_bar", conventionalName("src/foo", "test_bar.py"))
+	assert.Equal(t, "bar_test", conventionalName("src/foo", "bar_test.py"))
+}
+
+func TestPackageDirs(t *testing.T) {
+	defer inTempDir(t)()
+	writeFile(t, "src/foo/foo.go", "")
+	writeFile(t, "src/foo/bar/bar.go", "")
+	writeFile(t, "src/.hidden/x.go", "")
+	writeFile(t, "plz-out/gen/src/foo/foo.go", "")
+	assert.Equal(t, []string{"src", "src/foo", "src/foo/bar"}, packageDirs([]core.BuildLabel{
+		core.ParseBuildLabel("//src/...", ""),
+		core.ParseBuildLabel("//src/foo", ""),
+	}))
+}
+
+// inTempDir changes to a new temporary directory and returns a function to change back & clean it up.
+func inTempDir(t *testing.T) func() {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "generate_test")
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	return func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+func writeFile(t *testing.T, filename, contents string) {
+	require.NoError(t, os.MkdirAll(path.Dir(filename), core.DirPermissions))
+	require.NoError(t, ioutil.WriteFile(filename, []byte(contents), 0644))
+}
+
+func assertFile(t *testing.T, filename, expected string) {
+	b, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(b))
+}
+
+// addTarget adds a target of the given kind to the graph.
+func addTarget(graph *core.BuildGraph, label, kind string, outs, srcs []string, deps ...string) *core.BuildTarget {
+	target := core.NewBuildTarget(core.ParseBuildLabel(label, ""))
+	target.Kind = kind
+	for _, out := range outs {
+		target.AddOutput(out)
+	}
+	for _, src := range srcs {
+		target.AddSource(core.FileLabel{File: src, Package: target.Label.PackageName})
+	}
+	for _, dep := range deps {
+		target.AddDependency(core.ParseBuildLabel(dep, ""))
+	}
+	pkg := graph.Package(target.Label.PackageName)
+	if pkg == nil {
+		pkg = core.NewPackage(target.Label.PackageName)
+		graph.AddPackage(pkg)
+	}
+	pkg.AddTarget(target)
+	graph.AddTarget(target)
+	return target
+}
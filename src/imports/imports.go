@@ -0,0 +1,269 @@
+// Package imports finds the imports in source files, and the import paths that the outputs
+// of build targets provide, so that the two can be matched up.
+//
+// This works similarly to 'plz query whatoutputs', but on import paths rather than whole
+// filenames. For example, a Go import of "github.com/jessevdk/go-flags" is provided by a target
+// that outputs .../github.com/jessevdk/go-flags.a. Currently Go, Python and Java are supported.
+package imports
+
+import (
+	"archive/zip"
+	"bufio"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/op/go-logging.v1"
+
+	"core"
+)
+
+var log = logging.MustGetLogger("imports")
+
+// An Import is a single import from a source file. It's a set of alternative slash-separated
+// paths, any of which satisfy it.
+type Import []string
+
+// A Language defines how we find imports in source files of one language and the import
+// paths that outputs of targets provide for it.
+type Language struct {
+	Name     string
+	imports  func(filename string) ([]Import, error)
+	provides func(filename string, isDir bool) []string
+}
+
+// languages maps source file extensions to the language for them.
+var languages = map[string]*Language{
+	".go":   {Name: "go", imports: goImports, provides: goProvides},
+	".py":   {Name: "python", imports: pythonImports, provides: pythonProvides},
+	".java": {Name: "java", imports: javaImports, provides: javaProvides},
+}
+
+// ForFile returns the language of the given source file, or nil if it isn't one we understand.
+func ForFile(filename string) *Language {
+	return languages[path.Ext(filename)]
+}
+
+// Imports returns the imports of a single source file.
+func (lang *Language) Imports(filename string) ([]Import, error) {
+	return lang.imports(filename)
+}
+
+// Provides returns the set of import paths that a single file or directory provides.
+// Since we don't know where each language's import root is, every path suffix of each one is included.
+func (lang *Language) Provides(filename string, isDir bool) map[string]struct{} {
+	ret := map[string]struct{}{}
+	for _, p := range lang.provides(filename, isDir) {
+		for {
+			ret[p] = struct{}{}
+			idx := strings.IndexRune(p, '/')
+			if idx == -1 || idx == len(p)-1 {
+				break
+			}
+			p = p[idx+1:]
+		}
+	}
+	return ret
+}
+
+// Unsatisfied returns the imports that aren't satisfied by the given set of provided import paths.
+func Unsatisfied(imports []Import, provided map[string]struct{}) []Import {
+	var ret []Import
+outer:
+	for _, imp := range imports {
+		for _, alternative := range imp {
+			if _, present := provided[alternative]; present {
+				continue outer
+			}
+		}
+		ret = append(ret, imp)
+	}
+	return ret
+}
+
+// A Resolver works out the import paths that targets provide. It caches them, so should be
+// reused where possible. It is not safe for concurrent use.
+type Resolver struct {
+	provided map[*Language]map[*core.BuildTarget]map[string]struct{}
+}
+
+// NewResolver creates a new Resolver.
+func NewResolver() *Resolver {
+	return &Resolver{provided: map[*Language]map[*core.BuildTarget]map[string]struct{}{}}
+}
+
+// Provides returns the set of import paths provided by a target for the given language.
+// Outputs that exist are inspected (e.g. to find the classes in a .jar); otherwise they're assumed
+// to be as declared, and any without an extension are assumed to be directories.
+func (r *Resolver) Provides(lang *Language, target *core.BuildTarget) map[string]struct{} {
+	m, present := r.provided[lang]
+	if !present {
+		m = map[*core.BuildTarget]map[string]struct{}{}
+		r.provided[lang] = m
+	}
+	if ret, present := m[target]; present {
+		return ret
+	}
+	ret := map[string]struct{}{}
+	add := func(name string, isDir bool) {
+		for p := range lang.Provides(name, isDir) {
+			ret[p] = struct{}{}
+		}
+	}
+	for _, out := range target.Outputs() {
+		out = path.Join(target.OutDir(), out)
+		if !core.PathExists(out) {
+			add(out, path.Ext(out) == "")
+			continue
+		}
+		filepath.Walk(out, func(name string, info os.FileInfo, err error) error {
+			if err == nil {
+				add(name, info.IsDir())
+			}
+			return nil
+		})
+	}
+	m[target] = ret
+	return ret
+}
+
+// goImports returns the imports of a Go source file.
+func goImports(filename string) ([]Import, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), filename, nil, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	ret := []Import{}
+	for _, imp := range f.Imports {
+		if p, err := strconv.Unquote(imp.Path.Value); err == nil && p != "C" {
+			ret = append(ret, Import{p})
+		}
+	}
+	return ret, nil
+}
+
+// goProvides returns the import path a Go output provides, which is the archive without its
+// extension, or its directory if the archive is named the same as it (e.g. src/core/core.a
+// provides src/core).
+func goProvides(filename string, isDir bool) []string {
+	if isDir || !strings.HasSuffix(filename, ".a") {
+		return nil
+	}
+	filename = strings.TrimSuffix(filename, ".a")
+	if dir := path.Dir(filename); path.Base(dir) == path.Base(filename) {
+		return []string{dir}
+	}
+	return []string{filename}
+}
+
+var pythonImportRegex = regexp.MustCompile(`^\s*import\s+([\w., ]+)`)
+var pythonFromImportRegex = regexp.MustCompile(`^\s*from\s+([\w.]+)\s+import\s+\(?([\w., ]+|\*)`)
+
+// pythonImports returns the imports of a Python source file.
+// Relative imports are ignored since they always refer to things within the same package.
+func pythonImports(filename string) ([]Import, error) {
+	ret := []Import{}
+	modulePath := func(module string) string { return strings.Replace(module, ".", "/", -1) }
+	err := scanLines(filename, func(line string) {
+		if match := pythonImportRegex.FindStringSubmatch(line); match != nil {
+			for _, module := range strings.Split(match[1], ",") {
+				if fields := strings.Fields(module); len(fields) > 0 {
+					ret = append(ret, Import{modulePath(fields[0])})
+				}
+			}
+		} else if match := pythonFromImportRegex.FindStringSubmatch(line); match != nil && !strings.HasPrefix(match[1], ".") {
+			// Each name can be either a module itself or an object within the module.
+			module := modulePath(match[1])
+			for _, name := range strings.Split(match[2], ",") {
+				if fields := strings.Fields(name); len(fields) > 0 && fields[0] != "*" {
+					ret = append(ret, Import{module + "/" + fields[0], module})
+				} else if len(fields) > 0 {
+					ret = append(ret, Import{module})
+				}
+			}
+		}
+	})
+	return ret, err
+}
+
+// pythonProvides returns the module a Python output provides, which is the file without its
+// extension, or for a package, the directory.
+func pythonProvides(filename string, isDir bool) []string {
+	if isDir {
+		return []string{filename}
+	} else if ext := path.Ext(filename); ext != ".py" && ext != ".so" {
+		return nil
+	}
+	// Extension modules can be named like foo.cpython-36m-x86_64-linux-gnu.so
+	dir, base := path.Split(filename)
+	base = strings.SplitN(base, ".", 2)[0]
+	if base == "__init__" {
+		return []string{path.Clean(dir)}
+	}
+	return []string{dir + base}
+}
+
+var javaImportRegex = regexp.MustCompile(`^\s*import\s+(static\s+)?([\w.]+?)(\.\*)?\s*;`)
+
+// javaImports returns the imports of a Java source file.
+// Wildcard imports refer to a package, which is represented with a trailing slash.
+func javaImports(filename string) ([]Import, error) {
+	ret := []Import{}
+	err := scanLines(filename, func(line string) {
+		if match := javaImportRegex.FindStringSubmatch(line); match != nil {
+			p := strings.Replace(match[2], ".", "/", -1)
+			if match[3] != "" && match[1] == "" {
+				ret = append(ret, Import{p + "/"})
+			} else if match[1] != "" {
+				// Static imports name a member of a class (or all of them, with a wildcard).
+				ret = append(ret, Import{p, path.Dir(p)})
+			} else {
+				ret = append(ret, Import{p})
+			}
+		}
+	})
+	return ret, err
+}
+
+// javaProvides returns the classes and packages in a .jar file.
+func javaProvides(filename string, isDir bool) []string {
+	if isDir || !strings.HasSuffix(filename, ".jar") {
+		return nil
+	}
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warning("Failed to read %s: %s", filename, err)
+		}
+		return nil
+	}
+	defer r.Close()
+	ret := []string{}
+	for _, f := range r.File {
+		// Inner classes can't be imported without importing their outer class.
+		if strings.HasSuffix(f.Name, ".class") && !strings.ContainsRune(f.Name, '$') {
+			class := strings.TrimSuffix(f.Name, ".class")
+			ret = append(ret, class, path.Dir(class)+"/")
+		}
+	}
+	return ret
+}
+
+// scanLines calls the given function for each line of a file.
+func scanLines(filename string, f func(line string)) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		f(scanner.Text())
+	}
+	return scanner.Err()
+}
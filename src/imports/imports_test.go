@@ -0,0 +1,112 @@
+package imports
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"core"
+)
+
+func TestPythonImports(t *testing.T) {
+	defer inTempDir(t)()
+	writeFile(t, "test.py", `import os, sys
+import six.moves as moves
+from third_party.python import six
+from lib.strings import (join,
+                         split)
+from . import local
+from lib.wildcard import *
+`)
+	imports, err := pythonImports("test.py")
+	assert.NoError(t, err)
+	assert.Equal(t, []Import{
+		{"os"},
+		{"sys"},
+		{"six/moves"},
+		{"third_party/python/six", "third_party/python"},
+		{"lib/strings/join", "lib/strings"},
+		{"lib/wildcard"},
+	}, imports)
+}
+
+func TestJavaImports(t *testing.T) {
+	defer inTempDir(t)()
+	writeFile(t, "Test.java", `package com.example;
+
+import java.util.List;
+import com.google.common.collect.*;
+import static org.junit.Assert.assertEquals;
+import static org.junit.Assert.*;
+`)
+	imports, err := javaImports("Test.java")
+	assert.NoError(t, err)
+	assert.Equal(t, []Import{
+		{"java/util/List"},
+		{"com/google/common/collect/"},
+		{"org/junit/Assert/assertEquals", "org/junit/Assert"},
+		{"org/junit/Assert", "org/junit"},
+	}, imports)
+}
+
+func TestJavaProvides(t *testing.T) {
+	defer inTempDir(t)()
+	f, err := os.Create("test.jar")
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	for _, name := range []string{"META-INF/MANIFEST.MF", "com/example/Test.class", "com/example/Test$Inner.class"} {
+		_, err := w.Create(name)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+	assert.Equal(t, []string{"com/example/Test", "com/example/"}, javaProvides("test.jar", false))
+}
+
+func TestGoProvides(t *testing.T) {
+	assert.Equal(t, []string{"plz-out/gen/src/core"}, goProvides("plz-out/gen/src/core/core.a", false))
+	assert.Equal(t, []string{"plz-out/gen/src/parse/asp/rules"}, goProvides("plz-out/gen/src/parse/asp/rules.a", false))
+	assert.Nil(t, goProvides("plz-out/gen/src/core/core.go", false))
+}
+
+func TestProvidesUnbuilt(t *testing.T) {
+	defer inTempDir(t)()
+	target := core.NewBuildTarget(core.ParseBuildLabel("//third_party/python:six", ""))
+	target.AddOutput("six")
+	lib := core.NewBuildTarget(core.ParseBuildLabel("//src/core:core", ""))
+	lib.AddOutput("core.a")
+	r := NewResolver()
+	assert.Contains(t, r.Provides(ForFile("test.py"), target), "third_party/python/six")
+	assert.Contains(t, r.Provides(ForFile("test.py"), target), "six")
+	assert.Contains(t, r.Provides(ForFile("test.go"), lib), "src/core")
+	assert.Equal(t, 0, len(r.Provides(ForFile("test.go"), target)))
+}
+
+func TestUnsatisfied(t *testing.T) {
+	provided := map[string]struct{}{"lib/strings": {}}
+	assert.Equal(t, []Import{{"os"}}, Unsatisfied([]Import{{"lib/strings/join", "lib/strings"}, {"os"}}, provided))
+	assert.Nil(t, Unsatisfied([]Import{{"lib/strings"}}, provided))
+}
+
+// inTempDir changes to a new temporary directory and returns a function to change back & clean it up.
+func inTempDir(t *testing.T) func() {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "imports_test")
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	return func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+func writeFile(t *testing.T, filename, contents string) {
+	require.NoError(t, os.MkdirAll(path.Dir(filename), core.DirPermissions))
+	require.NoError(t, ioutil.WriteFile(filename, []byte(contents), 0644))
+}
@@ -0,0 +1,393 @@
+// Code for writing coverage results as a static HTML site.
+//
+// This produces an index page summarising coverage per package and per file, and a page for
+// each file showing its source with covered / uncovered lines highlighted.
+
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+
+	"core"
+	"test"
+)
+
+// WriteCoverageHTMLReportOrDie writes the collected coverage data as a set of HTML files into
+// the given directory. Dies on failure.
+func WriteCoverageHTMLReportOrDie(coverage core.TestCoverage, dir string, includeFiles []string) {
+	if err := writeCoverageHTMLReport(coverage, dir, includeFiles); err != nil {
+		log.Fatalf("Failed to write HTML coverage report to %s: %s", dir, err)
+	}
+}
+
+func writeCoverageHTMLReport(coverage core.TestCoverage, dir string, includeFiles []string) error {
+	if err := cleanHTMLReportDir(dir); err != nil {
+		return err
+	}
+	index := htmlIndex{CSS: coverageCSS}
+	packages := map[string]*htmlPackage{}
+	for _, file := range coverage.OrderedFiles() {
+		if !shouldInclude(file, includeFiles) {
+			continue
+		}
+		link := path.Clean("files/" + file + ".html")
+		if !strings.HasPrefix(link, "files/") {
+			log.Warning("Not writing HTML coverage for %s, it would be outside the report directory", file)
+			continue
+		}
+		lines := coverageForFile(coverage, file)
+		covered, total := test.CountCoverage(lines)
+		f := htmlFile{Name: file, Link: link, htmlStats: htmlStats{Covered: covered, Total: total}}
+		if err := writeHTMLFile(path.Join(dir, f.Link), f, lines); err != nil {
+			return err
+		}
+		pkg := path.Dir(file)
+		p, present := packages[pkg]
+		if !present {
+			p = &htmlPackage{Name: pkg}
+			packages[pkg] = p
+		}
+		p.Files = append(p.Files, f)
+		p.Covered += covered
+		p.Total += total
+		index.Covered += covered
+		index.Total += total
+	}
+	for _, pkg := range packages {
+		index.Packages = append(index.Packages, *pkg)
+	}
+	sort.Slice(index.Packages, func(i, j int) bool { return index.Packages[i].Name < index.Packages[j].Name })
+	return writeTemplate(path.Join(dir, "index.html"), indexTmpl, index)
+}
+
+// coverageForFile returns the coverage for a file, which may be recorded either relative to
+// the repo root or as an absolute path.
+func coverageForFile(coverage core.TestCoverage, file string) []core.LineCoverage {
+	if lines, present := coverage.Files[file]; present {
+		return lines
+	}
+	return coverage.Files[path.Join(core.RepoRoot, file)]
+}
+
+// htmlReportFiles are the files & directories at the top level of the report directory.
+var htmlReportFiles = map[string]bool{"index.html": true, "files": true}
+
+// cleanHTMLReportDir removes any previous report from the given directory.
+// It refuses to touch a directory that contains anything else, since it's not ours to remove.
+func cleanHTMLReportDir(dir string) error {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if !htmlReportFiles[info.Name()] {
+			return fmt.Errorf("%s already exists and contains files that aren't part of a coverage report", dir)
+		}
+	}
+	for _, info := range infos {
+		if err := os.RemoveAll(path.Join(dir, info.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeHTMLFile writes the page for a single source file.
+func writeHTMLFile(filename string, file htmlFile, coverage []core.LineCoverage) error {
+	page := htmlFilePage{
+		htmlFile: file,
+		CSS:      coverageCSS,
+		Index:    strings.Repeat("../", strings.Count(file.Link, "/")) + "index.html",
+	}
+	f, err := os.Open(file.Name)
+	if err != nil {
+		// Might not exist (e.g. generated files), but we still want a page saying so.
+		page.Error = err.Error()
+		return writeTemplate(filename, fileTmpl, page)
+	}
+	defer f.Close()
+	lang := languages[path.Ext(file.Name)]
+	inComment := false
+	scanner := bufio.NewScanner(f)
+	for i := 0; scanner.Scan(); i++ {
+		line := htmlLine{Number: i + 1, Class: "none", Source: highlight(scanner.Text(), lang, &inComment)}
+		if i < len(coverage) {
+			line.Class = lineCoverageClasses[coverage[i]]
+		}
+		page.Lines = append(page.Lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return writeTemplate(filename, fileTmpl, page)
+}
+
+// writeTemplate executes a template and writes its output to the given file.
+func writeTemplate(filename string, tmpl *template.Template, data interface{}) error {
+	if err := os.MkdirAll(path.Dir(filename), core.DirPermissions); err != nil {
+		return err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return tmpl.Execute(f, data)
+}
+
+// htmlStats is the coverage count for any part of the report.
+type htmlStats struct {
+	Covered, Total int
+}
+
+// Percentage returns the percentage of lines covered, formatted for display.
+func (stats htmlStats) Percentage() string {
+	if stats.Total == 0 {
+		return "No data"
+	}
+	return fmt.Sprintf("%2.1f%%", 100.0*float32(stats.Covered)/float32(stats.Total))
+}
+
+// Class returns a CSS class describing how good the coverage is.
+// The thresholds correspond to the colours used in the shell output.
+func (stats htmlStats) Class() string {
+	if stats.Total == 0 {
+		return "nodata"
+	}
+	percentage := 100.0 * float32(stats.Covered) / float32(stats.Total)
+	if percentage < 20.0 {
+		return "terrible"
+	} else if percentage < 60.0 {
+		return "bad"
+	} else if percentage < 80.0 {
+		return "ok"
+	}
+	return "good"
+}
+
+type htmlIndex struct {
+	htmlStats
+	CSS      template.CSS
+	Packages []htmlPackage
+}
+
+type htmlPackage struct {
+	htmlStats
+	Name  string
+	Files []htmlFile
+}
+
+type htmlFile struct {
+	htmlStats
+	Name string
+	Link string
+}
+
+type htmlFilePage struct {
+	htmlFile
+	CSS   template.CSS
+	Index string
+	Error string
+	Lines []htmlLine
+}
+
+type htmlLine struct {
+	Number int
+	Class  string
+	Source template.HTML
+}
+
+var lineCoverageClasses = map[core.LineCoverage]string{
+	core.NotExecutable: "none",
+	core.Unreachable:   "unreachable",
+	core.Uncovered:     "uncovered",
+	core.Covered:       "covered",
+}
+
+// A language describes just enough about a programming language to highlight it.
+type language struct {
+	Keywords     map[string]bool
+	LineComment  string
+	BlockComment [2]string
+}
+
+func keywords(words string) map[string]bool {
+	ret := map[string]bool{}
+	for _, word := range strings.Fields(words) {
+		ret[word] = true
+	}
+	return ret
+}
+
+var cLanguage = &language{
+	Keywords:     keywords("auto break case char class const continue default delete do double else enum extern float for goto if inline int long namespace new private protected public return short signed sizeof static struct switch template this typedef union unsigned using virtual void volatile while bool true false nullptr"),
+	LineComment:  "//",
+	BlockComment: [2]string{"/*", "*/"},
+}
+
+var languages = map[string]*language{
+	".go": {
+		Keywords:     keywords("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var true false nil"),
+		LineComment:  "//",
+		BlockComment: [2]string{"/*", "*/"},
+	},
+	".py": {
+		Keywords:    keywords("and as assert break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield None True False"),
+		LineComment: "#",
+	},
+	".java": {
+		Keywords:     keywords("abstract boolean break byte case catch char class continue default do double else enum extends final finally float for if implements import instanceof int interface long new package private protected public return short static super switch synchronized this throw throws try void volatile while true false null"),
+		LineComment:  "//",
+		BlockComment: [2]string{"/*", "*/"},
+	},
+	".js": {
+		Keywords:     keywords("break case catch class const continue default delete do else export extends finally for function if import in instanceof let new return super switch this throw try typeof var void while yield true false null undefined"),
+		LineComment:  "//",
+		BlockComment: [2]string{"/*", "*/"},
+	},
+	".sh": {
+		Keywords:    keywords("if then else elif fi for while do done case esac function in return"),
+		LineComment: "#",
+	},
+	".c":   cLanguage,
+	".cc":  cLanguage,
+	".cpp": cLanguage,
+	".h":   cLanguage,
+	".hpp": cLanguage,
+}
+
+// highlight produces a syntax-highlighted HTML representation of a single line of source.
+// This is pretty basic and only knows about comments, strings, numbers and keywords, but
+// that's enough to make the code a lot easier to read.
+// inComment tracks whether we are inside a block comment between calls.
+func highlight(line string, lang *language, inComment *bool) template.HTML {
+	if lang == nil {
+		return template.HTML(template.HTMLEscapeString(line))
+	}
+	var b strings.Builder
+	span := func(class, s string) {
+		fmt.Fprintf(&b, `<span class="%s">%s</span>`, class, template.HTMLEscapeString(s))
+	}
+	for i := 0; i < len(line); {
+		rest := line[i:]
+		if *inComment {
+			end := strings.Index(rest, lang.BlockComment[1])
+			if end == -1 {
+				span("comment", rest)
+				break
+			}
+			end += len(lang.BlockComment[1])
+			span("comment", rest[:end])
+			*inComment = false
+			i += end
+		} else if lang.BlockComment[0] != "" && strings.HasPrefix(rest, lang.BlockComment[0]) {
+			*inComment = true
+			span("comment", lang.BlockComment[0])
+			i += len(lang.BlockComment[0])
+		} else if lang.LineComment != "" && strings.HasPrefix(rest, lang.LineComment) {
+			span("comment", rest)
+			break
+		} else if c := rest[0]; c == '"' || c == '\'' || c == '`' {
+			end := 1
+			for ; end < len(rest) && rest[end] != c; end++ {
+				if rest[end] == '\\' && c != '`' {
+					end++
+				}
+			}
+			if end < len(rest) {
+				end++
+			} else {
+				end = len(rest)
+			}
+			span("string", rest[:end])
+			i += end
+		} else if isIdentifier(rune(c)) {
+			end := 1
+			for end < len(rest) && isIdentifier(rune(rest[end])) {
+				end++
+			}
+			if word := rest[:end]; lang.Keywords[word] {
+				span("keyword", word)
+			} else if unicode.IsDigit(rune(c)) {
+				span("number", word)
+			} else {
+				b.WriteString(template.HTMLEscapeString(word))
+			}
+			i += end
+		} else {
+			b.WriteString(template.HTMLEscapeString(rest[:1]))
+			i++
+		}
+	}
+	return template.HTML(b.String())
+}
+
+// isIdentifier returns true if the given character can be part of an identifier (or a number).
+func isIdentifier(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+const coverageCSS = template.CSS(`
+body { font-family: sans-serif; margin: 2em; color: #333; }
+table { border-collapse: collapse; }
+td, th { padding: 2px 12px; text-align: left; }
+tr.package td { font-weight: bold; padding-top: 10px; }
+td.file { padding-left: 30px; }
+.good { color: #2a2; } .ok { color: #b80; } .bad { color: #d22; } .terrible { color: #b2b; } .nodata { color: #888; }
+table.source { font-family: monospace; white-space: pre; width: 100%; }
+table.source td { padding: 0 8px; }
+td.num { color: #999; text-align: right; user-select: none; }
+tr.covered td.src { background-color: #dfd; }
+tr.uncovered td.src { background-color: #fdd; }
+tr.unreachable td.src { background-color: #ffd; }
+.keyword { color: #00a; font-weight: bold; } .string { color: #a11; } .comment { color: #888; font-style: italic; } .number { color: #164; }
+`)
+
+var indexTmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Coverage report</title><style>{{ .CSS }}</style></head>
+<body>
+<h1>Coverage report</h1>
+<h2>Total coverage: <span class="{{ .Class }}">{{ .Percentage }}</span> ({{ .Covered }}/{{ .Total }} lines)</h2>
+<table>
+<tr><th>File</th><th>Coverage</th><th>Lines</th></tr>
+{{- range .Packages }}
+<tr class="package"><td>{{ .Name }}</td><td class="{{ .Class }}">{{ .Percentage }}</td><td>{{ .Covered }}/{{ .Total }}</td></tr>
+{{- range .Files }}
+<tr><td class="file"><a href="{{ .Link }}">{{ .Name }}</a></td><td class="{{ .Class }}">{{ .Percentage }}</td><td>{{ .Covered }}/{{ .Total }}</td></tr>
+{{- end }}
+{{- end }}
+</table>
+</body>
+</html>
+`))
+
+var fileTmpl = template.Must(template.New("file").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{ .Name }}</title><style>{{ .CSS }}</style></head>
+<body>
+<p><a href="{{ .Index }}">Back to index</a></p>
+<h1>{{ .Name }}</h1>
+<h2>Coverage: <span class="{{ .Class }}">{{ .Percentage }}</span> ({{ .Covered }}/{{ .Total }} lines)</h2>
+{{- if .Error }}
+<p>Can't display source: {{ .Error }}</p>
+{{- else }}
+<table class="source">
+{{- range .Lines }}
+<tr class="{{ .Class }}"><td class="num" id="L{{ .Number }}">{{ .Number }}</td><td class="src">{{ .Source }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+</body>
+</html>
+`))
@@ -0,0 +1,104 @@
+package output
+
+import (
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"core"
+)
+
+const htmlExampleFile = "src/output/test_data/html_coverage_example.py"
+
+func TestWriteCoverageHTMLReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "html_coverage")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	coverage := core.NewTestCoverage()
+	coverage.Files[htmlExampleFile] = []core.LineCoverage{
+		core.NotExecutable, core.NotExecutable, core.NotExecutable, core.Covered,
+		core.NotExecutable, core.Covered, core.Uncovered, core.Covered,
+	}
+	coverage.Files["src/output/test_data/does_not_exist.py"] = []core.LineCoverage{core.Uncovered}
+	assert.NoError(t, writeCoverageHTMLReport(coverage, dir, nil))
+
+	index, err := ioutil.ReadFile(path.Join(dir, "index.html"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(index), `<a href="files/src/output/test_data/html_coverage_example.py.html">`)
+	assert.Contains(t, string(index), `<td class="ok">75.0%</td><td>3/4</td>`)
+
+	page, err := ioutil.ReadFile(path.Join(dir, "files", htmlExampleFile+".html"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(page), `<a href="../../../../index.html">`)
+	assert.Contains(t, string(page), `<tr class="uncovered"><td class="num" id="L7">7</td>`)
+	assert.Contains(t, string(page), `&lt;interesting&gt;`)
+
+	page, err = ioutil.ReadFile(path.Join(dir, "files/src/output/test_data/does_not_exist.py.html"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(page), "Can't display source")
+}
+
+func TestWriteCoverageHTMLReportIncludeFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "html_coverage")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	coverage := core.NewTestCoverage()
+	coverage.Files[htmlExampleFile] = []core.LineCoverage{core.Covered}
+	coverage.Files["src/output/test_data/does_not_exist.py"] = []core.LineCoverage{core.Uncovered}
+	assert.NoError(t, writeCoverageHTMLReport(coverage, dir, []string{htmlExampleFile}))
+	assert.True(t, core.PathExists(path.Join(dir, "files", htmlExampleFile+".html")))
+	assert.False(t, core.PathExists(path.Join(dir, "files/src/output/test_data/does_not_exist.py.html")))
+}
+
+func TestWriteCoverageHTMLReportExistingDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "html_coverage")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	coverage := core.NewTestCoverage()
+	coverage.Files[htmlExampleFile] = []core.LineCoverage{core.Covered}
+	assert.NoError(t, writeCoverageHTMLReport(coverage, dir, nil))
+	// Writing a new report over the top of an old one is fine.
+	assert.NoError(t, ioutil.WriteFile(path.Join(dir, "files", "stale.html"), nil, 0644))
+	assert.NoError(t, writeCoverageHTMLReport(coverage, dir, nil))
+	assert.False(t, core.PathExists(path.Join(dir, "files", "stale.html")))
+	// But anything else in the directory isn't ours to remove.
+	assert.NoError(t, ioutil.WriteFile(path.Join(dir, "README"), nil, 0644))
+	assert.Error(t, writeCoverageHTMLReport(coverage, dir, nil))
+	assert.True(t, core.PathExists(path.Join(dir, "README")))
+	assert.True(t, core.PathExists(path.Join(dir, "index.html")))
+}
+
+func TestWriteCoverageHTMLReportOutsideDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "html_coverage")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	coverage := core.NewTestCoverage()
+	coverage.Files["../../escape.py"] = []core.LineCoverage{core.Covered}
+	assert.NoError(t, writeCoverageHTMLReport(coverage, path.Join(dir, "report"), nil))
+	assert.False(t, core.PathExists(path.Join(dir, "escape.py.html")))
+	index, err := ioutil.ReadFile(path.Join(dir, "report", "index.html"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(index), "escape.py")
+}
+
+func TestHighlight(t *testing.T) {
+	inComment := false
+	lang := languages[".go"]
+	assert.EqualValues(t, `<span class="keyword">func</span> x() <span class="string">&#34;a\&#34;&lt;b&#34;</span> <span class="comment">// c</span>`,
+		highlight(`func x() "a\"<b" // c`, lang, &inComment))
+	assert.EqualValues(t, `x := <span class="number">42</span> <span class="comment">/*</span><span class="comment"> start</span>`,
+		highlight(`x := 42 /* start`, lang, &inComment))
+	assert.True(t, inComment)
+	assert.EqualValues(t, `<span class="comment">end */</span> <span class="keyword">return</span>`,
+		highlight(`end */ return`, lang, &inComment))
+	assert.False(t, inComment)
+	assert.Equal(t, template.HTML("a &lt; b"), highlight("a < b", nil, &inComment))
+}
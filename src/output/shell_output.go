@@ -11,6 +11,8 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -92,7 +94,7 @@ func MonitorState(state *core.BuildState, numThreads int, plainOutput, keepGoing
 	duration := time.Since(state.StartTime).Round(durationGranularity)
 	if len(failedNonTests) > 0 { // Something failed in the build step.
 		if state.Verbosity > 0 {
-			printFailedBuildResults(failedNonTests, failedTargetMap, duration)
+			printFailedBuildResults(state.Graph, failedNonTests, failedTargetMap, duration)
 		}
 		// Die immediately and unsuccessfully, this avoids awkward interactions with
 		// --failing_tests_ok later on.
@@ -191,10 +193,10 @@ func processResult(state *core.BuildState, result *core.BuildResult, buildingTar
 		// Don't stop here after test failure, aggregate them for later.
 		if !keepGoing && result.Status != core.TargetTestFailed {
 			// Reset colour so the entire compiler error output doesn't appear red.
-			log.Errorf("%s failed:${RESET}\n%s", result.Label, shortError(result.Err))
+			log.Errorf("%s failed%s:${RESET}\n%s", result.Label, ownedBy(state.Graph, label), shortError(result.Err))
 			state.KillAll()
 		} else if !plainOutput { // plain output will have already logged this
-			log.Errorf("%s failed: %s", result.Label, shortError(result.Err))
+			log.Errorf("%s failed%s: %s", result.Label, ownedBy(state.Graph, label), shortError(result.Err))
 		}
 		*failedTargets = append(*failedTargets, label)
 		if result.Status != core.TargetTestFailed {
@@ -214,13 +216,13 @@ func printTestResults(state *core.BuildState, aggregatedResults core.TestResults
 			target := state.Graph.TargetOrDie(failed)
 			if len(target.Results.Failures) == 0 {
 				if target.Results.TimedOut {
-					printf("${WHITE_ON_RED}Fail:${RED_NO_BG} %s ${WHITE_ON_RED}Timed out${RESET}\n", target.Label)
+					printf("${WHITE_ON_RED}Fail:${RED_NO_BG} %s ${WHITE_ON_RED}Timed out${RESET}%s\n", target.Label, ownedBy(state.Graph, target.Label))
 				} else {
-					printf("${WHITE_ON_RED}Fail:${RED_NO_BG} %s ${WHITE_ON_RED}Failed to run test${RESET}\n", target.Label)
+					printf("${WHITE_ON_RED}Fail:${RED_NO_BG} %s ${WHITE_ON_RED}Failed to run test${RESET}%s\n", target.Label, ownedBy(state.Graph, target.Label))
 				}
 			} else {
-				printf("${WHITE_ON_RED}Fail:${RED_NO_BG} %s ${BOLD_GREEN}%3d passed ${BOLD_YELLOW}%3d skipped ${BOLD_RED}%3d failed ${BOLD_WHITE}Took %s${RESET}\n",
-					target.Label, target.Results.Passed, target.Results.Skipped, target.Results.Failed, target.Results.Duration.Round(durationGranularity))
+				printf("${WHITE_ON_RED}Fail:${RED_NO_BG} %s ${BOLD_GREEN}%3d passed ${BOLD_YELLOW}%3d skipped ${BOLD_RED}%3d failed ${BOLD_WHITE}Took %s${RESET}%s\n",
+					target.Label, target.Results.Passed, target.Results.Skipped, target.Results.Failed, target.Results.Duration.Round(durationGranularity), ownedBy(state.Graph, target.Label))
 				for _, failure := range target.Results.Failures {
 					printf("${BOLD_RED}Failure: %s in %s${RESET}\n", failure.Type, failure.Name)
 					printf("%s\n", failure.Traceback)
@@ -309,6 +311,61 @@ func testResultMessage(results core.TestResults, failedTargets []core.BuildLabel
 	return msg
 }
 
+// PrintSlowestTests writes out the slowest individual test cases from the current run.
+func PrintSlowestTests(graph *core.BuildGraph, n int) {
+	slowest := slowestTests(graph, n)
+	if len(slowest) == 0 {
+		printf("${BOLD_WHITE}No test case durations available.${RESET}\n")
+		return
+	}
+	printf("${BOLD_WHITE}Slowest %s:${RESET}\n", pluralise(len(slowest), "test case", "test cases"))
+	for _, tc := range slowest {
+		printf("  ${BOLD_WHITE}%10s${RESET} %s ${WHITE}%s${RESET}\n", tc.Duration.Round(testDurationGranularity), tc.Label, tc.Name)
+	}
+}
+
+// PrintBenchmarkRegressions prints any benchmarks that got worse compared to the previous run.
+func PrintBenchmarkRegressions(regressions []test.BenchmarkRegression, threshold float64) {
+	if len(regressions) == 0 {
+		printf("${BOLD_WHITE}No benchmarks regressed by more than %0.1f%%.${RESET}\n", threshold)
+		return
+	}
+	printf("${BOLD_RED}%s:${RESET}\n", pluralise(len(regressions), "benchmark regressed", "benchmarks regressed"))
+	for _, r := range regressions {
+		printf("  %s ${BOLD_WHITE}%s${RESET}: ${RED}%+0.1f%%${RESET} (%0.2f -> %0.2f ns/op, %d -> %d allocs/op)\n",
+			r.Label, r.Current.Name, r.Slowdown(), r.Previous.NsPerOp, r.Current.NsPerOp, r.Previous.AllocsPerOp, r.Current.AllocsPerOp)
+	}
+}
+
+// A testCaseDuration records how long a single test case took.
+type testCaseDuration struct {
+	Label    core.BuildLabel
+	Name     string
+	Duration time.Duration
+}
+
+// slowestTests returns the n slowest test cases in the graph, slowest first.
+func slowestTests(graph *core.BuildGraph, n int) []testCaseDuration {
+	tests := []testCaseDuration{}
+	for _, target := range graph.AllTargets() {
+		for name, duration := range target.Results.Durations {
+			tests = append(tests, testCaseDuration{Label: target.Label, Name: name, Duration: duration})
+		}
+	}
+	sort.Slice(tests, func(i, j int) bool {
+		if tests[i].Duration != tests[j].Duration {
+			return tests[i].Duration > tests[j].Duration
+		} else if tests[i].Label != tests[j].Label {
+			return tests[i].Label.Less(tests[j].Label)
+		}
+		return tests[i].Name < tests[j].Name
+	})
+	if len(tests) > n {
+		return tests[:n]
+	}
+	return tests
+}
+
 func printBuildResults(state *core.BuildState, duration time.Duration, showStatus bool) {
 	// Count incrementality.
 	totalBuilt := 0
@@ -389,18 +446,27 @@ func buildResult(target *core.BuildTarget) []string {
 	return results
 }
 
-func printFailedBuildResults(failedTargets []core.BuildLabel, failedTargetMap map[core.BuildLabel]error, duration time.Duration) {
+func printFailedBuildResults(graph *core.BuildGraph, failedTargets []core.BuildLabel, failedTargetMap map[core.BuildLabel]error, duration time.Duration) {
 	printf("${WHITE_ON_RED}Build stopped after %s. %s failed:${RESET}\n", duration, pluralise(len(failedTargetMap), "target", "targets"))
 	for _, label := range failedTargets {
 		err := failedTargetMap[label]
 		if err != nil {
-			printf("    ${BOLD_RED}%s\n${RESET}%s${RESET}\n", label, colouriseError(err))
+			printf("    ${BOLD_RED}%s${RESET}%s\n%s${RESET}\n", label, ownedBy(graph, label), colouriseError(err))
 		} else {
-			printf("    ${BOLD_RED}%s${RESET}\n", label)
+			printf("    ${BOLD_RED}%s${RESET}%s\n", label, ownedBy(graph, label))
 		}
 	}
 }
 
+// ownedBy returns a note of the owners of a target to append to messages about it,
+// or an empty string if it doesn't have any.
+func ownedBy(graph *core.BuildGraph, label core.BuildLabel) string {
+	if owners := graph.Owners(label.PackageName); len(owners) > 0 {
+		return " (owners: " + strings.Join(owners, ", ") + ")"
+	}
+	return ""
+}
+
 func updateTarget(state *core.BuildState, plainOutput bool, buildingTarget *buildingTarget, label core.BuildLabel,
 	active bool, failed bool, cached bool, description string, err error, colour string, target *core.BuildTarget) {
 	updateTarget2(buildingTarget, label, active, failed, cached, description, err, colour, target)
@@ -554,6 +620,41 @@ func PrintLineCoverageReport(state *core.BuildState, includeFiles []string) {
 	}
 }
 
+// PrintDiffCoverage writes out coverage metrics for only the lines that have changed since a revision.
+func PrintDiffCoverage(diff test.DiffCoverage, includeFiles []string) {
+	printf("${BOLD_WHITE}Coverage of lines changed since %s:${RESET}\n", diff.Base)
+	for _, file := range diff.OrderedFiles() {
+		if !shouldInclude(file, includeFiles) {
+			continue
+		}
+		coverage := diff.Files[file]
+		printf("  %s\n", coveragePercentage(coverage.Covered, coverage.Total, file))
+		if len(coverage.Uncovered) > 0 {
+			printf("    ${RED}Uncovered: %s${RESET}\n", lineRanges(coverage.Uncovered))
+		}
+	}
+	covered, total := diff.Totals()
+	printf("${BOLD_WHITE}Total diff coverage: %s${RESET}\n", coveragePercentage(covered, total, ""))
+}
+
+// lineRanges collapses a sorted list of line numbers into a more readable set of ranges, e.g. "1-3, 7".
+func lineRanges(lines []int) string {
+	ranges := []string{}
+	for i := 0; i < len(lines); {
+		j := i
+		for j+1 < len(lines) && lines[j+1] == lines[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(lines[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", lines[i], lines[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ", ")
+}
+
 // shouldInclude returns true if we should include a file in the coverage display.
 func shouldInclude(file string, files []string) bool {
 	if len(files) == 0 {
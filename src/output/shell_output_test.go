@@ -3,6 +3,7 @@ package output
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -39,6 +40,29 @@ func TestColouriseError(t *testing.T) {
 	assert.EqualValues(t, expected, colouriseError(err))
 }
 
+func TestLineRanges(t *testing.T) {
+	assert.Equal(t, "", lineRanges(nil))
+	assert.Equal(t, "3", lineRanges([]int{3}))
+	assert.Equal(t, "1-3, 7, 9-10", lineRanges([]int{1, 2, 3, 7, 9, 10}))
+}
+
+func TestSlowestTests(t *testing.T) {
+	graph := core.NewGraph()
+	target1 := makeTarget("//src/output:test1")
+	target1.Results.Durations = map[string]time.Duration{"TestA": time.Second, "TestB": 3 * time.Second}
+	target2 := makeTarget("//src/output:test2")
+	target2.Results.Durations = map[string]time.Duration{"TestC": 2 * time.Second, "TestD": time.Millisecond}
+	graph.AddTarget(target1)
+	graph.AddTarget(target2)
+	graph.AddTarget(makeTarget("//src/output:test3"))
+	assert.Equal(t, []testCaseDuration{
+		{Label: target1.Label, Name: "TestB", Duration: 3 * time.Second},
+		{Label: target2.Label, Name: "TestC", Duration: 2 * time.Second},
+		{Label: target1.Label, Name: "TestA", Duration: time.Second},
+	}, slowestTests(graph, 3))
+	assert.Equal(t, 4, len(slowestTests(graph, 10)))
+}
+
 // Factory function for build targets
 func makeTarget(label string, deps ...string) *core.BuildTarget {
 	target := core.NewBuildTarget(core.ParseBuildLabel(label, ""))
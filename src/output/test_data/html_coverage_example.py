@@ -0,0 +1,8 @@
+# An example file used for testing HTML coverage output.
+
+
+def example(x):
+    """Returns something <interesting>."""
+    if x:
+        return 'yes'
+    return 42
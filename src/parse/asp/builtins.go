@@ -190,6 +190,10 @@ func pkg(s *scope, args []pyObject) pyObject {
 	c, ok := s.Lookup("CONFIG").(*pyConfig)
 	s.Assert(ok, "CONFIG object has been altered")
 	for k, v := range s.locals {
+		if k == "owners" {
+			s.pkg.Owners = asStringList(s, v, "owners")
+			continue
+		}
 		k = strings.ToUpper(k)
 		s.Assert(c.Get(k, nil) != nil, "error calling package(): %s is not a known config value", k)
 		c.IndexAssign(pyString(k), v)
@@ -593,6 +597,11 @@ func getLabels(s *scope, args []pyObject) pyObject {
 		return getLabelsInternal(s.state.Graph.TargetOrDie(label), prefix, core.Built)
 	}
 	target := getTargetPost(s, name)
+	if s.Callback && s.state.Graph.AllDependenciesResolved(target) {
+		// Callbacks can run before the target builds (e.g. for plz query compdb); its own labels
+		// are still available once its dependencies are known.
+		return getLabelsInternal(target, prefix, core.Inactive)
+	}
 	return getLabelsInternal(target, prefix, core.Building)
 }
 
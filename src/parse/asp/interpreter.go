@@ -161,6 +161,9 @@ type scope struct {
 	locals      pyDict
 	// True if this scope is for a pre- or post-build callback.
 	Callback bool
+	// The name of the outermost function called to create this scope, which is recorded
+	// as the kind of any targets created within it.
+	kind string
 }
 
 // NewScope creates a new child scope of this one.
@@ -177,6 +180,7 @@ func (s *scope) NewPackagedScope(pkg *core.Package) *scope {
 		parent:      s,
 		locals:      pyDict{},
 		Callback:    s.Callback,
+		kind:        s.kind,
 	}
 }
 
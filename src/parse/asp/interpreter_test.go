@@ -97,6 +97,14 @@ func TestBuiltins(t *testing.T) {
 	assert.NotNil(t, s.pkg.Target("lib"))
 }
 
+func TestKinds(t *testing.T) {
+	s, err := parseFile("src/parse/asp/test_data/interpreter/kinds.build")
+	require.NoError(t, err)
+	assert.Equal(t, "build_rule", s.pkg.Target("direct").Kind)
+	assert.Equal(t, "my_library", s.pkg.Target("lib").Kind)
+	assert.Equal(t, "my_binary", s.pkg.Target("bin").Kind)
+}
+
 func TestParentheses(t *testing.T) {
 	s, err := parseFile("src/parse/asp/test_data/interpreter/parentheses.build")
 	require.NoError(t, err)
@@ -193,3 +201,9 @@ func TestAliases(t *testing.T) {
 	require.NoError(t, err)
 	assert.EqualValues(t, 42, s.Lookup("v"))
 }
+
+func TestPackageOwners(t *testing.T) {
+	s, err := parseFile("src/parse/asp/test_data/interpreter/package_owners.build")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "bob"}, s.pkg.Owners)
+}
@@ -488,6 +488,9 @@ func (f *pyFunc) Call(s *scope, c *Call) pyObject {
 	s2 := f.scope.NewPackagedScope(s.pkg)
 	s2.Set("CONFIG", s.Lookup("CONFIG")) // This needs to be copied across too :(
 	s2.Callback = s.Callback
+	if s2.kind = s.kind; s2.kind == "" {
+		s2.kind = f.name
+	}
 	// Handle implicit 'self' parameter for bound functions.
 	args := c.Arguments
 	if f.self != nil {
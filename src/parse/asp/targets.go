@@ -42,6 +42,9 @@ func createTarget(s *scope, args []pyObject) *core.BuildTarget {
 	s.Assert(err == nil, "Invalid build target name %s", name)
 
 	target := core.NewBuildTarget(label)
+	if target.Kind = s.kind; target.Kind == "" {
+		target.Kind = "build_rule" // Called directly from the BUILD file.
+	}
 	target.IsBinary = isTruthy(13)
 	target.IsTest = test
 	target.NeedsTransitiveDependencies = isTruthy(17)
@@ -67,10 +67,13 @@ func (p *aspParser) runBuildFunction(tid int, state *core.BuildState, target *co
 	state.LogBuildResult(tid, target.Label, core.PackageParsing, fmt.Sprintf("Running %s-build function for %s", callbackType, target.Label))
 	pkg := state.Graph.Package(target.Label.PackageName)
 	changed, err := pkg.EnterBuildCallback(f)
+	if err == nil {
+		rescanDeps(state, changed)
+		err = checkPolicy(state)
+	}
 	if err != nil {
 		state.LogBuildError(tid, target.Label, core.ParseFailed, err, "Failed %s-build function for %s", callbackType, target.Label)
 	} else {
-		rescanDeps(state, changed)
 		state.LogBuildResult(tid, target.Label, core.TargetBuilding, fmt.Sprintf("Finished %s-build function for %s", callbackType, target.Label))
 	}
 	return err
@@ -9,12 +9,14 @@ package parse
 import (
 	"fmt"
 	"path"
+	"strings"
 	"sync"
 
 	"gopkg.in/op/go-logging.v1"
 
 	"core"
 	"parse/asp"
+	"query"
 )
 
 var log = logging.MustGetLogger("parse")
@@ -218,6 +220,7 @@ func parsePackage(state *core.BuildState, label, dependor core.BuildLabel) *core
 		}
 		panic(fmt.Sprintf("Can't build %s; the directory %s doesn't exist", label, packageName))
 	}
+	pkg.Owners = core.ReadOwnersFile(path.Dir(pkg.Filename))
 
 	err := state.Parser.ParseFile(state, pkg, pkg.Filename)
 	if required, l := asp.RequiresSubinclude(err); required {
@@ -258,6 +261,9 @@ func parsePackage(state *core.BuildState, label, dependor core.BuildLabel) *core
 			state.Graph.AddDependency(target.Label, dep)
 		}
 	}
+	if err := checkPolicy(state); err != nil {
+		panic(err)
+	}
 	// Verify some details of the output files in the background. Don't need to wait for this
 	// since it only issues warnings sometimes.
 	go pkg.VerifyOutputs()
@@ -356,3 +362,23 @@ func rescanDeps(state *core.BuildState, changed map[*core.BuildTarget]struct{})
 		}
 	}
 }
+
+// checkPolicy checks whether any dependencies added to the graph violate its layering policy.
+// The returned error describes the offending dependency paths.
+func checkPolicy(state *core.BuildState) error {
+	violations := state.Graph.PolicyViolations()
+	if len(violations) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(violations))
+	for i, v := range violations {
+		path := query.FindPath(state.Graph, v.From, v.To)
+		labels := make([]string, len(path))
+		for j, target := range path {
+			labels[j] = target.Label.String()
+		}
+		msgs[i] = fmt.Sprintf("%s can't depend on %s; layer %s isn't allowed to depend on layer %s. Dependency path:\n  %s",
+			v.From.Label, v.To.Label, v.FromLayer, v.ToLayer, strings.Join(labels, "\n  "))
+	}
+	return fmt.Errorf("%s", strings.Join(msgs, "\n"))
+}
@@ -20,9 +20,11 @@ import (
 	"clean"
 	"cli"
 	"core"
+	"edit"
 	"export"
 	"follow"
 	"gc"
+	"generate"
 	"hashes"
 	"help"
 	"metrics"
@@ -114,6 +116,10 @@ var opts struct {
 		ShowOutput      bool         `short:"s" long:"show_output" description:"Always show output of tests, even on success."`
 		Debug           bool         `short:"d" long:"debug" description:"Allows starting an interactive debugger on test failure. Does not work with all test types (currently only python/pytest, C and C++). Implies -c dbg unless otherwise set."`
 		Failed          bool         `short:"f" long:"failed" description:"Runs just the test cases that failed from the immediately previous run."`
+		Slowest         int          `long:"slowest" description:"Shows this many of the slowest individual test cases after running."`
+		Benchmark       bool         `long:"benchmark" description:"Runs benchmarks as well as tests, and compares their results to the previous run."`
+		BenchmarkFile   cli.Filepath `long:"benchmark_results_file" default:"plz-out/log/benchmarks.json" description:"File to write benchmark results to."`
+		Threshold       float64      `long:"benchmark_threshold" default:"10" description:"Percentage by which a benchmark can be slower than the previous run before it's reported as a regression."`
 		// Slightly awkward since we can specify a single test with arguments or multiple test targets.
 		Args struct {
 			Target core.BuildLabel `positional-arg-name:"target" description:"Target to test"`
@@ -130,9 +136,13 @@ var opts struct {
 		IncludeFile         []string     `long:"include_file" description:"Filenames to filter coverage display to"`
 		TestResultsFile     cli.Filepath `long:"test_results_file" default:"plz-out/log/test_results.xml" description:"File to write combined test results to."`
 		CoverageResultsFile cli.Filepath `long:"coverage_results_file" default:"plz-out/log/coverage.json" description:"File to write combined coverage results to."`
+		HTMLReport          cli.Filepath `long:"html_report" description:"Directory to write a browsable HTML coverage report into."`
+		DiffBase            string       `long:"diff_base" description:"Git revision to calculate coverage of changed lines against (e.g. master)."`
+		DiffThreshold       float32      `long:"diff_threshold" description:"Minimum percentage of changed lines that must be covered. Only has an effect with --diff_base."`
 		ShowOutput          bool         `short:"s" long:"show_output" description:"Always show output of tests, even on success."`
 		Debug               bool         `short:"d" long:"debug" description:"Allows starting an interactive debugger on test failure. Does not work with all test types (currently only python/pytest, C and C++). Implies -c dbg unless otherwise set."`
 		Failed              bool         `short:"f" long:"failed" description:"Runs just the test cases that failed from the immediately previous run."`
+		Slowest             int          `long:"slowest" description:"Shows this many of the slowest individual test cases after running."`
 		Args                struct {
 			Target core.BuildLabel `positional-arg-name:"target" description:"Target to test" group:"one test"`
 			Args   []string        `positional-arg-name:"arguments" description:"Arguments or test selectors" group:"one test"`
@@ -199,14 +209,17 @@ var opts struct {
 		NoPrompt     bool `short:"y" long:"no_prompt" description:"Remove targets without prompting"`
 		DryRun       bool `short:"n" long:"dry_run" description:"Don't remove any targets or files, just print what would be done"`
 		Git          bool `short:"g" long:"git" description:"Use 'git rm' to remove unused files instead of just 'rm'."`
+		Patch        bool `long:"patch" description:"Print a patch that removes the targets and files instead of removing them."`
 		Args         struct {
 			Targets []core.BuildLabel `positional-arg-name:"targets" description:"Targets to limit gc to."`
 		} `positional-args:"true"`
 	} `command:"gc" description:"Analyzes the repo to determine unneeded targets."`
 
 	Export struct {
-		Output string `short:"o" long:"output" required:"true" description:"Directory to export into"`
-		Args   struct {
+		Output      string `short:"o" long:"output" required:"true" description:"Directory to export into"`
+		NoTrim      bool   `long:"notrim" description:"Don't remove unneeded targets from the exported BUILD files"`
+		StripPrefix string `long:"strip_prefix" description:"Package prefix to remove, moving the packages under it to the root of the export"`
+		Args        struct {
 			Targets []core.BuildLabel `positional-arg-name:"targets" description:"Targets to export."`
 		} `positional-args:"true"`
 
@@ -217,6 +230,52 @@ var opts struct {
 		} `command:"outputs" description:"Exports outputs of a set of targets"`
 	} `command:"export" subcommands-optional:"true" description:"Exports a set of targets and files from the repo."`
 
+	Generate struct {
+		Args struct {
+			Packages []core.BuildLabel `positional-arg-name:"packages" required:"true" description:"Packages to generate targets in, e.g. //src/foo or //src/..."`
+		} `positional-args:"true"`
+	} `command:"generate" description:"Creates and updates BUILD targets for Go and Python sources from their imports."`
+
+	Edit struct {
+		AddDep struct {
+			Args struct {
+				Target core.BuildLabel   `positional-arg-name:"target" required:"true" description:"Target to add dependencies to"`
+				Deps   []core.BuildLabel `positional-arg-name:"deps" required:"true" description:"Dependencies to add"`
+			} `positional-args:"true"`
+		} `command:"add_dep" description:"Adds dependencies to a target"`
+		RemoveDep struct {
+			Args struct {
+				Target core.BuildLabel   `positional-arg-name:"target" required:"true" description:"Target to remove dependencies from"`
+				Deps   []core.BuildLabel `positional-arg-name:"deps" required:"true" description:"Dependencies to remove"`
+			} `positional-args:"true"`
+		} `command:"remove_dep" description:"Removes dependencies from a target"`
+		Set struct {
+			Args struct {
+				Target core.BuildLabel `positional-arg-name:"target" required:"true" description:"Target to edit"`
+				Attr   string          `positional-arg-name:"attribute" required:"true" description:"Argument to set, e.g. visibility"`
+				Value  string          `positional-arg-name:"value" required:"true" description:"Value to set it to, in the BUILD language, e.g. \"['PUBLIC']\""`
+			} `positional-args:"true"`
+		} `command:"set" description:"Sets an argument of a target"`
+		Unset struct {
+			Args struct {
+				Target core.BuildLabel `positional-arg-name:"target" required:"true" description:"Target to edit"`
+				Attr   string          `positional-arg-name:"attribute" required:"true" description:"Argument to remove"`
+			} `positional-args:"true"`
+		} `command:"unset" description:"Removes an argument from a target"`
+		Rename struct {
+			Args struct {
+				Target core.BuildLabel `positional-arg-name:"target" required:"true" description:"Target to rename"`
+				Name   string          `positional-arg-name:"name" required:"true" description:"New name for it"`
+			} `positional-args:"true"`
+		} `command:"rename" description:"Renames a target and updates all references to it"`
+		Move struct {
+			Args struct {
+				Target  core.BuildLabel `positional-arg-name:"target" required:"true" description:"Target to move"`
+				Package string          `positional-arg-name:"package" required:"true" description:"Package to move it to, e.g. //src/foo"`
+			} `positional-args:"true"`
+		} `command:"move" description:"Moves a target and its sources to another package and updates all references to it"`
+	} `command:"edit" description:"Edits BUILD files"`
+
 	Follow struct {
 		Retries int          `long:"retries" description:"Number of times to retry the connection"`
 		Delay   cli.Duration `long:"delay" default:"1s" description:"Delay between timeouts"`
@@ -281,6 +340,11 @@ var opts struct {
 				Files []string `positional-arg-name:"files" description:"Files to query affected tests for"`
 			} `positional-args:"true"`
 		} `command:"affectedtargets" description:"Prints any targets affected by a set of files."`
+		Changes struct {
+			Since        string `short:"s" long:"since" default:"origin/master" description:"Git revision to compare against"`
+			Tests        bool   `long:"tests" description:"Shows only changed tests, no other targets."`
+			Intransitive bool   `long:"intransitive" description:"Shows only targets that have changed themselves, not ones that depend on them."`
+		} `command:"changes" description:"Prints any targets whose build inputs have changed since a git revision."`
 		Input struct {
 			Args struct {
 				Targets []core.BuildLabel `positional-arg-name:"targets" description:"Targets to display inputs for" required:"true"`
@@ -292,21 +356,47 @@ var opts struct {
 			} `positional-args:"true" required:"true"`
 		} `command:"output" alias:"outputs" description:"Prints all outputs of a target."`
 		Graph struct {
-			Args struct {
+			Format           string `long:"format" choice:"json" choice:"dot" choice:"graphml" default:"json" description:"Format to print the graph in"`
+			Depth            int    `long:"depth" default:"-1" description:"Maximum depth of dependencies to include from the given targets. Negative values include all of them."`
+			CollapsePackages bool   `long:"collapse_packages" description:"Collapses targets into their packages. Only applies to dot and graphml formats."`
+			ColourBy         string `long:"colour_by" choice:"kind" choice:"label" description:"Colours targets by their rule kind or first label. Only applies to dot and graphml formats."`
+			Args             struct {
 				Targets []core.BuildLabel `positional-arg-name:"targets" description:"Targets to render graph for"`
 			} `positional-args:"true"`
-		} `command:"graph" description:"Prints a JSON representation of the build graph."`
+		} `command:"graph" description:"Prints a representation of the build graph as JSON, DOT or GraphML."`
 		WhatOutputs struct {
 			EchoFiles bool `long:"echo_files" description:"Echo the file for which the printed output is responsible."`
 			Args      struct {
 				Files []string `positional-arg-name:"files" description:"Files to query targets responsible for"`
 			} `positional-args:"true"`
 		} `command:"whatoutputs" description:"Prints out target(s) responsible for outputting provided file(s)"`
+		Owners struct {
+			Args struct {
+				Targets []string `positional-arg-name:"targets" description:"Build labels or files to print the owners of" required:"true"`
+			} `positional-args:"true" required:"true"`
+		} `command:"owners" description:"Prints the owners of targets or files, from OWNERS files or package(owners=...)"`
 		Rules struct {
 			Args struct {
 				Targets []core.BuildLabel `position-arg-name:"targets" description:"Additional targets to load rules from"`
 			} `positional-args:"true"`
 		} `command:"rules" description:"Prints built-in rules to stdout as JSON"`
+		Eval struct {
+			Output string `short:"o" long:"output" choice:"label" choice:"json" choice:"graph" default:"label" description:"Format to print the resulting targets in"`
+			Args   struct {
+				Query string `positional-arg-name:"query" description:"Query expression to evaluate, e.g. 'deps(//src/...) except tests(//src/...)'" required:"true"`
+			} `positional-args:"true" required:"true"`
+		} `command:"eval" description:"Evaluates an expression in the query language and prints the resulting targets"`
+		UnusedDeps struct {
+			Fix  bool `long:"fix" description:"Rewrites BUILD files to remove unused dependencies and add missing direct ones"`
+			Args struct {
+				Targets []core.BuildLabel `positional-arg-name:"targets" description:"Targets to check"`
+			} `positional-args:"true"`
+		} `command:"unused_deps" description:"Finds dependencies that aren't used by a target's sources, and imports only satisfied transitively"`
+		Compdb struct {
+			Args struct {
+				Targets []core.BuildLabel `positional-arg-name:"targets" description:"Targets to generate compile commands for"`
+			} `positional-args:"true"`
+		} `command:"compdb" description:"Prints a compilation database (compile_commands.json) for C and C++ targets"`
 	} `command:"query" description:"Queries information about the build graph"`
 }
 
@@ -340,8 +430,16 @@ var buildFunctions = map[string]func() bool{
 	"test": func() bool {
 		targets := testTargets(opts.Test.Args.Target, opts.Test.Args.Args, opts.Test.Failed, opts.Test.TestResultsFile)
 		os.RemoveAll(string(opts.Test.TestResultsFile))
+		previousBenchmarks := test.LoadBenchmarks(string(opts.Test.BenchmarkFile))
 		success, state := runBuild(targets, true, true)
 		test.WriteResultsToFileOrDie(state.Graph, string(opts.Test.TestResultsFile))
+		if opts.Test.Slowest > 0 {
+			output.PrintSlowestTests(state.Graph, opts.Test.Slowest)
+		}
+		if opts.Test.Benchmark {
+			test.WriteBenchmarksToFileOrDie(state.Graph, previousBenchmarks, string(opts.Test.BenchmarkFile))
+			output.PrintBenchmarkRegressions(test.CompareBenchmarks(state.Graph, previousBenchmarks, opts.Test.Threshold), opts.Test.Threshold)
+		}
 		return success || opts.Test.FailingTestsOk
 	},
 	"cover": func() bool {
@@ -358,11 +456,28 @@ var buildFunctions = map[string]func() bool{
 		test.AddOriginalTargetsToCoverage(state, opts.Cover.IncludeAllFiles)
 		test.RemoveFilesFromCoverage(state.Coverage, state.Config.Cover.ExcludeExtension)
 		test.WriteCoverageToFileOrDie(state.Coverage, string(opts.Cover.CoverageResultsFile))
+		if opts.Cover.HTMLReport != "" {
+			output.WriteCoverageHTMLReportOrDie(state.Coverage, string(opts.Cover.HTMLReport), opts.Cover.IncludeFile)
+		}
 		if opts.Cover.LineCoverageReport {
 			output.PrintLineCoverageReport(state, opts.Cover.IncludeFile)
 		} else if !opts.Cover.NoCoverageReport {
 			output.PrintCoverage(state, opts.Cover.IncludeFile)
 		}
+		if opts.Cover.Slowest > 0 {
+			output.PrintSlowestTests(state.Graph, opts.Cover.Slowest)
+		}
+		if opts.Cover.DiffBase != "" {
+			diff, err := test.CalculateDiffCoverage(state.Coverage, opts.Cover.DiffBase)
+			if err != nil {
+				log.Fatalf("Failed to calculate diff coverage: %s", err)
+			}
+			output.PrintDiffCoverage(diff, opts.Cover.IncludeFile)
+			if !diff.MeetsThreshold(opts.Cover.DiffThreshold) {
+				log.Error("Coverage of changed lines is below the threshold of %2.1f%%", opts.Cover.DiffThreshold)
+				return false
+			}
+		}
 		return success || opts.Cover.FailingTestsOk
 	},
 	"run": func() bool {
@@ -430,18 +545,62 @@ var buildFunctions = map[string]func() bool{
 		success, state := runBuild(core.WholeGraph, false, false)
 		if success {
 			state.OriginalTargets = state.Config.Gc.Keep
-			gc.GarbageCollect(state, opts.Gc.Args.Targets, state.ExpandOriginalTargets(), state.Config.Gc.Keep, state.Config.Gc.KeepLabel,
-				opts.Gc.Conservative, opts.Gc.TargetsOnly, opts.Gc.SrcsOnly, opts.Gc.NoPrompt, opts.Gc.DryRun, opts.Gc.Git)
+			keepLabels := append(state.Config.Gc.KeepLabel, state.Config.Gc.PublishedLabel...)
+			gc.GarbageCollect(state, opts.Gc.Args.Targets, state.ExpandOriginalTargets(), state.Config.Gc.Keep, keepLabels,
+				opts.Gc.Conservative, opts.Gc.TargetsOnly, opts.Gc.SrcsOnly, opts.Gc.NoPrompt, opts.Gc.DryRun, opts.Gc.Git, opts.Gc.Patch)
 		}
 		return success
 	},
 	"export": func() bool {
-		success, state := runBuild(opts.Export.Args.Targets, false, false)
+		targets := opts.Export.Args.Targets
+		if len(targets) == 0 {
+			targets = core.InitialPackage()
+		}
+		// Anything the config refers to has to come along too for the exported repo to build.
+		targets = append(targets, export.ConfigTargets(core.ConfigFileName)...)
+		success, state := runBuild(targets, false, false)
 		if success {
-			export.ToDir(state, opts.Export.Output, state.ExpandOriginalTargets())
+			export.ToDir(state, opts.Export.Output, state.ExpandOriginalTargets(), !opts.Export.NoTrim, opts.Export.StripPrefix)
 		}
 		return success
 	},
+	"generate": func() bool {
+		success := false
+		runQuery(true, core.WholeGraph, func(state *core.BuildState) {
+			success = generate.Generate(state, opts.Generate.Args.Packages)
+		})
+		return success
+	},
+	"add_dep": func() bool {
+		return editTarget(opts.Edit.AddDep.Args.Target, func(state *core.BuildState) error {
+			return edit.AddDeps(state.Graph, opts.Edit.AddDep.Args.Target, opts.Edit.AddDep.Args.Deps)
+		})
+	},
+	"remove_dep": func() bool {
+		return editTarget(opts.Edit.RemoveDep.Args.Target, func(state *core.BuildState) error {
+			return edit.RemoveDeps(state.Graph, opts.Edit.RemoveDep.Args.Target, opts.Edit.RemoveDep.Args.Deps)
+		})
+	},
+	"set": func() bool {
+		return editTarget(opts.Edit.Set.Args.Target, func(state *core.BuildState) error {
+			return edit.SetAttr(state.Graph, opts.Edit.Set.Args.Target, opts.Edit.Set.Args.Attr, opts.Edit.Set.Args.Value)
+		})
+	},
+	"unset": func() bool {
+		return editTarget(opts.Edit.Unset.Args.Target, func(state *core.BuildState) error {
+			return edit.RemoveAttr(state.Graph, opts.Edit.Unset.Args.Target, opts.Edit.Unset.Args.Attr)
+		})
+	},
+	"rename": func() bool {
+		return editTarget(core.WholeGraph[0], func(state *core.BuildState) error {
+			return edit.Rename(state.Graph, opts.Edit.Rename.Args.Target, opts.Edit.Rename.Args.Name)
+		})
+	},
+	"move": func() bool {
+		return editTarget(core.WholeGraph[0], func(state *core.BuildState) error {
+			return edit.Move(state.Graph, opts.Edit.Move.Args.Target, opts.Edit.Move.Args.Package, state.Config.Parse.BuildFileName[0])
+		})
+	},
 	"follow": func() bool {
 		// This is only temporary, ConnectClient will alter it to match the server.
 		state := core.NewBuildState(1, nil, opts.OutputFlags.Verbosity, config)
@@ -503,6 +662,17 @@ var buildFunctions = map[string]func() bool{
 			query.AffectedTargets(state.Graph, files, opts.BuildFlags.Include, opts.BuildFlags.Exclude, opts.Query.AffectedTargets.Tests, !opts.Query.AffectedTargets.Intransitive)
 		})
 	},
+	"changes": func() bool {
+		success := false
+		runQuery(true, core.WholeGraph, func(state *core.BuildState) {
+			if err := query.Changes(state.Graph, opts.Query.Changes.Since, opts.BuildFlags.Include, opts.BuildFlags.Exclude, opts.Query.Changes.Tests, !opts.Query.Changes.Intransitive); err != nil {
+				log.Error("%s", err)
+			} else {
+				success = true
+			}
+		})
+		return success
+	},
 	"input": func() bool {
 		return runQuery(true, opts.Query.Input.Args.Targets, func(state *core.BuildState) {
 			query.TargetInputs(state.Graph, state.ExpandOriginalTargets())
@@ -546,7 +716,27 @@ var buildFunctions = map[string]func() bool{
 			if len(opts.Query.Graph.Args.Targets) == 0 {
 				state.OriginalTargets = opts.Query.Graph.Args.Targets // It special-cases doing the full graph.
 			}
-			query.Graph(state.Graph, state.ExpandOriginalTargets())
+			query.Graph(state.Graph, state.ExpandOriginalTargets(), opts.Query.Graph.Format, opts.Query.Graph.Depth,
+				opts.Query.Graph.CollapsePackages, opts.Query.Graph.ColourBy)
+		})
+	},
+	"compdb": func() bool {
+		return runQuery(true, opts.Query.Compdb.Args.Targets, func(state *core.BuildState) {
+			query.CompilationDatabase(state, state.ExpandOriginalTargets())
+		})
+	},
+	"unused_deps": func() bool {
+		// This needs a build since it inspects the outputs of each target's dependencies.
+		success, state := runBuild(opts.Query.UnusedDeps.Args.Targets, true, false)
+		return success && query.UnusedDeps(state.Graph, state.ExpandOriginalTargets(), opts.Query.UnusedDeps.Fix)
+	},
+	"eval": func() bool {
+		q, err := query.ParseQuery(opts.Query.Eval.Args.Query)
+		if err != nil {
+			log.Fatalf("Invalid query: %s", err)
+		}
+		return runQuery(true, q.Labels(), func(state *core.BuildState) {
+			query.Eval(state.Graph, q, opts.Query.Eval.Output)
 		})
 	},
 	"whatoutputs": func() bool {
@@ -558,6 +748,13 @@ var buildFunctions = map[string]func() bool{
 			query.WhatOutputs(state.Graph, files, opts.Query.WhatOutputs.EchoFiles)
 		})
 	},
+	"owners": func() bool {
+		success := false
+		runQuery(true, core.WholeGraph, func(state *core.BuildState) {
+			success = query.Owners(state.Graph, opts.Query.Owners.Args.Targets)
+		})
+		return success
+	},
 	"rules": func() bool {
 		targets := opts.Query.Rules.Args.Targets
 		success, state := Please(opts.Query.Rules.Args.Targets, config, true, true, false)
@@ -595,6 +792,20 @@ func runQuery(needFullParse bool, labels []core.BuildLabel, onSuccess func(state
 	return false
 }
 
+// editTarget parses the given label and then runs an edit on the BUILD files.
+// Edits that rename or move targets need the whole graph so they can find references to them.
+func editTarget(label core.BuildLabel, f func(state *core.BuildState) error) bool {
+	success := false
+	runQuery(label.IsAllSubpackages(), []core.BuildLabel{label}, func(state *core.BuildState) {
+		if err := f(state); err != nil {
+			log.Error("%s", err)
+		} else {
+			success = true
+		}
+	})
+	return success
+}
+
 func please(tid int, state *core.BuildState, parsePackageOnly bool, include, exclude []string) {
 	for {
 		label, dependor, t := state.NextTask()
@@ -655,10 +866,18 @@ func Please(targets []core.BuildLabel, config *core.Configuration, prettyOutput,
 	}
 	c := newCache(config)
 	state := core.NewBuildState(config.Please.NumThreads, c, opts.OutputFlags.Verbosity, config)
+	if config.Policy.File != "" {
+		policy, err := core.ReadPolicyFile(config.Policy.File)
+		if err != nil {
+			log.Fatalf("Error reading policy file: %s", err)
+		}
+		state.Graph.SetPolicy(policy)
+	}
 	state.VerifyHashes = !opts.FeatureFlags.NoHashVerification
 	state.NumTestRuns = opts.Test.NumRuns + opts.Cover.NumRuns            // Only one of these can be passed.
 	state.TestArgs = append(opts.Test.Args.Args, opts.Cover.Args.Args...) // Similarly here.
 	state.NeedCoverage = !opts.Cover.Args.Target.IsEmpty()
+	state.NeedBenchmarks = opts.Test.Benchmark
 	state.NeedBuild = shouldBuild
 	state.NeedTests = shouldTest
 	state.NeedHashesOnly = len(opts.Hash.Args.Targets) > 0
@@ -863,6 +1082,8 @@ func printCompletions(items []flags.Completion) {
 }
 
 func main() {
+	// This must come first; if we were started to set up a sandbox we never get any further.
+	core.MaybeEnterSandbox()
 	parser, extraArgs, flagsErr := cli.ParseFlags("Please", &opts, os.Args, handleCompletions)
 	// Note that we must leave flagsErr for later, because it may be affected by aliases.
 	if opts.OutputFlags.Version {
@@ -31,8 +31,7 @@ func AffectedTargets(graph *core.BuildGraph, files, include, exclude []string, t
 
 	// Check all the packages to see if any are defined by these files.
 	// This is pretty pessimistic, we have to just assume the whole package is invalidated.
-	// A better approach involves using plz query graph and plz_diff_graphs - see that tool
-	// for more explanation.
+	// 'plz query changes' does better by parsing the BUILD files before the change too.
 	go func() {
 		invalidatePackage := func(pkg *core.Package) {
 			for _, target := range pkg.AllTargets() {
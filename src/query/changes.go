@@ -0,0 +1,201 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"core"
+)
+
+// Changes prints all the targets whose build inputs have changed since the given git revision.
+// The BUILD files at that revision are parsed as well, so targets are only reported if their
+// definition has changed or one of their sources has, rather than every target in a package
+// whose BUILD file was touched. If transitive is true, targets depending on changed ones are
+// reported too. The graph must have been fully parsed.
+func Changes(graph *core.BuildGraph, since string, include, exclude []string, tests, transitive bool) error {
+	files, err := changedFiles(since)
+	if err != nil {
+		return err
+	}
+	before, err := graphAtRevision(since)
+	if err != nil {
+		return err
+	}
+	after := makeJSONGraph(graph, nil)
+	for _, label := range DiffGraphs(before, after, files, include, exclude, transitive) {
+		if !tests || after.Packages[label.PackageName].Targets[label.Name].Test {
+			fmt.Printf("%s\n", label)
+		}
+	}
+	return nil
+}
+
+// DiffGraphs calculates the targets that have changed between two graphs, given the set of files
+// that have changed between them.
+// Note that the ordering of the two graphs matters; targets that have been added are returned
+// but those that have been deleted are not (since there's nothing to build for them).
+// Only targets matching the include / exclude labels are returned.
+func DiffGraphs(before, after *JSONGraph, changedFiles, include, exclude []string, transitive bool) []core.BuildLabel {
+	changedFileMap := map[string]bool{}
+	for _, file := range changedFiles {
+		changedFileMap[file] = true
+	}
+	allChanges := map[string]bool{}
+	for pkgName, afterPkg := range after.Packages {
+		beforePkg, present := before.Packages[pkgName]
+		for targetName, afterTarget := range afterPkg.Targets {
+			beforeTarget, present2 := beforePkg.Targets[targetName]
+			if !present || !present2 || targetChanged(&beforeTarget, &afterTarget, changedFileMap) {
+				label := core.BuildLabel{PackageName: pkgName, Name: targetName}
+				allChanges[label.String()] = true
+			}
+		}
+	}
+	// Now we have all the targets that are directly changed, we locate all transitive ones
+	// in a second pass. We can't do this above because we've got no sensible ordering for it.
+	ret := core.BuildLabels{}
+	for pkgName, pkg := range after.Packages {
+		for targetName, target := range pkg.Targets {
+			if depsChanged(after, allChanges, pkgName, targetName, transitive) && shouldIncludeJSON(&target, include, exclude) {
+				ret = append(ret, core.BuildLabel{PackageName: pkgName, Name: targetName})
+			}
+		}
+	}
+	sort.Sort(ret)
+	return ret
+}
+
+// targetChanged returns true if the definition of a target has changed, or any of its inputs.
+func targetChanged(before, after *JSONTarget, changedFiles map[string]bool) bool {
+	// The hash covers the definition of the rule, so if the set of sources etc has changed, it
+	// will have changed also; here we're only worrying about their content.
+	if before.Hash != after.Hash {
+		return true
+	}
+	return anyFileChanged(after.Sources, changedFiles) || anyFileChanged(after.Data, changedFiles)
+}
+
+// anyFileChanged returns true if any of the given files have changed, or any files within them
+// if they are directories.
+func anyFileChanged(files []string, changedFiles map[string]bool) bool {
+	for _, file := range files {
+		if changedFiles[file] {
+			return true
+		}
+		prefix := strings.TrimSuffix(file, "/") + "/"
+		for changed := range changedFiles {
+			if strings.HasPrefix(changed, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// depsChanged returns true if this target or any of its transitive dependencies have changed.
+// It marks any changes in allChanges for efficiency.
+func depsChanged(graph *JSONGraph, allChanges map[string]bool, pkgName, targetName string, transitive bool) bool {
+	label := core.BuildLabel{PackageName: pkgName, Name: targetName}.String()
+	changed, present := allChanges[label]
+	if present || !transitive {
+		return changed
+	}
+	allChanges[label] = false // Guards against cycles; they're invalid but we might not have checked yet.
+	for _, dep := range graph.Packages[pkgName].Targets[targetName].Deps {
+		depLabel := core.ParseBuildLabel(dep, "")
+		if depsChanged(graph, allChanges, depLabel.PackageName, depLabel.Name, transitive) {
+			allChanges[label] = true
+			return true
+		}
+	}
+	return false
+}
+
+// shouldIncludeJSON returns true if the given combination of labels means we should return this target.
+func shouldIncludeJSON(target *JSONTarget, include, exclude []string) bool {
+	return (len(include) == 0 || hasAnyLabel(target, include)) && !hasAnyLabel(target, exclude)
+}
+
+func hasAnyLabel(target *JSONTarget, labels []string) bool {
+	for _, l1 := range labels {
+		for _, l2 := range target.Labels {
+			if l1 == l2 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// changedFiles returns all the files that have changed since the given revision, including
+// uncommitted changes and untracked files.
+func changedFiles(since string) ([]string, error) {
+	out, err := git("diff", "--name-only", "--no-renames", "--relative", since, "--")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := git("ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out) + "\n" + string(untracked)), nil
+}
+
+// graphAtRevision checks out the given revision into a temporary worktree and returns the
+// build graph at that point. The same plz binary is used to generate it so the rule hashes
+// are comparable with ours.
+func graphAtRevision(revision string) (*JSONGraph, error) {
+	dir, err := ioutil.TempDir("", "plz_query_changes")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		os.RemoveAll(dir)
+		git("worktree", "prune")
+	}()
+	log.Notice("Checking out %s...", revision)
+	if _, err := git("worktree", "add", "--detach", dir, revision); err != nil {
+		return nil, err
+	}
+	// We might not be at the root of the git repo.
+	prefix, err := git("rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	log.Notice("Parsing build graph at %s...", revision)
+	cmd := core.ExecCommand(executable, "query", "graph", "--plain_output")
+	cmd.Dir = path.Join(dir, strings.TrimSpace(string(prefix)))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse build graph at %s: %s\n%s", revision, err, stderr.String())
+	}
+	graph := &JSONGraph{}
+	if err := json.Unmarshal(out, graph); err != nil {
+		return nil, fmt.Errorf("Failed to read build graph at %s: %s", revision, err)
+	}
+	return graph, nil
+}
+
+// git runs git with the given arguments and returns its output.
+func git(args ...string) ([]byte, error) {
+	cmd := core.ExecCommand("git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to run git %s: %s\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	return out, nil
+}
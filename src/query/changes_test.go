@@ -0,0 +1,80 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"core"
+)
+
+var testGraph = &JSONGraph{Packages: map[string]JSONPackage{
+	"src/lib": {Targets: map[string]JSONTarget{
+		"lib":      {Sources: []string{"src/lib/lib.go"}, Hash: "lib"},
+		"resource": {Sources: []string{"src/lib/resources"}, Hash: "resource"},
+	}},
+	"src/app": {Targets: map[string]JSONTarget{
+		"app":      {Deps: []string{"//src/lib:lib"}, Hash: "app"},
+		"app_test": {Deps: []string{"//src/app:app"}, Data: []string{"src/app/test_data.txt"}, Labels: []string{"manual"}, Hash: "app_test", Test: true},
+	}},
+}}
+
+func TestDiffGraphsNoChanges(t *testing.T) {
+	assert.Equal(t, []core.BuildLabel{}, diffGraphs(testGraph, nil, true))
+}
+
+func TestDiffGraphsChangedSource(t *testing.T) {
+	assert.Equal(t, labels("//src/app:app", "//src/app:app_test", "//src/lib:lib"), diffGraphs(testGraph, []string{"src/lib/lib.go"}, true))
+	assert.Equal(t, labels("//src/lib:lib"), diffGraphs(testGraph, []string{"src/lib/lib.go"}, false))
+}
+
+func TestDiffGraphsChangedFileInDirectory(t *testing.T) {
+	assert.Equal(t, labels("//src/lib:resource"), diffGraphs(testGraph, []string{"src/lib/resources/a.txt"}, true))
+	assert.Equal(t, []core.BuildLabel{}, diffGraphs(testGraph, []string{"src/lib/resources_b.txt"}, true))
+}
+
+func TestDiffGraphsChangedData(t *testing.T) {
+	assert.Equal(t, labels("//src/app:app_test"), diffGraphs(testGraph, []string{"src/app/test_data.txt"}, true))
+}
+
+func TestDiffGraphsChangedDefinition(t *testing.T) {
+	after := &JSONGraph{Packages: map[string]JSONPackage{
+		"src/lib": {Targets: map[string]JSONTarget{
+			"lib":      testGraph.Packages["src/lib"].Targets["lib"],
+			"resource": testGraph.Packages["src/lib"].Targets["resource"],
+		}},
+		"src/app": {Targets: map[string]JSONTarget{
+			"app":      {Deps: []string{"//src/lib:lib"}, Hash: "app2"},
+			"app_test": testGraph.Packages["src/app"].Targets["app_test"],
+		}},
+	}}
+	assert.Equal(t, labels("//src/app:app", "//src/app:app_test"), DiffGraphs(testGraph, after, nil, nil, nil, true))
+	assert.Equal(t, labels("//src/app:app"), DiffGraphs(testGraph, after, nil, nil, []string{"manual"}, true))
+	assert.Equal(t, labels("//src/app:app_test"), DiffGraphs(testGraph, after, nil, []string{"manual"}, nil, true))
+}
+
+func TestDiffGraphsNewTarget(t *testing.T) {
+	after := &JSONGraph{Packages: map[string]JSONPackage{
+		"src/lib": testGraph.Packages["src/lib"],
+		"src/app": testGraph.Packages["src/app"],
+		"src/new": {Targets: map[string]JSONTarget{
+			"new": {Deps: []string{"//src/lib:lib"}, Hash: "new"},
+		}},
+	}}
+	assert.Equal(t, labels("//src/new:new"), DiffGraphs(testGraph, after, nil, nil, nil, true))
+	// Deleted targets aren't reported since there's nothing to build for them.
+	assert.Equal(t, []core.BuildLabel{}, DiffGraphs(after, testGraph, nil, nil, nil, true))
+}
+
+// diffGraphs diffs a graph against itself with the given changed files.
+func diffGraphs(graph *JSONGraph, changedFiles []string, transitive bool) []core.BuildLabel {
+	return DiffGraphs(graph, graph, changedFiles, nil, nil, transitive)
+}
+
+func labels(labels ...string) []core.BuildLabel {
+	ret := make([]core.BuildLabel, len(labels))
+	for i, label := range labels {
+		ret[i] = core.ParseBuildLabel(label, "")
+	}
+	return ret
+}
@@ -0,0 +1,162 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"build"
+	"core"
+)
+
+// A compileCommand is a single entry in a compilation database, as described at
+// https://clang.llvm.org/docs/JSONCompilationDatabase.html
+type compileCommand struct {
+	Directory string `json:"directory"`
+	File      string `json:"file"`
+	Command   string `json:"command"`
+}
+
+// backtickRegex matches subcommands in backticks, which we use to invoke pkg-config.
+var backtickRegex = regexp.MustCompile("`[^`]*`")
+
+// CompilationDatabase prints a compilation database (i.e. the contents of compile_commands.json)
+// for all the C and C++ targets that the given targets depend on.
+func CompilationDatabase(state *core.BuildState, labels []core.BuildLabel) {
+	commands, err := compilationDatabase(state, labels)
+	if err != nil {
+		log.Fatalf("Failed to generate compilation database: %s", err)
+	}
+	b, err := json.MarshalIndent(commands, "", "    ")
+	if err != nil {
+		log.Fatalf("Failed to encode compilation database: %s", err)
+	}
+	fmt.Println(string(b))
+}
+
+// compilationDatabase returns the compile commands for all the C and C++ targets that the
+// given targets depend on.
+func compilationDatabase(state *core.BuildState, labels []core.BuildLabel) ([]compileCommand, error) {
+	targets := map[*core.BuildTarget]bool{}
+	for _, label := range labels {
+		findCompileTargets(state.Graph.TargetOrDie(label), targets)
+	}
+	commands := []compileCommand{}
+	for target := range targets {
+		if !isCompileTarget(target) {
+			continue
+		}
+		cmds, err := compileCommands(state, target)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, cmds...)
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		if commands[i].File != commands[j].File {
+			return commands[i].File < commands[j].File
+		}
+		return commands[i].Command < commands[j].Command
+	})
+	return commands, nil
+}
+
+// findCompileTargets collects a target and all of its transitive dependencies.
+func findCompileTargets(target *core.BuildTarget, targets map[*core.BuildTarget]bool) {
+	if targets[target] {
+		return
+	}
+	targets[target] = true
+	for _, dep := range target.Dependencies() {
+		findCompileTargets(dep, targets)
+	}
+}
+
+// isCompileTarget returns true if the given target compiles C or C++ sources.
+// These are identified by the way cc_rules.build_defs declares them, i.e. they have a
+// compiler tool named 'cc' and a named group of sources to compile called 'srcs'.
+func isCompileTarget(target *core.BuildTarget) bool {
+	return len(target.NamedTools("cc")) > 0 && len(target.NamedSources["srcs"]) > 0 && strings.Contains(target.GetCommand(), " -c ")
+}
+
+// compileCommands returns the compile commands for each source file of a single target.
+// The commands are rewritten to run from the repo root rather than the target's temporary
+// directory, so replacements like $(location) refer to outputs by their paths in plz-out and
+// the generated directory is added to the include path to find any generated headers there.
+func compileCommands(state *core.BuildState, target *core.BuildTarget) ([]compileCommand, error) {
+	// Pre-build functions add flags from the target's dependencies, so we need to run them first.
+	if target.PreBuildFunction != nil {
+		pkg := state.Graph.PackageOrDie(target.Label.PackageName)
+		if _, err := pkg.EnterBuildCallback(func() error { return target.PreBuildFunction.Call(target) }); err != nil {
+			return nil, err
+		}
+	}
+	cmd := target.GetCommand()
+	// Anything after the compilation itself (e.g. archiving the outputs) isn't interesting.
+	if idx := strings.Index(cmd, " && "); idx != -1 {
+		cmd = cmd[:idx]
+	}
+	cmd = build.ReplaceSequencesFromRepoRoot(target, cmd)
+	env := core.BuildEnvironment(state, target, false)
+	commands := []compileCommand{}
+	for _, src := range target.NamedSources["srcs"] {
+		for _, file := range src.FullPaths(state.Graph) {
+			fileEnv := overrideEnv(env, "TMP_DIR="+core.RepoRoot, "SRCS_SRCS="+file)
+			command := os.Expand(cmd, fileEnv.ReplaceEnvironment)
+			var err error
+			command = backtickRegex.ReplaceAllStringFunc(command, func(s string) string {
+				out, e := runSubcommand(s[1:len(s)-1], fileEnv)
+				if e != nil && err == nil {
+					err = e
+				}
+				return out
+			})
+			if err != nil {
+				return nil, fmt.Errorf("Failed to generate compile command for %s in %s: %s", file, target.Label, err)
+			}
+			commands = append(commands, compileCommand{
+				Directory: core.RepoRoot,
+				File:      path.Join(core.RepoRoot, file),
+				Command:   strings.TrimSpace(command) + " -I " + core.GenDir,
+			})
+		}
+	}
+	return commands, nil
+}
+
+// overrideEnv returns a copy of the given environment with some variables replaced.
+func overrideEnv(env core.BuildEnv, overrides ...string) core.BuildEnv {
+	ret := make(core.BuildEnv, 0, len(env)+len(overrides))
+	for _, e := range env {
+		overridden := false
+		for _, o := range overrides {
+			if strings.HasPrefix(e, o[:strings.IndexByte(o, '=')+1]) {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			ret = append(ret, e)
+		}
+	}
+	return append(ret, overrides...)
+}
+
+// runSubcommand runs a subcommand of a compile command (e.g. pkg-config) and returns its output.
+func runSubcommand(command string, env core.BuildEnv) (string, error) {
+	cmd := exec.Command("bash", "-c", command)
+	cmd.Env = env
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("Failed to run %s: %s\n%s", command, err, exitErr.Stderr)
+		}
+		return "", fmt.Errorf("Failed to run %s: %s", command, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,154 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"core"
+)
+
+func TestCompilationDatabase(t *testing.T) {
+	state := core.NewBuildState(1, nil, 4, core.DefaultConfiguration())
+	core.State = state
+	oldRepoRoot := core.RepoRoot
+	core.RepoRoot = "/repo"
+	defer func() { core.RepoRoot = oldRepoRoot }()
+
+	gen := addCompdbTarget(state.Graph, "//lib:gen", []string{"gen.cc"})
+	gen.Command = "echo 'int gen() { return 1; }' > $OUT"
+	lib := addCompdbTarget(state.Graph, "//lib:_lib#cc", []string{"lib.a"})
+	lib.AddNamedSource("srcs", core.FileLabel{File: "lib.cc", Package: "lib"})
+	lib.AddNamedSource("srcs", gen.Label)
+	lib.AddNamedSource("hdrs", core.FileLabel{File: "lib.h", Package: "lib"})
+	lib.AddNamedTool("cc", core.SystemFileLabel{Path: "/usr/bin/g++"})
+	lib.AddNamedTool("ar", core.SystemFileLabel{Path: "/usr/bin/ar"})
+	lib.Command = "$TOOLS_CC -c -I . ${SRCS_SRCS} -DLIB `echo -DPC` && $TOOLS_AR rcs $OUT *.o"
+	app := addCompdbTarget(state.Graph, "//app:app", []string{"app"})
+	app.AddDependency(lib.Label)
+	app.AddTool(core.SystemFileLabel{Path: "/usr/bin/g++"})
+	app.Command = "$TOOL -o $OUT *.a"
+	for _, target := range state.Graph.AllTargets() {
+		for _, dep := range target.DeclaredDependencies() {
+			state.Graph.AddDependency(target.Label, dep)
+		}
+	}
+
+	commands, err := compilationDatabase(state, []core.BuildLabel{app.Label})
+	require.NoError(t, err)
+	assert.Equal(t, []compileCommand{
+		{
+			Directory: "/repo",
+			File:      "/repo/lib/lib.cc",
+			Command:   "/usr/bin/g++ -c -I . lib/lib.cc -DLIB -DPC -I plz-out/gen",
+		},
+		{
+			Directory: "/repo",
+			File:      "/repo/plz-out/gen/lib/gen.cc",
+			Command:   "/usr/bin/g++ -c -I . plz-out/gen/lib/gen.cc -DLIB -DPC -I plz-out/gen",
+		},
+	}, commands)
+}
+
+func TestCompilationDatabaseNoCompileTargets(t *testing.T) {
+	state := core.NewBuildState(1, nil, 4, core.DefaultConfiguration())
+	core.State = state
+	target := addCompdbTarget(state.Graph, "//lib:gen", []string{"gen.cc"})
+	target.Command = "echo 'int gen() { return 1; }' > $OUT"
+	commands, err := compilationDatabase(state, []core.BuildLabel{target.Label})
+	assert.NoError(t, err)
+	assert.Equal(t, []compileCommand{}, commands)
+}
+
+func TestCompilationDatabasePreBuild(t *testing.T) {
+	state := core.NewBuildState(1, nil, 4, core.DefaultConfiguration())
+	core.State = state
+	oldRepoRoot := core.RepoRoot
+	core.RepoRoot = "/repo"
+	defer func() { core.RepoRoot = oldRepoRoot }()
+
+	lib := addCompdbTarget(state.Graph, "//lib:_lib#cc", []string{"lib.a"})
+	lib.AddNamedSource("srcs", core.FileLabel{File: "lib.cc", Package: "lib"})
+	lib.AddNamedTool("cc", core.SystemFileLabel{Path: "/usr/bin/g++"})
+	lib.Command = "$TOOLS_CC -c ${SRCS_SRCS}"
+	lib.PreBuildFunction = preBuildFunc(func(target *core.BuildTarget) error {
+		target.Command += " -DPREBUILD"
+		return nil
+	})
+	commands, err := compilationDatabase(state, []core.BuildLabel{lib.Label})
+	require.NoError(t, err)
+	assert.Equal(t, []compileCommand{
+		{
+			Directory: "/repo",
+			File:      "/repo/lib/lib.cc",
+			Command:   "/usr/bin/g++ -c lib/lib.cc -DPREBUILD -I plz-out/gen",
+		},
+	}, commands)
+	// We aren't building it, so it shouldn't appear to be building.
+	assert.Equal(t, core.Inactive, lib.State())
+}
+
+func TestCompilationDatabaseLocation(t *testing.T) {
+	state := core.NewBuildState(1, nil, 4, core.DefaultConfiguration())
+	core.State = state
+	oldRepoRoot := core.RepoRoot
+	core.RepoRoot = "/repo"
+	defer func() { core.RepoRoot = oldRepoRoot }()
+
+	hdr := addCompdbTarget(state.Graph, "//lib:config_h", []string{"config.h"})
+	lib := addCompdbTarget(state.Graph, "//lib:_lib#cc", []string{"lib.a"})
+	lib.AddNamedSource("srcs", core.FileLabel{File: "lib.cc", Package: "lib"})
+	lib.AddNamedTool("cc", core.SystemFileLabel{Path: "/usr/bin/g++"})
+	lib.AddDependency(hdr.Label)
+	lib.Command = "$TOOLS_CC -c ${SRCS_SRCS} -include $(location //lib:config_h) -I $(dir //lib:config_h)"
+	state.Graph.AddDependency(lib.Label, hdr.Label)
+	commands, err := compilationDatabase(state, []core.BuildLabel{lib.Label})
+	require.NoError(t, err)
+	// The header is generated, so it should be referred to where it is in plz-out.
+	assert.Equal(t, []compileCommand{
+		{
+			Directory: "/repo",
+			File:      "/repo/lib/lib.cc",
+			Command:   "/usr/bin/g++ -c lib/lib.cc -include plz-out/gen/lib/config.h -I plz-out/gen/lib -I plz-out/gen",
+		},
+	}, commands)
+}
+
+func TestCompilationDatabaseSubcommandFails(t *testing.T) {
+	state := core.NewBuildState(1, nil, 4, core.DefaultConfiguration())
+	core.State = state
+	lib := addCompdbTarget(state.Graph, "//lib:_lib#cc", []string{"lib.a"})
+	lib.AddNamedSource("srcs", core.FileLabel{File: "lib.cc", Package: "lib"})
+	lib.AddNamedTool("cc", core.SystemFileLabel{Path: "/usr/bin/g++"})
+	lib.Command = "$TOOLS_CC -c ${SRCS_SRCS} `pkg-config --cflags nonexistent-package-that-does-not-exist`"
+	_, err := compilationDatabase(state, []core.BuildLabel{lib.Label})
+	assert.Error(t, err)
+}
+
+// A preBuildFunc implements core.PreBuildFunction for tests.
+type preBuildFunc func(*core.BuildTarget) error
+
+func (f preBuildFunc) Call(target *core.BuildTarget) error {
+	return f(target)
+}
+
+func (f preBuildFunc) String() string {
+	return "pre_build"
+}
+
+// addCompdbTarget adds a new target to the graph.
+func addCompdbTarget(graph *core.BuildGraph, label string, outs []string) *core.BuildTarget {
+	target := core.NewBuildTarget(core.ParseBuildLabel(label, ""))
+	for _, out := range outs {
+		target.AddOutput(out)
+	}
+	pkg := graph.Package(target.Label.PackageName)
+	if pkg == nil {
+		pkg = core.NewPackage(target.Label.PackageName)
+		graph.AddPackage(pkg)
+	}
+	pkg.AddTarget(target)
+	graph.AddTarget(target)
+	return target
+}
@@ -0,0 +1,678 @@
+// Implementation of 'plz query eval', which evaluates expressions in a small query language.
+//
+// The language is loosely modelled on Bazel's. Expressions are build label patterns which are
+// combined using set operators (union / +, intersect / ^ and except / -, all of equal precedence
+// and left-associative) and functions:
+//   deps(x[, depth])              - x and all its transitive dependencies, optionally limited in depth
+//   rdeps(universe, x[, depth])   - everything in the transitive closure of universe which depends on x
+//   kind(regex, x)                - targets in x created by a rule whose name matches regex
+//   attr(name, regex, x)          - targets in x whose attribute name matches regex
+//   labels(attr, x)               - targets referred to by the given attribute (e.g. srcs, deps) of x
+//   tests(x)                      - test targets in x
+//   somepath(from, to)            - the targets on some dependency path from from to to
+//   allpaths(from, to)            - the targets on every dependency path from from to to
+
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"core"
+)
+
+// A Query is a parsed query expression.
+type Query struct {
+	expr   queryExpr
+	labels []core.BuildLabel
+}
+
+// ParseQuery parses the given query expression.
+func ParseQuery(query string) (*Query, error) {
+	tokens, err := tokeniseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	} else if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("Unexpected %s at end of query", p.tokens[p.pos])
+	}
+	return &Query{expr: expr, labels: p.labels}, nil
+}
+
+// Labels returns all the build label patterns that the query refers to.
+// These and their dependencies must be parsed before it's evaluated.
+func (q *Query) Labels() []core.BuildLabel {
+	return q.labels
+}
+
+// Eval evaluates a query and prints the resulting targets in the given format,
+// which is one of "label", "json" or "graph".
+func Eval(graph *core.BuildGraph, query *Query, format string) {
+	targets, err := evalQuery(graph, query)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	if err := printQueryResults(os.Stdout, graph, targets, format); err != nil {
+		log.Fatalf("%s", err)
+	}
+}
+
+// evalQuery evaluates a query and returns the resulting targets in sorted order.
+// As with 'plz query revdeps', hidden targets are replaced by their parents.
+func evalQuery(graph *core.BuildGraph, query *Query) ([]*core.BuildTarget, error) {
+	set, err := query.expr.eval(graph)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]*core.BuildTarget, 0, len(set))
+	done := make(targetSet, len(set))
+	for target := range set {
+		if parent := target.Parent(graph); parent != nil {
+			target = parent
+		}
+		if _, present := done[target]; !present {
+			done[target] = struct{}{}
+			targets = append(targets, target)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Label.Less(targets[j].Label) })
+	return targets, nil
+}
+
+// printQueryResults prints the results of a query in one of our output formats.
+func printQueryResults(w io.Writer, graph *core.BuildGraph, targets []*core.BuildTarget, format string) error {
+	switch format {
+	case "", "label":
+		for _, target := range targets {
+			fmt.Fprintf(w, "%s\n", target.Label)
+		}
+		return nil
+	case "json":
+		labels := make([]string, len(targets))
+		for i, target := range targets {
+			labels[i] = target.Label.String()
+		}
+		return writeJSON(w, labels)
+	case "graph":
+		g := JSONGraph{Packages: map[string]JSONPackage{}}
+		for _, target := range targets {
+			pkg, present := g.Packages[target.Label.PackageName]
+			if !present {
+				pkg = JSONPackage{Targets: map[string]JSONTarget{}}
+				g.Packages[target.Label.PackageName] = pkg
+			}
+			pkg.Targets[target.Label.Name] = makeJSONTarget(graph, target)
+		}
+		return writeJSON(w, g)
+	}
+	return fmt.Errorf("Unknown output format %s", format)
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+// A targetSet is the result of evaluating a query expression.
+type targetSet map[*core.BuildTarget]struct{}
+
+// A queryExpr is a single node of a parsed query.
+type queryExpr interface {
+	eval(graph *core.BuildGraph) (targetSet, error)
+}
+
+// A patternExpr is a build label, which may be a pseudo-label like :all or /...
+// As with 'plz query alltargets', pseudo-labels don't include hidden targets.
+type patternExpr struct {
+	label core.BuildLabel
+}
+
+func (e *patternExpr) eval(graph *core.BuildGraph) (targetSet, error) {
+	ret := targetSet{}
+	addPackage := func(pkg *core.Package) {
+		for _, target := range pkg.AllTargets() {
+			if !strings.HasPrefix(target.Label.Name, "_") {
+				ret[target] = struct{}{}
+			}
+		}
+	}
+	if e.label.IsAllSubpackages() {
+		for name, pkg := range graph.PackageMap() {
+			if e.label.Includes(core.BuildLabel{PackageName: name}) {
+				addPackage(pkg)
+			}
+		}
+	} else if e.label.IsAllTargets() {
+		pkg := graph.Package(e.label.PackageName)
+		if pkg == nil {
+			return nil, fmt.Errorf("Unknown package %s", e.label.PackageName)
+		}
+		addPackage(pkg)
+	} else if target := graph.Target(e.label); target != nil {
+		ret[target] = struct{}{}
+	} else {
+		return nil, fmt.Errorf("Unknown target %s", e.label)
+	}
+	return ret, nil
+}
+
+// A binaryExpr is a set operation on two subexpressions.
+type binaryExpr struct {
+	op          string
+	left, right queryExpr
+}
+
+// queryOperators maps the names of set operators to their canonical form.
+var queryOperators = map[string]string{
+	"union":     "union",
+	"+":         "union",
+	"intersect": "intersect",
+	"^":         "intersect",
+	"except":    "except",
+	"-":         "except",
+}
+
+func (e *binaryExpr) eval(graph *core.BuildGraph) (targetSet, error) {
+	left, err := e.left.eval(graph)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.eval(graph)
+	if err != nil {
+		return nil, err
+	}
+	ret := targetSet{}
+	switch e.op {
+	case "union":
+		for target := range left {
+			ret[target] = struct{}{}
+		}
+		for target := range right {
+			ret[target] = struct{}{}
+		}
+	case "intersect":
+		for target := range left {
+			if _, present := right[target]; present {
+				ret[target] = struct{}{}
+			}
+		}
+	case "except":
+		for target := range left {
+			if _, present := right[target]; !present {
+				ret[target] = struct{}{}
+			}
+		}
+	}
+	return ret, nil
+}
+
+// A queryArgType describes the type of one argument to a query function.
+type queryArgType int
+
+const (
+	exprArg queryArgType = iota
+	wordArg
+	intArg
+)
+
+// A queryFunction describes one of the functions available in queries.
+type queryFunction struct {
+	args     []queryArgType
+	optional int // Number of trailing arguments that are optional.
+	eval     func(graph *core.BuildGraph, args []queryArg) (targetSet, error)
+}
+
+// A queryArg is a single argument to a function call. Exactly one field is meaningful
+// depending on the corresponding queryArgType.
+type queryArg struct {
+	expr queryExpr
+	word string
+	num  int
+}
+
+// queryFunctions is the set of functions that can be called in a query.
+var queryFunctions = map[string]queryFunction{
+	"deps":     {args: []queryArgType{exprArg, intArg}, optional: 1, eval: evalDeps},
+	"rdeps":    {args: []queryArgType{exprArg, exprArg, intArg}, optional: 1, eval: evalRdeps},
+	"kind":     {args: []queryArgType{wordArg, exprArg}, eval: evalKind},
+	"attr":     {args: []queryArgType{wordArg, wordArg, exprArg}, eval: evalAttr},
+	"labels":   {args: []queryArgType{wordArg, exprArg}, eval: evalLabels},
+	"tests":    {args: []queryArgType{exprArg}, eval: evalTests},
+	"somepath": {args: []queryArgType{exprArg, exprArg}, eval: evalSomepath},
+	"allpaths": {args: []queryArgType{exprArg, exprArg}, eval: evalAllpaths},
+}
+
+// A funcExpr is a call to one of the query functions.
+type funcExpr struct {
+	name string
+	args []queryArg
+}
+
+func (e *funcExpr) eval(graph *core.BuildGraph) (targetSet, error) {
+	return queryFunctions[e.name].eval(graph, e.args)
+}
+
+// evalArgs evaluates all the expression arguments of a function call.
+func evalArgs(graph *core.BuildGraph, args []queryArg) ([]targetSet, error) {
+	ret := []targetSet{}
+	for _, arg := range args {
+		if arg.expr != nil {
+			set, err := arg.expr.eval(graph)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, set)
+		}
+	}
+	return ret, nil
+}
+
+// depth returns the depth argument to deps / rdeps, or -1 if it wasn't given.
+func depth(args []queryArg, i int) int {
+	if i < len(args) {
+		return args[i].num
+	}
+	return -1
+}
+
+func evalDeps(graph *core.BuildGraph, args []queryArg) (targetSet, error) {
+	sets, err := evalArgs(graph, args)
+	if err != nil {
+		return nil, err
+	}
+	return transitiveDeps(sets[0], depth(args, 1)), nil
+}
+
+// transitiveDeps returns the given targets and their dependencies up to the given depth (or all of them if it's negative).
+func transitiveDeps(targets targetSet, depth int) targetSet {
+	return walkGraph(targets, depth, func(target *core.BuildTarget) []*core.BuildTarget {
+		return target.Dependencies()
+	})
+}
+
+// walkGraph does a breadth-first walk of the graph from the given targets, following edges
+// given by the next function, up to the given depth.
+func walkGraph(targets targetSet, depth int, next func(*core.BuildTarget) []*core.BuildTarget) targetSet {
+	ret := targetSet{}
+	current := make([]*core.BuildTarget, 0, len(targets))
+	for target := range targets {
+		ret[target] = struct{}{}
+		current = append(current, target)
+	}
+	for ; len(current) > 0 && depth != 0; depth-- {
+		nextLevel := []*core.BuildTarget{}
+		for _, target := range current {
+			for _, t := range next(target) {
+				if _, present := ret[t]; !present {
+					ret[t] = struct{}{}
+					nextLevel = append(nextLevel, t)
+				}
+			}
+		}
+		current = nextLevel
+	}
+	return ret
+}
+
+func evalRdeps(graph *core.BuildGraph, args []queryArg) (targetSet, error) {
+	sets, err := evalArgs(graph, args)
+	if err != nil {
+		return nil, err
+	}
+	return reverseDepsWithin(transitiveDeps(sets[0], -1), sets[1], depth(args, 2)), nil
+}
+
+// reverseDepsWithin returns the targets in the given universe which depend on any of the given
+// targets up to the given depth, including those targets themselves.
+func reverseDepsWithin(universe, targets targetSet, depth int) targetSet {
+	revdeps := map[*core.BuildTarget][]*core.BuildTarget{}
+	for target := range universe {
+		for _, dep := range target.Dependencies() {
+			revdeps[dep] = append(revdeps[dep], target)
+		}
+	}
+	start := targetSet{}
+	for target := range targets {
+		if _, present := universe[target]; present {
+			start[target] = struct{}{}
+		}
+	}
+	return walkGraph(start, depth, func(target *core.BuildTarget) []*core.BuildTarget {
+		return revdeps[target]
+	})
+}
+
+// filter returns the subset of the given targets that satisfy a predicate.
+func filter(targets targetSet, f func(*core.BuildTarget) bool) targetSet {
+	ret := targetSet{}
+	for target := range targets {
+		if f(target) {
+			ret[target] = struct{}{}
+		}
+	}
+	return ret
+}
+
+func evalKind(graph *core.BuildGraph, args []queryArg) (targetSet, error) {
+	re, err := regexp.Compile(args[0].word)
+	if err != nil {
+		return nil, err
+	}
+	sets, err := evalArgs(graph, args)
+	if err != nil {
+		return nil, err
+	}
+	return filter(sets[0], func(target *core.BuildTarget) bool { return re.MatchString(target.Kind) }), nil
+}
+
+func evalAttr(graph *core.BuildGraph, args []queryArg) (targetSet, error) {
+	re, err := regexp.Compile(args[1].word)
+	if err != nil {
+		return nil, err
+	}
+	sets, err := evalArgs(graph, args)
+	if err != nil {
+		return nil, err
+	}
+	var attrErr error
+	ret := filter(sets[0], func(target *core.BuildTarget) bool {
+		values, err := attrValues(target, args[0].word)
+		if err != nil {
+			attrErr = err
+			return false
+		}
+		for _, value := range values {
+			if re.MatchString(value) {
+				return true
+			}
+		}
+		return false
+	})
+	return ret, attrErr
+}
+
+// attrValues returns the values of the named attribute of a target as strings, in the same form that
+// 'plz query print' would show them. Lists have one entry per item; unset attributes have a single empty value.
+func attrValues(target *core.BuildTarget, name string) ([]string, error) {
+	var buf bytes.Buffer
+	p := newPrinter(&buf, target, 0)
+	v := reflect.ValueOf(target).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); p.fieldName(f) == name && f.Tag.Get("print") != "false" {
+			contents, _ := p.shouldPrintField(f, v.Field(i))
+			return strings.Split(strings.TrimSuffix(contents, "\n"), "\n"), nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown attribute %s", name)
+}
+
+// labelAttributes are the attributes that can be used with labels(); each returns the labels of that attribute of a target.
+var labelAttributes = map[string]func(*core.BuildTarget) []core.BuildLabel{
+	"srcs":          func(target *core.BuildTarget) []core.BuildLabel { return inputLabels(target.AllSources()) },
+	"data":          func(target *core.BuildTarget) []core.BuildLabel { return inputLabels(target.Data) },
+	"tools":         func(target *core.BuildTarget) []core.BuildLabel { return inputLabels(target.AllTools()) },
+	"deps":          func(target *core.BuildTarget) []core.BuildLabel { return target.DeclaredDependenciesStrict() },
+	"exported_deps": func(target *core.BuildTarget) []core.BuildLabel { return target.ExportedDependencies() },
+}
+
+// inputLabels returns the labels of any of the given inputs that are build labels.
+func inputLabels(inputs []core.BuildInput) []core.BuildLabel {
+	ret := []core.BuildLabel{}
+	for _, input := range inputs {
+		if label := input.Label(); label != nil {
+			ret = append(ret, *label)
+		}
+	}
+	return ret
+}
+
+func evalLabels(graph *core.BuildGraph, args []queryArg) (targetSet, error) {
+	f, present := labelAttributes[args[0].word]
+	if !present {
+		return nil, fmt.Errorf("Unknown label attribute %s", args[0].word)
+	}
+	sets, err := evalArgs(graph, args)
+	if err != nil {
+		return nil, err
+	}
+	ret := targetSet{}
+	for target := range sets[0] {
+		for _, label := range f(target) {
+			if t := graph.Target(label); t != nil {
+				ret[t] = struct{}{}
+			}
+		}
+	}
+	return ret, nil
+}
+
+func evalTests(graph *core.BuildGraph, args []queryArg) (targetSet, error) {
+	sets, err := evalArgs(graph, args)
+	if err != nil {
+		return nil, err
+	}
+	return filter(sets[0], func(target *core.BuildTarget) bool { return target.IsTest }), nil
+}
+
+func evalSomepath(graph *core.BuildGraph, args []queryArg) (targetSet, error) {
+	sets, err := evalArgs(graph, args)
+	if err != nil {
+		return nil, err
+	}
+	from, to := sets[0], sets[1]
+	// Breadth-first search from all the starting points at once, remembering how we got to each target.
+	parents := map[*core.BuildTarget]*core.BuildTarget{}
+	queue := []*core.BuildTarget{}
+	for target := range from {
+		parents[target] = nil
+		queue = append(queue, target)
+	}
+	for len(queue) > 0 {
+		target := queue[0]
+		queue = queue[1:]
+		if _, present := to[target]; present {
+			ret := targetSet{}
+			for ; target != nil; target = parents[target] {
+				ret[target] = struct{}{}
+			}
+			return ret, nil
+		}
+		for _, dep := range target.Dependencies() {
+			if _, present := parents[dep]; !present {
+				parents[dep] = target
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return targetSet{}, nil
+}
+
+func evalAllpaths(graph *core.BuildGraph, args []queryArg) (targetSet, error) {
+	sets, err := evalArgs(graph, args)
+	if err != nil {
+		return nil, err
+	}
+	return reverseDepsWithin(transitiveDeps(sets[0], -1), sets[1], -1), nil
+}
+
+// A queryToken is a single token in a query.
+type queryToken struct {
+	value  string
+	quoted bool
+}
+
+func (t queryToken) String() string {
+	if t.quoted {
+		return strconv.Quote(t.value)
+	}
+	return "'" + t.value + "'"
+}
+
+// is returns true if this token is the given unquoted value.
+func (t queryToken) is(value string) bool {
+	return !t.quoted && t.value == value
+}
+
+// tokeniseQuery splits a query into tokens. Punctuation is a token on its own, strings can be
+// quoted with either single or double quotes, and anything else is split on whitespace.
+func tokeniseQuery(query string) ([]queryToken, error) {
+	tokens := []queryToken{}
+	for i := 0; i < len(query); {
+		c := query[i]
+		if unicode.IsSpace(rune(c)) {
+			i++
+		} else if c == '(' || c == ')' || c == ',' {
+			tokens = append(tokens, queryToken{value: string(c)})
+			i++
+		} else if c == '"' || c == '\'' {
+			end := strings.IndexByte(query[i+1:], c)
+			if end == -1 {
+				return nil, fmt.Errorf("Unterminated string in query: %s", query[i:])
+			}
+			tokens = append(tokens, queryToken{value: query[i+1 : i+1+end], quoted: true})
+			i += end + 2
+		} else {
+			end := strings.IndexFunc(query[i:], func(r rune) bool {
+				return unicode.IsSpace(r) || r == '(' || r == ')' || r == ','
+			})
+			if end == -1 {
+				end = len(query) - i
+			}
+			tokens = append(tokens, queryToken{value: query[i : i+end]})
+			i += end
+		}
+	}
+	return tokens, nil
+}
+
+// A queryParser is a simple recursive-descent parser for queries.
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	labels []core.BuildLabel
+}
+
+// next returns the next token, or an error if there aren't any more.
+func (p *queryParser) next() (queryToken, error) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, fmt.Errorf("Unexpected end of query")
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+// peek returns true if the next token is the given unquoted value.
+func (p *queryParser) peek(value string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].is(value)
+}
+
+// expect consumes the next token and returns an error if it isn't the given value.
+func (p *queryParser) expect(value string) error {
+	tok, err := p.next()
+	if err != nil {
+		return err
+	} else if !tok.is(value) {
+		return fmt.Errorf("Expected '%s', got %s", value, tok)
+	}
+	return nil
+}
+
+// parseExpr parses a full expression, i.e. a series of terms joined by set operators.
+func (p *queryParser) parseExpr() (queryExpr, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.pos < len(p.tokens) {
+		tok := p.tokens[p.pos]
+		op, present := queryOperators[tok.value]
+		if !present || tok.quoted {
+			break
+		}
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseTerm parses a single term, i.e. a build label, function call or a parenthesised expression.
+func (p *queryParser) parseTerm() (queryExpr, error) {
+	tok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if tok.is("(") {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	} else if f, present := queryFunctions[tok.value]; present && !tok.quoted && p.peek("(") {
+		return p.parseCall(tok.value, f)
+	}
+	label, err := core.TryParseBuildLabel(tok.value, "")
+	if err != nil {
+		return nil, err
+	}
+	p.labels = append(p.labels, label)
+	return &patternExpr{label: label}, nil
+}
+
+// parseCall parses the arguments of a function call.
+func (p *queryParser) parseCall(name string, f queryFunction) (queryExpr, error) {
+	p.pos++ // Skip the opening bracket
+	args := []queryArg{}
+	for i, argType := range f.args {
+		if i > 0 {
+			if i >= len(f.args)-f.optional && p.peek(")") {
+				break
+			} else if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		if argType == exprArg {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, queryArg{expr: expr})
+			continue
+		}
+		tok, err := p.next()
+		if err != nil {
+			return nil, err
+		} else if argType == wordArg {
+			args = append(args, queryArg{word: tok.value})
+		} else if n, err := strconv.Atoi(tok.value); err != nil || n < 0 {
+			return nil, fmt.Errorf("Argument %d to %s must be a non-negative integer, got %s", i+1, name, tok)
+		} else {
+			args = append(args, queryArg{num: n})
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, fmt.Errorf("%s in call to %s", err, name)
+	}
+	return &funcExpr{name: name, args: args}, nil
+}
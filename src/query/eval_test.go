@@ -0,0 +1,179 @@
+package query
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"core"
+)
+
+func TestEvalPattern(t *testing.T) {
+	graph := makeEvalGraph()
+	assert.Equal(t, []string{"//src/core:core"}, queryLabels(t, graph, "//src/core:core"))
+	assert.Equal(t, []string{"//src/core:core", "//src/core:core_test"}, queryLabels(t, graph, "//src/core:all"))
+	assert.Equal(t, []string{
+		"//src/core:core", "//src/core:core_test", "//src/query:query", "//src/query:query_test",
+	}, queryLabels(t, graph, "//src/..."))
+}
+
+func TestEvalSetOperations(t *testing.T) {
+	graph := makeEvalGraph()
+	assert.Equal(t, []string{"//src/core:core", "//third_party:lib"}, queryLabels(t, graph, "//src/core:core union //third_party:lib"))
+	assert.Equal(t, []string{"//src/core:core", "//third_party:lib"}, queryLabels(t, graph, "//src/core:core + //third_party:lib"))
+	assert.Equal(t, []string{"//src/core:core"}, queryLabels(t, graph, "//src/core:all intersect //src/core:core"))
+	assert.Equal(t, []string{"//src/core:core"}, queryLabels(t, graph, "//src/core:all ^ //src/core:core"))
+	assert.Equal(t, []string{"//src/core:core_test"}, queryLabels(t, graph, "//src/core:all except //src/core:core"))
+	assert.Equal(t, []string{"//src/core:core_test"}, queryLabels(t, graph, "//src/core:all - //src/core:core"))
+	// Operators are left-associative and of equal precedence.
+	assert.Equal(t, []string{"//src/core:core_test", "//third_party:lib"},
+		queryLabels(t, graph, "//src/core:all - //src/core:core + //third_party:lib"))
+	assert.Equal(t, []string{"//src/core:core_test"},
+		queryLabels(t, graph, "//src/core:all - (//src/core:core + //third_party:lib)"))
+}
+
+func TestEvalDeps(t *testing.T) {
+	graph := makeEvalGraph()
+	assert.Equal(t, []string{"//src/core:core", "//src/query:query", "//third_party:lib"}, queryLabels(t, graph, "deps(//src/query:query)"))
+	assert.Equal(t, []string{"//src/core:core", "//src/query:query"}, queryLabels(t, graph, "deps(//src/query:query, 1)"))
+	assert.Equal(t, []string{"//src/query:query"}, queryLabels(t, graph, "deps(//src/query:query, 0)"))
+}
+
+func TestEvalRdeps(t *testing.T) {
+	graph := makeEvalGraph()
+	assert.Equal(t, []string{"//src/core:core", "//src/core:core_test", "//src/query:query", "//src/query:query_test"},
+		queryLabels(t, graph, "rdeps(//src/..., //src/core:core)"))
+	assert.Equal(t, []string{"//src/core:core", "//src/core:core_test", "//src/query:query"},
+		queryLabels(t, graph, "rdeps(//src/..., //src/core:core, 1)"))
+	// Only things within the universe are considered.
+	assert.Equal(t, []string{"//src/core:core", "//src/core:core_test"},
+		queryLabels(t, graph, "rdeps(//src/core:all, //src/core:core)"))
+}
+
+func TestEvalFilters(t *testing.T) {
+	graph := makeEvalGraph()
+	assert.Equal(t, []string{"//src/core:core_test", "//src/query:query_test"}, queryLabels(t, graph, "tests(//...)"))
+	assert.Equal(t, []string{"//src/core:core", "//src/query:query"}, queryLabels(t, graph, "kind(go_library, //...)"))
+	assert.Equal(t, []string{"//src/core:core_test", "//src/query:query_test", "//third_party:lib"},
+		queryLabels(t, graph, "kind('_(test|get)$', //...)"))
+	assert.Equal(t, []string{"//third_party:lib"}, queryLabels(t, graph, "attr(labels, '^third_party$', //...)"))
+	assert.Equal(t, []string{"//src/query:query"}, queryLabels(t, graph, `attr(srcs, "eval\.go", //...)`))
+}
+
+func TestEvalLabels(t *testing.T) {
+	graph := makeEvalGraph()
+	assert.Equal(t, []string{"//src/core:core"}, queryLabels(t, graph, "labels(deps, //src/query:query)"))
+	assert.Equal(t, []string{"//src/core:core", "//src/query:query"}, queryLabels(t, graph, "labels(deps, tests(//...))"))
+}
+
+func TestEvalPaths(t *testing.T) {
+	graph := makeEvalGraph()
+	assert.Equal(t, []string{"//src/core:core", "//src/query:query", "//src/query:query_test", "//third_party:lib"},
+		queryLabels(t, graph, "somepath(//src/query:query_test, //third_party:lib)"))
+	assert.Equal(t, []string{}, queryLabels(t, graph, "somepath(//third_party:lib, //src/query:query_test)"))
+	assert.Equal(t, []string{"//src/core:core", "//src/query:query", "//src/query:query_test", "//third_party:lib"},
+		queryLabels(t, graph, "allpaths(//src/query:query_test, //third_party:lib)"))
+	assert.Equal(t, []string{"//src/core:core", "//src/core:core_test", "//src/query:query", "//src/query:query_test", "//third_party:lib"},
+		queryLabels(t, graph, "allpaths(tests(//...), //third_party:lib)"))
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"deps(",
+		"deps(//src/core:core",
+		"deps(//src/core:core, x)",
+		"deps(//src/core:core, 1, 2)",
+		"//src/core:core union",
+		"//src/core:core //src/query:query",
+		"kind('go_library, //src/...)",
+		"not a label",
+	} {
+		_, err := ParseQuery(query)
+		assert.Error(t, err, query)
+	}
+}
+
+func TestParseQueryLabels(t *testing.T) {
+	q, err := ParseQuery("rdeps(//src/..., kind(go_library, //src/core:all)) - //third_party:lib")
+	require.NoError(t, err)
+	assert.Equal(t, []core.BuildLabel{
+		core.ParseBuildLabel("//src/...", ""),
+		core.ParseBuildLabel("//src/core:all", ""),
+		core.ParseBuildLabel("//third_party:lib", ""),
+	}, q.Labels())
+}
+
+func TestEvalErrors(t *testing.T) {
+	graph := makeEvalGraph()
+	for _, query := range []string{
+		"//src/core:nope",
+		"//src/nope:all",
+		"attr(nope, x, //src/core:core)",
+		"labels(nope, //src/core:core)",
+		"kind('(', //src/core:core)",
+	} {
+		q, err := ParseQuery(query)
+		require.NoError(t, err)
+		_, err = evalQuery(graph, q)
+		assert.Error(t, err, query)
+	}
+}
+
+func TestPrintQueryResultsJSON(t *testing.T) {
+	graph := makeEvalGraph()
+	q, err := ParseQuery("tests(//src/...)")
+	require.NoError(t, err)
+	targets, err := evalQuery(graph, q)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, printQueryResults(&buf, graph, targets, "json"))
+	assert.Equal(t, "[\n    \"//src/core:core_test\",\n    \"//src/query:query_test\"\n]\n", buf.String())
+	assert.Error(t, printQueryResults(&buf, graph, targets, "wibble"))
+}
+
+func queryLabels(t *testing.T, graph *core.BuildGraph, query string) []string {
+	q, err := ParseQuery(query)
+	require.NoError(t, err)
+	targets, err := evalQuery(graph, q)
+	require.NoError(t, err)
+	ret := []string{}
+	for _, target := range targets {
+		ret = append(ret, target.Label.String())
+	}
+	return ret
+}
+
+func makeEvalGraph() *core.BuildGraph {
+	core.State = &core.BuildState{}
+	graph := core.NewGraph()
+	add := func(label, kind string, deps ...string) *core.BuildTarget {
+		target := core.NewBuildTarget(core.ParseBuildLabel(label, ""))
+		target.Kind = kind
+		target.IsTest = kind == "go_test"
+		pkg := graph.Package(target.Label.PackageName)
+		if pkg == nil {
+			pkg = core.NewPackage(target.Label.PackageName)
+			graph.AddPackage(pkg)
+		}
+		pkg.AddTarget(target)
+		graph.AddTarget(target)
+		for _, dep := range deps {
+			target.AddDependency(core.ParseBuildLabel(dep, ""))
+		}
+		return target
+	}
+	add("//third_party:lib", "go_get").Labels = []string{"third_party"}
+	add("//src/core:core", "go_library", "//third_party:lib")
+	add("//src/core:core_test", "go_test", "//src/core:core")
+	add("//src/query:query", "go_library", "//src/core:core").AddSource(core.FileLabel{File: "eval.go", Package: "src/query"})
+	add("//src/query:query_test", "go_test", "//src/query:query")
+	for _, target := range graph.AllTargets() {
+		for _, dep := range target.DeclaredDependencies() {
+			graph.AddDependency(target.Label, dep)
+		}
+	}
+	return graph
+}
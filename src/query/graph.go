@@ -4,6 +4,8 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math"
+	"os"
 	"path"
 	"sync"
 
@@ -11,17 +13,30 @@ import (
 	"core"
 )
 
-// Graph prints a representation of the build graph as JSON.
-func Graph(graph *core.BuildGraph, targets []core.BuildLabel) {
+// Graph prints a representation of the build graph in the given format (json, dot or graphml).
+// If targets are given, only they and their dependencies up to the given depth are included;
+// a negative depth includes all of them.
+// The dot and graphml formats can optionally collapse targets into their packages and
+// colour nodes by their kind or label.
+func Graph(graph *core.BuildGraph, targets []core.BuildLabel, format string, depth int, collapsePackages bool, colourBy string) {
 	log.Notice("Generating graph...")
-	g := makeJSONGraph(graph, targets)
-	log.Notice("Marshalling...")
-	b, err := json.MarshalIndent(g, "", "    ")
+	g := makeJSONGraphToDepth(graph, targets, depth)
+	log.Notice("Writing...")
+	var err error
+	switch format {
+	case "dot":
+		err = writeDotGraph(os.Stdout, makeRenderGraph(g, collapsePackages, colourBy))
+	case "graphml":
+		err = writeGraphML(os.Stdout, makeRenderGraph(g, collapsePackages, colourBy))
+	default:
+		var b []byte
+		if b, err = json.MarshalIndent(g, "", "    "); err == nil {
+			fmt.Println(string(b))
+		}
+	}
 	if err != nil {
-		log.Fatalf("Failed to serialise JSON: %s\n", err)
+		log.Fatalf("Failed to serialise graph: %s\n", err)
 	}
-	log.Notice("Writing...")
-	fmt.Println(string(b))
 	log.Notice("Done")
 }
 
@@ -46,6 +61,7 @@ type JSONTarget struct {
 	Data     []string `json:"data,omitempty" note:"corresponds to data in rule declaration"`
 	Labels   []string `json:"labels,omitempty" note:"corresponds to labels in rule declaration"`
 	Requires []string `json:"requires,omitempty" note:"corresponds to requires in rule declaration"`
+	Kind     string   `json:"kind,omitempty" note:"name of the rule that created the target"`
 	Hash     string   `json:"hash" note:"partial hash of target, does not include source hash"`
 	Test     bool     `json:"test,omitempty" note:"true if target is a test"`
 	Binary   bool     `json:"binary,omitempty" note:"true if target is a binary"`
@@ -53,15 +69,24 @@ type JSONTarget struct {
 }
 
 func makeJSONGraph(graph *core.BuildGraph, targets []core.BuildLabel) *JSONGraph {
+	return makeJSONGraphToDepth(graph, targets, -1)
+}
+
+// makeJSONGraphToDepth is like makeJSONGraph but only follows dependencies of the given targets
+// to the given depth. A negative depth follows them all.
+func makeJSONGraphToDepth(graph *core.BuildGraph, targets []core.BuildLabel, depth int) *JSONGraph {
 	ret := JSONGraph{Packages: map[string]JSONPackage{}}
 	if len(targets) == 0 {
 		for pkg := range makeAllPackages(graph) {
 			ret.Packages[pkg.name] = pkg
 		}
 	} else {
-		done := map[core.BuildLabel]struct{}{}
+		if depth < 0 {
+			depth = math.MaxInt32
+		}
+		done := map[core.BuildLabel]int{}
 		for _, target := range targets {
-			addJSONTarget(graph, &ret, target, done)
+			addJSONTarget(graph, &ret, target, depth, done)
 		}
 	}
 	return &ret
@@ -86,30 +111,36 @@ func makeAllPackages(graph *core.BuildGraph) <-chan JSONPackage {
 	return ch
 }
 
-func addJSONTarget(graph *core.BuildGraph, ret *JSONGraph, label core.BuildLabel, done map[core.BuildLabel]struct{}) {
-	if _, present := done[label]; present {
+// addJSONTarget adds a target and its dependencies up to the given depth to the graph.
+// done records the greatest remaining depth each target has been visited with, since one reached
+// via a longer path first may need revisiting to include more of its dependencies.
+func addJSONTarget(graph *core.BuildGraph, ret *JSONGraph, label core.BuildLabel, depth int, done map[core.BuildLabel]int) {
+	if d, present := done[label]; present && d >= depth {
 		return
 	}
-	done[label] = struct{}{}
+	done[label] = depth
 	if label.IsAllTargets() {
 		pkg := graph.PackageOrDie(label.PackageName)
 		for _, target := range pkg.AllTargets() {
-			addJSONTarget(graph, ret, target.Label, done)
+			addJSONTarget(graph, ret, target.Label, depth, done)
 		}
 		return
 	}
 	target := graph.TargetOrDie(label)
-	if _, present := ret.Packages[label.PackageName]; present {
-		ret.Packages[label.PackageName].Targets[label.Name] = makeJSONTarget(graph, target)
-	} else {
+	if pkg, present := ret.Packages[label.PackageName]; !present {
 		ret.Packages[label.PackageName] = JSONPackage{
 			Targets: map[string]JSONTarget{
 				label.Name: makeJSONTarget(graph, target),
 			},
 		}
+	} else if _, present := pkg.Targets[label.Name]; !present {
+		pkg.Targets[label.Name] = makeJSONTarget(graph, target)
+	}
+	if depth == 0 {
+		return
 	}
 	for _, dep := range target.Dependencies() {
-		addJSONTarget(graph, ret, dep.Label, done)
+		addJSONTarget(graph, ret, dep.Label, depth-1, done)
 	}
 }
 
@@ -139,6 +170,7 @@ func makeJSONTarget(graph *core.BuildGraph, target *core.BuildTarget) JSONTarget
 		t.Data = append(t.Data, data.Src)
 	}
 	t.Labels = target.Labels
+	t.Kind = target.Kind
 	t.Requires = target.Requires
 	rawHash := append(build.RuleHash(target, true, false), core.State.Hashes.Config...)
 	t.Hash = base64.RawStdEncoding.EncodeToString(rawHash)
@@ -0,0 +1,185 @@
+package query
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"core"
+)
+
+// nodeColours is the palette that nodes are coloured from (ColorBrewer's Set3).
+var nodeColours = []string{
+	"#8dd3c7", "#ffffb3", "#bebada", "#fb8072", "#80b1d3", "#fdb462",
+	"#b3de69", "#fccde5", "#d9d9d9", "#bc80bd", "#ccebc5", "#ffed6f",
+}
+
+// A renderGraph is a simplified form of the graph used for the dot and graphml formats.
+// Nodes and edges are sorted so the output is stable.
+type renderGraph struct {
+	Nodes []renderNode
+	Edges [][2]string
+}
+
+// A renderNode is a single node in a renderGraph; either a target or a package.
+type renderNode struct {
+	ID, Kind, Labels, Colour string
+}
+
+// makeRenderGraph converts a JSONGraph to a renderGraph.
+// If collapsePackages is true each package becomes a single node, otherwise each target does.
+// colourBy can be "kind" or "label" to colour target nodes by their kind or first label;
+// it has no effect when packages are collapsed.
+func makeRenderGraph(g *JSONGraph, collapsePackages bool, colourBy string) *renderGraph {
+	nodes := map[string]renderNode{}
+	edges := map[[2]string]struct{}{}
+	for pkgName, pkg := range g.Packages {
+		for name, target := range pkg.Targets {
+			label := core.NewBuildLabel(pkgName, name).String()
+			if collapsePackages {
+				label = "//" + pkgName
+				nodes[label] = renderNode{ID: label}
+			} else {
+				node := renderNode{ID: label, Kind: target.Kind, Labels: strings.Join(target.Labels, ",")}
+				if colourBy == "kind" {
+					node.Colour = nodeColour(target.Kind)
+				} else if colourBy == "label" && len(target.Labels) > 0 {
+					node.Colour = nodeColour(target.Labels[0])
+				}
+				nodes[label] = node
+			}
+			for _, dep := range target.Deps {
+				edges[[2]string{label, dep}] = struct{}{}
+			}
+		}
+	}
+	ret := &renderGraph{}
+	for _, node := range nodes {
+		ret.Nodes = append(ret.Nodes, node)
+	}
+	sort.Slice(ret.Nodes, func(i, j int) bool { return ret.Nodes[i].ID < ret.Nodes[j].ID })
+	for edge := range edges {
+		if collapsePackages {
+			edge[1] = "//" + core.ParseBuildLabel(edge[1], "").PackageName
+		}
+		// Edges to things outside the graph (i.e. beyond the requested depth) are dropped,
+		// as are those within a single package once it's been collapsed.
+		if _, present := nodes[edge[1]]; present && edge[0] != edge[1] {
+			ret.Edges = append(ret.Edges, edge)
+		}
+	}
+	// Collapsing packages can create duplicate edges, which sort adjacent to one another.
+	sort.Slice(ret.Edges, func(i, j int) bool {
+		if ret.Edges[i][0] != ret.Edges[j][0] {
+			return ret.Edges[i][0] < ret.Edges[j][0]
+		}
+		return ret.Edges[i][1] < ret.Edges[j][1]
+	})
+	for i := len(ret.Edges) - 1; i > 0; i-- {
+		if ret.Edges[i] == ret.Edges[i-1] {
+			ret.Edges = append(ret.Edges[:i], ret.Edges[i+1:]...)
+		}
+	}
+	return ret
+}
+
+// nodeColour picks a colour for the given key. The same key always gets the same colour.
+func nodeColour(key string) string {
+	if key == "" {
+		return ""
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return nodeColours[h.Sum32()%uint32(len(nodeColours))]
+}
+
+// writeDotGraph writes the graph in Graphviz's DOT format.
+func writeDotGraph(w io.Writer, g *renderGraph) error {
+	var b bytes.Buffer
+	b.WriteString("digraph please {\n    node [shape=box];\n")
+	for _, node := range g.Nodes {
+		if node.Colour != "" {
+			fmt.Fprintf(&b, "    %s [style=filled, fillcolor=%s];\n", strconv.Quote(node.ID), strconv.Quote(node.Colour))
+		} else {
+			fmt.Fprintf(&b, "    %s;\n", strconv.Quote(node.ID))
+		}
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "    %s -> %s;\n", strconv.Quote(edge[0]), strconv.Quote(edge[1]))
+	}
+	b.WriteString("}\n")
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// These types describe the parts of the GraphML format that we emit.
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLEdge struct {
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+}
+
+// writeGraphML writes the graph in GraphML format. Kinds, labels and colours are written as node data.
+func writeGraphML(w io.Writer, g *renderGraph) error {
+	ml := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "kind", For: "node", Name: "kind", Type: "string"},
+			{ID: "labels", For: "node", Name: "labels", Type: "string"},
+			{ID: "colour", For: "node", Name: "color", Type: "string"},
+		},
+	}
+	ml.Graph.ID = "please"
+	ml.Graph.EdgeDefault = "directed"
+	for _, node := range g.Nodes {
+		n := graphMLNode{ID: node.ID}
+		for _, data := range []graphMLData{{"kind", node.Kind}, {"labels", node.Labels}, {"colour", node.Colour}} {
+			if data.Value != "" {
+				n.Data = append(n.Data, data)
+			}
+		}
+		ml.Graph.Nodes = append(ml.Graph.Nodes, n)
+	}
+	for _, edge := range g.Edges {
+		ml.Graph.Edges = append(ml.Graph.Edges, graphMLEdge{Source: edge[0], Target: edge[1]})
+	}
+	b, err := xml.MarshalIndent(ml, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, b)
+	return err
+}
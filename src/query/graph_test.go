@@ -1,6 +1,7 @@
 package query
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -37,6 +38,84 @@ func TestQueryPackage(t *testing.T) {
 	assert.Equal(t, []string{"//package1:target1"}, pkg1.Targets["target2"].Deps)
 }
 
+func TestQueryDepth(t *testing.T) {
+	target3 := []core.BuildLabel{core.ParseBuildLabel("//package2:target3", "")}
+	graph := makeJSONGraphToDepth(makeGraph(), target3, 0)
+	assert.Equal(t, 1, len(graph.Packages))
+	graph = makeJSONGraphToDepth(makeGraph(), target3, 1)
+	assert.Equal(t, 2, len(graph.Packages))
+	assert.Equal(t, 1, len(graph.Packages["package1"].Targets))
+	graph = makeJSONGraphToDepth(makeGraph(), target3, -1)
+	assert.Equal(t, 2, len(graph.Packages["package1"].Targets))
+}
+
+func TestQueryDepthRevisitsTargets(t *testing.T) {
+	// target2 is first reached via target3 with no depth remaining, but should still have its
+	// dependency included when it's requested directly.
+	graph := makeJSONGraphToDepth(makeGraph(), []core.BuildLabel{
+		core.ParseBuildLabel("//package2:target3", ""),
+		core.ParseBuildLabel("//package1:target2", ""),
+	}, 1)
+	assert.Equal(t, 2, len(graph.Packages["package1"].Targets))
+}
+
+func TestDotGraph(t *testing.T) {
+	graph := makeJSONGraphToDepth(makeGraph(), []core.BuildLabel{core.ParseBuildLabel("//package2:target3", "")}, 1)
+	var buf bytes.Buffer
+	assert.NoError(t, writeDotGraph(&buf, makeRenderGraph(graph, false, "")))
+	// target1 is beyond the requested depth so there's no edge to it.
+	assert.Equal(t, `digraph please {
+    node [shape=box];
+    "//package1:target2";
+    "//package2:target3";
+    "//package2:target3" -> "//package1:target2";
+}
+`, buf.String())
+}
+
+func TestDotGraphColours(t *testing.T) {
+	graph := makeJSONGraph(makeGraph(), nil)
+	graph.Packages["package1"].Targets["target1"] = JSONTarget{Kind: "go_library"}
+	rg := makeRenderGraph(graph, false, "kind")
+	assert.Equal(t, "//package1:target1", rg.Nodes[0].ID)
+	assert.Equal(t, nodeColour("go_library"), rg.Nodes[0].Colour)
+	assert.Equal(t, "", rg.Nodes[1].Colour)
+	var buf bytes.Buffer
+	assert.NoError(t, writeDotGraph(&buf, rg))
+	assert.Contains(t, buf.String(), `"//package1:target1" [style=filled, fillcolor="`+nodeColour("go_library")+`"];`)
+}
+
+func TestCollapsePackages(t *testing.T) {
+	rg := makeRenderGraph(makeJSONGraph(makeGraph(), nil), true, "kind")
+	assert.Equal(t, []renderNode{{ID: "//package1"}, {ID: "//package2"}}, rg.Nodes)
+	// The edge between the two targets in package1 disappears.
+	assert.Equal(t, [][2]string{{"//package2", "//package1"}}, rg.Edges)
+}
+
+func TestGraphML(t *testing.T) {
+	graph := makeJSONGraph(makeGraph(), nil)
+	graph.Packages["package1"].Targets["target1"] = JSONTarget{Kind: "go_library", Labels: []string{"a", "b"}}
+	var buf bytes.Buffer
+	assert.NoError(t, writeGraphML(&buf, makeRenderGraph(graph, false, "")))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+    <key id="kind" for="node" attr.name="kind" attr.type="string"></key>
+    <key id="labels" for="node" attr.name="labels" attr.type="string"></key>
+    <key id="colour" for="node" attr.name="color" attr.type="string"></key>
+    <graph id="please" edgedefault="directed">
+        <node id="//package1:target1">
+            <data key="kind">go_library</data>
+            <data key="labels">a,b</data>
+        </node>
+        <node id="//package1:target2"></node>
+        <node id="//package2:target3"></node>
+        <edge source="//package1:target2" target="//package1:target1"></edge>
+        <edge source="//package2:target3" target="//package1:target2"></edge>
+    </graph>
+</graphml>
+`, buf.String())
+}
+
 func makeGraph() *core.BuildGraph {
 	core.State = &core.BuildState{}
 	graph := core.NewGraph()
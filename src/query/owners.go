@@ -0,0 +1,41 @@
+package query
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"core"
+)
+
+// Owners prints the owners of each of the given build labels or files, which are those of the
+// closest package or directory above them that declares any.
+// It returns false if any of them aren't valid build labels.
+func Owners(graph *core.BuildGraph, args []string) bool {
+	success := true
+	for _, arg := range args {
+		if owners, err := ownersOf(graph, arg); err != nil {
+			log.Error("%s", err)
+			success = false
+		} else if len(owners) > 0 {
+			fmt.Printf("%s %s\n", arg, strings.Join(owners, " "))
+		} else {
+			log.Warning("%s has no owners", arg)
+		}
+	}
+	return success
+}
+
+// ownersOf returns the owners of a single build label or file.
+func ownersOf(graph *core.BuildGraph, arg string) ([]string, error) {
+	if core.LooksLikeABuildLabel(arg) {
+		label, err := core.TryParseBuildLabel(arg, "")
+		if err != nil {
+			return nil, err
+		}
+		return graph.Owners(label.PackageName), nil
+	} else if core.PathExists(arg) && !core.FileExists(arg) {
+		return graph.Owners(arg), nil
+	}
+	return graph.Owners(path.Dir(arg)), nil
+}
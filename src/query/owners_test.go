@@ -0,0 +1,32 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"core"
+)
+
+func TestOwnersOf(t *testing.T) {
+	graph := core.NewGraph()
+	pkg := core.NewPackage("src/query")
+	pkg.Owners = []string{"alice", "bob"}
+	graph.AddPackage(pkg)
+	assertOwners(t, graph, []string{"alice", "bob"}, "//src/query:query")
+	assertOwners(t, graph, []string{"alice", "bob"}, "//src/query/...")
+	assertOwners(t, graph, []string{"alice", "bob"}, "src/query/owners.go")
+	assertOwners(t, graph, nil, "src/core/owners.go")
+}
+
+func TestOwnersOfInvalidLabel(t *testing.T) {
+	_, err := ownersOf(core.NewGraph(), "//src/query:query:query")
+	assert.Error(t, err)
+	assert.False(t, Owners(core.NewGraph(), []string{"//src/query:query:query"}))
+}
+
+func assertOwners(t *testing.T, graph *core.BuildGraph, expected []string, arg string) {
+	owners, err := ownersOf(graph, arg)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, owners)
+}
@@ -21,6 +21,8 @@
 //             that are output by this rule.
 //   'graph': 'plz query graph' produces a JSON representation of the build graph
 //            that other programs can interpret for their own uses.
+//   'changes': 'plz query changes --since=master' produces a list of targets whose
+//              build inputs have changed since the given git revision.
 package query
 
 import "gopkg.in/op/go-logging.v1"
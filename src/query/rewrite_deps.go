@@ -0,0 +1,53 @@
+package query
+
+import (
+	"sort"
+
+	"core"
+	"edit"
+)
+
+// fixDeps rewrites BUILD files to remove unused dependencies and add missing ones.
+// Targets that can't be found (e.g. because they're created by a macro) are skipped with a warning.
+func fixDeps(graph *core.BuildGraph, reports []*depsReport) error {
+	files := map[string][]*depsReport{}
+	for _, report := range reports {
+		filename := graph.PackageOrDie(report.Target.Label.PackageName).Filename
+		files[filename] = append(files[filename], report)
+	}
+	filenames := make([]string, 0, len(files))
+	for filename := range files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		log.Notice("Rewriting dependencies in %s...", filename)
+		if err := rewriteDeps(filename, files[filename]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteDeps rewrites the dependencies of the targets in a single BUILD file.
+func rewriteDeps(filename string, reports []*depsReport) error {
+	pkgName := reports[0].Target.Label.PackageName
+	f, err := edit.Open(filename, pkgName)
+	if err != nil {
+		return err
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Target.Label.Name < reports[j].Target.Label.Name })
+	for _, report := range reports {
+		name := report.Target.Label.Name
+		add := make([]core.BuildLabel, len(report.Missing))
+		for i, missing := range report.Missing {
+			add[i] = missing.Label
+		}
+		if !f.HasTarget(name) {
+			log.Warning("Can't find target %s in %s; it may be created by a macro", name, filename)
+		} else if err := f.EditList(name, "deps", edit.Labels(report.Unused, pkgName), edit.Labels(add, pkgName)); err != nil {
+			log.Warning("Can't rewrite dependencies of %s in %s: %s", name, filename, err)
+		}
+	}
+	return f.Save()
+}
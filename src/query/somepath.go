@@ -45,19 +45,39 @@ func querySomePath2(graph *core.BuildGraph, target1, target2 *core.BuildTarget,
 	return true
 }
 
-// This is just a simple DFS through the graph.
+// printSomePath prints a path from target1 to target2, if there is one.
 func printSomePath(graph *core.BuildGraph, target1, target2 *core.BuildTarget) bool {
-	if target1 == target2 {
-		fmt.Printf("Found path:\n  %s\n", target1.Label)
-		return true
+	path := FindPath(graph, target1, target2)
+	if path == nil {
+		return false
 	}
-	for _, target := range graph.ReverseDependencies(target2) {
-		if printSomePath(graph, target1, target) {
-			if target2.Parent(graph) != target {
-				fmt.Printf("  %s\n", target2.Label)
-			}
-			return true
+	fmt.Printf("Found path:\n")
+	for i, target := range path {
+		if i == 0 || target.Parent(graph) != path[i-1] {
+			fmt.Printf("  %s\n", target.Label)
+		}
+	}
+	return true
+}
+
+// FindPath returns a dependency path from one target to another (both inclusive),
+// or nil if the first doesn't depend on the second.
+func FindPath(graph *core.BuildGraph, from, to *core.BuildTarget) []*core.BuildTarget {
+	return findPath(graph, from, to, map[*core.BuildTarget]bool{})
+}
+
+// findPath implements FindPath. This is just a simple DFS up through the graph from the end of the path.
+func findPath(graph *core.BuildGraph, from, to *core.BuildTarget, seen map[*core.BuildTarget]bool) []*core.BuildTarget {
+	if from == to {
+		return []*core.BuildTarget{from}
+	} else if seen[to] {
+		return nil
+	}
+	seen[to] = true
+	for _, target := range graph.ReverseDependencies(to) {
+		if path := findPath(graph, from, target, seen); path != nil {
+			return append(path, to)
 		}
 	}
-	return false
+	return nil
 }
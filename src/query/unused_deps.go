@@ -0,0 +1,210 @@
+// Detection of unused dependencies, and of imports only satisfied by transitive dependencies.
+//
+// Imports are read from the sources of each target and matched against the import paths
+// that the outputs of its dependencies provide; see the imports package for details.
+
+package query
+
+import (
+	"fmt"
+	"sort"
+
+	"core"
+	"imports"
+)
+
+// A depsReport describes the problems found with a single target's dependencies.
+type depsReport struct {
+	Target *core.BuildTarget
+	// Declared dependencies that nothing imports.
+	Unused []core.BuildLabel
+	// Transitive dependencies that are imported directly.
+	Missing []missingDep
+}
+
+// A missingDep is a transitive dependency that should be declared directly.
+type missingDep struct {
+	Label  core.BuildLabel
+	Import string
+}
+
+// UnusedDeps prints any dependencies of the given targets that none of their sources import,
+// and any imports that are only satisfied by transitive dependencies.
+// If fix is true, it rewrites the BUILD files to remove the former and add the latter.
+// The targets must have been built already. It returns true if no problems were found
+// (or if they were all fixed successfully).
+func UnusedDeps(graph *core.BuildGraph, labels []core.BuildLabel, fix bool) bool {
+	checker := newDepsChecker(graph)
+	reports := []*depsReport{}
+	for _, label := range labels {
+		if target := graph.TargetOrDie(label); !target.HasParent() {
+			report, err := checker.Check(target)
+			if err != nil {
+				log.Fatalf("Failed to check dependencies of %s: %s", label, err)
+			} else if report != nil {
+				reports = append(reports, report)
+			}
+		}
+	}
+	for _, report := range reports {
+		for _, unused := range report.Unused {
+			fmt.Printf("%s: unused dependency %s\n", report.Target.Label, unused)
+		}
+		for _, missing := range report.Missing {
+			fmt.Printf("%s: %s is imported directly (%s) but is only a transitive dependency\n", report.Target.Label, missing.Label, missing.Import)
+		}
+	}
+	if !fix || len(reports) == 0 {
+		return len(reports) == 0
+	}
+	if err := fixDeps(graph, reports); err != nil {
+		log.Error("Failed to rewrite BUILD files: %s", err)
+		return false
+	}
+	return true
+}
+
+// A depsChecker checks dependencies of targets.
+type depsChecker struct {
+	graph    *core.BuildGraph
+	resolver *imports.Resolver
+}
+
+func newDepsChecker(graph *core.BuildGraph) *depsChecker {
+	return &depsChecker{graph: graph, resolver: imports.NewResolver()}
+}
+
+// Check checks a single target (including its hidden children) and returns a report,
+// or nil if there's nothing wrong with it.
+func (c *depsChecker) Check(target *core.BuildTarget) (*depsReport, error) {
+	children := c.graph.PackageOrDie(target.Label.PackageName).AllChildren(target)
+	imps, lang, err := c.imports(children)
+	if err != nil || lang == nil {
+		return nil, err
+	}
+	// Imports of things the target provides itself (e.g. other files in the same library) aren't interesting.
+	own := map[string]struct{}{}
+	for _, child := range children {
+		for p := range c.resolver.Provides(lang, child) {
+			own[p] = struct{}{}
+		}
+	}
+	imps = imports.Unsatisfied(imps, own)
+
+	report := &depsReport{Target: target}
+	missing := imps
+	for _, label := range declaredDeps(target, children) {
+		provided := map[string]struct{}{}
+		for _, child := range children {
+			for _, dep := range c.exportedClosure(child.DependenciesFor(label)) {
+				for p := range c.resolver.Provides(lang, dep) {
+					provided[p] = struct{}{}
+				}
+			}
+		}
+		// If it doesn't provide anything we understand we can't tell if it's used or not.
+		if len(provided) > 0 && len(imports.Unsatisfied(imps, provided)) == len(imps) {
+			report.Unused = append(report.Unused, label)
+		}
+		missing = imports.Unsatisfied(missing, provided)
+	}
+	report.Missing = c.findTransitive(lang, target, children, missing)
+	if len(report.Unused) == 0 && len(report.Missing) == 0 {
+		return nil, nil
+	}
+	return report, nil
+}
+
+// imports returns all the imports of the given targets' sources, and the language they're in.
+// It returns a nil language if there are no sources in any language we understand.
+func (c *depsChecker) imports(targets []*core.BuildTarget) ([]imports.Import, *imports.Language, error) {
+	var lang *imports.Language
+	ret := []imports.Import{}
+	done := map[string]bool{}
+	for _, target := range targets {
+		for _, src := range target.AllFullSourcePaths(c.graph) {
+			if l := imports.ForFile(src); l != nil && !done[src] {
+				done[src] = true
+				imps, err := l.Imports(src)
+				if err != nil {
+					return nil, nil, err
+				}
+				ret = append(ret, imps...)
+				lang = l
+			}
+		}
+	}
+	return ret, lang, nil
+}
+
+// declaredDeps returns the dependencies declared by a target & its children, excluding
+// any that are internal to it.
+func declaredDeps(target *core.BuildTarget, children []*core.BuildTarget) []core.BuildLabel {
+	ret := core.BuildLabels{}
+	done := map[core.BuildLabel]bool{}
+	for _, child := range children {
+		for _, dep := range child.DeclaredDependenciesStrict() {
+			if dep.Parent() != target.Label && !done[dep] {
+				done[dep] = true
+				ret = append(ret, dep)
+			}
+		}
+	}
+	sort.Sort(ret)
+	return ret
+}
+
+// exportedClosure returns the given targets plus any they transitively export.
+func (c *depsChecker) exportedClosure(targets []*core.BuildTarget) []*core.BuildTarget {
+	ret := append([]*core.BuildTarget{}, targets...)
+	for _, target := range targets {
+		for _, exported := range target.ExportedDependencies() {
+			if t := c.graph.Target(exported); t != nil {
+				ret = append(ret, c.exportedClosure([]*core.BuildTarget{t})...)
+			}
+		}
+	}
+	return ret
+}
+
+// findTransitive finds the transitive dependencies that satisfy any of the given imports.
+// It searches breadth-first so the nearest dependency is chosen if several would satisfy one.
+func (c *depsChecker) findTransitive(lang *imports.Language, target *core.BuildTarget, children []*core.BuildTarget, imps []imports.Import) []missingDep {
+	ret := []missingDep{}
+	reported := map[core.BuildLabel]bool{}
+	done := map[*core.BuildTarget]bool{}
+	queue := []*core.BuildTarget{}
+	for _, child := range children {
+		done[child] = true
+		queue = append(queue, child.Dependencies()...)
+	}
+	for len(queue) > 0 && len(imps) > 0 {
+		dep := queue[0]
+		queue = queue[1:]
+		if done[dep] {
+			continue
+		}
+		done[dep] = true
+		queue = append(queue, dep.Dependencies()...)
+		if dep.Label.Parent() == target.Label {
+			continue
+		}
+		provided := c.resolver.Provides(lang, dep)
+		remaining := []imports.Import{}
+		var satisfied imports.Import
+		for _, imp := range imps {
+			if imports.Unsatisfied([]imports.Import{imp}, provided) != nil {
+				remaining = append(remaining, imp)
+			} else if satisfied == nil {
+				satisfied = imp
+			}
+		}
+		// Only one import is reported for each dependency; there's no need to list all of them.
+		if label := dep.Label.Parent(); satisfied != nil && !reported[label] {
+			reported[label] = true
+			ret = append(ret, missingDep{Label: label, Import: satisfied[0]})
+		}
+		imps = remaining
+	}
+	return ret
+}
@@ -0,0 +1,119 @@
+package query
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"core"
+)
+
+func TestUnusedDepsGo(t *testing.T) {
+	defer inTempDir(t)()
+	graph := core.NewGraph()
+	addDepsTarget(graph, "//lib/a:a", []string{"a.a"}, nil)
+	addDepsTarget(graph, "//lib/b:b", []string{"b.a"}, nil, "//lib/a:a")
+	addDepsTarget(graph, "//lib/unused:unused", []string{"unused.a"}, nil)
+	addDepsTarget(graph, "//lib/data:data", []string{"data.txt"}, nil)
+	writeFile(t, "app/main.go", "package main\n\nimport (\n\t\"fmt\"\n\n\t\"lib/a\"\n\t\"lib/b\"\n)\n")
+	app := addDepsTarget(graph, "//app:app", []string{"app.a"}, []string{"main.go"}, "//lib/b:b", "//lib/unused:unused", "//lib/data:data")
+	resolveDepsGraph(graph)
+
+	report, err := newDepsChecker(graph).Check(app)
+	require.NoError(t, err)
+	require.NotNil(t, report)
+	// lib/data isn't reported since we can't tell whether it's used or not.
+	assert.Equal(t, []core.BuildLabel{core.ParseBuildLabel("//lib/unused:unused", "")}, report.Unused)
+	assert.Equal(t, []missingDep{{Label: core.ParseBuildLabel("//lib/a:a", ""), Import: "lib/a"}}, report.Missing)
+}
+
+func TestUnusedDepsNoProblems(t *testing.T) {
+	defer inTempDir(t)()
+	graph := core.NewGraph()
+	addDepsTarget(graph, "//lib/a:a", []string{"a.a"}, nil)
+	writeFile(t, "app/main.go", "package main\n\nimport \"lib/a\"\n")
+	writeFile(t, "app/util.go", "package main\n\nimport \"app\"\n")
+	app := addDepsTarget(graph, "//app:app", []string{"app.a"}, []string{"main.go", "util.go"}, "//lib/a:a")
+	resolveDepsGraph(graph)
+
+	report, err := newDepsChecker(graph).Check(app)
+	assert.NoError(t, err)
+	assert.Nil(t, report)
+}
+
+func TestUnusedDepsPython(t *testing.T) {
+	defer inTempDir(t)()
+	graph := core.NewGraph()
+	writeFile(t, "plz-out/gen/third_party/python/six/__init__.py", "")
+	writeFile(t, "plz-out/gen/lib/strings.py", "")
+	writeFile(t, "plz-out/gen/lib/unused.py", "")
+	addDepsTarget(graph, "//third_party/python:six", []string{"six"}, nil)
+	addDepsTarget(graph, "//lib:strings", []string{"strings.py"}, nil)
+	addDepsTarget(graph, "//lib:unused", []string{"unused.py"}, nil)
+	writeFile(t, "app/main.py", "import os\nimport six\nfrom lib import strings\nfrom . import sibling\n")
+	app := addDepsTarget(graph, "//app:app", nil, []string{"main.py"}, "//lib:strings", "//lib:unused", "//third_party/python:six")
+	resolveDepsGraph(graph)
+
+	report, err := newDepsChecker(graph).Check(app)
+	require.NoError(t, err)
+	require.NotNil(t, report)
+	assert.Equal(t, []core.BuildLabel{core.ParseBuildLabel("//lib:unused", "")}, report.Unused)
+	assert.Equal(t, []missingDep{}, report.Missing)
+}
+
+// inTempDir changes to a new temporary directory and returns a function to change back & clean it up.
+func inTempDir(t *testing.T) func() {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "unused_deps_test")
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	return func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+func writeFile(t *testing.T, filename, contents string) {
+	require.NoError(t, os.MkdirAll(path.Dir(filename), core.DirPermissions))
+	require.NoError(t, ioutil.WriteFile(filename, []byte(contents), 0644))
+}
+
+// addDepsTarget adds a target to the graph. Any .a outputs are created as files.
+func addDepsTarget(graph *core.BuildGraph, label string, outs, srcs []string, deps ...string) *core.BuildTarget {
+	target := core.NewBuildTarget(core.ParseBuildLabel(label, ""))
+	for _, out := range outs {
+		target.AddOutput(out)
+		if path.Ext(out) == ".a" {
+			filename := path.Join(target.OutDir(), out)
+			os.MkdirAll(path.Dir(filename), core.DirPermissions)
+			ioutil.WriteFile(filename, nil, 0644)
+		}
+	}
+	for _, src := range srcs {
+		target.AddSource(core.FileLabel{File: src, Package: target.Label.PackageName})
+	}
+	for _, dep := range deps {
+		target.AddDependency(core.ParseBuildLabel(dep, ""))
+	}
+	pkg := graph.Package(target.Label.PackageName)
+	if pkg == nil {
+		pkg = core.NewPackage(target.Label.PackageName)
+		graph.AddPackage(pkg)
+	}
+	pkg.AddTarget(target)
+	graph.AddTarget(target)
+	return target
+}
+
+func resolveDepsGraph(graph *core.BuildGraph) {
+	for _, target := range graph.AllTargets() {
+		for _, dep := range target.DeclaredDependencies() {
+			graph.AddDependency(target.Label, dep)
+		}
+	}
+}
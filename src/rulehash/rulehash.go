@@ -0,0 +1,30 @@
+// Package rulehash calculates the hashes that Please gives the outputs of rules, so tools that
+// generate rules (e.g. please_maven and please_pypi) can add hashes to them that match.
+package rulehash
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+)
+
+// Contents returns the hash that Please would calculate for a rule that outputs only a file
+// with the given contents (which is a SHA-1 of its SHA-1).
+func Contents(b []byte) string {
+	h := sha1.Sum(b)
+	return fromSHA1(h[:])
+}
+
+// FromSHA1 returns the hash that Please would calculate for a rule that outputs only a file
+// with the given hex-encoded SHA-1, or the empty string if it isn't one.
+func FromSHA1(sha1Hash string) string {
+	b, err := hex.DecodeString(sha1Hash)
+	if err != nil || len(b) != sha1.Size {
+		return ""
+	}
+	return fromSHA1(b)
+}
+
+func fromSHA1(b []byte) string {
+	h := sha1.Sum(b)
+	return hex.EncodeToString(h[:])
+}
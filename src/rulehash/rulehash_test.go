@@ -0,0 +1,17 @@
+package rulehash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContents(t *testing.T) {
+	assert.Equal(t, "be1bdec0aa74b4dcb079943e70528096cca985f8", Contents([]byte{}))
+}
+
+func TestFromSHA1(t *testing.T) {
+	assert.Equal(t, "be1bdec0aa74b4dcb079943e70528096cca985f8", FromSHA1("da39a3ee5e6b4b0d3255bfef95601890afd80709"))
+	assert.Equal(t, "", FromSHA1(""))
+	assert.Equal(t, "", FromSHA1("nope"))
+}
@@ -0,0 +1,109 @@
+// Code for recording benchmark results and comparing them to previous runs.
+
+package test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"core"
+)
+
+// A BenchmarkRegression describes a benchmark that got worse compared to a previous run.
+type BenchmarkRegression struct {
+	Label    string
+	Previous core.BenchmarkResult
+	Current  core.BenchmarkResult
+}
+
+// Slowdown returns the percentage by which the benchmark slowed down.
+func (regression BenchmarkRegression) Slowdown() float64 {
+	if regression.Previous.NsPerOp == 0 {
+		return 0
+	}
+	return 100.0 * (regression.Current.NsPerOp - regression.Previous.NsPerOp) / regression.Previous.NsPerOp
+}
+
+// LoadBenchmarks loads the benchmark results written by a previous run, keyed by build label.
+// It returns nil if there aren't any.
+func LoadBenchmarks(filename string) map[string][]core.BenchmarkResult {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warning("Failed to read previous benchmark results: %s", err)
+		}
+		return nil
+	}
+	benchmarks := map[string][]core.BenchmarkResult{}
+	if err := json.Unmarshal(b, &benchmarks); err != nil {
+		log.Warning("Failed to parse previous benchmark results from %s: %s", filename, err)
+		return nil
+	}
+	return benchmarks
+}
+
+// WriteBenchmarksToFileOrDie writes the results of all benchmarks run in this build to a file,
+// along with the previous results of any targets that weren't run this time.
+func WriteBenchmarksToFileOrDie(graph *core.BuildGraph, previous map[string][]core.BenchmarkResult, filename string) {
+	benchmarks := currentBenchmarks(graph)
+	for label, results := range previous {
+		if _, present := benchmarks[label]; !present {
+			benchmarks[label] = results
+		}
+	}
+	if b, err := json.MarshalIndent(benchmarks, "", "    "); err != nil {
+		log.Fatalf("Failed to encode json: %s", err)
+	} else if err := ioutil.WriteFile(filename, b, 0644); err != nil {
+		log.Fatalf("Failed to write benchmark results to %s: %s", filename, err)
+	}
+}
+
+// CompareBenchmarks compares the benchmarks run in this build to the previous results.
+// It returns any that are slower by more than the given threshold (a percentage) or that
+// now make more allocations per op.
+func CompareBenchmarks(graph *core.BuildGraph, previous map[string][]core.BenchmarkResult, threshold float64) []BenchmarkRegression {
+	regressions := []BenchmarkRegression{}
+	for label, results := range currentBenchmarks(graph) {
+		before := bestBenchmarks(previous[label])
+		for name, current := range bestBenchmarks(results) {
+			if prev, present := before[name]; present {
+				regression := BenchmarkRegression{Label: label, Previous: prev, Current: current}
+				if regression.Slowdown() > threshold || current.AllocsPerOp > prev.AllocsPerOp {
+					regressions = append(regressions, regression)
+				}
+			}
+		}
+	}
+	sort.Slice(regressions, func(i, j int) bool {
+		if regressions[i].Label != regressions[j].Label {
+			return regressions[i].Label < regressions[j].Label
+		}
+		return regressions[i].Current.Name < regressions[j].Current.Name
+	})
+	return regressions
+}
+
+// currentBenchmarks returns the results of all the benchmarks run in this build, keyed by build label.
+func currentBenchmarks(graph *core.BuildGraph) map[string][]core.BenchmarkResult {
+	benchmarks := map[string][]core.BenchmarkResult{}
+	for _, target := range graph.AllTargets() {
+		if len(target.Results.Benchmarks) > 0 {
+			benchmarks[target.Label.String()] = target.Results.Benchmarks
+		}
+	}
+	return benchmarks
+}
+
+// bestBenchmarks returns the fastest result of each benchmark, since they may have been run
+// multiple times. The fastest is the least affected by noise from anything else running.
+func bestBenchmarks(results []core.BenchmarkResult) map[string]core.BenchmarkResult {
+	best := make(map[string]core.BenchmarkResult, len(results))
+	for _, result := range results {
+		if existing, present := best[result.Name]; !present || result.NsPerOp < existing.NsPerOp {
+			best[result.Name] = result
+		}
+	}
+	return best
+}
@@ -0,0 +1,62 @@
+package test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"core"
+)
+
+func TestCompareBenchmarks(t *testing.T) {
+	graph := core.NewGraph()
+	graph.AddTarget(benchmarkTarget("//src/core:core_test",
+		core.BenchmarkResult{Name: "BenchmarkFast", NsPerOp: 100},
+		core.BenchmarkResult{Name: "BenchmarkSlow", NsPerOp: 130},
+		core.BenchmarkResult{Name: "BenchmarkSlow", NsPerOp: 115}, // Second run, the fastest is used.
+		core.BenchmarkResult{Name: "BenchmarkAllocs", NsPerOp: 100, AllocsPerOp: 2},
+		core.BenchmarkResult{Name: "BenchmarkNew", NsPerOp: 1000},
+	))
+	previous := map[string][]core.BenchmarkResult{
+		"//src/core:core_test": {
+			{Name: "BenchmarkFast", NsPerOp: 120},
+			{Name: "BenchmarkSlow", NsPerOp: 100},
+			{Name: "BenchmarkAllocs", NsPerOp: 100, AllocsPerOp: 1},
+		},
+	}
+	regressions := CompareBenchmarks(graph, previous, 10)
+	assert.Equal(t, 2, len(regressions))
+	assert.Equal(t, "BenchmarkAllocs", regressions[0].Current.Name)
+	assert.Equal(t, "BenchmarkSlow", regressions[1].Current.Name)
+	assert.Equal(t, "//src/core:core_test", regressions[1].Label)
+	assert.InDelta(t, 15.0, regressions[1].Slowdown(), 0.001)
+	// It's within the threshold if we're more tolerant.
+	assert.Equal(t, 1, len(CompareBenchmarks(graph, previous, 20)))
+	assert.Equal(t, 0, len(CompareBenchmarks(graph, nil, 10)))
+}
+
+func TestWriteAndLoadBenchmarks(t *testing.T) {
+	graph := core.NewGraph()
+	graph.AddTarget(benchmarkTarget("//src/core:core_test", core.BenchmarkResult{Name: "BenchmarkFast", NsPerOp: 100}))
+	filename := path.Join(os.TempDir(), "benchmarks.json")
+	defer os.Remove(filename)
+	assert.Nil(t, LoadBenchmarks(filename))
+	previous := map[string][]core.BenchmarkResult{
+		"//src/core:core_test":   {{Name: "BenchmarkFast", NsPerOp: 120}},
+		"//src/build:build_test": {{Name: "BenchmarkBuild", NsPerOp: 5000, BytesPerOp: 64}},
+	}
+	WriteBenchmarksToFileOrDie(graph, previous, filename)
+	assert.Equal(t, map[string][]core.BenchmarkResult{
+		"//src/core:core_test":   {{Name: "BenchmarkFast", NsPerOp: 100}},
+		"//src/build:build_test": {{Name: "BenchmarkBuild", NsPerOp: 5000, BytesPerOp: 64}},
+	}, LoadBenchmarks(filename))
+}
+
+func benchmarkTarget(label string, benchmarks ...core.BenchmarkResult) *core.BuildTarget {
+	target := core.NewBuildTarget(core.ParseBuildLabel(label, ""))
+	target.IsTest = true
+	target.Results.Benchmarks = benchmarks
+	return target
+}
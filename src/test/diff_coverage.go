@@ -0,0 +1,154 @@
+// Code for calculating coverage of only the lines that have changed since a git revision.
+//
+// This is typically what a reviewer cares about; the overall coverage of a package is less
+// interesting than whether the new code being added to it is tested.
+
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"core"
+)
+
+// hunkRe matches the header of a hunk in a unified diff; we only care about the new side.
+var hunkRe = regexp.MustCompile(`^@@ -[0-9]+(?:,[0-9]+)? \+([0-9]+)(?:,([0-9]+))? @@`)
+
+// A lineRange is an inclusive range of (1-indexed) line numbers.
+type lineRange struct {
+	Start, End int
+}
+
+// DiffCoverage describes the coverage of lines changed relative to some base revision.
+type DiffCoverage struct {
+	Base  string
+	Files map[string]FileDiffCoverage
+}
+
+// FileDiffCoverage describes the coverage of the changed lines within a single file.
+type FileDiffCoverage struct {
+	Covered   int   // Number of changed lines that are covered.
+	Total     int   // Number of changed lines that are executable.
+	Uncovered []int // Line numbers of changed lines that are executable but not covered.
+}
+
+// OrderedFiles returns the files that have changed, in sorted order.
+func (diff *DiffCoverage) OrderedFiles() []string {
+	files := make([]string, 0, len(diff.Files))
+	for file := range diff.Files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Totals returns the number of changed lines covered and the total number coverable.
+func (diff *DiffCoverage) Totals() (int, int) {
+	covered := 0
+	total := 0
+	for _, file := range diff.Files {
+		covered += file.Covered
+		total += file.Total
+	}
+	return covered, total
+}
+
+// MeetsThreshold returns true if the percentage of changed lines that are covered is at least
+// the given threshold. Trivially true if there are no coverable changed lines.
+func (diff *DiffCoverage) MeetsThreshold(threshold float32) bool {
+	covered, total := diff.Totals()
+	return total == 0 || 100.0*float32(covered)/float32(total) >= threshold
+}
+
+// CalculateDiffCoverage calculates coverage of the lines changed since the given git revision.
+func CalculateDiffCoverage(coverage core.TestCoverage, base string) (DiffCoverage, error) {
+	changes, err := changedLines(base)
+	if err != nil {
+		return DiffCoverage{}, err
+	}
+	return intersectCoverage(coverage, base, changes), nil
+}
+
+// changedLines runs git to find the set of lines that have changed since the given revision.
+func changedLines(base string) (map[string][]lineRange, error) {
+	cmd := core.ExecCommand("git", "diff", "--unified=0", "--no-color", "--no-ext-diff", "--no-prefix", "--relative", base, "--")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to run git diff against %s: %s\n%s", base, err, stderr.String())
+	}
+	return parseGitDiff(out)
+}
+
+// parseGitDiff parses the output of git diff into the line ranges added or modified in each file.
+// It expects the diff to have been produced with --no-prefix.
+func parseGitDiff(diff []byte) (map[string][]lineRange, error) {
+	ret := map[string][]lineRange{}
+	file := ""
+	inHeader := false // Added lines can look like file headers, so we need to track where we are.
+	scanner := bufio.NewScanner(bytes.NewReader(diff))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "diff --git ") {
+			file = ""
+			inHeader = true
+		} else if inHeader && strings.HasPrefix(line, "+++ ") {
+			file = strings.TrimPrefix(line, "+++ ")
+			inHeader = false
+			if file == "/dev/null" {
+				file = "" // File has been deleted, there's nothing to cover.
+			}
+		} else if match := hunkRe.FindStringSubmatch(line); match != nil && file != "" {
+			start, _ := strconv.Atoi(match[1])
+			count := 1
+			if match[2] != "" {
+				count, _ = strconv.Atoi(match[2])
+			}
+			if count > 0 { // A count of zero indicates lines were only removed.
+				ret[file] = append(ret[file], lineRange{Start: start, End: start + count - 1})
+			}
+		}
+	}
+	return ret, scanner.Err()
+}
+
+// intersectCoverage calculates coverage for the given changed lines.
+// Files that we have no coverage information for are assumed not to be interesting (for example
+// they are not in the packages that were tested) and are omitted.
+func intersectCoverage(coverage core.TestCoverage, base string, changes map[string][]lineRange) DiffCoverage {
+	files := make(map[string][]core.LineCoverage, len(coverage.Files))
+	for file, lines := range coverage.Files {
+		if strings.HasPrefix(file, core.RepoRoot) {
+			file = strings.TrimLeft(file[len(core.RepoRoot):], "/")
+		}
+		files[file] = lines
+	}
+	diff := DiffCoverage{Base: base, Files: map[string]FileDiffCoverage{}}
+	for file, ranges := range changes {
+		lines, present := files[file]
+		if !present {
+			continue
+		}
+		fileCoverage := FileDiffCoverage{}
+		for _, r := range ranges {
+			for i := r.Start; i <= r.End && i <= len(lines); i++ {
+				if line := lines[i-1]; line == core.Covered {
+					fileCoverage.Covered++
+					fileCoverage.Total++
+				} else if line != core.NotExecutable {
+					fileCoverage.Total++
+					fileCoverage.Uncovered = append(fileCoverage.Uncovered, i)
+				}
+			}
+		}
+		diff.Files[file] = fileCoverage
+	}
+	return diff
+}
@@ -0,0 +1,50 @@
+package test
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"core"
+)
+
+func TestParseGitDiff(t *testing.T) {
+	data, err := ioutil.ReadFile("src/test/test_data/git_diff.txt")
+	assert.NoError(t, err)
+	changes, err := parseGitDiff(data)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]lineRange{
+		"src/core/state.go": {{Start: 2, End: 2}, {Start: 6, End: 7}},
+		"src/core/new.go":   {{Start: 1, End: 3}},
+	}, changes)
+}
+
+func TestIntersectCoverage(t *testing.T) {
+	coverage := core.NewTestCoverage()
+	coverage.Files["src/core/state.go"] = []core.LineCoverage{
+		core.NotExecutable, core.Covered, core.NotExecutable, core.Covered, core.Uncovered, core.Uncovered, core.Covered,
+	}
+	coverage.Files["src/core/other.go"] = []core.LineCoverage{core.Uncovered, core.Uncovered}
+	diff := intersectCoverage(coverage, "master", map[string][]lineRange{
+		"src/core/state.go": {{Start: 2, End: 2}, {Start: 6, End: 7}},
+		"src/core/new.go":   {{Start: 1, End: 3}},
+	})
+	assert.Equal(t, []string{"src/core/state.go"}, diff.OrderedFiles())
+	assert.Equal(t, FileDiffCoverage{Covered: 2, Total: 3, Uncovered: []int{6}}, diff.Files["src/core/state.go"])
+	covered, total := diff.Totals()
+	assert.Equal(t, 2, covered)
+	assert.Equal(t, 3, total)
+	assert.True(t, diff.MeetsThreshold(60.0))
+	assert.False(t, diff.MeetsThreshold(70.0))
+}
+
+func TestIntersectCoverageLineOutOfRange(t *testing.T) {
+	// Lines beyond the end of the coverage data (e.g. trailing non-executable lines) are ignored.
+	coverage := core.NewTestCoverage()
+	coverage.Files["src/core/state.go"] = []core.LineCoverage{core.Covered}
+	diff := intersectCoverage(coverage, "master", map[string][]lineRange{
+		"src/core/state.go": {{Start: 1, End: 5}},
+	})
+	assert.Equal(t, FileDiffCoverage{Covered: 1, Total: 1}, diff.Files["src/core/state.go"])
+}
@@ -10,6 +10,7 @@ import (
 	"bytes"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"core"
@@ -19,6 +20,13 @@ import (
 var testStart = regexp.MustCompile("^=== RUN (.*)(?:-6)?$")
 var testResult = regexp.MustCompile("^ *--- (PASS|FAIL|SKIP): (.*)(?:-6)? \\((.*)s\\)$")
 
+// Benchmarks don't have a start line; results are followed by any other measurements (e.g. allocations)
+// and failures don't have a duration.
+var benchmarkResult = regexp.MustCompile(`^(Benchmark\S+?)(?:-\d+)?\s+(\d+)\s+([0-9.]+) ns/op(.*)$`)
+var benchmarkBytes = regexp.MustCompile(`\s([0-9]+) B/op`)
+var benchmarkAllocs = regexp.MustCompile(`\s([0-9]+) allocs/op`)
+var benchmarkFailure = regexp.MustCompile(`^--- FAIL: (Benchmark\S*?)(?:-\d+)?$`)
+
 func parseGoTestResults(data []byte) (core.TestResults, error) {
 	results := core.TestResults{}
 	lines := bytes.Split(data, []byte{'\n'})
@@ -26,7 +34,18 @@ func parseGoTestResults(data []byte) (core.TestResults, error) {
 	for i, line := range lines {
 		testStartMatches := testStart.FindSubmatch(line)
 		testResultMatches := testResult.FindSubmatch(line)
-		if testStartMatches != nil {
+		if m := benchmarkResult.FindSubmatch(line); m != nil {
+			results.NumTests++
+			results.Passed++
+			results.Passes = append(results.Passes, string(m[1]))
+			results.Benchmarks = append(results.Benchmarks, parseBenchmarkResult(m))
+		} else if m := benchmarkFailure.FindSubmatch(line); m != nil {
+			results.NumTests++
+			results.Failed++
+			results.Failures = append(results.Failures, core.TestFailure{
+				Name: string(m[1]), Type: "FAILURE", Traceback: benchmarkOutput(lines, i),
+			})
+		} else if testStartMatches != nil {
 			testsStarted[strings.TrimSpace(string(testStartMatches[1]))] = true
 		} else if testResultMatches != nil {
 			testName := strings.TrimSpace(string(testResultMatches[2]))
@@ -34,6 +53,9 @@ func parseGoTestResults(data []byte) (core.TestResults, error) {
 				continue
 			}
 			results.NumTests++
+			if seconds, err := strconv.ParseFloat(string(testResultMatches[3]), 64); err == nil {
+				recordDuration(&results, testName, seconds)
+			}
 			if bytes.Equal(testResultMatches[1], []byte("PASS")) {
 				results.Passed++
 				results.Passes = append(results.Passes, testName)
@@ -60,3 +82,39 @@ func parseGoTestResults(data []byte) (core.TestResults, error) {
 	}
 	return results, nil
 }
+
+// parseBenchmarkResult parses the result of a single benchmark from the matches of benchmarkResult.
+func parseBenchmarkResult(m [][]byte) core.BenchmarkResult {
+	result := core.BenchmarkResult{Name: string(m[1])}
+	result.Iterations, _ = strconv.ParseInt(string(m[2]), 10, 64)
+	result.NsPerOp, _ = strconv.ParseFloat(string(m[3]), 64)
+	if b := benchmarkBytes.FindSubmatch(m[4]); b != nil {
+		result.BytesPerOp, _ = strconv.ParseInt(string(b[1]), 10, 64)
+	}
+	if a := benchmarkAllocs.FindSubmatch(m[4]); a != nil {
+		result.AllocsPerOp, _ = strconv.ParseInt(string(a[1]), 10, 64)
+	}
+	return result
+}
+
+// benchmarkOutput returns the output of a failed benchmark whose result is on the given line.
+// Older versions of Go print it indented after the result, newer ones before it.
+func benchmarkOutput(lines [][]byte, i int) string {
+	isIndented := func(line []byte) bool {
+		return len(line) > 0 && (line[0] == ' ' || line[0] == '\t')
+	}
+	start, end := i+1, i+1
+	for end < len(lines) && isIndented(lines[end]) {
+		end++
+	}
+	if start == end {
+		end = i
+		for start = i; start > 0 && isIndented(lines[start-1]); start-- {
+		}
+	}
+	output := ""
+	for _, line := range lines[start:end] {
+		output += string(bytes.TrimSpace(line)) + "\n"
+	}
+	return output
+}
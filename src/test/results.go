@@ -38,6 +38,10 @@ func parseTestResultsImpl(outputFile string) (core.TestResults, error) {
 		return core.TestResults{}, fmt.Errorf("No results")
 	} else if looksLikeJUnitXMLTestResults(bytes) {
 		return parseJUnitXMLTestResults(bytes)
+	} else if looksLikeTest2JSONResults(bytes) {
+		return parseTest2JSONResults(bytes)
+	} else if looksLikeTAPResults(bytes) {
+		return parseTAPResults(bytes)
 	} else {
 		return parseGoTestResults(bytes)
 	}
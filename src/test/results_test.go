@@ -1,7 +1,10 @@
 package test
 
 import (
+	"os"
+	"path"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -165,3 +168,96 @@ func TestParseGoFileWithLogging(t *testing.T) {
 	assert.Equal(t, 3, results.Passed)
 	assert.Equal(t, 0, results.Failed)
 }
+
+func TestGoBenchmarks(t *testing.T) {
+	results, err := parseTestResults(new(core.BuildTarget), "src/test/test_data/go_benchmarks.txt", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, results.NumTests)
+	assert.Equal(t, 6, results.Passed)
+	assert.Equal(t, 1, results.Failed)
+	assert.Equal(t, "BenchmarkFail", results.Failures[0].Name)
+	assert.Equal(t, "lib_test.go:43: boom\n", results.Failures[0].Traceback)
+	assert.Equal(t, []core.BenchmarkResult{
+		{Name: "BenchmarkDouble", Iterations: 100, NsPerOp: 5.02},
+		{Name: "BenchmarkAlloc", Iterations: 100, NsPerOp: 47.67, BytesPerOp: 72, AllocsPerOp: 1},
+	}, results.Benchmarks)
+}
+
+func TestTAPResults(t *testing.T) {
+	results, err := parseTestResults(new(core.BuildTarget), "src/test/test_data/tap_results.txt", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, results.NumTests)
+	assert.Equal(t, 2, results.Passed)
+	assert.Equal(t, 2, results.Failed)
+	assert.Equal(t, 1, results.Skipped)
+	assert.Equal(t, 1, results.ExpectedFailures)
+	assert.Equal(t, []string{"Input file opened", "test 5"}, results.Passes)
+	assert.Equal(t, "First line of the input valid", results.Failures[0].Name)
+	assert.Contains(t, results.Failures[0].Traceback, "First line invalid")
+	assert.Equal(t, "Reports failure", results.Failures[1].Name)
+	assert.Equal(t, "timed out", results.Failures[1].Traceback)
+	assert.Equal(t, 12500*time.Microsecond, results.Durations["First line of the input valid"])
+	assert.Equal(t, 1500*time.Millisecond, results.Durations["test 5"])
+}
+
+func TestTAPBailOut(t *testing.T) {
+	_, err := parseTestResults(new(core.BuildTarget), "src/test/test_data/tap_bail_out.txt", false)
+	assert.Error(t, err)
+}
+
+func TestTAPMissingTests(t *testing.T) {
+	_, err := parseTestResults(new(core.BuildTarget), "src/test/test_data/tap_missing_tests.txt", false)
+	assert.Error(t, err)
+}
+
+func TestTest2JSONResults(t *testing.T) {
+	results, err := parseTestResults(new(core.BuildTarget), "src/test/test_data/test2json_results.json", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, results.NumTests)
+	assert.Equal(t, 1, results.Passed)
+	assert.Equal(t, 1, results.Failed)
+	assert.Equal(t, 1, results.Skipped)
+	assert.Equal(t, []string{"TestPass"}, results.Passes)
+	assert.Equal(t, "TestFail", results.Failures[0].Name)
+	assert.Contains(t, results.Failures[0].Traceback, "expected 1, was 2")
+	assert.Equal(t, 10*time.Millisecond, results.Durations["TestPass"])
+	assert.Equal(t, 500*time.Millisecond, results.Durations["TestFail"])
+}
+
+func TestTest2JSONFailIfNoFailuresFound(t *testing.T) {
+	_, err := parseTestResults(new(core.BuildTarget), "src/test/test_data/test2json_unknown_failure.json", false)
+	assert.Error(t, err)
+}
+
+func TestJUnitXMLDurations(t *testing.T) {
+	results, err := parseTestResults(new(core.BuildTarget), "src/test/test_data/junit.xml", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 172*time.Second, results.Durations["testDeconstructsSoulNames"])
+	assert.Equal(t, 2*time.Second, results.Durations["testDeconstructsSoulPersonal"])
+	assert.NotContains(t, results.Durations, "testSoulEntriesPersonal")
+}
+
+func TestGoDurations(t *testing.T) {
+	results, err := parseTestResults(new(core.BuildTarget), "src/test/test_data/go_test_durations.txt", false)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{
+		"TestFast":   10 * time.Millisecond,
+		"TestSlow":   1500 * time.Millisecond,
+		"TestBroken": 250 * time.Millisecond,
+	}, results.Durations)
+}
+
+func TestWriteResultsWithDurations(t *testing.T) {
+	target := core.NewBuildTarget(core.ParseBuildLabel("//src/test:durations_test", ""))
+	target.IsTest = true
+	_, err := parseTestResults(target, "src/test/test_data/go_test_durations.txt", false)
+	assert.NoError(t, err)
+	graph := core.NewGraph()
+	graph.AddTarget(target)
+	filename := path.Join(os.TempDir(), "test_results_with_durations.xml")
+	defer os.Remove(filename)
+	WriteResultsToFileOrDie(graph, filename)
+	results, err := parseTestResults(new(core.BuildTarget), filename, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1500*time.Millisecond, results.Durations["TestSlow"])
+}
@@ -0,0 +1,100 @@
+// Parser for the Test Anything Protocol (TAP), version 13.
+//
+// See https://testanything.org/tap-version-13-specification.html for the spec.
+// This is commonly emitted by shell test frameworks (e.g. bats) as well as Perl & Node.
+
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"core"
+)
+
+var tapVersion = regexp.MustCompile(`^TAP version ([0-9]+)`)
+var tapPlan = regexp.MustCompile(`^1\.\.([0-9]+)`)
+var tapResult = regexp.MustCompile(`^(not )?ok\b *([0-9]*) *(?:- *)?([^#]*?) *(?:#(.*))?$`)
+var tapDirective = regexp.MustCompile(`^ *(?i:(SKIP|TODO))\S* *(.*)`)
+var tapDuration = regexp.MustCompile(`(?m)^ *duration_ms: *([0-9.]+)`)
+
+func looksLikeTAPResults(b []byte) bool {
+	line := bytes.TrimSpace(firstLine(b))
+	return tapVersion.Match(line) || tapPlan.Match(line) || tapResult.Match(line)
+}
+
+// firstLine returns the first non-empty line of some data.
+func firstLine(b []byte) []byte {
+	b = bytes.TrimLeft(b, "\n\r\t ")
+	if index := bytes.IndexByte(b, '\n'); index != -1 {
+		return b[:index]
+	}
+	return b
+}
+
+func parseTAPResults(data []byte) (core.TestResults, error) {
+	results := core.TestResults{}
+	lines := strings.Split(string(data), "\n")
+	planned := -1
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+		if match := tapPlan.FindStringSubmatch(line); match != nil {
+			planned, _ = strconv.Atoi(match[1])
+		} else if strings.HasPrefix(line, "Bail out!") {
+			return results, fmt.Errorf("Test run bailed out: %s", strings.TrimSpace(strings.TrimPrefix(line, "Bail out!")))
+		} else if match := tapResult.FindStringSubmatch(line); match != nil {
+			// Consume the YAML diagnostic block following the result, if there is one.
+			diagnostics := ""
+			if i+1 < len(lines) && strings.TrimSpace(lines[i+1]) == "---" {
+				for i += 2; i < len(lines) && strings.TrimSpace(lines[i]) != "..."; i++ {
+					diagnostics += lines[i] + "\n"
+				}
+			}
+			appendTAPResult(&results, match, diagnostics)
+		}
+	}
+	if planned != -1 && results.NumTests != planned {
+		return results, fmt.Errorf("Planned to run %d tests but %d were run", planned, results.NumTests)
+	}
+	return results, nil
+}
+
+func appendTAPResult(results *core.TestResults, match []string, diagnostics string) {
+	name := match[3]
+	if name == "" {
+		name = "test " + match[2]
+	}
+	if m := tapDuration.FindStringSubmatch(diagnostics); m != nil {
+		if ms, err := strconv.ParseFloat(m[1], 64); err == nil {
+			recordDuration(results, name, ms/1000.0)
+		}
+	}
+	results.NumTests++
+	passed := match[1] == ""
+	directive, reason := "", strings.TrimSpace(match[4])
+	if m := tapDirective.FindStringSubmatch(match[4]); m != nil {
+		directive = strings.ToUpper(m[1])
+		reason = m[2]
+	}
+	switch {
+	case directive == "SKIP":
+		results.Skipped++
+	case directive == "TODO" && !passed:
+		results.ExpectedFailures++
+	case passed:
+		results.Passed++
+		results.Passes = append(results.Passes, name)
+	default:
+		traceback := diagnostics
+		if traceback == "" {
+			traceback = reason
+		}
+		results.Failed++
+		results.Failures = append(results.Failures, core.TestFailure{
+			Name: name, Type: "FAILURE", Traceback: traceback,
+		})
+	}
+}
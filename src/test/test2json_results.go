@@ -0,0 +1,82 @@
+// Parser for the JSON event stream produced by Go's test2json tool (i.e. go test -json).
+//
+// This is the structured equivalent of the -v output handled in go_results.go.
+
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"core"
+)
+
+// A test2JSONEvent is a single event emitted by test2json.
+// See https://golang.org/cmd/test2json for details of the format.
+type test2JSONEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64 // seconds
+	Output  string
+}
+
+func looksLikeTest2JSONResults(b []byte) bool {
+	line := firstLine(b)
+	return bytes.HasPrefix(line, []byte{'{'}) && bytes.Contains(line, []byte(`"Action"`))
+}
+
+func parseTest2JSONResults(data []byte) (core.TestResults, error) {
+	results := core.TestResults{}
+	output := map[string]*bytes.Buffer{}
+	failed := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 10*1024*1024) // Lines of output can be pretty long.
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		event := test2JSONEvent{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return results, fmt.Errorf("Invalid test2json event: %s", err)
+		}
+		if event.Test == "" {
+			// Package-level event; we're only really interested in whether it failed overall.
+			failed = failed || event.Action == "fail"
+			continue
+		}
+		switch event.Action {
+		case "output":
+			if output[event.Test] == nil {
+				output[event.Test] = &bytes.Buffer{}
+			}
+			output[event.Test].WriteString(event.Output)
+		case "pass", "fail", "skip":
+			results.NumTests++
+			recordDuration(&results, event.Test, event.Elapsed)
+			if event.Action == "pass" {
+				results.Passed++
+				results.Passes = append(results.Passes, event.Test)
+			} else if event.Action == "skip" {
+				results.Skipped++
+			} else {
+				traceback := ""
+				if buf := output[event.Test]; buf != nil {
+					traceback = buf.String()
+				}
+				results.Failed++
+				results.Failures = append(results.Failures, core.TestFailure{
+					Name: event.Test, Type: "FAILURE", Traceback: traceback,
+				})
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return results, err
+	} else if failed && results.Failed == 0 {
+		return results, fmt.Errorf("Test indicated final failure but no failures found")
+	}
+	return results, nil
+}
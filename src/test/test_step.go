@@ -119,7 +119,8 @@ func test(tid int, state *core.BuildState, label core.BuildLabel, target *core.B
 	}
 
 	// Don't cache when doing multiple runs, presumably the user explicitly wants to check it.
-	if state.NumTestRuns <= 1 && !needToRun() {
+	// Similarly benchmarks have to be run again to be of any use.
+	if state.NumTestRuns <= 1 && !state.NeedBenchmarks && !needToRun() {
 		cachedTest()
 		return
 	}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"core"
 )
@@ -48,13 +49,16 @@ func appendResult(test jUnitXMLTest, results *core.TestResults) {
 	} else {
 		results.Passed++
 		results.Passes = append(results.Passes, test.Name)
+		recordDuration(results, test.Name, test.Time)
 	}
 }
 
 func appendResult2(test jUnitXMLTest, results *core.TestResults, failure jUnitXMLFailure) {
+	name := combineNames(test.ClassName, test.Name)
+	recordDuration(results, name, test.Time)
 	results.Failed++
 	results.Failures = append(results.Failures, core.TestFailure{
-		Name:      combineNames(test.ClassName, test.Name),
+		Name:      name,
 		Type:      failure.Type,
 		Traceback: messageOrTraceback(failure), // TODO(pebers): store both of these, not just one.
 		Stdout:    test.Stdout,
@@ -62,6 +66,16 @@ func appendResult2(test jUnitXMLTest, results *core.TestResults, failure jUnitXM
 	})
 }
 
+// recordDuration records the duration of a single test case, given in seconds.
+func recordDuration(results *core.TestResults, name string, seconds float64) {
+	if seconds > 0 {
+		if results.Durations == nil {
+			results.Durations = map[string]time.Duration{}
+		}
+		results.Durations[name] = time.Duration(seconds * float64(time.Second))
+	}
+}
+
 func messageOrTraceback(failure jUnitXMLFailure) string {
 	if failure.Traceback != "" {
 		return failure.Traceback
@@ -88,6 +102,7 @@ type jUnitXMLTestSuite struct {
 	Name      string         `xml:"name,attr"`
 	Failures  int            `xml:"failures,attr,omitempty"`
 	Tests     int            `xml:"tests,attr"`
+	Time      float64        `xml:"time,attr,omitempty"`
 	TestCases []jUnitXMLTest `xml:"testcase"`
 }
 
@@ -123,14 +138,19 @@ func WriteResultsToFileOrDie(graph *core.BuildGraph, filename string) {
 				Name:     target.Label.String(),
 				Failures: target.Results.Failed,
 				Tests:    target.Results.NumTests,
+				Time:     target.Results.Duration.Seconds(),
 			}
 			for _, pass := range target.Results.Passes {
-				suite.TestCases = append(suite.TestCases, jUnitXMLTest{Name: pass})
+				suite.TestCases = append(suite.TestCases, jUnitXMLTest{
+					Name: pass,
+					Time: target.Results.Durations[pass].Seconds(),
+				})
 			}
 			for _, fail := range target.Results.Failures {
 				suite.TestCases = append(suite.TestCases, jUnitXMLTest{
 					Name:   fail.Name,
 					Type:   fail.Type,
+					Time:   target.Results.Durations[fail.Name].Seconds(),
 					Stdout: fail.Stdout,
 					Stderr: fail.Stderr,
 					Error: &jUnitXMLFailure{
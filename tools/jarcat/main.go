@@ -33,6 +33,25 @@ func must(err error) {
 	}
 }
 
+// excludeUnmerged returns the given exclusions except for any that have merge rules for them.
+// These are typically used to merge files that we'd otherwise exclude (e.g. Java manifests).
+func excludeUnmerged(excludes []string, rules []zip.MergeRule) []string {
+	ret := make([]string, 0, len(excludes))
+	for _, exclude := range excludes {
+		merged := false
+		for _, rule := range rules {
+			if rule.Pattern == exclude {
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			ret = append(ret, exclude)
+		}
+	}
+	return ret
+}
+
 // mustReadPreamble reads and returns the first line of a file.
 func mustReadPreamble(path string) string {
 	f, err := os.Open(path)
@@ -72,6 +91,8 @@ var opts = struct {
 	NoDirEntries          bool              `short:"n" long:"nodir_entries" description:"Don't add directory entries to zip"`
 	RenameDirs            map[string]string `short:"r" long:"rename_dir" description:"Rename directories within zip file"`
 	StoreSuffix           []string          `short:"u" long:"store_suffix" description:"Suffix of filenames to store instead of deflate (i.e. without compression). Note that this only affects files found with --include_other."`
+	Merge                 []string          `long:"merge" description:"Strategy for handling duplicate files matching a pattern, as pattern=strategy. Strategy is one of first, last, concatenate, error or merge-manifest."`
+	PreserveOrder         bool              `long:"preserve_order" description:"Write entries in the order they're found instead of sorting them. Uses less memory but the output is no longer independent of the order of its inputs."`
 
 	Tar    bool     `long:"tar" description:"Write a tarball instead of a zipfile. Note that most other flags are not honoured if this is given."`
 	Gzip   bool     `short:"z" long:"gzip" description:"Apply gzip compression to the tar file. Only has an effect if --tar is passed."`
@@ -86,8 +107,9 @@ when compiling Java code. This is possible with zip files because each file is c
 individually so it's possible to combine them without decompressing and recompressing each one.
 
 It now has a number of other features to help in compilation and serves as a general-purpose
-zip manipulator for Please. To help us maintain reproduceability of builds it is able to strip
-timestamps from files, and also has a bunch of Python-specific functionality to help with .pex files.
+zip manipulator for Please. To help us maintain reproduceability of builds it sorts its entries,
+strips timestamps, permissions and other metadata from them (honouring $SOURCE_DATE_EPOCH if it's set),
+and also has a bunch of Python-specific functionality to help with .pex files.
 
 Typically you don't invoke this directly, Please will run it when individual rules need it.
 You're welcome to use it separately if you find it useful, although be aware that we do not
@@ -113,11 +135,18 @@ func main() {
 		os.Exit(0)
 	}
 
+	rules := make([]zip.MergeRule, len(opts.Merge))
+	for i, merge := range opts.Merge {
+		rule, err := zip.ParseMergeRule(merge)
+		must(err)
+		rules[i] = rule
+	}
 	if opts.ExcludeJavaPrefixes {
-		opts.ExcludeInternalPrefix = javaExcludePrefixes
+		opts.ExcludeInternalPrefix = excludeUnmerged(javaExcludePrefixes, rules)
 	}
 
 	f := zip.NewFile(opts.Out, opts.Strict)
+	f.MergeRules = rules
 	defer f.Close()
 	f.RenameDirs = opts.RenameDirs
 	f.Include = opts.IncludeInternalPrefix
@@ -130,6 +159,7 @@ func main() {
 	f.AddInitPy = opts.AddInitPy
 	f.DirEntries = !opts.NoDirEntries
 	f.Align = opts.Align
+	f.PreserveOrder = opts.PreserveOrder
 
 	if opts.PreambleFrom != "" {
 		opts.Preamble = mustReadPreamble(opts.PreambleFrom)
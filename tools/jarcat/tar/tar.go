@@ -11,12 +11,21 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
 // mtime is the time we attach for the modification time of all files.
-var mtime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+// It's overridden by $SOURCE_DATE_EPOCH if that's set.
+var mtime = sourceDateEpoch(time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+// An entry is a single file that we're going to write into the tarball.
+type entry struct {
+	Path, Name string
+	Info       os.FileInfo
+}
 
 // Write writes a tarball to output with all the files found in inputDir.
 // If prefix is given the files are all placed into a single directory with that name.
@@ -41,6 +50,22 @@ func write(w io.Writer, output string, srcs []string, prefix string) error {
 	tw := tar.NewWriter(w)
 	defer tw.Close()
 
+	files, err := findFiles(output, srcs, prefix)
+	if err != nil {
+		return err
+	}
+	for _, e := range files {
+		if err := writeEntry(tw, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findFiles returns all the files found in the given sources, sorted by the name they'll
+// have in the tarball so the output doesn't depend on the order they were given in.
+func findFiles(output string, srcs []string, prefix string) ([]entry, error) {
+	files := []entry{}
 	for _, src := range srcs {
 		strip := filepath.Dir(src)
 		if err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
@@ -51,37 +76,59 @@ func write(w io.Writer, output string, srcs []string, prefix string) error {
 			} else if abs, _ := filepath.Abs(path); abs == output {
 				return nil // don't write the output tarball into itself :)
 			}
-			hdr, err := tar.FileInfoHeader(info, "") // We don't write symlinks into plz-out/tmp, so the argument doesn't matter.
-			if err != nil {
-				return err
-			}
 			// Set name appropriately (recall that FileInfoHeader does not set the full path).
-			hdr.Name = strings.TrimLeft(strings.TrimPrefix(path, strip), "/")
+			name := strings.TrimLeft(strings.TrimPrefix(path, strip), "/")
 			if prefix != "" {
-				hdr.Name = filepath.Join(prefix, hdr.Name)
-			}
-			// Zero out all timestamps.
-			hdr.ModTime = mtime
-			hdr.AccessTime = mtime
-			hdr.ChangeTime = mtime
-			// Strip user/group ids.
-			hdr.Uid = 0
-			hdr.Gid = 0
-			// Setting the user/group write bits helps consistency of output.
-			hdr.Mode |= 0220
-			if err := tw.WriteHeader(hdr); err != nil {
-				return err
-			}
-			f, err := os.Open(path)
-			if err != nil {
-				return err
+				name = filepath.Join(prefix, name)
 			}
-			defer f.Close()
-			_, err = io.Copy(tw, f)
-			return err
+			files = append(files, entry{Path: path, Name: name, Info: info})
+			return nil
 		}); err != nil {
-			return err
+			return nil, err
 		}
 	}
-	return nil
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// writeEntry writes a single file into the tarball.
+func writeEntry(tw *tar.Writer, e entry) error {
+	hdr, err := tar.FileInfoHeader(e.Info, "") // We don't write symlinks into plz-out/tmp, so the argument doesn't matter.
+	if err != nil {
+		return err
+	}
+	hdr.Name = e.Name
+	// Zero out all timestamps.
+	hdr.ModTime = mtime
+	hdr.AccessTime = mtime
+	hdr.ChangeTime = mtime
+	// Strip user/group ids and names.
+	hdr.Uid = 0
+	hdr.Gid = 0
+	hdr.Uname = ""
+	hdr.Gname = ""
+	// Normalise permissions; the only thing we preserve is whether it's executable.
+	hdr.Mode = 0664
+	if e.Info.Mode()&0111 != 0 {
+		hdr.Mode = 0775
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	f, err := os.Open(e.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// sourceDateEpoch returns the time given by $SOURCE_DATE_EPOCH, or the given default if it's not set.
+// See https://reproducible-builds.org/specs/source-date-epoch/ for more details.
+func sourceDateEpoch(def time.Time) time.Time {
+	if secs, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC()
+	}
+	return def
 }
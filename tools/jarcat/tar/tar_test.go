@@ -5,7 +5,9 @@ import (
 	"bytes"
 	"compress/gzip"
 	"io"
+	"io/ioutil"
 	"os"
+	"path"
 	"strings"
 	"testing"
 	"time"
@@ -64,6 +66,42 @@ func TestWithPrefix(t *testing.T) {
 	}, toFilenameMap(m))
 }
 
+func TestReproducible(t *testing.T) {
+	// Same files, created in a different order with different timestamps & permissions.
+	writeTestFiles(t, "reproducible_1", []string{"dir1/a.txt", "dir1/b.txt", "dir2/c.txt"}, 0644, time.Now())
+	writeTestFiles(t, "reproducible_2", []string{"dir2/c.txt", "dir1/b.txt", "dir1/a.txt"}, 0600, time.Now().Add(-time.Hour))
+	require.NoError(t, Write("reproducible_1.tar", []string{"reproducible_1/dir1", "reproducible_1/dir2"}, "", false))
+	require.NoError(t, Write("reproducible_2.tar", []string{"reproducible_2/dir2", "reproducible_2/dir1"}, "", false))
+	b1, err := ioutil.ReadFile("reproducible_1.tar")
+	require.NoError(t, err)
+	b2, err := ioutil.ReadFile("reproducible_2.tar")
+	require.NoError(t, err)
+	assert.Equal(t, b1, b2)
+
+	f, err := os.Open("reproducible_1.tar")
+	require.NoError(t, err)
+	defer f.Close()
+	tr := tar.NewReader(f)
+	for _, name := range []string{"dir1/a.txt", "dir1/b.txt", "dir2/c.txt"} {
+		hdr, err := tr.Next()
+		require.NoError(t, err)
+		assert.Equal(t, name, hdr.Name)
+		assert.EqualValues(t, 0664, hdr.Mode)
+		assert.Equal(t, "", hdr.Uname)
+	}
+}
+
+// writeTestFiles is a test utility that writes the given files under a directory in the given order.
+func writeTestFiles(t *testing.T, dir string, files []string, mode os.FileMode, mtime time.Time) {
+	for _, file := range files {
+		filename := path.Join(dir, file)
+		require.NoError(t, os.MkdirAll(path.Dir(filename), os.ModeDir|0755))
+		require.NoError(t, ioutil.WriteFile(filename, []byte(file), mode))
+		require.NoError(t, os.Chmod(filename, mode))
+		require.NoError(t, os.Chtimes(filename, mtime, mtime))
+	}
+}
+
 // ReadTar is a test utility that reads all the files from a tarball and returns a map of
 // their headers -> their contents.
 func ReadTar(t *testing.T, filename string, compress bool) map[*tar.Header]string {
@@ -0,0 +1,189 @@
+package zip
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// A MergeStrategy defines how we handle files with the same name that are found in more than one input.
+type MergeStrategy int
+
+const (
+	// MergeFirst keeps the first file found and ignores any later ones.
+	MergeFirst MergeStrategy = iota
+	// MergeLast keeps the last file found.
+	MergeLast
+	// MergeConcatenate concatenates the contents of all the files together.
+	MergeConcatenate
+	// MergeError fails if files differ in their contents.
+	MergeError
+	// MergeManifest merges Java manifests together. Attributes in earlier files take precedence.
+	MergeManifest
+)
+
+var mergeStrategyNames = map[string]MergeStrategy{
+	"first":          MergeFirst,
+	"last":           MergeLast,
+	"concatenate":    MergeConcatenate,
+	"error":          MergeError,
+	"merge-manifest": MergeManifest,
+}
+
+// A MergeRule applies a merge strategy to all files that match a pattern.
+// Patterns are matched as with filepath.Match, except that a trailing * also matches
+// across directories (so META-INF/services/* matches everything under it).
+type MergeRule struct {
+	Pattern  string
+	Strategy MergeStrategy
+}
+
+// defaultMergeRules are applied to files that don't match any explicitly given rules.
+var defaultMergeRules = []MergeRule{
+	// These files need to have their contents merged, we can't replace them or leave them out.
+	{Pattern: "META-INF/services/*", Strategy: MergeConcatenate},
+	{Pattern: "META-INF/spring*", Strategy: MergeConcatenate},
+	{Pattern: "META-INF/please_sourcemap", Strategy: MergeConcatenate},
+	// akka libs each have their own reference.conf. if you are using
+	// akka as a lib-only (e.g akka-remote), those need to be merged together
+	{Pattern: "reference.conf", Strategy: MergeConcatenate},
+}
+
+// ParseMergeRule parses a merge rule from a string of the form pattern=strategy.
+func ParseMergeRule(s string) (MergeRule, error) {
+	idx := strings.LastIndexByte(s, '=')
+	if idx == -1 {
+		return MergeRule{}, fmt.Errorf("Invalid merge rule %s, should be of the form pattern=strategy", s)
+	}
+	strategy, present := mergeStrategyNames[s[idx+1:]]
+	if !present {
+		return MergeRule{}, fmt.Errorf("Unknown merge strategy %s, must be one of first, last, concatenate, error or merge-manifest", s[idx+1:])
+	}
+	return MergeRule{Pattern: s[:idx], Strategy: strategy}, nil
+}
+
+// Matches returns true if this rule applies to a file of the given name.
+func (rule MergeRule) Matches(name string) bool {
+	if matched, _ := filepath.Match(rule.Pattern, name); matched {
+		return true
+	}
+	return strings.HasSuffix(rule.Pattern, "*") && strings.HasPrefix(name, strings.TrimSuffix(rule.Pattern, "*"))
+}
+
+// mergeStrategy returns the strategy we use for a file of the given name.
+func (f *File) mergeStrategy(name string) MergeStrategy {
+	var match *MergeRule
+	for i, rule := range f.MergeRules {
+		if rule.Matches(name) && (match == nil || len(rule.Pattern) > len(match.Pattern)) {
+			match = &f.MergeRules[i]
+		}
+	}
+	if match != nil {
+		return match.Strategy
+	}
+	for _, rule := range defaultMergeRules {
+		if rule.Matches(name) {
+			return rule.Strategy
+		}
+	}
+	if f.Strict {
+		return MergeError
+	}
+	return MergeFirst
+}
+
+// A manifestSection is a single section of a Java manifest, i.e. either the main attributes
+// or those of a single named entry.
+type manifestSection struct {
+	Keys   []string
+	Values map[string]string
+}
+
+// set sets an attribute on this section if it doesn't already have one.
+func (section *manifestSection) set(key, value string) {
+	if _, present := section.Values[key]; !present {
+		section.Keys = append(section.Keys, key)
+		section.Values[key] = value
+	}
+}
+
+// parseManifest parses a Java manifest into its sections. The first is always the main section.
+func parseManifest(b []byte) []*manifestSection {
+	sections := []*manifestSection{{Values: map[string]string{}}}
+	section := sections[0]
+	lastKey := ""
+	for _, line := range strings.Split(strings.Replace(string(b), "\r\n", "\n", -1), "\n") {
+		if line == "" {
+			if len(section.Keys) > 0 {
+				section = &manifestSection{Values: map[string]string{}}
+				sections = append(sections, section)
+			}
+			lastKey = ""
+		} else if line[0] == ' ' && lastKey != "" {
+			section.Values[lastKey] += line[1:] // Continuation of the previous line.
+		} else if idx := strings.IndexByte(line, ':'); idx != -1 {
+			lastKey = line[:idx]
+			section.set(lastKey, strings.TrimPrefix(line[idx+1:], " "))
+		}
+	}
+	if section != sections[0] && len(section.Keys) == 0 {
+		sections = sections[:len(sections)-1]
+	}
+	return sections
+}
+
+// mergeManifests merges a Java manifest into an existing one. Attributes in the existing
+// manifest take precedence over the new one; named sections are merged together by name.
+func mergeManifests(existing, manifest []byte) []byte {
+	sections := parseManifest(existing)
+	named := map[string]*manifestSection{}
+	for _, section := range sections[1:] {
+		named[section.Values["Name"]] = section
+	}
+	for i, section := range parseManifest(manifest) {
+		target := sections[0]
+		if i > 0 {
+			name := section.Values["Name"]
+			if target = named[name]; target == nil {
+				target = &manifestSection{Values: map[string]string{}}
+				named[name] = target
+				sections = append(sections, target)
+			}
+		}
+		for _, key := range section.Keys {
+			target.set(key, section.Values[key])
+		}
+	}
+	var buf bytes.Buffer
+	for i, section := range sections {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		// The manifest version has to come first.
+		if i == 0 && section.Values["Manifest-Version"] != "" {
+			writeManifestLine(&buf, "Manifest-Version", section.Values["Manifest-Version"])
+		}
+		for _, key := range section.Keys {
+			if i > 0 || key != "Manifest-Version" {
+				writeManifestLine(&buf, key, section.Values[key])
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// writeManifestLine writes a single attribute to a manifest, wrapping it at the
+// 72 byte line length limit that the manifest format imposes.
+func writeManifestLine(buf *bytes.Buffer, key, value string) {
+	const maxLineLength = 72
+	line := key + ": " + value
+	// Continuation lines have a leading space that counts towards their length.
+	for width := maxLineLength; len(line) > width; width = maxLineLength - 1 {
+		buf.WriteString(line[:width])
+		buf.WriteString("\n ")
+		line = line[width:]
+	}
+	buf.WriteString(line)
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,112 @@
+package zip
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMergeRule(t *testing.T) {
+	rule, err := ParseMergeRule("META-INF/services/*=last")
+	require.NoError(t, err)
+	assert.Equal(t, MergeRule{Pattern: "META-INF/services/*", Strategy: MergeLast}, rule)
+	_, err = ParseMergeRule("META-INF/services/*")
+	assert.Error(t, err)
+	_, err = ParseMergeRule("META-INF/services/*=wibble")
+	assert.Error(t, err)
+}
+
+func TestMergeRuleMatches(t *testing.T) {
+	rule := MergeRule{Pattern: "META-INF/spring*"}
+	assert.True(t, rule.Matches("META-INF/spring.factories"))
+	assert.True(t, rule.Matches("META-INF/spring/aot.factories"))
+	assert.False(t, rule.Matches("META-INF/MANIFEST.MF"))
+	rule = MergeRule{Pattern: "META-INF/*.MF"}
+	assert.True(t, rule.Matches("META-INF/MANIFEST.MF"))
+	assert.False(t, rule.Matches("META-INF/services/MANIFEST.MF"))
+}
+
+func TestMergeStrategy(t *testing.T) {
+	f := &File{MergeRules: []MergeRule{
+		{Pattern: "META-INF/*", Strategy: MergeFirst},
+		{Pattern: "META-INF/services/*", Strategy: MergeLast},
+	}}
+	assert.Equal(t, MergeLast, f.mergeStrategy("META-INF/services/java.sql.Driver"))
+	assert.Equal(t, MergeFirst, f.mergeStrategy("META-INF/spring.factories"))
+	assert.Equal(t, MergeConcatenate, f.mergeStrategy("reference.conf"))
+	assert.Equal(t, MergeFirst, f.mergeStrategy("build_step.go"))
+	f.Strict = true
+	assert.Equal(t, MergeError, f.mergeStrategy("build_step.go"))
+}
+
+func TestMergeStrategies(t *testing.T) {
+	z1 := readZipFile(t, "tools/jarcat/zip/test_data_3/z1.zip")
+	z2 := readZipFile(t, "tools/jarcat/zip/test_data_3/z2.zip")
+	for strategy, expected := range map[MergeStrategy]string{
+		MergeFirst:       z1["reference.conf"],
+		MergeLast:        z2["reference.conf"],
+		MergeConcatenate: z1["reference.conf"] + z2["reference.conf"],
+	} {
+		f := NewFile("merge_strategies_test.zip", false)
+		f.MergeRules = []MergeRule{{Pattern: "reference.conf", Strategy: strategy}}
+		require.NoError(t, f.AddZipFile("tools/jarcat/zip/test_data_3/z1.zip"))
+		require.NoError(t, f.AddZipFile("tools/jarcat/zip/test_data_3/z2.zip"))
+		f.Close()
+		contents := readZipFile(t, "merge_strategies_test.zip")
+		assert.Equal(t, expected, contents["reference.conf"])
+		assert.Equal(t, z1["file1"], contents["file1"])
+	}
+
+	f := NewFile("merge_strategies_test.zip", false)
+	f.MergeRules = []MergeRule{{Pattern: "reference.conf", Strategy: MergeError}}
+	require.NoError(t, f.AddZipFile("tools/jarcat/zip/test_data_3/z1.zip"))
+	assert.Error(t, f.AddZipFile("tools/jarcat/zip/test_data_3/z2.zip"))
+}
+
+func TestMergeManifests(t *testing.T) {
+	f := NewFile("merge_manifests_test.zip", false)
+	f.MergeRules = []MergeRule{{Pattern: "META-INF/MANIFEST.MF", Strategy: MergeManifest}}
+	require.NoError(t, f.AddManifest("build.please.Main"))
+	require.NoError(t, f.WriteFile("META-INF/MANIFEST.MF", []byte("Manifest-Version: 1.0\r\n"+
+		"Main-Class: build.please.NotMain\r\n"+
+		"Implementation-Title: Please\r\n"+
+		"\r\n"+
+		"Name: build/please/\r\n"+
+		"Sealed: true\r\n")))
+	require.NoError(t, f.WriteFile("META-INF/MANIFEST.MF", []byte("Manifest-Version: 1.0\n"+
+		"Class-Path: lib/a-very-long-library-name-1.0.jar lib/another-very-long-library-name-2.0.jar\n"+
+		"\n"+
+		"Name: build/please/\n"+
+		"Sealed: false\n"+
+		"Implementation-Version: 12.0.0\n")))
+	f.Close()
+	assert.Equal(t, "Manifest-Version: 1.0\n"+
+		"Main-Class: build.please.Main\n"+
+		"Implementation-Title: Please\n"+
+		"Class-Path: lib/a-very-long-library-name-1.0.jar lib/another-very-long-l\n"+
+		" ibrary-name-2.0.jar\n"+
+		"\n"+
+		"Name: build/please/\n"+
+		"Sealed: true\n"+
+		"Implementation-Version: 12.0.0\n", readZipFile(t, "merge_manifests_test.zip")["META-INF/MANIFEST.MF"])
+}
+
+// readZipFile is a test utility that returns a map of filename -> contents for a zipfile.
+func readZipFile(t *testing.T, filename string) map[string]string {
+	r, err := zip.OpenReader(filename)
+	require.NoError(t, err)
+	defer r.Close()
+	m := map[string]string{}
+	for _, f := range r.File {
+		fr, err := f.Open()
+		require.NoError(t, err)
+		b, err := ioutil.ReadAll(fr)
+		require.NoError(t, err)
+		fr.Close()
+		m[f.Name] = string(b)
+	}
+	return m
+}
@@ -3,14 +3,17 @@ package zip
 
 import (
 	"bytes"
+	"compress/flate"
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,7 +23,13 @@ import (
 )
 
 var log = logging.MustGetLogger("zip")
-var modTime = time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// modTime is the modification time we give to every file in the zipfile.
+// It's overridden by $SOURCE_DATE_EPOCH if that's set.
+var modTime = sourceDateEpoch(time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+// uint32max is the largest size that doesn't require zip64 extensions.
+const uint32max = (1 << 32) - 1
 
 // fileHeaderLen is the length of a file header in a zipfile.
 // We need to know this to adjust alignment.
@@ -37,7 +46,11 @@ type File struct {
 	// Strict controls whether we deny duplicate files or not.
 	// Zipfiles can readily contain duplicates, if this is true we reject them unless they are identical.
 	// If false we allow duplicates and leave it to someone else to handle.
+	// It only applies to files that don't match any of the MergeRules.
 	Strict bool
+	// MergeRules control how we handle duplicate files matching particular patterns.
+	// The most specific (i.e. longest) matching pattern is used; they take precedence over the default rules.
+	MergeRules []MergeRule
 	// RenameDirs is a map of directories to rename, from the old name to the new one.
 	RenameDirs map[string]string
 	// StripPrefix is a prefix that is stripped off any files added with AddFiles.
@@ -56,10 +69,27 @@ type File struct {
 	DirEntries bool
 	// Align aligns entries to a multiple of this many bytes.
 	Align int
+	// PreserveOrder writes entries in the order they're added, rather than sorting them when
+	// the file is closed. This uses less memory, but the output then depends on the order of
+	// its inputs.
+	PreserveOrder bool
 	// files tracks the files that we've written so far.
 	files map[string]fileRecord
-	// concatenatedFiles tracks the files that are built up as we go.
-	concatenatedFiles map[string][]byte
+	// mergedFiles tracks the files that are built up as we go.
+	mergedFiles map[string][]byte
+	// lastFiles tracks the latest version of files that we keep the last one of.
+	lastFiles map[string]*entry
+	// entries are the files that we haven't written yet.
+	entries []*entry
+}
+
+// An entry is a file that's been added to the zipfile but not necessarily written yet.
+type entry struct {
+	zip.FileHeader
+	// The compressed contents of the file, or the zipfile & offset to copy them from.
+	data   []byte
+	source string
+	offset int64
 }
 
 // A fileRecord records some information about a file that we use to check if they're exact duplicates.
@@ -77,23 +107,29 @@ func NewFile(output string, strict bool) *File {
 		log.Fatalf("Failed to open output file: %s", err)
 	}
 	return &File{
-		f:                 f,
-		w:                 zip.NewWriter(f),
-		filename:          output,
-		Strict:            strict,
-		files:             map[string]fileRecord{},
-		concatenatedFiles: map[string][]byte{},
+		f:           f,
+		w:           zip.NewWriter(f),
+		filename:    output,
+		Strict:      strict,
+		files:       map[string]fileRecord{},
+		mergedFiles: map[string][]byte{},
+		lastFiles:   map[string]*entry{},
 	}
 }
 
 // Close must be called before the File is destroyed.
 func (f *File) Close() {
-	f.handleConcatenatedFiles()
+	if err := f.handleMergedFiles(); err != nil {
+		log.Fatalf("Failed to write merged files: %s", err)
+	}
 	if f.AddInitPy {
 		if err := f.AddInitPyFiles(); err != nil {
 			log.Fatalf("%s", err)
 		}
 	}
+	if err := f.writeEntries(); err != nil {
+		log.Fatalf("Failed to write zip file: %s", err)
+	}
 	if err := f.w.Close(); err != nil {
 		log.Fatalf("Failed to finalise zip file: %s", err)
 	}
@@ -122,24 +158,18 @@ func (f *File) AddZipFile(filepath string) error {
 		if !f.shouldInclude(rf.Name) {
 			continue
 		}
-		// This directory is very awkward. We need to merge the contents by concatenating them,
-		// we can't replace them or leave them out.
-		if strings.HasPrefix(rf.Name, "META-INF/services/") ||
-			strings.HasPrefix(rf.Name, "META-INF/spring") ||
-			rf.Name == "META-INF/please_sourcemap" ||
-			// akka libs each have their own reference.conf. if you are using
-			// akka as a lib-only (e.g akka-remote), those need to be merged together
-			rf.Name == "reference.conf" {
-			if err := f.concatenateFile(rf); err != nil {
-				return err
-			}
-			continue
-		}
 		hasTrailingSlash := strings.HasSuffix(rf.Name, "/")
 		isDir := hasTrailingSlash || rf.FileInfo().IsDir()
 		if isDir && !hasTrailingSlash {
 			rf.Name = rf.Name + "/"
 		}
+		strategy := f.mergeStrategy(rf.Name)
+		if !isDir && (strategy == MergeConcatenate || strategy == MergeManifest) {
+			if err := f.mergeFile(rf, strategy); err != nil {
+				return err
+			}
+			continue
+		}
 		if existing, present := f.files[rf.Name]; present {
 			// Allow duplicates of directories. Seemingly the best way to identify them is that
 			// they end in a trailing slash.
@@ -154,11 +184,13 @@ func (f *File) AddZipFile(filepath string) error {
 				log.Info("Skipping %s / %s: already added (from %s)", filepath, rf.Name, existing.ZipFile)
 				continue
 			}
-			if f.Strict {
+			if strategy == MergeError {
 				log.Error("Duplicate file %s (from %s, already added from %s); crc %d / %d", rf.Name, filepath, existing.ZipFile, rf.CRC32, existing.CRC32)
 				return fmt.Errorf("File %s already added to destination zip file (from %s)", rf.Name, existing.ZipFile)
+			} else if strategy != MergeLast {
+				continue
 			}
-			continue
+			log.Info("Replacing %s with the version from %s", rf.Name, filepath)
 		}
 		for before, after := range f.RenameDirs {
 			if strings.HasPrefix(rf.Name, before) {
@@ -172,19 +204,17 @@ func (f *File) AddZipFile(filepath string) error {
 		if f.StripPrefix != "" {
 			rf.Name = strings.TrimPrefix(rf.Name, f.StripPrefix)
 		}
-		// Java tools don't seem to like writing a data descriptor for stored items.
-		// Unsure if this is a limitation of the format or a problem of those tools.
-		rf.Flags = 0
 		f.addExistingFile(rf.Name, filepath, rf.CompressedSize64, rf.UncompressedSize64, rf.CRC32)
 
 		start, err := rf.DataOffset()
 		if err != nil {
 			return err
 		}
-		if _, err := r2.Seek(start, 0); err != nil {
-			return err
-		}
-		if err := f.addFile(&rf.FileHeader, r2, rf.CRC32); err != nil {
+		e := &entry{FileHeader: rf.FileHeader, source: filepath, offset: start}
+		if !isDir && strategy == MergeLast {
+			// Hold onto it until the end in case we find another one.
+			f.lastFiles[rf.Name] = e
+		} else if err := f.add(e, r2); err != nil {
 			return err
 		}
 	}
@@ -323,9 +353,8 @@ func (f *File) addExistingFile(name, file string, compressedSize, uncompressedSi
 	f.files[name] = fileRecord{file, compressedSize, uncompressedSize, crc}
 }
 
-// concatenateFile adds a file to the zip which is concatenated with any existing content with the same name.
-// Writing is deferred since we obviously can't append to it later.
-func (f *File) concatenateFile(zf *zip.File) error {
+// mergeFile adds a file to the zip which is merged with any existing content with the same name.
+func (f *File) mergeFile(zf *zip.File, strategy MergeStrategy) error {
 	r, err := zf.Open()
 	if err != nil {
 		return err
@@ -335,66 +364,225 @@ func (f *File) concatenateFile(zf *zip.File) error {
 	if _, err := io.Copy(&buf, r); err != nil {
 		return err
 	}
-	contents := buf.Bytes()
+	f.merge(zf.Name, buf.Bytes(), strategy)
+	return nil
+}
+
+// merge merges the given contents with any existing content for a file with the same name.
+// Writing is deferred since we obviously can't append to it later.
+func (f *File) merge(name string, contents []byte, strategy MergeStrategy) {
+	if strategy == MergeManifest {
+		f.mergedFiles[name] = mergeManifests(f.mergedFiles[name], contents)
+		return
+	}
 	if !bytes.HasSuffix(contents, []byte{'\n'}) {
 		contents = append(contents, '\n')
 	}
-	f.concatenatedFiles[zf.Name] = append(f.concatenatedFiles[zf.Name], contents...)
-	return nil
+	f.mergedFiles[name] = append(f.mergedFiles[name], contents...)
 }
 
-// handleConcatenatedFiles appends concatenated files to the archive's directory for writing.
-func (f *File) handleConcatenatedFiles() error {
+// handleMergedFiles appends merged files, and the last version of any files we
+// kept the last of, to the archive's directory for writing.
+func (f *File) handleMergedFiles() error {
 	// Must do it in a deterministic order
-	files := make([]string, 0, len(f.concatenatedFiles))
-	for name := range f.concatenatedFiles {
+	files := make([]string, 0, len(f.mergedFiles))
+	for name := range f.mergedFiles {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	for _, name := range files {
+		if err := f.writeFile(name, f.mergedFiles[name]); err != nil {
+			return err
+		}
+	}
+	files = files[:0]
+	for name := range f.lastFiles {
 		files = append(files, name)
 	}
 	sort.Strings(files)
 	for _, name := range files {
-		if err := f.WriteFile(name, f.concatenatedFiles[name]); err != nil {
+		e := f.lastFiles[name]
+		src, err := os.Open(e.source)
+		if err != nil {
+			return err
+		}
+		err = f.add(e, src)
+		src.Close()
+		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// addFile writes a file to the new writer.
-func (f *File) addFile(fh *zip.FileHeader, r io.Reader, crc uint32) error {
-	f.align(fh)
-	fh.Flags = 0 // we're not writing a data descriptor after the file
+// add adds an entry to the zipfile. It's written immediately if we're preserving the order of
+// entries, otherwise once everything else has been added. src is the file to copy its contents
+// from if it's from another zipfile.
+func (f *File) add(e *entry, src io.ReadSeeker) error {
+	normalise(&e.FileHeader)
+	if f.PreserveOrder {
+		return f.writeEntry(e, src)
+	}
+	f.entries = append(f.entries, e)
+	return nil
+}
+
+// writeEntries writes all the entries we haven't written yet, sorted by name.
+func (f *File) writeEntries() error {
+	sort.SliceStable(f.entries, func(i, j int) bool { return entryLess(f.entries[i].Name, f.entries[j].Name) })
+	// Entries from the same zipfile tend to be adjacent, so we only keep one of them open at once.
+	var src *os.File
+	defer func() {
+		if src != nil {
+			src.Close()
+		}
+	}()
+	for _, e := range f.entries {
+		if e.source != "" && (src == nil || src.Name() != e.source) {
+			if src != nil {
+				src.Close()
+			}
+			s, err := os.Open(e.source)
+			if err != nil {
+				return err
+			}
+			src = s
+		}
+		if err := f.writeEntry(e, src); err != nil {
+			return err
+		}
+	}
+	f.entries = nil
+	return nil
+}
+
+// writeEntry writes a single entry to the zipfile.
+func (f *File) writeEntry(e *entry, src io.ReadSeeker) error {
+	f.align(&e.FileHeader)
+	// Java tools don't seem to like writing a data descriptor for stored items.
+	// Unsure if this is a limitation of the format or a problem of those tools.
+	// Either way we always know the sizes in advance so don't need one.
+	e.Flags = 0
 	comp := func(w io.Writer) (io.WriteCloser, error) { return nopCloser{w}, nil }
-	fh.SetModTime(modTime)
-	fw, err := f.w.CreateHeaderWithCompressor(fh, comp, fixedCrc32{value: crc})
-	if err == nil {
-		_, err = io.CopyN(fw, r, int64(fh.CompressedSize64))
+	fw, err := f.w.CreateHeaderWithCompressor(&e.FileHeader, comp, fixedCrc32{value: e.CRC32})
+	if err != nil {
+		return err
+	} else if e.source == "" {
+		_, err = fw.Write(e.data)
+		return err
+	} else if _, err := src.Seek(e.offset, io.SeekStart); err != nil {
+		return err
 	}
+	_, err = io.CopyN(fw, src, int64(e.CompressedSize64))
 	return err
 }
 
+// entryLess returns true if the entry with name a should come before the one named b.
+// They're sorted by name except that the Java manifest has to come first, since
+// JarInputStream won't find it otherwise.
+func entryLess(a, b string) bool {
+	if ra, rb := entryRank(a), entryRank(b); ra != rb {
+		return ra < rb
+	}
+	return a < b
+}
+
+func entryRank(name string) int {
+	switch name {
+	case "META-INF/":
+		return 0
+	case "META-INF/MANIFEST.MF":
+		return 1
+	}
+	return 2
+}
+
+// normalise removes anything from a file header that could differ between otherwise identical
+// inputs, so that the same inputs always produce the same output.
+func normalise(fh *zip.FileHeader) {
+	fh.SetModTime(modTime)
+	fh.Comment = ""
+	// Extra fields commonly contain timestamps and user ids. Zip64 entries still need theirs.
+	if fh.CompressedSize64 < uint32max && fh.UncompressedSize64 < uint32max {
+		fh.Extra = nil
+	}
+	if strings.HasSuffix(fh.Name, "/") {
+		fh.SetMode(os.ModeDir | 0755)
+	} else if fh.Mode()&0111 != 0 {
+		fh.SetMode(0755)
+	} else {
+		fh.SetMode(0644)
+	}
+}
+
+// sourceDateEpoch returns the time given by $SOURCE_DATE_EPOCH, or the given default if it's not set.
+// See https://reproducible-builds.org/specs/source-date-epoch/ for more details.
+func sourceDateEpoch(def time.Time) time.Time {
+	s := os.Getenv("SOURCE_DATE_EPOCH")
+	if s == "" {
+		return def
+	}
+	secs, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		log.Warning("Invalid $SOURCE_DATE_EPOCH %s, ignoring", s)
+		return def
+	}
+	// Zipfiles can't represent times before 1980 and only have a resolution of two seconds.
+	if min := time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC); secs < min.Unix() {
+		return min
+	}
+	return time.Unix(secs-secs%2, 0).UTC()
+}
+
 // WriteFile writes a complete file to the writer.
+// If it's one that we merge the contents of, it's merged with any others of the same name.
 func (f *File) WriteFile(filename string, data []byte) error {
-	fh := zip.FileHeader{
-		Name:   filename,
-		Method: zip.Deflate,
+	if strategy := f.mergeStrategy(filename); strategy == MergeConcatenate || strategy == MergeManifest {
+		f.merge(filename, data, strategy)
+		return nil
 	}
-	fh.SetModTime(modTime)
+	return f.writeFile(filename, data)
+}
 
+// writeFile writes a complete file to the writer.
+func (f *File) writeFile(filename string, data []byte) error {
+	e := &entry{
+		FileHeader: zip.FileHeader{
+			Name:   filename,
+			Method: zip.Deflate,
+		},
+		data: data,
+	}
 	for _, ext := range f.StoreSuffix {
 		if strings.HasSuffix(filename, ext) {
-			fh.Method = zip.Store
+			e.Method = zip.Store
 			break
 		}
 	}
-
-	f.align(&fh)
-	if fw, err := f.w.CreateHeader(&fh); err != nil {
-		return err
-	} else if _, err := fw.Write(data); err != nil {
-		return err
+	if e.Method == zip.Deflate {
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, 5) // Same level the zip writer would use.
+		if _, err := w.Write(data); err != nil {
+			return err
+		} else if err := w.Close(); err != nil {
+			return err
+		}
+		e.data = buf.Bytes()
 	}
+	e.CRC32 = crc32.ChecksumIEEE(data)
+	e.UncompressedSize64 = uint64(len(data))
+	e.CompressedSize64 = uint64(len(e.data))
+	e.UncompressedSize = uint32(min64(e.UncompressedSize64, uint32max))
+	e.CompressedSize = uint32(min64(e.CompressedSize64, uint32max))
 	f.addExistingFile(filename, filename, 0, 0, 0)
-	return nil
+	return f.add(e, nil)
+}
+
+func min64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
 }
 
 // align writes any necessary bytes to align the next file.
@@ -413,16 +601,8 @@ func (f *File) align(h *zip.FileHeader) {
 // WriteDir writes a directory entry to the writer.
 func (f *File) WriteDir(filename string) error {
 	filename += "/" // Must have trailing slash to tell it it's a directory.
-	fh := zip.FileHeader{
-		Name:   filename,
-		Method: zip.Store,
-	}
-	fh.SetModTime(modTime)
-	if _, err := f.w.CreateHeader(&fh); err != nil {
-		return err
-	}
 	f.addExistingFile(filename, filename, 0, 0, 0)
-	return nil
+	return f.add(&entry{FileHeader: zip.FileHeader{Name: filename, Method: zip.Store}}, nil)
 }
 
 // WritePreamble writes a preamble to the zipfile.
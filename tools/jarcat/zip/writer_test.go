@@ -5,6 +5,9 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"path"
 	"strings"
 	"testing"
 	"time"
@@ -146,7 +149,71 @@ func TestStoreSuffix(t *testing.T) {
 	require.NoError(t, err)
 	defer r.Close()
 	assert.Equal(t, 3, len(r.File))
-	png := r.File[0]
+	png := r.File[2] // Entries are sorted by name.
 	assert.Equal(t, "tools/jarcat/zip/test_data/kitten.png", png.Name)
 	assert.Equal(t, zip.Store, png.Method)
 }
+
+func TestReproducible(t *testing.T) {
+	// Build the same archive twice from inputs created in a different order with
+	// different timestamps, permissions and zip metadata.
+	files := []string{"a.txt", "b/c.txt", "b/d.txt"}
+	writeTestInputs(t, files, 0644, time.Now(), "")
+	f := NewFile("reproducible_1.zip", false)
+	f.Suffix = []string{"zip"}
+	f.IncludeOther = true
+	require.NoError(t, f.AddFiles("reproducible_inputs"))
+	require.NoError(t, f.AddManifest("test.Main"))
+	f.Close()
+
+	writeTestInputs(t, []string{"b/d.txt", "a.txt", "b/c.txt"}, 0600, time.Now().Add(-time.Hour), "wibble")
+	f = NewFile("reproducible_2.zip", false)
+	f.Suffix = []string{"zip"}
+	f.IncludeOther = true
+	require.NoError(t, f.AddManifest("test.Main"))
+	require.NoError(t, f.AddFiles("reproducible_inputs"))
+	f.Close()
+
+	b1, err := ioutil.ReadFile("reproducible_1.zip")
+	require.NoError(t, err)
+	b2, err := ioutil.ReadFile("reproducible_2.zip")
+	require.NoError(t, err)
+	assert.Equal(t, b1, b2)
+
+	r, err := zip.OpenReader("reproducible_1.zip")
+	require.NoError(t, err)
+	defer r.Close()
+	expected := append(append([]string{"META-INF/MANIFEST.MF"}, files...), "reproducible_inputs/a.txt", "reproducible_inputs/b/c.txt", "reproducible_inputs/b/d.txt")
+	require.Equal(t, len(expected), len(r.File))
+	for i, f := range r.File {
+		assert.Equal(t, expected[i], f.Name)
+		assert.Equal(t, expectedModTime, f.ModTime())
+		assert.EqualValues(t, 0644, f.Mode())
+		assert.Equal(t, 0, len(f.Extra))
+		assert.Equal(t, "", f.Comment)
+	}
+}
+
+// writeTestInputs writes a set of loose files and a zipfile containing the same files, in the given order.
+func writeTestInputs(t *testing.T, files []string, mode os.FileMode, mtime time.Time, comment string) {
+	require.NoError(t, os.RemoveAll("reproducible_inputs"))
+	require.NoError(t, os.MkdirAll("reproducible_inputs", os.ModeDir|0755))
+	zf, err := os.Create("reproducible_inputs/test.zip")
+	require.NoError(t, err)
+	defer zf.Close()
+	w := zip.NewWriter(zf)
+	defer w.Close()
+	for _, file := range files {
+		filename := path.Join("reproducible_inputs", file)
+		require.NoError(t, os.MkdirAll(path.Dir(filename), os.ModeDir|0755))
+		require.NoError(t, ioutil.WriteFile(filename, []byte(file), mode))
+		require.NoError(t, os.Chmod(filename, mode))
+		require.NoError(t, os.Chtimes(filename, mtime, mtime))
+		fh := &zip.FileHeader{Name: file, Method: zip.Deflate, Modified: mtime, Comment: comment}
+		fh.SetMode(mode)
+		fw, err := w.CreateHeader(fh)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(file))
+		require.NoError(t, err)
+	}
+}
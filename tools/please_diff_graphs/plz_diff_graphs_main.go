@@ -46,6 +46,8 @@ the operation is non-commutative because targets that are added appear and those
 
 please_diff_graphs is mostly useful in conjunction with Please in a CI system; you can use it to
 formally determine what set of targets have changed in a diff and run the minimal set of affected tests.
+'plz query changes --since=<revision>' does the same thing in one step, without needing to
+generate the graphs separately.
 `,
 }
 
@@ -0,0 +1,19 @@
+package gomod
+
+import "fmt"
+
+// Download downloads a module from the proxy into the given directory, verifying it against
+// the given go.sum hash.
+func Download(proxy *Proxy, m Module, sum, dir string) error {
+	b, err := proxy.Zip(m)
+	if err != nil {
+		return fmt.Errorf("Failed to download %s: %s", m, err)
+	}
+	h, err := HashZip(b)
+	if err != nil {
+		return fmt.Errorf("Failed to read zip for %s: %s", m, err)
+	} else if h != sum {
+		return fmt.Errorf("Checksum mismatch for %s: expected %s but downloaded %s", m, sum, h)
+	}
+	return extractZip(b, m, dir)
+}
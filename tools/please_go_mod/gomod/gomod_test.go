@@ -0,0 +1,172 @@
+package gomod
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDir = "tools/please_go_mod/gomod/test_data"
+
+var proxy = NewProxy(path.Join(testDir, "proxy"))
+
+func TestBuildList(t *testing.T) {
+	r := newResolver(t, nil)
+	buildList, err := r.BuildList()
+	require.NoError(t, err)
+	// c is included since an older version of a requires it, even though that isn't selected.
+	assert.Equal(t, []Module{
+		{Path: "example.com/Quote", Version: "v1.0.0"},
+		{Path: "example.com/a", Version: "v1.1.0"},
+		{Path: "example.com/b", Version: "v1.2.0"},
+		{Path: "example.com/c", Version: "v1.0.0"},
+		{Path: "example.com/d", Version: "v1.0.0"},
+		{Path: "example.com/unused", Version: "v1.0.0"},
+	}, buildList)
+}
+
+func TestBuildListExclude(t *testing.T) {
+	r := newResolver(t, func(f *ModFile) {
+		f.Exclude = []Module{{Path: "example.com/b", Version: "v1.2.0"}}
+	})
+	buildList, err := r.BuildList()
+	require.NoError(t, err)
+	assert.Contains(t, buildList, Module{Path: "example.com/b", Version: "v1.3.0"})
+}
+
+func TestBuildListReplace(t *testing.T) {
+	r := newResolver(t, func(f *ModFile) {
+		f.Replace["example.com/a"] = Module{Path: "example.com/a", Version: "v1.0.0"}
+	})
+	buildList, err := r.BuildList()
+	require.NoError(t, err)
+	// The replacement doesn't require b v1.2.0 any more so we get the version the main module asks for.
+	assert.Contains(t, buildList, Module{Path: "example.com/b", Version: "v1.1.0"})
+}
+
+func TestRules(t *testing.T) {
+	r := newResolver(t, nil)
+	buildList, err := r.BuildList()
+	require.NoError(t, err)
+	rules, err := r.Rules(buildList)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, WriteRules(&buf, rules))
+	expected, err := ioutil.ReadFile(path.Join(testDir, "expected_rules.build"))
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), buf.String())
+}
+
+func TestRulesReplace(t *testing.T) {
+	r := newResolver(t, func(f *ModFile) {
+		f.Replace["example.com/d"] = Module{Path: "example.com/c", Version: "v1.0.0"}
+	})
+	b, err := ioutil.ReadFile(path.Join(testDir, "proxy/example.com/c/@v/v1.0.0.zip"))
+	require.NoError(t, err)
+	sum, err := HashZip(b)
+	require.NoError(t, err)
+	r.sums["example.com/c@v1.0.0"] = sum
+	buildList, err := r.BuildList()
+	require.NoError(t, err)
+	rules, err := r.Rules(buildList)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, WriteRules(&buf, rules[len(rules)-1:]))
+	// It should download the replacement but install it as the original.
+	assert.Equal(t, `go_get(
+    name = 'd',
+    get = 'example.com/d',
+    module = 'example.com/c',
+    revision = 'v1.0.0',
+    go_sum = '`+sum+`',
+)
+
+`, buf.String())
+}
+
+func TestRulesReplaceWithoutSum(t *testing.T) {
+	r := newResolver(t, func(f *ModFile) {
+		f.Replace["example.com/d"] = Module{Path: "example.com/c", Version: "v1.0.0"}
+	})
+	buildList, err := r.BuildList()
+	require.NoError(t, err)
+	_, err = r.Rules(buildList)
+	assert.Error(t, err)
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	r := newResolver(t, nil)
+	r.sums["example.com/d@v1.0.0/go.mod"] = "h1:J4uRCSbDERdSuSw1RiLofuIVXkkbMmLrWaDTilWRxTc="
+	_, err := r.BuildList()
+	assert.Error(t, err)
+}
+
+func TestRuleNames(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"github.com/pkg/errors":       "pkg_errors",
+		"github.com/go-errors/errors": "go-errors_errors",
+		"golang.org/x/net":            "net",
+		"gopkg.in/yaml.v2":            "yaml.v2",
+		"github.com/thing/thing/v2":   "thing",
+	}, ruleNames([]Module{
+		{Path: "github.com/pkg/errors"},
+		{Path: "github.com/go-errors/errors"},
+		{Path: "golang.org/x/net"},
+		{Path: "gopkg.in/yaml.v2"},
+		{Path: "github.com/thing/thing/v2"},
+	}))
+}
+
+func TestHashMod(t *testing.T) {
+	// This is the hash go.sum has for github.com/pkg/errors v0.8.1/go.mod, which doesn't have
+	// a go.mod file so the proxy synthesises one.
+	h, err := HashMod([]byte("module github.com/pkg/errors\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "h1:bwawxfHBFNV+L2hUp1rHADufV3IMtnDRdf1r5NINEl0=", h)
+}
+
+func TestDownload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "please_go_mod_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	m := Module{Path: "example.com/b", Version: "v1.2.0"}
+	assert.Error(t, Download(proxy, m, "h1:wrong", dir))
+	require.NoError(t, Download(proxy, m, "h1:bIfN4PWpCvYxPzA8c1OlyA1PxmFyWjSk4mbjWGXw0es=", dir))
+	b, err := ioutil.ReadFile(path.Join(dir, "util/util.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "package util")
+}
+
+func TestExtractZipOutsideDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "please_go_mod_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create("example.com/b@v1.2.0/../../evil.go")
+	require.NoError(t, err)
+	_, err = f.Write([]byte("package evil\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Error(t, extractZip(buf.Bytes(), Module{Path: "example.com/b", Version: "v1.2.0"}, path.Join(dir, "b")))
+	_, err = os.Stat(path.Join(dir, "evil.go"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// newResolver returns a new resolver for the test module, optionally modifying its go.mod first.
+func newResolver(t *testing.T, modify func(*ModFile)) *Resolver {
+	f, err := ReadModFile(path.Join(testDir, "main/go.mod"))
+	require.NoError(t, err)
+	sums, err := ReadSumFile(path.Join(testDir, "main/go.sum"))
+	require.NoError(t, err)
+	if modify != nil {
+		modify(f)
+	}
+	return NewResolver(proxy, f, path.Join(testDir, "main"), sums)
+}
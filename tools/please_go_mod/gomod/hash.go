@@ -0,0 +1,55 @@
+package gomod
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// HashZip returns the hash of a module zip file in the same format as go.sum.
+func HashZip(b []byte) (string, error) {
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return "", err
+	}
+	files := make(map[string]*zip.File, len(r.File))
+	names := make([]string, 0, len(r.File))
+	for _, f := range r.File {
+		files[f.Name] = f
+		names = append(names, f.Name)
+	}
+	return hash1(names, func(name string) (io.ReadCloser, error) { return files[name].Open() })
+}
+
+// HashMod returns the hash of a go.mod file in the same format as go.sum.
+func HashMod(b []byte) (string, error) {
+	return hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	})
+}
+
+// hash1 implements the "h1" hash used by go.sum, which is a SHA-256 of a summary
+// containing the SHA-256 and name of each file in sorted order.
+func hash1(names []string, open func(string) (io.ReadCloser, error)) (string, error) {
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		r, err := open(name)
+		if err != nil {
+			return "", err
+		}
+		hf := sha256.New()
+		_, err = io.Copy(hf, r)
+		r.Close()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%x  %s\n", hf.Sum(nil), name)
+	}
+	return "h1:" + base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,186 @@
+// Package gomod implements reading Go modules and resolving their dependencies, so we can
+// generate go_get rules for them.
+package gomod
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"gopkg.in/op/go-logging.v1"
+)
+
+var log = logging.MustGetLogger("gomod")
+
+// A Module is a single version of a Go module.
+type Module struct {
+	Path, Version string
+}
+
+// String returns the usual path@version representation of a module.
+func (m Module) String() string {
+	if m.Version == "" {
+		return m.Path
+	}
+	return m.Path + "@" + m.Version
+}
+
+// A ModFile is the parsed contents of a go.mod file.
+// Only the parts we care about are represented here.
+type ModFile struct {
+	Module  string
+	Require []Module
+	Exclude []Module
+	// Replacements, keyed by either path or path@version. Replacements with a local
+	// directory have an empty version.
+	Replace map[string]Module
+}
+
+// ReadModFile reads a go.mod file from the given filename.
+func ReadModFile(filename string) (*ModFile, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseModFile(b)
+}
+
+// ParseModFile parses the contents of a go.mod file.
+func ParseModFile(data []byte) (*ModFile, error) {
+	f := &ModFile{Replace: map[string]Module{}}
+	block := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineno := 1; scanner.Scan(); lineno++ {
+		fields, err := splitLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("go.mod:%d: %s", lineno, err)
+		} else if len(fields) == 0 {
+			continue
+		} else if block != "" {
+			if fields[0] == ")" {
+				block = ""
+			} else if err := f.addLine(block, fields); err != nil {
+				return nil, fmt.Errorf("go.mod:%d: %s", lineno, err)
+			}
+		} else if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+		} else if err := f.addLine(fields[0], fields[1:]); err != nil {
+			return nil, fmt.Errorf("go.mod:%d: %s", lineno, err)
+		}
+	}
+	return f, scanner.Err()
+}
+
+// addLine adds a single directive to this file.
+func (f *ModFile) addLine(verb string, args []string) error {
+	switch verb {
+	case "module":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: module path")
+		}
+		f.Module = args[0]
+	case "require", "exclude":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: %s module/path v1.2.3", verb)
+		}
+		if verb == "require" {
+			f.Require = append(f.Require, Module{Path: args[0], Version: args[1]})
+		} else {
+			f.Exclude = append(f.Exclude, Module{Path: args[0], Version: args[1]})
+		}
+	case "replace":
+		// Either path [version] => path version or path [version] => directory
+		arrow := 0
+		for i, arg := range args {
+			if arg == "=>" {
+				arrow = i
+			}
+		}
+		if arrow < 1 || arrow > 2 || len(args)-arrow-1 < 1 || len(args)-arrow-1 > 2 {
+			return fmt.Errorf("usage: replace module/path [v1.2.3] => other/module v1.4.5 or directory")
+		}
+		key := args[0]
+		if arrow == 2 {
+			key += "@" + args[1]
+		}
+		to := Module{Path: args[arrow+1]}
+		if len(args) == arrow+3 {
+			to.Version = args[arrow+2]
+		}
+		f.Replace[key] = to
+	case "go":
+		// We don't care about the Go version.
+	default:
+		log.Warning("Unknown directive in go.mod: %s", verb)
+	}
+	return nil
+}
+
+// Replacement returns the replacement for a module, or the module itself if it isn't replaced.
+func (f *ModFile) Replacement(m Module) Module {
+	if r, present := f.Replace[m.String()]; present {
+		return r
+	} else if r, present := f.Replace[m.Path]; present {
+		return r
+	}
+	return m
+}
+
+// Excluded returns true if the given module version is excluded by this file.
+func (f *ModFile) Excluded(m Module) bool {
+	for _, e := range f.Exclude {
+		if e == m {
+			return true
+		}
+	}
+	return false
+}
+
+// splitLine splits a line of a go.mod file into its fields, removing comments and unquoting
+// any quoted strings.
+func splitLine(line string) ([]string, error) {
+	fields := []string{}
+	for line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "//"); line = strings.TrimSpace(line) {
+		if line[0] == '"' || line[0] == '`' {
+			prefix, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				return nil, err
+			}
+			s, _ := strconv.Unquote(prefix)
+			fields = append(fields, s)
+			line = line[len(prefix):]
+			continue
+		}
+		end := strings.IndexAny(line, " \t")
+		if end == -1 {
+			end = len(line)
+		}
+		if idx := strings.Index(line[:end], "//"); idx != -1 {
+			end = idx
+		}
+		fields = append(fields, line[:end])
+		line = line[end:]
+	}
+	return fields, nil
+}
+
+// ReadSumFile reads a go.sum file and returns its hashes, keyed by path@version for the hashes
+// of module contents and path@version/go.mod for their go.mod files.
+func ReadSumFile(filename string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	sums := map[string]string{}
+	for i, line := range strings.Split(string(b), "\n") {
+		if fields := strings.Fields(line); len(fields) == 3 {
+			sums[fields[0]+"@"+fields[1]] = fields[2]
+		} else if len(fields) != 0 {
+			return nil, fmt.Errorf("%s:%d: malformed line", filename, i+1)
+		}
+	}
+	return sums, nil
+}
@@ -0,0 +1,57 @@
+package gomod
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testModFile = `// The main module.
+module "example.com/main"
+
+go 1.11
+
+require example.com/a v1.1.0
+require (
+	example.com/b v1.1.0 // indirect
+	"example.com/c" v1.0.0
+)
+
+exclude example.com/b v1.2.0
+
+replace (
+	example.com/c => example.com/c2 v1.0.1
+	example.com/d v1.0.0 => ../d
+)
+`
+
+func TestParseModFile(t *testing.T) {
+	f, err := ParseModFile([]byte(testModFile))
+	require.NoError(t, err)
+	assert.Equal(t, "example.com/main", f.Module)
+	assert.Equal(t, []Module{
+		{Path: "example.com/a", Version: "v1.1.0"},
+		{Path: "example.com/b", Version: "v1.1.0"},
+		{Path: "example.com/c", Version: "v1.0.0"},
+	}, f.Require)
+	assert.True(t, f.Excluded(Module{Path: "example.com/b", Version: "v1.2.0"}))
+	assert.False(t, f.Excluded(Module{Path: "example.com/b", Version: "v1.1.0"}))
+	assert.Equal(t, Module{Path: "example.com/c2", Version: "v1.0.1"}, f.Replacement(Module{Path: "example.com/c", Version: "v1.0.0"}))
+	assert.Equal(t, Module{Path: "../d"}, f.Replacement(Module{Path: "example.com/d", Version: "v1.0.0"}))
+	assert.Equal(t, Module{Path: "example.com/d", Version: "v1.1.0"}, f.Replacement(Module{Path: "example.com/d", Version: "v1.1.0"}))
+}
+
+func TestParseModFileErrors(t *testing.T) {
+	_, err := ParseModFile([]byte("module example.com/main\nrequire example.com/a\n"))
+	assert.Error(t, err)
+	_, err = ParseModFile([]byte("replace example.com/a v1.0.0\n"))
+	assert.Error(t, err)
+}
+
+func TestReadSumFile(t *testing.T) {
+	sums, err := ReadSumFile("tools/please_go_mod/gomod/test_data/main/go.sum")
+	require.NoError(t, err)
+	assert.Equal(t, "h1:W6wX+EIU/PYNofbrW6BCUefb+/V7P2k8O9A+LipaHZc=", sums["example.com/a@v1.1.0"])
+	assert.Equal(t, "h1:i5j4jcxcbmmikWYTYlWCO7ahiZnAocvCUAZBt9yxxH8=", sums["example.com/a@v1.1.0/go.mod"])
+}
@@ -0,0 +1,154 @@
+package gomod
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+)
+
+// A Resolver resolves the build list of a main module using minimal version selection,
+// as described at https://research.swtch.com/vgo-mvs.
+type Resolver struct {
+	proxy *Proxy
+	main  *ModFile
+	// Directory containing the main module, which local replacements are relative to.
+	dir string
+	// Hashes from the main module's go.sum.
+	sums map[string]string
+	// Requirements of each module we've seen so far.
+	reqs map[Module][]Module
+}
+
+// NewResolver creates a new Resolver for the main module in the given directory.
+// sums may be nil if there's no go.sum file, in which case nothing will be verified.
+func NewResolver(proxy *Proxy, main *ModFile, dir string, sums map[string]string) *Resolver {
+	return &Resolver{
+		proxy: proxy,
+		main:  main,
+		dir:   dir,
+		sums:  sums,
+		reqs:  map[Module][]Module{},
+	}
+}
+
+// BuildList returns the build list for the main module, i.e. the selected version of each
+// module it transitively requires (excluding itself), sorted by path.
+func (r *Resolver) BuildList() ([]Module, error) {
+	main := Module{Path: r.main.Module}
+	r.reqs[main] = r.main.Require
+	// Find the maximum required version of each module reachable from anything at all.
+	selected := map[string]string{}
+	if err := r.walk(main, map[Module]bool{}, func(m Module) {
+		if v, present := selected[m.Path]; !present || CompareVersions(m.Version, v) > 0 {
+			selected[m.Path] = m.Version
+		}
+	}); err != nil {
+		return nil, err
+	}
+	ret := make([]Module, 0, len(selected))
+	for modPath, version := range selected {
+		ret = append(ret, Module{Path: modPath, Version: version})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Path < ret[j].Path })
+	return ret, nil
+}
+
+// walk walks the module graph from the given module, calling visit for each requirement.
+func (r *Resolver) walk(m Module, seen map[Module]bool, visit func(Module)) error {
+	reqs, err := r.requirements(m)
+	if err != nil {
+		return err
+	}
+	for _, req := range reqs {
+		if req.Path != r.main.Module && !seen[req] {
+			seen[req] = true
+			visit(req)
+			if err := r.walk(req, seen, visit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// requirements returns the requirements of a single module.
+func (r *Resolver) requirements(m Module) ([]Module, error) {
+	if reqs, present := r.reqs[m]; present {
+		return reqs, nil
+	}
+	b, err := r.modFile(m)
+	if err != nil {
+		return nil, err
+	}
+	f, err := ParseModFile(b)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse go.mod for %s: %s", m, err)
+	}
+	reqs := make([]Module, 0, len(f.Require))
+	for _, req := range f.Require {
+		// Only the main module's exclusions apply.
+		if req, err = r.unexclude(req); err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+	r.reqs[m] = reqs
+	return reqs, nil
+}
+
+// modFile returns the contents of the go.mod file for a module, verifying it against go.sum.
+func (r *Resolver) modFile(m Module) ([]byte, error) {
+	replacement := r.main.Replacement(m)
+	if replacement.Version == "" {
+		return ioutil.ReadFile(path.Join(r.dir, replacement.Path, "go.mod"))
+	}
+	b, err := r.proxy.Mod(replacement)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch go.mod for %s: %s", replacement, err)
+	}
+	return b, r.verify(replacement.String()+"/go.mod", b, HashMod)
+}
+
+// unexclude returns the next version of a module that isn't excluded by the main module.
+func (r *Resolver) unexclude(m Module) (Module, error) {
+	if !r.main.Excluded(m) {
+		return m, nil
+	}
+	versions, err := r.proxy.Versions(m.Path)
+	if err != nil {
+		return m, fmt.Errorf("Failed to list versions of %s: %s", m.Path, err)
+	}
+	sort.Slice(versions, func(i, j int) bool { return CompareVersions(versions[i], versions[j]) < 0 })
+	for _, v := range versions {
+		if next := (Module{Path: m.Path, Version: v}); CompareVersions(v, m.Version) > 0 && !r.main.Excluded(next) {
+			log.Debug("%s is excluded, using %s instead", m, next)
+			return next, nil
+		}
+	}
+	return m, fmt.Errorf("%s is excluded and there is no later version", m)
+}
+
+// Sum returns the go.sum hash for a module's contents, or the empty string if there isn't one.
+func (r *Resolver) Sum(m Module) string {
+	return r.sums[r.main.Replacement(m).String()]
+}
+
+// verify verifies some downloaded content against go.sum, if we have a go.sum file.
+func (r *Resolver) verify(key string, b []byte, hash func([]byte) (string, error)) error {
+	if r.sums == nil {
+		return nil
+	}
+	expected, present := r.sums[key]
+	if !present {
+		log.Warning("No hash for %s in go.sum", key)
+		return nil
+	}
+	h, err := hash(b)
+	if err != nil {
+		return err
+	} else if h != expected {
+		return fmt.Errorf("Checksum mismatch for %s: go.sum has %s but downloaded %s", key, expected, h)
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package gomod
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A Rule describes the go_get rule for a single module.
+type Rule struct {
+	Name   string
+	Module Module
+	// The module to download for it, which is different if go.mod replaces it with another.
+	Download Module
+	// Hash of the downloaded module's contents from go.sum.
+	Sum string
+	// Packages within the module to install, relative to its root (which is the empty string).
+	Install []string
+	// Names of the rules for other modules that this one depends on.
+	Deps []string
+}
+
+// A packageScanner finds the packages used from each module and the dependencies between them.
+type packageScanner struct {
+	*Resolver
+	buildList []Module
+	// Temporary directory that module sources are extracted into.
+	tmpDir string
+	// Directory that each module's source is in, once we've got it.
+	dirs map[string]string
+	// Packages used from each module.
+	used map[string]map[string]bool
+	// Modules that each module depends on.
+	deps map[string]map[string]bool
+}
+
+// Rules returns the go_get rules needed for the given build list. Only modules providing
+// packages that the main module imports (transitively) get rules, and only the packages
+// it needs from each are installed.
+func (r *Resolver) Rules(buildList []Module) ([]*Rule, error) {
+	tmpDir, err := ioutil.TempDir("", "please_go_mod")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	s := &packageScanner{
+		Resolver:  r,
+		buildList: buildList,
+		tmpDir:    tmpDir,
+		dirs:      map[string]string{r.main.Module: r.dir},
+		used:      map[string]map[string]bool{},
+		deps:      map[string]map[string]bool{},
+	}
+	imports, err := s.mainImports()
+	if err != nil {
+		return nil, err
+	}
+	for _, imp := range imports {
+		if err := s.scan(r.main.Module, imp); err != nil {
+			return nil, err
+		}
+	}
+	return s.rules()
+}
+
+// mainImports returns all the imports of packages in the main module, including its tests.
+func (s *packageScanner) mainImports() ([]string, error) {
+	imports := map[string]bool{}
+	err := filepath.Walk(s.dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if !info.IsDir() {
+			return nil
+		} else if base := info.Name(); name != s.dir && (base == "vendor" || base == "testdata" || base == "plz-out" || strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_")) {
+			return filepath.SkipDir
+		} else if _, err := os.Stat(path.Join(name, "go.mod")); err == nil && name != s.dir {
+			return filepath.SkipDir // Nested module, which isn't part of this one.
+		}
+		pkg, err := build.ImportDir(name, 0)
+		if err != nil {
+			if _, ok := err.(*build.NoGoError); !ok {
+				log.Warning("Failed to read package in %s: %s", name, err)
+			}
+			return nil
+		}
+		for _, l := range [][]string{pkg.Imports, pkg.TestImports, pkg.XTestImports} {
+			for _, imp := range l {
+				imports[imp] = true
+			}
+		}
+		return nil
+	})
+	ret := make([]string, 0, len(imports))
+	for imp := range imports {
+		ret = append(ret, imp)
+	}
+	sort.Strings(ret)
+	return ret, err
+}
+
+// scan scans a single imported package and its dependencies. from is the module importing it.
+func (s *packageScanner) scan(from, importPath string) error {
+	if isStdlib(importPath) {
+		return nil
+	}
+	m, present := s.moduleFor(importPath)
+	if !present {
+		log.Warning("No module provides package %s", importPath)
+		return nil
+	} else if m.Path == s.main.Module {
+		return nil // This is the main module's own package which we've already got.
+	}
+	if m.Path != from {
+		if s.deps[from] == nil {
+			s.deps[from] = map[string]bool{}
+		}
+		s.deps[from][m.Path] = true
+	}
+	rel := strings.TrimPrefix(strings.TrimPrefix(importPath, m.Path), "/")
+	if s.used[m.Path][rel] {
+		return nil
+	} else if s.used[m.Path] == nil {
+		s.used[m.Path] = map[string]bool{}
+	}
+	s.used[m.Path][rel] = true
+	dir, err := s.moduleDir(m)
+	if err != nil {
+		return err
+	}
+	pkg, err := build.ImportDir(path.Join(dir, rel), 0)
+	if err != nil {
+		return fmt.Errorf("Failed to read package %s from %s: %s", importPath, m, err)
+	}
+	for _, imp := range pkg.Imports {
+		if err := s.scan(m.Path, imp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moduleFor returns the module in the build list that provides the given package.
+// This is the one with the longest path that is a prefix of it.
+func (s *packageScanner) moduleFor(importPath string) (Module, bool) {
+	if importPath == s.main.Module || strings.HasPrefix(importPath, s.main.Module+"/") {
+		return Module{Path: s.main.Module}, true
+	}
+	best := Module{}
+	for _, m := range s.buildList {
+		if (importPath == m.Path || strings.HasPrefix(importPath, m.Path+"/")) && len(m.Path) > len(best.Path) {
+			best = m
+		}
+	}
+	return best, best.Path != ""
+}
+
+// moduleDir returns the directory containing the given module's source, downloading it if needed.
+func (s *packageScanner) moduleDir(m Module) (string, error) {
+	if dir, present := s.dirs[m.Path]; present {
+		return dir, nil
+	}
+	replacement := s.main.Replacement(m)
+	if replacement.Version == "" {
+		log.Warning("%s is replaced by local directory %s; you'll need to write rules for it yourself", m.Path, replacement.Path)
+		dir := path.Join(s.dir, replacement.Path)
+		s.dirs[m.Path] = dir
+		return dir, nil
+	}
+	log.Notice("Downloading %s...", replacement)
+	b, err := s.proxy.Zip(replacement)
+	if err != nil {
+		return "", fmt.Errorf("Failed to download %s: %s", replacement, err)
+	} else if err := s.verify(replacement.String(), b, HashZip); err != nil {
+		return "", err
+	}
+	dir := path.Join(s.tmpDir, EscapePath(replacement.String()))
+	if err := extractZip(b, replacement, dir); err != nil {
+		return "", err
+	}
+	s.dirs[m.Path] = dir
+	return dir, nil
+}
+
+// rules returns the rules for all the modules that we've found to be used.
+func (s *packageScanner) rules() ([]*Rule, error) {
+	modules := []Module{}
+	for _, m := range s.buildList {
+		if s.used[m.Path] != nil && s.main.Replacement(m).Version != "" {
+			modules = append(modules, m)
+		}
+	}
+	names := ruleNames(modules)
+	rules := make([]*Rule, len(modules))
+	for i, m := range modules {
+		rule := &Rule{Name: names[m.Path], Module: m, Download: s.main.Replacement(m), Sum: s.Sum(m)}
+		if rule.Download != m && rule.Sum == "" {
+			// Without a hash go_get can only fetch the module from its original path.
+			return nil, fmt.Errorf("%s is replaced by %s, but there's no hash for it in go.sum", m, rule.Download)
+		}
+		for pkg := range s.used[m.Path] {
+			rule.Install = append(rule.Install, pkg)
+		}
+		for dep := range s.deps[m.Path] {
+			if name, present := names[dep]; present {
+				rule.Deps = append(rule.Deps, name)
+			}
+		}
+		sort.Strings(rule.Install)
+		sort.Strings(rule.Deps)
+		rules[i] = rule
+	}
+	return rules, s.checkCycles(modules)
+}
+
+// checkCycles returns an error if there are any dependency cycles between modules, which can
+// happen even though packages can't import one another cyclically.
+func (s *packageScanner) checkCycles(modules []Module) error {
+	done := map[string]bool{}
+	var visit func(m string, stack []string) error
+	visit = func(m string, stack []string) error {
+		for i, m2 := range stack {
+			if m2 == m {
+				return fmt.Errorf("Dependency cycle between modules: %s", strings.Join(append(stack[i:], m), " -> "))
+			}
+		}
+		if done[m] {
+			return nil
+		}
+		deps := []string{}
+		for dep := range s.deps[m] {
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if err := visit(dep, append(stack, m)); err != nil {
+				return err
+			}
+		}
+		done[m] = true
+		return nil
+	}
+	for _, m := range modules {
+		if err := visit(m.Path, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ruleNames returns names for the rules for each module; by default the last part of the path
+// (ignoring any major version suffix), or enough of the path to make it unique.
+func ruleNames(modules []Module) map[string]string {
+	names := map[string]string{}
+	for n := 1; len(names) < len(modules); n++ {
+		candidates := map[string][]string{}
+		for _, m := range modules {
+			if _, present := names[m.Path]; !present {
+				name := ruleName(m.Path, n)
+				candidates[name] = append(candidates[name], m.Path)
+			}
+		}
+		for name, paths := range candidates {
+			if len(paths) == 1 {
+				names[paths[0]] = name
+			} else if n > strings.Count(strings.Join(paths, "/"), "/") {
+				// We've run out of path to disambiguate them with (which is pretty unlikely).
+				for i, p := range paths {
+					names[p] = fmt.Sprintf("%s_%d", name, i+1)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// ruleName returns a name for a module path made from its last n elements.
+func ruleName(modPath string, n int) string {
+	parts := strings.Split(modPath, "/")
+	if last := parts[len(parts)-1]; len(parts) > 1 && len(last) > 1 && last[0] == 'v' && strings.Trim(last[1:], "0123456789") == "" {
+		parts = parts[:len(parts)-1] // Major version suffix, e.g. github.com/thing/v2
+	}
+	if n < len(parts) {
+		parts = parts[len(parts)-n:]
+	}
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, strings.Join(parts, "_"))
+}
+
+// isStdlib returns true if the given import path is part of the standard library, which
+// we identify by its first element not having a dot in it.
+func isStdlib(importPath string) bool {
+	return !strings.Contains(strings.SplitN(importPath, "/", 2)[0], ".")
+}
+
+// extractZip extracts a module zip file into the given directory.
+// It's an error for any file in it to be outside that directory.
+func extractZip(b []byte, m Module, dir string) error {
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return err
+	}
+	prefix := m.String() + "/"
+	for _, f := range r.File {
+		if !strings.HasPrefix(f.Name, prefix) {
+			return fmt.Errorf("Unexpected file in zip for %s: %s", m, f.Name)
+		} else if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		filename := path.Join(dir, strings.TrimPrefix(f.Name, prefix))
+		if rel, err := filepath.Rel(dir, filename); err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			return fmt.Errorf("Invalid file in zip for %s, it's outside the module: %s", m, f.Name)
+		}
+		if err := extractFile(f, filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractFile(f *zip.File, filename string) error {
+	if err := os.MkdirAll(path.Dir(filename), 0755); err != nil {
+		return err
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode()|0644)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
@@ -0,0 +1,28 @@
+package gomod
+
+import (
+	"io"
+	"text/template"
+)
+
+const goGetTemplate = `{{ range . }}go_get(
+    name = '{{ .Name }}',
+    get = '{{ .Module.Path }}',{{ if ne .Download.Path .Module.Path }}
+    module = '{{ .Download.Path }}',{{ end }}
+    revision = '{{ .Download.Version }}',{{ if .Sum }}
+    go_sum = '{{ .Sum }}',{{ end }}{{ if ne (len .Install) 1 | or (index .Install 0) }}
+    install = [
+{{ range .Install }}        '{{ . }}',
+{{ end }}    ],{{ end }}{{ if .Deps }}
+    deps = [
+{{ range .Deps }}        ':{{ . }}',
+{{ end }}    ],{{ end }}
+)
+
+{{ end }}`
+
+// WriteRules writes go_get rules for the given rules, in a format suitable for pasting into
+// a BUILD file.
+func WriteRules(w io.Writer, rules []*Rule) error {
+	return template.Must(template.New("go_get").Parse(goGetTemplate)).Execute(w, rules)
+}
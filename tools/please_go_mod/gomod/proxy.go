@@ -0,0 +1,64 @@
+package gomod
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// A Proxy fetches files from a Go module proxy, as described by 'go help goproxy'.
+// It can be either a remote URL or a local directory in the same layout.
+type Proxy struct {
+	url    string
+	client *http.Client
+}
+
+// NewProxy returns a new Proxy fetching from the given URL or directory.
+func NewProxy(url string) *Proxy {
+	url = strings.TrimSuffix(url, "/")
+	if strings.HasPrefix(url, "http:") {
+		log.Warning("Proxy URL %s is not secure, you should really be using https", url)
+	}
+	return &Proxy{url: url, client: &http.Client{Timeout: 60 * time.Second}}
+}
+
+// Mod returns the go.mod file for a module.
+func (p *Proxy) Mod(m Module) ([]byte, error) {
+	return p.fetch(m.Path, m.Version+".mod")
+}
+
+// Zip returns the zip file containing a module's source.
+func (p *Proxy) Zip(m Module) ([]byte, error) {
+	return p.fetch(m.Path, m.Version+".zip")
+}
+
+// Versions returns the known versions of a module.
+func (p *Proxy) Versions(modPath string) ([]string, error) {
+	b, err := p.fetch(modPath, "list")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(b)), nil
+}
+
+// fetch fetches a single file from the proxy.
+func (p *Proxy) fetch(modPath, filename string) ([]byte, error) {
+	url := p.url + "/" + EscapePath(modPath) + "/@v/" + filename
+	if !strings.HasPrefix(url, "http:") && !strings.HasPrefix(url, "https:") {
+		log.Debug("Reading %s", url)
+		return ioutil.ReadFile(path.Clean(strings.TrimPrefix(url, "file://")))
+	}
+	log.Debug("Fetching %s", url)
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to fetch %s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,8 @@
+module example.com/main
+
+require (
+	example.com/a v1.1.0
+	example.com/b v1.1.0
+	example.com/d v1.0.0
+	example.com/unused v1.0.0 // indirect
+)
@@ -0,0 +1,6 @@
+package lib
+
+import _ "example.com/b"
+
+// Lib is a library.
+const Lib = "lib"
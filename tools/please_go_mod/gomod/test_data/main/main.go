@@ -0,0 +1,13 @@
+package main
+
+import (
+	"fmt"
+
+	"example.com/a"
+	"example.com/d"
+	"example.com/main/lib"
+)
+
+func main() {
+	fmt.Println(a.A, d.D, lib.Lib)
+}
@@ -0,0 +1,3 @@
+module example.com/Quote
+
+require example.com/a v1.0.0
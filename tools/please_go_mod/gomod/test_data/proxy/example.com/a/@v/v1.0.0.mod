@@ -0,0 +1,3 @@
+module example.com/a
+
+require example.com/c v1.0.0
@@ -0,0 +1,6 @@
+module example.com/d
+
+require (
+	example.com/Quote v1.0.0
+	example.com/a v1.0.0 // indirect
+)
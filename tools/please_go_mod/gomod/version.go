@@ -0,0 +1,103 @@
+package gomod
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersions compares two semantic versions as Go does, returning -1, 0 or 1 if a is
+// respectively less than, equal to or greater than b. Build metadata (e.g. +incompatible) is
+// ignored, and pseudo-versions are prereleases so sort below the release they precede.
+func CompareVersions(a, b string) int {
+	a, aPre := splitVersion(a)
+	b, bPre := splitVersion(b)
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		if c := compareNumeric(element(as, i), element(bs, i)); c != 0 {
+			return c
+		}
+	}
+	if aPre == bPre {
+		return 0
+	} else if aPre == "" {
+		return 1
+	} else if bPre == "" {
+		return -1
+	}
+	as = strings.Split(aPre, ".")
+	bs = strings.Split(bPre, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := comparePrerelease(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(as), len(bs))
+}
+
+// splitVersion splits a version into its release and prerelease parts.
+func splitVersion(v string) (string, string) {
+	v = strings.TrimPrefix(v, "v")
+	if idx := strings.IndexByte(v, '+'); idx != -1 {
+		v = v[:idx]
+	}
+	if idx := strings.IndexByte(v, '-'); idx != -1 {
+		return v[:idx], v[idx+1:]
+	}
+	return v, ""
+}
+
+func element(s []string, i int) string {
+	if i < len(s) {
+		return s[i]
+	}
+	return "0"
+}
+
+// comparePrerelease compares two prerelease identifiers; numeric ones sort below alphanumeric ones.
+func comparePrerelease(a, b string) int {
+	_, aErr := strconv.Atoi(a)
+	_, bErr := strconv.Atoi(b)
+	if aErr == nil && bErr == nil {
+		return compareNumeric(a, b)
+	} else if aErr == nil {
+		return -1
+	} else if bErr == nil {
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// compareNumeric compares two strings of digits without worrying about how big they are.
+func compareNumeric(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if c := compareInts(len(a), len(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// EscapePath escapes a module path for use in a URL or filename, which replaces each
+// upper-case letter with an exclamation mark followed by the lower-case letter.
+func EscapePath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteByte('!')
+			b.WriteRune(r + 'a' - 'A')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,24 @@
+package gomod
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 0, CompareVersions("v1.2.3", "v1.2.3"))
+	assert.Equal(t, -1, CompareVersions("v1.2.3", "v1.10.0"))
+	assert.Equal(t, 1, CompareVersions("v2.0.0+incompatible", "v1.10.0"))
+	assert.Equal(t, 0, CompareVersions("v2.0.0+incompatible", "v2.0.0"))
+	assert.Equal(t, -1, CompareVersions("v1.2.0-rc.1", "v1.2.0"))
+	assert.Equal(t, -1, CompareVersions("v1.2.0-rc.2", "v1.2.0-rc.10"))
+	assert.Equal(t, -1, CompareVersions("v1.2.0-rc", "v1.2.0-rc.1"))
+	assert.Equal(t, 1, CompareVersions("v0.0.0-20180801120000-abcdef123456", "v0.0.0-20180701120000-fedcba654321"))
+	assert.Equal(t, -1, CompareVersions("v0.0.0-20180801120000-abcdef123456", "v0.1.0"))
+}
+
+func TestEscapePath(t *testing.T) {
+	assert.Equal(t, "github.com/!burnt!sushi/toml", EscapePath("github.com/BurntSushi/toml"))
+	assert.Equal(t, "golang.org/x/net", EscapePath("golang.org/x/net"))
+}
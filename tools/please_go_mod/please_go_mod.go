@@ -0,0 +1,92 @@
+// Package main implements please_go_mod, which generates go_get rules for the dependencies
+// of a Go module from its go.mod and go.sum files, and downloads modules for those rules.
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/op/go-logging.v1"
+
+	"cli"
+	"tools/please_go_mod/gomod"
+)
+
+var log = logging.MustGetLogger("please_go_mod")
+
+var opts = struct {
+	Usage     string
+	Verbosity int    `short:"v" long:"verbose" default:"1" description:"Verbosity of output (higher number = more output, default 1 -> warnings and errors only)"`
+	Proxy     string `short:"p" long:"proxy" default:"https://proxy.golang.org" env:"GOPROXY" description:"Go module proxy to fetch from. Can be a URL or a local directory in the same layout."`
+	Rules     struct {
+		GoMod string `short:"m" long:"go_mod" default:"go.mod" description:"go.mod file of the module to generate rules for"`
+		GoSum string `short:"s" long:"go_sum" description:"go.sum file to take hashes from. Defaults to the one next to go.mod."`
+	} `command:"rules" description:"Prints go_get rules for all the modules needed by a module"`
+	Download struct {
+		Sum  string `short:"s" long:"sum" required:"true" description:"Hash of the module from go.sum to verify it against"`
+		Out  string `short:"o" long:"out" required:"true" description:"Directory to extract the module into"`
+		Args struct {
+			Module string `positional-arg-name:"module" required:"true" description:"Module to download, as path@version"`
+		} `positional-args:"true" required:"true"`
+	} `command:"download" description:"Downloads a single module and verifies it against its hash"`
+}{
+	Usage: `
+please_go_mod is a tool shipped with Please that creates go_get rules from Go modules.
+
+Given a go.mod file (and its go.sum), it resolves the versions of all the modules it needs
+using minimal version selection, as the go tool would, and prints a go_get rule for each one
+that provides packages the module imports. For example:
+
+please_go_mod rules --go_mod src/go.mod >> third_party/go/BUILD
+
+The rules have dependencies on one another and the hashes from go.sum, which they're verified
+against when downloaded (which is done by 'please_go_mod download').
+
+Modules are fetched from a module proxy; this can also be a local directory in the same
+format, for example $GOPATH/pkg/mod/cache/download, which allows running it offline.
+`,
+}
+
+func main() {
+	parser := cli.ParseFlagsOrDie("please_go_mod", "12.0.0", &opts)
+	cli.InitLogging(opts.Verbosity)
+	// GOPROXY may contain a list of proxies; we only support one.
+	proxy := gomod.NewProxy(strings.Split(strings.Split(opts.Proxy, ",")[0], "|")[0])
+	if parser.Active.Name == "download" {
+		parts := strings.SplitN(opts.Download.Args.Module, "@", 2)
+		if len(parts) != 2 {
+			log.Fatalf("Invalid module %s, must be of the form path@version", opts.Download.Args.Module)
+		}
+		if err := gomod.Download(proxy, gomod.Module{Path: parts[0], Version: parts[1]}, opts.Download.Sum, opts.Download.Out); err != nil {
+			log.Fatalf("%s", err)
+		}
+		return
+	}
+	f, err := gomod.ReadModFile(opts.Rules.GoMod)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %s", opts.Rules.GoMod, err)
+	}
+	dir := path.Dir(opts.Rules.GoMod)
+	if opts.Rules.GoSum == "" {
+		opts.Rules.GoSum = path.Join(dir, "go.sum")
+	}
+	sums, err := gomod.ReadSumFile(opts.Rules.GoSum)
+	if os.IsNotExist(err) {
+		log.Warning("%s doesn't exist, modules won't be verified", opts.Rules.GoSum)
+	} else if err != nil {
+		log.Fatalf("Failed to read %s: %s", opts.Rules.GoSum, err)
+	}
+	r := gomod.NewResolver(proxy, f, dir, sums)
+	buildList, err := r.BuildList()
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	rules, err := r.Rules(buildList)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	if err := gomod.WriteRules(os.Stdout, rules); err != nil {
+		log.Fatalf("%s", err)
+	}
+}
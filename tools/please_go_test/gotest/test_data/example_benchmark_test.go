@@ -0,0 +1,53 @@
+// This isn't a 'real' source file, it's test data for //tools/please_go_test/gotest:write_test_main_test
+
+package buildgo
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestReadPkgdef(t *testing.T) {
+}
+
+func BenchmarkReadPkgdef(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		readPkgdef("src/build/go/test_data/core.a")
+	}
+}
+
+func BenchmarkFindCoverVars(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		FindCoverVars("src/build/go/test_data", nil)
+	}
+}
+
+func FuzzReadPkgdef(f *testing.F) {
+	f.Add("src/build/go/test_data/core.a")
+	f.Fuzz(func(t *testing.T, filename string) {
+		readPkgdef(filename)
+	})
+}
+
+// Benchmarking isn't a benchmark since it doesn't match the naming convention.
+func Benchmarking(b *testing.B) {
+}
+
+func ExampleFindCoverVars() {
+	vars, _ := FindCoverVars("src/build/go/test_data", nil)
+	fmt.Println(vars)
+	// Output: [core.GoCover_lock_go]
+}
+
+func ExampleReadPkgdef_unordered() {
+	fmt.Println("core.GoCover_lock_go")
+	fmt.Println("core.GoCover_state_go")
+	// Unordered output:
+	// core.GoCover_state_go
+	// core.GoCover_lock_go
+}
+
+// This one has no output comment so won't be run.
+func ExampleReadPkgdef_noOutput() {
+	readPkgdef("src/build/go/test_data/core.a")
+}
@@ -3,6 +3,7 @@ package gotest
 import (
 	"fmt"
 	"go/ast"
+	"go/doc"
 	"go/parser"
 	"go/token"
 	"os"
@@ -17,24 +18,35 @@ import (
 )
 
 type testDescr struct {
-	Package   string
-	Main      string
-	Functions []string
-	CoverVars []CoverVar
-	Imports   []string
-	Version18 bool
+	Package     string
+	Main        string
+	Functions   []string
+	Benchmarks  []string
+	FuzzTargets []string
+	Examples    []*doc.Example
+	CoverVars   []CoverVar
+	Imports     []string
+	Version18   bool
+	Version118  bool
 }
 
 // WriteTestMain templates a test main file from the given sources to the given output file.
-// This mimics what 'go test' does, although we do not currently support benchmarks or examples.
-func WriteTestMain(pkgDir string, version18 bool, sources []string, output string, coverVars []CoverVar) error {
+// This mimics what 'go test' does; benchmarks are only run if $BENCHMARK is set, and fuzz
+// targets only run their seed corpus (which requires Go 1.18 or greater).
+// goVersion is the minor version of the Go tool, e.g. 8 for Go 1.8.
+func WriteTestMain(pkgDir string, goVersion int, sources []string, output string, coverVars []CoverVar) error {
 	testDescr, err := parseTestSources(sources)
 	if err != nil {
 		return err
 	}
 	testDescr.CoverVars = coverVars
-	testDescr.Version18 = version18
-	if len(testDescr.Functions) > 0 {
+	testDescr.Version18 = goVersion >= 8
+	testDescr.Version118 = goVersion >= 18
+	if len(testDescr.FuzzTargets) > 0 && !testDescr.Version118 {
+		log.Warning("Ignoring fuzz targets %s, they require Go 1.18 or greater", strings.Join(testDescr.FuzzTargets, ", "))
+		testDescr.FuzzTargets = nil
+	}
+	if len(testDescr.Functions) > 0 || len(testDescr.Benchmarks) > 0 || len(testDescr.FuzzTargets) > 0 || len(testDescr.Examples) > 0 {
 		// Can't set this if there are no test functions, it'll be an unused import.
 		testDescr.Imports = extraImportPaths(testDescr.Package, pkgDir, coverVars)
 	}
@@ -49,26 +61,30 @@ func WriteTestMain(pkgDir string, version18 bool, sources []string, output strin
 	return testMainTmpl.Execute(f, testDescr)
 }
 
-// IsVersion18 returns true if the given Go tool is version 1.8 or greater.
+// GoVersion returns the minor version of the given Go tool (e.g. 8 for Go 1.8).
 // This is needed because the test main signature has changed - it's not subject to the Go1 compatibility guarantee :(
-func IsVersion18(goTool string) bool {
+func GoVersion(goTool string) int {
 	cmd := exec.Command(goTool, "version")
 	out, err := cmd.Output()
 	if err != nil {
 		log.Fatalf("Can't determine Go version: %s", err)
 	}
-	return isVersion18(out)
+	return goVersion(out)
 }
 
 func isVersion18(version []byte) bool {
+	return goVersion(version) >= 8
+}
+
+func goVersion(version []byte) int {
 	r := regexp.MustCompile("go version go1.([0-9]+)[^0-9].*")
 	m := r.FindSubmatch(version)
 	if len(m) == 0 {
 		log.Warning("Failed to match %s", version)
-		return false
+		return 0
 	}
 	v, _ := strconv.Atoi(string(m[1]))
-	return v >= 8
+	return v
 }
 
 // extraImportPaths returns the set of extra import paths that are needed.
@@ -87,7 +103,7 @@ func extraImportPaths(pkg, pkgDir string, coverVars []CoverVar) []string {
 func parseTestSources(sources []string) (testDescr, error) {
 	descr := testDescr{}
 	for _, source := range sources {
-		f, err := parser.ParseFile(token.NewFileSet(), source, nil, 0)
+		f, err := parser.ParseFile(token.NewFileSet(), source, nil, parser.ParseComments)
 		if err != nil {
 			log.Errorf("Error parsing %s: %s", source, err)
 			return descr, err
@@ -104,9 +120,20 @@ func parseTestSources(sources []string) (testDescr, error) {
 					descr.Main = name
 				} else if isTest(name, "Test") {
 					descr.Functions = append(descr.Functions, name)
+				} else if isTest(name, "Benchmark") {
+					descr.Benchmarks = append(descr.Benchmarks, name)
+				} else if isTest(name, "Fuzz") {
+					descr.FuzzTargets = append(descr.FuzzTargets, name)
 				}
 			}
 		}
+		for _, example := range doc.Examples(f) {
+			// Examples without an output comment are compiled but not run.
+			if example.Output != "" || example.EmptyOutput {
+				example.Name = "Example" + example.Name
+				descr.Examples = append(descr.Examples, example)
+			}
+		}
 	}
 	return descr, nil
 }
@@ -173,6 +200,26 @@ var tests = []testing.InternalTest{
 {{end}}
 }
 
+var benchmarks = []testing.InternalBenchmark{
+{{range .Benchmarks}}
+	{"{{.}}", {{$.Package}}.{{.}}},
+{{end}}
+}
+
+{{if .Version118}}
+var fuzzTargets = []testing.InternalFuzzTarget{
+{{range .FuzzTargets}}
+	{"{{.}}", {{$.Package}}.{{.}}},
+{{end}}
+}
+{{end}}
+
+var examples = []testing.InternalExample{
+{{range .Examples}}
+	{"{{.Name}}", {{$.Package}}.{{.Name}}, {{printf "%q" .Output}}, {{.Unordered}}},
+{{end}}
+}
+
 {{if .CoverVars}}
 
 // Only updated by init functions, so no need for atomicity.
@@ -235,10 +282,18 @@ func main() {
     if testVar != "" {
         args = append(args, "-test.run", testVar)
     }
+    if os.Getenv("BENCHMARK") != "" {
+        if testVar == "" {
+            testVar = "."
+        }
+        args = append(args, "-test.bench", testVar, "-test.benchmem")
+    }
     os.Args = append(args, os.Args[1:]...)
-	benchmarks := []testing.InternalBenchmark{}
-	var examples = []testing.InternalExample{}
+{{if .Version118}}
+	m := testing.MainStart(testDeps, tests, benchmarks, fuzzTargets, examples)
+{{else}}
 	m := testing.MainStart(testDeps, tests, benchmarks, examples)
+{{end}}
 {{if .Main}}
 	{{.Package}}.{{.Main}}(m)
 {{else}}
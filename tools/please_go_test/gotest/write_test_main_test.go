@@ -3,6 +3,7 @@ package gotest
 import (
 	"go/parser"
 	"go/token"
+	"io/ioutil"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -40,6 +41,20 @@ func TestParseTestSourcesWithMain(t *testing.T) {
 	assert.Equal(t, functions, descr.Functions)
 }
 
+func TestParseTestSourcesWithBenchmarksAndExamples(t *testing.T) {
+	descr, err := parseTestSources([]string{"tools/please_go_test/gotest/test_data/example_benchmark_test.go"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"TestReadPkgdef"}, descr.Functions)
+	assert.Equal(t, []string{"BenchmarkReadPkgdef", "BenchmarkFindCoverVars"}, descr.Benchmarks)
+	assert.Equal(t, []string{"FuzzReadPkgdef"}, descr.FuzzTargets)
+	assert.Equal(t, 2, len(descr.Examples))
+	assert.Equal(t, "ExampleFindCoverVars", descr.Examples[0].Name)
+	assert.Equal(t, "[core.GoCover_lock_go]\n", descr.Examples[0].Output)
+	assert.False(t, descr.Examples[0].Unordered)
+	assert.Equal(t, "ExampleReadPkgdef_unordered", descr.Examples[1].Name)
+	assert.True(t, descr.Examples[1].Unordered)
+}
+
 func TestParseTestSourcesFailsGracefully(t *testing.T) {
 	_, err := parseTestSources([]string{"wibble"})
 	assert.Error(t, err)
@@ -48,7 +63,7 @@ func TestParseTestSourcesFailsGracefully(t *testing.T) {
 func TestWriteTestMain(t *testing.T) {
 	err := WriteTestMain(
 		"tools/please_go_test/gotest/test_data",
-		false, // not version 1.8
+		7, // not version 1.8
 		[]string{"tools/please_go_test/gotest/test_data/example_test.go"},
 		"test.go",
 		[]CoverVar{},
@@ -64,7 +79,7 @@ func TestWriteTestMain(t *testing.T) {
 func TestWriteTestMainWithCoverage(t *testing.T) {
 	err := WriteTestMain(
 		"tools/please_go_test/gotest/test_data",
-		false, // not version 1.8
+		7, // not version 1.8
 		[]string{"tools/please_go_test/gotest/test_data/example_test.go"},
 		"test.go",
 		[]CoverVar{{
@@ -82,6 +97,27 @@ func TestWriteTestMainWithCoverage(t *testing.T) {
 	assert.Equal(t, "main", f.Name.Name)
 }
 
+func TestWriteTestMainWithBenchmarksAndExamples(t *testing.T) {
+	err := WriteTestMain(
+		"tools/please_go_test/gotest/test_data",
+		18,
+		[]string{"tools/please_go_test/gotest/test_data/example_benchmark_test.go"},
+		"test.go",
+		[]CoverVar{},
+	)
+	assert.NoError(t, err)
+	f, err := parser.ParseFile(token.NewFileSet(), "test.go", nil, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "main", f.Name.Name)
+	b, err := ioutil.ReadFile("test.go")
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `{"BenchmarkReadPkgdef", buildgo.BenchmarkReadPkgdef}`)
+	assert.Contains(t, string(b), `{"ExampleFindCoverVars", buildgo.ExampleFindCoverVars, "[core.GoCover_lock_go]\n", false}`)
+	assert.NotContains(t, string(b), "ExampleReadPkgdef_noOutput")
+	assert.Contains(t, string(b), `{"FuzzReadPkgdef", buildgo.FuzzReadPkgdef}`)
+	assert.Contains(t, string(b), "testing.MainStart(testDeps, tests, benchmarks, fuzzTargets, examples)")
+}
+
 func TestExtraImportPaths(t *testing.T) {
 	assert.Equal(t, extraImportPaths("core", "src/core", []CoverVar{
 		{ImportPath: "core"},
@@ -35,7 +35,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("Error scanning for coverage: %s", err)
 	}
-	if err = gotest.WriteTestMain(opts.Package, gotest.IsVersion18(opts.Args.Go), opts.Args.Sources, opts.Output, coverVars); err != nil {
+	if err = gotest.WriteTestMain(opts.Package, gotest.GoVersion(opts.Args.Go), opts.Args.Sources, opts.Output, coverVars); err != nil {
 		log.Fatalf("Error writing test main: %s", err)
 	}
 	os.Exit(0)
@@ -11,15 +11,20 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"strings"
 
+	"gopkg.in/op/go-logging.v1"
+
 	"cli"
 	"tools/please_maven/maven"
 )
 
+var log = logging.MustGetLogger("please_maven")
+
 var opts = struct {
 	Usage        string
-	Repositories []string `short:"r" long:"repository" description:"Location of Maven repo" default:"https://repo1.maven.org/maven2"`
+	Repositories []string `short:"r" long:"repository" description:"Location of Maven repo. Can be given as id::url to match it to a server in the settings file." default:"https://repo1.maven.org/maven2"`
 	Android      bool     `short:"a" long:"android" description:"Adds https://maven.google.org to repositories for Android deps."`
 	Verbosity    int      `short:"v" long:"verbose" default:"1" description:"Verbosity of output (higher number = more output, default 1 -> warnings and errors only)"`
 	Exclude      []string `short:"e" long:"exclude" description:"Artifacts to exclude from download"`
@@ -27,10 +32,15 @@ var opts = struct {
 	Optional     []string `short:"o" long:"optional" description:"Optional dependencies to fetch"`
 	BuildRules   bool     `short:"b" long:"build_rules" description:"Print individual maven_jar build rules for each artifact"`
 	NumThreads   int      `short:"n" long:"num_threads" default:"10" description:"Number of concurrent fetches to perform"`
+	Settings     string   `short:"s" long:"settings" description:"Maven settings.xml file to read mirrors and credentials from"`
+	CacheDir     string   `short:"c" long:"cache_dir" description:"Directory to cache downloaded files in between invocations"`
 	LicenceOnly  bool     `short:"l" long:"licence_only" description:"Fetch only the licence of the given package from Maven"`
+	Lockfile     string   `short:"L" long:"lockfile" description:"Writes a lockfile of all resolved artifacts to this file instead of printing them"`
+	FromLockfile string   `long:"from_lockfile" description:"Reads resolved artifacts from this lockfile instead of fetching them from the repo"`
+	Download     string   `short:"d" long:"download" description:"Downloads a single file, given as its path within the repo, and writes it to stdout"`
 	Args         struct {
-		Artifacts []maven.Artifact `positional-arg-name:"ids" required:"yes" description:"Maven IDs to fetch (e.g. io.grpc:grpc-all:1.4.0)"`
-	} `positional-args:"yes" required:"yes"`
+		Artifacts []maven.Artifact `positional-arg-name:"ids" description:"Maven IDs to fetch (e.g. io.grpc:grpc-all:1.4.0)"`
+	} `positional-args:"yes"`
 }{
 	Usage: `
 please_maven is a tool shipped with Please that communicates with Maven repositories
@@ -49,17 +59,67 @@ Note that it does not do complex cross-package dependency resolution and doesn't
 necessarily support every aspect of Maven's pom.xml format, which is pretty hard
 to fully grok. The goal is to provide a backend to Please's built-in maven_jars
 rule to make adding dependencies easier.
+
+Resolution can be pinned by writing a lockfile with --lockfile, which records the
+version, hashes and licences of every artifact and which artifact pulled it in.
+--from_lockfile then prints dependencies from that file (with hashes) without
+contacting any repo again.
+
+--download fetches a single file (e.g. a jar) from the repos and writes it to stdout;
+maven_jar rules use this to download through the same mirrors and credentials.
+
+Repos can be local directories (e.g. file:///home/me/.m2/repository) as well as
+remote ones. Mirrors and credentials for private repos are read from a Maven
+settings.xml file given by --settings.
 `,
 }
 
 func main() {
 	cli.ParseFlagsOrDie("please_maven", "9.0.3", &opts)
 	cli.InitLogging(opts.Verbosity)
+	if len(opts.Args.Artifacts) == 0 && opts.Download == "" {
+		log.Fatalf("You must pass either some Maven IDs or --download")
+	}
 	if opts.Android {
 		opts.Repositories = append(opts.Repositories, "https://maven.google.com")
 	}
+	if opts.FromLockfile != "" {
+		lockfile, err := maven.ReadLockfile(opts.FromLockfile)
+		if err != nil {
+			log.Fatalf("Failed to read lockfile: %s", err)
+		}
+		deps, err := lockfile.Dependencies(opts.Args.Artifacts)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		fmt.Println(strings.Join(deps, "\n"))
+		return
+	}
 	f := maven.NewFetch(opts.Repositories, opts.Exclude, opts.Optional)
-	if opts.LicenceOnly {
+	if opts.Settings != "" {
+		settings, err := maven.ReadSettings(opts.Settings)
+		if err != nil {
+			log.Fatalf("Failed to read settings: %s", err)
+		}
+		f.ApplySettings(settings)
+	}
+	f.SetCacheDir(opts.CacheDir)
+	if opts.Download != "" {
+		b, err := f.Download(opts.Download)
+		if err != nil {
+			log.Fatalf("Failed to download %s: %s", opts.Download, err)
+		}
+		os.Stdout.Write(b)
+	} else if opts.Lockfile != "" {
+		file, err := os.Create(opts.Lockfile)
+		if err != nil {
+			log.Fatalf("Failed to create lockfile: %s", err)
+		}
+		defer file.Close()
+		if err := maven.NewLockfile(f, opts.Args.Artifacts, opts.NumThreads).Write(file); err != nil {
+			log.Fatalf("Failed to write lockfile: %s", err)
+		}
+	} else if opts.LicenceOnly {
 		for _, artifact := range opts.Args.Artifacts {
 			for _, licence := range f.Pom(&artifact).Licences.Licence {
 				fmt.Println(licence.Name)
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
 	"strings"
 	"sync"
 	"time"
@@ -13,13 +16,15 @@ import (
 // It memoises requests internally so we don't re-request the same file.
 type Fetch struct {
 	// Maven repos we're fetching from.
-	repos []string
+	repos []*repo
 	// HTTP client to fetch with
 	client *http.Client
 	// Request cache
 	// TODO(peterebden): is this actually ever useful now we have Resolver?
 	cache map[string][]byte
 	mutex sync.Mutex
+	// Directory to persist downloaded files in between invocations, if any.
+	cacheDir string
 	// Excluded & optional artifacts; this isn't a great place for them but they need to go somewhere.
 	exclude, optional map[string]bool
 	// Version resolver.
@@ -27,26 +32,57 @@ type Fetch struct {
 }
 
 // NewFetch constructs & returns a new Fetch instance.
+// Repos can either be URLs or id::url, where the id identifies it in a settings file.
 func NewFetch(repos, exclude, optional []string) *Fetch {
-	for i, url := range repos {
-		if !strings.HasSuffix(url, "/") {
-			repos[i] = url + "/"
-		}
-		if strings.HasPrefix(url, "http:") {
-			log.Warning("Repo URL %s is not secure, you should really be using https", url)
-		}
-	}
 	f := &Fetch{
-		repos:    repos,
+		repos:    make([]*repo, len(repos)),
 		client:   &http.Client{Timeout: 30 * time.Second},
 		cache:    map[string][]byte{},
 		exclude:  toMap(exclude),
 		optional: toMap(optional),
 	}
+	for i, r := range repos {
+		f.repos[i] = newRepo(r)
+	}
 	f.Resolver = NewResolver(f)
+	f.checkRepos()
 	return f
 }
 
+// ApplySettings applies the mirrors and credentials in the given settings to the repos we use.
+func (f *Fetch) ApplySettings(settings *Settings) {
+	repos := make([]*repo, 0, len(f.repos))
+	seen := map[string]bool{}
+	for _, r := range f.repos {
+		id, url := settings.mirror(r)
+		if !seen[url] {
+			seen[url] = true
+			username, password := settings.credentials(id)
+			repos = append(repos, &repo{ID: id, URL: url, Username: username, Password: password})
+		}
+	}
+	f.repos = repos
+	f.checkRepos()
+}
+
+// SetCacheDir sets a directory to store downloaded files in, which is reused by later
+// invocations so they don't have to download them again.
+func (f *Fetch) SetCacheDir(dir string) {
+	f.cacheDir = dir
+}
+
+// checkRepos normalises our repo URLs and warns about any that are insecure.
+func (f *Fetch) checkRepos() {
+	for _, r := range f.repos {
+		if !strings.HasSuffix(r.URL, "/") {
+			r.URL += "/"
+		}
+		if strings.HasPrefix(r.URL, "http:") && !r.isLocal() {
+			log.Warning("Repo URL %s is not secure, you should really be using https", r.URL)
+		}
+	}
+}
+
 // toMap converts a slice of strings to a map.
 func toMap(sl []string) map[string]bool {
 	m := make(map[string]bool, len(sl))
@@ -89,6 +125,26 @@ func (f *Fetch) HasSources(a *Artifact) bool {
 	return err == nil
 }
 
+// Sha1 returns the SHA-1 hash of a file, as published alongside it in the repo, or the empty
+// string if there isn't one.
+func (f *Fetch) Sha1(path string) string {
+	b, err := f.fetch(path+".sha1", true)
+	if err != nil {
+		log.Warning("Couldn't find SHA-1 for %s: %s", path, err)
+		return ""
+	}
+	// Some of these files have the filename after the hash, so we only take the first field.
+	if fields := strings.Fields(string(b)); len(fields) > 0 {
+		return strings.ToLower(fields[0])
+	}
+	return ""
+}
+
+// Download fetches a single file (e.g. a jar) from the repos, given its path within them.
+func (f *Fetch) Download(path string) ([]byte, error) {
+	return f.fetch(path, true)
+}
+
 // IsExcluded returns true if this artifact should be excluded from the download.
 func (f *Fetch) IsExcluded(artifact string) bool {
 	return f.exclude[artifact]
@@ -103,7 +159,7 @@ func (f *Fetch) ShouldInclude(artifact string) bool {
 func (f *Fetch) mustFetch(url string) []byte {
 	b, err := f.fetch(url, true)
 	if err != nil {
-		log.Fatalf("Error downloading %s: %s\n", f.repos[len(f.repos)-1]+url, err)
+		log.Fatalf("Error downloading %s: %s\n", f.repos[len(f.repos)-1].URL+url, err)
 	}
 	return b
 }
@@ -116,10 +172,14 @@ func (f *Fetch) fetch(url string, readBody bool) ([]byte, error) {
 	if present {
 		log.Debug("Retrieved %s from cache", url)
 		return contents, nil
+	} else if contents, present := f.readCache(url, readBody); present {
+		log.Debug("Retrieved %s from %s", url, f.cacheDir)
+		return contents, nil
 	}
 	var err error
 	for _, repo := range f.repos {
-		if contents, err = f.fetchURL(repo+url, readBody); err == nil {
+		if contents, err = f.fetchURL(repo, url, readBody); err == nil {
+			f.writeCache(url, contents, readBody)
 			f.mutex.Lock()
 			defer f.mutex.Unlock()
 			f.cache[url] = contents
@@ -129,11 +189,17 @@ func (f *Fetch) fetch(url string, readBody bool) ([]byte, error) {
 	return nil, err
 }
 
-func (f *Fetch) fetchURL(url string, readBody bool) ([]byte, error) {
-	log.Notice("%s %s...", f.description(readBody), url)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+func (f *Fetch) fetchURL(r *repo, file string, readBody bool) ([]byte, error) {
+	u := r.URL + file
+	log.Notice("%s %s...", f.description(readBody), u)
+	if strings.HasPrefix(u, "file://") {
+		return fetchFile(u, readBody)
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
 	if err != nil {
 		return nil, err
+	} else if r.Username != "" || r.Password != "" {
+		req.SetBasicAuth(r.Username, r.Password)
 	}
 	response, err := f.client.Do(req)
 	if err != nil {
@@ -148,6 +214,65 @@ func (f *Fetch) fetchURL(url string, readBody bool) ([]byte, error) {
 	return ioutil.ReadAll(response.Body)
 }
 
+// fetchFile reads a file from a file:// URL.
+func fetchFile(u string, readBody bool) ([]byte, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	} else if !readBody {
+		_, err := os.Stat(parsed.Path)
+		return nil, err
+	}
+	return ioutil.ReadFile(parsed.Path)
+}
+
+// readCache reads a file from the on-disk cache, if there is one. If readBody is false it
+// only checks whether we've seen the file before.
+func (f *Fetch) readCache(url string, readBody bool) ([]byte, bool) {
+	if !f.cacheable(url) {
+		return nil, false
+	} else if !readBody {
+		_, err := os.Stat(path.Join(f.cacheDir, url+".exists"))
+		return nil, err == nil
+	}
+	b, err := ioutil.ReadFile(path.Join(f.cacheDir, url))
+	return b, err == nil
+}
+
+// writeCache writes a file to the on-disk cache, if there is one. Errors are logged but not fatal.
+func (f *Fetch) writeCache(url string, contents []byte, readBody bool) {
+	if !f.cacheable(url) {
+		return
+	} else if !readBody {
+		url += ".exists" // Just remember that it's there.
+	}
+	filename := path.Join(f.cacheDir, url)
+	if err := os.MkdirAll(path.Dir(filename), 0755); err != nil {
+		log.Warning("Failed to create cache directory: %s", err)
+		return
+	}
+	// Write to a temporary file & rename it so concurrent invocations don't see partial files.
+	tmp, err := ioutil.TempFile(path.Dir(filename), ".tmp")
+	if err != nil {
+		log.Warning("Failed to write %s to cache: %s", url, err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(contents); err != nil {
+		log.Warning("Failed to write %s to cache: %s", url, err)
+	} else if err := tmp.Close(); err != nil {
+		log.Warning("Failed to write %s to cache: %s", url, err)
+	} else if err := os.Rename(tmp.Name(), filename); err != nil {
+		log.Warning("Failed to write %s to cache: %s", url, err)
+	}
+}
+
+// cacheable returns true if the given file can be stored in the on-disk cache.
+// Metadata and snapshots are excluded because they change over time.
+func (f *Fetch) cacheable(url string) bool {
+	return f.cacheDir != "" && !strings.HasSuffix(url, "maven-metadata.xml") && !strings.Contains(url, "-SNAPSHOT")
+}
+
 // description returns the log description we'll use for a download.
 func (f *Fetch) description(readBody bool) string {
 	if readBody {
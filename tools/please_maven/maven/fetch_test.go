@@ -0,0 +1,89 @@
+package maven
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDataDir = "tools/please_maven/maven/test_data"
+
+func TestFileRepo(t *testing.T) {
+	wd, _ := os.Getwd()
+	f := NewFetch([]string{"file://" + path.Join(wd, testDataDir)}, []string{"junit"}, nil)
+	a := Artifact{}
+	a.FromID("io.grpc:grpc-core:1.1.2")
+	assert.Equal(t, []string{
+		"com.google.guava:guava:20.0:src:The Apache Software License, Version 2.0",
+		"com.google.errorprone:error_prone_annotations:2.0.11:src:Apache 2.0",
+		"com.google.code.findbugs:jsr305:3.0.0:src:The Apache Software License, Version 2.0",
+		"io.grpc:grpc-context:1.1.2:src:BSD 3-Clause",
+		"com.google.instrumentation:instrumentation-api:0.3.0:src:Apache License, Version 2.0",
+	}, AllDependencies(f, []Artifact{a}, 1, false, false))
+	// Missing files are not found
+	_, err := f.fetch("io/grpc/grpc-core/1.1.2/grpc-core-1.1.2-javadoc.jar", false)
+	assert.Error(t, err)
+}
+
+func TestAuth(t *testing.T) {
+	handler := http.FileServer(http.Dir(testDataDir))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "private-user" || password != "hunter2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	const pom = "io/grpc/grpc-core/1.1.2/grpc-core-1.1.2.pom"
+	f := NewFetch([]string{"private::" + s.URL}, nil, nil)
+	_, err := f.fetch(pom, true)
+	assert.Error(t, err)
+	settings, err := ReadSettings(path.Join(testDataDir, "settings.xml"))
+	require.NoError(t, err)
+	f.ApplySettings(settings)
+	_, err = f.fetch(pom, true)
+	assert.NoError(t, err)
+	// Downloading jars needs the credentials too.
+	b, err := f.Download("io/grpc/grpc-core/1.1.2/grpc-core-1.1.2-sources.jar")
+	assert.NoError(t, err)
+	expected, err := ioutil.ReadFile(path.Join(testDataDir, "io/grpc/grpc-core/1.1.2/grpc-core-1.1.2-sources.jar"))
+	require.NoError(t, err)
+	assert.Equal(t, expected, b)
+}
+
+func TestDiskCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maven_cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	const pom = "io/grpc/grpc-core/1.1.2/grpc-core-1.1.2.pom"
+	const sources = "io/grpc/grpc-core/1.1.2/grpc-core-1.1.2-sources.jar"
+	const metadata = "com/google/code/findbugs/jsr305/maven-metadata.xml"
+	s := httptest.NewServer(http.FileServer(http.Dir(testDataDir)))
+	f := NewFetch([]string{s.URL}, nil, nil)
+	f.SetCacheDir(dir)
+	b, err := f.fetch(pom, true)
+	require.NoError(t, err)
+	_, err = f.fetch(sources, false)
+	require.NoError(t, err)
+	_, err = f.fetch(metadata, true)
+	require.NoError(t, err)
+	s.Close()
+	// A new instance should now get them from the cache, even though the server's gone.
+	f = NewFetch([]string{s.URL}, nil, nil)
+	f.SetCacheDir(dir)
+	b2, err := f.fetch(pom, true)
+	assert.NoError(t, err)
+	assert.Equal(t, b, b2)
+	_, err = f.fetch(sources, false)
+	assert.NoError(t, err)
+	// But metadata is never cached since it changes.
+	_, err = f.fetch(metadata, true)
+	assert.Error(t, err)
+}
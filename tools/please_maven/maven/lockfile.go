@@ -0,0 +1,215 @@
+package maven
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"rulehash"
+)
+
+// A Lockfile records the result of resolving a set of artifacts, so they can be used again
+// later without re-resolving them (which can give different results as new versions are
+// published, and is slow anyway).
+type Lockfile struct {
+	// The artifacts that were originally requested.
+	Roots []string
+	// All resolved artifacts, including the roots, sorted by id.
+	Artifacts []*LockedArtifact
+	// The same artifacts, keyed by id.
+	artifacts map[string]*LockedArtifact
+}
+
+// A LockedArtifact is a single resolved artifact in a lockfile.
+type LockedArtifact struct {
+	ID       string
+	Sources  bool
+	Licences []string
+	// SHA-1 hashes of the jar and the source jar, as published in the Maven repo.
+	Sha1, SourcesSha1 string
+	// Ids of the artifacts this one depends on directly.
+	Deps []string
+	// The chain of artifacts that pulled this one in, starting from one of the roots.
+	Via []string
+}
+
+// NewLockfile resolves the given artifacts and returns a lockfile describing them.
+func NewLockfile(f *Fetch, artifacts []Artifact, concurrency int) *Lockfile {
+	f.Resolver.Run(artifacts, concurrency)
+	f.Resolver.Mediate()
+	l := &Lockfile{artifacts: map[string]*LockedArtifact{}}
+	// Walk breadth-first so each artifact records the shortest path to it.
+	queue := []*PomXML{}
+	for _, a := range artifacts {
+		pom := f.Pom(&a)
+		l.Roots = append(l.Roots, pom.Artifact.String())
+		queue = append(queue, pom)
+		l.add(f, pom, nil)
+	}
+	for len(queue) > 0 {
+		pom := queue[0]
+		queue = queue[1:]
+		locked := l.artifacts[pom.Artifact.String()]
+		for _, dep := range pom.AllDependencies() {
+			id := dep.Artifact.String()
+			locked.Deps = append(locked.Deps, id)
+			if _, present := l.artifacts[id]; !present {
+				l.add(f, dep, append(append([]string{}, locked.Via...), locked.ID))
+				queue = append(queue, dep)
+			}
+		}
+		sort.Strings(locked.Deps)
+	}
+	sort.Slice(l.Artifacts, func(i, j int) bool { return l.Artifacts[i].ID < l.Artifacts[j].ID })
+	return l
+}
+
+// add adds a single artifact to this lockfile.
+func (l *Lockfile) add(f *Fetch, pom *PomXML, via []string) {
+	locked := &LockedArtifact{
+		ID:       pom.Artifact.String(),
+		Sources:  pom.HasSources,
+		Licences: pom.AllLicences(),
+		Sha1:     f.Sha1(pom.Artifact.Path(pom.extension())),
+		Via:      via,
+	}
+	if pom.HasSources {
+		locked.SourcesSha1 = f.Sha1(pom.SourcePath())
+	}
+	l.artifacts[locked.ID] = locked
+	l.Artifacts = append(l.Artifacts, locked)
+}
+
+// extension returns the file extension of the artifact for this pom.
+func (pom *PomXML) extension() string {
+	if pom.Type != "" {
+		return "." + pom.Type
+	}
+	return ".jar"
+}
+
+// Write writes this lockfile out. The format is deliberately simple & deterministic so it
+// diffs nicely when it's updated.
+func (l *Lockfile) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# Generated by please_maven --lockfile; don't edit it by hand.\n\n[roots]\n")
+	for _, root := range l.Roots {
+		fmt.Fprintf(bw, "id = %s\n", root)
+	}
+	for _, a := range l.Artifacts {
+		fmt.Fprintf(bw, "\n[%s]\n", a.ID)
+		fmt.Fprintf(bw, "sources = %v\n", a.Sources)
+		if a.Sha1 != "" {
+			fmt.Fprintf(bw, "sha1 = %s\n", a.Sha1)
+		}
+		if a.SourcesSha1 != "" {
+			fmt.Fprintf(bw, "sources_sha1 = %s\n", a.SourcesSha1)
+		}
+		for _, licence := range a.Licences {
+			fmt.Fprintf(bw, "licence = %s\n", licence)
+		}
+		for _, dep := range a.Deps {
+			fmt.Fprintf(bw, "dep = %s\n", dep)
+		}
+		if len(a.Via) > 0 {
+			fmt.Fprintf(bw, "via = %s\n", strings.Join(a.Via, " > "))
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadLockfile reads a lockfile previously written by Write.
+func ReadLockfile(filename string) (*Lockfile, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	l := &Lockfile{artifacts: map[string]*LockedArtifact{}}
+	var current *LockedArtifact
+	inRoots := false
+	scanner := bufio.NewScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		} else if line == "[roots]" {
+			inRoots = true
+			continue
+		} else if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inRoots = false
+			current = &LockedArtifact{ID: line[1 : len(line)-1]}
+			l.Artifacts = append(l.Artifacts, current)
+			l.artifacts[current.ID] = current
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || (current == nil && !inRoots) {
+			return nil, fmt.Errorf("%s:%d: unexpected line %s", filename, lineno, line)
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if inRoots {
+			if key != "id" {
+				return nil, fmt.Errorf("%s:%d: unknown key %s", filename, lineno, key)
+			}
+			l.Roots = append(l.Roots, value)
+			continue
+		}
+		switch key {
+		case "sources":
+			current.Sources = value == "true"
+		case "sha1":
+			current.Sha1 = value
+		case "sources_sha1":
+			current.SourcesSha1 = value
+		case "licence":
+			current.Licences = append(current.Licences, value)
+		case "dep":
+			current.Deps = append(current.Deps, value)
+		case "via":
+			current.Via = strings.Split(value, " > ")
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown key %s", filename, lineno, key)
+		}
+	}
+	return l, scanner.Err()
+}
+
+// Dependencies returns all the dependencies of the given artifacts from this lockfile, in the
+// same format as AllDependencies, but with the rule hashes of each jar and source jar added
+// after the sources field. It returns an error if any of the artifacts aren't in the lockfile,
+// which most likely means it needs regenerating.
+func (l *Lockfile) Dependencies(artifacts []Artifact) ([]string, error) {
+	done := map[string]bool{}
+	ret := []string{}
+	var visit func(a *LockedArtifact)
+	visit = func(a *LockedArtifact) {
+		for _, id := range a.Deps {
+			if dep := l.artifacts[id]; dep != nil && !done[id] {
+				done[id] = true
+				ret = append(ret, dep.line())
+				visit(dep)
+			}
+		}
+	}
+	for _, artifact := range artifacts {
+		a, present := l.artifacts[artifact.String()]
+		if !present {
+			return nil, fmt.Errorf("%s is not in the lockfile; you may need to regenerate it", artifact)
+		}
+		visit(a)
+	}
+	return ret, nil
+}
+
+// line returns the line describing this artifact that Dependencies returns.
+func (a *LockedArtifact) line() string {
+	src := "no_src"
+	if a.Sources {
+		src = "src"
+	}
+	return fmt.Sprintf("%s:%s:%s:%s:%s", a.ID, src, rulehash.FromSHA1(a.Sha1), rulehash.FromSHA1(a.SourcesSha1), strings.Join(a.Licences, "|"))
+}
@@ -0,0 +1,102 @@
+package maven
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockfile(t *testing.T) {
+	l := lockfile(t, "io.grpc:grpc-core:1.1.2")
+	assert.Equal(t, []string{"io.grpc:grpc-core:1.1.2"}, l.Roots)
+	ids := make([]string, len(l.Artifacts))
+	for i, a := range l.Artifacts {
+		ids[i] = a.ID
+	}
+	assert.Equal(t, []string{
+		"com.google.code.findbugs:jsr305:3.0.0",
+		"com.google.errorprone:error_prone_annotations:2.0.11",
+		"com.google.guava:guava:20.0",
+		"com.google.instrumentation:instrumentation-api:0.3.0",
+		"io.grpc:grpc-context:1.1.2",
+		"io.grpc:grpc-core:1.1.2",
+	}, ids)
+	core := l.artifacts["io.grpc:grpc-core:1.1.2"]
+	assert.Equal(t, &LockedArtifact{
+		ID:          "io.grpc:grpc-core:1.1.2",
+		Sources:     true,
+		Licences:    []string{"BSD 3-Clause"},
+		Sha1:        "95848bfd4da5732a3c0fa60554f903f5cbdb3206",
+		SourcesSha1: "da39a3ee5e6b4b0d3255bfef95601890afd80709",
+		Deps: []string{
+			"com.google.code.findbugs:jsr305:3.0.0",
+			"com.google.errorprone:error_prone_annotations:2.0.11",
+			"com.google.guava:guava:20.0",
+			"com.google.instrumentation:instrumentation-api:0.3.0",
+			"io.grpc:grpc-context:1.1.2",
+		},
+	}, core)
+	context := l.artifacts["io.grpc:grpc-context:1.1.2"]
+	assert.Equal(t, "bff4d79d12e758ae1eb9760e7236de109314d2a0", context.Sha1)
+	assert.Equal(t, "", context.SourcesSha1) // There's no .sha1 file for it.
+	assert.Equal(t, []string{"io.grpc:grpc-core:1.1.2"}, context.Via)
+}
+
+func TestLockfileRoundTrip(t *testing.T) {
+	l := lockfile(t, "io.grpc:grpc-core:1.1.2")
+	file, err := ioutil.TempFile("", "maven_lockfile")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	require.NoError(t, l.Write(file))
+	file.Close()
+	l2, err := ReadLockfile(file.Name())
+	require.NoError(t, err)
+	assert.Equal(t, l, l2)
+}
+
+func TestLockfileDependencies(t *testing.T) {
+	l := lockfile(t, "io.grpc:grpc-core:1.1.2")
+	deps, err := l.Dependencies([]Artifact{artifact("io.grpc:grpc-core:1.1.2")})
+	require.NoError(t, err)
+	assert.Equal(t, 5, len(deps))
+	assert.Contains(t, deps, "io.grpc:grpc-context:1.1.2:src:e76b8900eca7ce86cb8bcd57960b32affc0b9462::BSD 3-Clause")
+	deps, err = l.Dependencies([]Artifact{artifact("io.grpc:grpc-context:1.1.2")})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(deps))
+}
+
+func TestLockfileMissingArtifact(t *testing.T) {
+	l := lockfile(t, "io.grpc:grpc-core:1.1.2")
+	_, err := l.Dependencies([]Artifact{artifact("io.grpc:grpc-core:1.2.0")})
+	assert.Error(t, err)
+}
+
+func TestReadLockfileBadKey(t *testing.T) {
+	file, err := ioutil.TempFile("", "maven_lockfile")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	file.WriteString(strings.Join([]string{"[roots]", "id = a:b:1.0", "", "[a:b:1.0]", "wibble = wobble"}, "\n"))
+	file.Close()
+	_, err = ReadLockfile(file.Name())
+	assert.Error(t, err)
+}
+
+// lockfile resolves the given artifact against the test data and returns a lockfile for it.
+func lockfile(t *testing.T, id string) *Lockfile {
+	s := httptest.NewServer(http.FileServer(http.Dir("tools/please_maven/maven/test_data")))
+	defer s.Close()
+	f := NewFetch([]string{s.URL}, []string{"junit"}, nil)
+	return NewLockfile(f, []Artifact{artifact(id)}, 1)
+}
+
+func artifact(id string) Artifact {
+	a := Artifact{}
+	a.FromID(id)
+	return a
+}
@@ -179,12 +179,15 @@ func (r *Resolver) mediate(poms []*PomXML) {
 		r.updateDeps(poms, poms[0])
 		return
 	}
+	conflict := r.describeConflict(hard)
+	if conflict != "" {
+		log.Warning("Conflicting versions requested for %s:%s:%s", hard[0].GroupID, hard[0].ArtifactID, conflict)
+	}
 	// Walk over once and calculate the intersection of all required versions
 	ver := hard[0].OriginalArtifact.ParsedVersion
 	for _, pom := range hard[1:] {
 		if !ver.Intersect(&pom.OriginalArtifact.ParsedVersion) {
-			// TODO(peterebden): Should really give some more detail here about what we can't satisfy
-			log.Fatalf("Unsatisfiable version constraints for %s:%s: %s", pom.GroupID, pom.ArtifactID, strings.Join(r.allVersions(hard), " "))
+			log.Fatalf("Unsatisfiable version constraints for %s:%s: %s%s", pom.GroupID, pom.ArtifactID, strings.Join(r.allVersions(hard), " "), conflict)
 		}
 	}
 	// Find the first one that satisfies this version & use that.
@@ -218,3 +221,48 @@ func (r *Resolver) allVersions(poms []*PomXML) []string {
 	}
 	return ret
 }
+
+// describeConflict returns a description of each of the different versions requested in the
+// given set of poms and the chain of dependencies that requested it, or the empty string if
+// they all requested the same version.
+func (r *Resolver) describeConflict(poms []*PomXML) string {
+	versions := r.allVersions(poms)
+	conflict := false
+	for _, v := range versions[1:] {
+		conflict = conflict || v != versions[0]
+	}
+	if !conflict {
+		return ""
+	}
+	var buf strings.Builder
+	for i, pom := range poms {
+		buf.WriteString("\n  " + versions[i] + " via " + strings.Join(r.dependencyChain(pom), " > "))
+	}
+	return buf.String()
+}
+
+// dependencyChain returns a chain of artifacts leading from one of the originally requested
+// artifacts to the given one. Where there are several we pick deterministically (but arbitrarily).
+func (r *Resolver) dependencyChain(pom *PomXML) []string {
+	chain := []string{pom.Artifact.String()}
+	seen := map[*PomXML]bool{pom: true}
+	for len(pom.Dependors) > 0 {
+		dependors := make([]*PomXML, len(pom.Dependors))
+		copy(dependors, pom.Dependors)
+		sort.Slice(dependors, func(i, j int) bool { return dependors[i].Artifact.String() < dependors[j].Artifact.String() })
+		next := dependors[0]
+		for _, dependor := range dependors {
+			if !seen[dependor] {
+				next = dependor
+				break
+			}
+		}
+		if seen[next] {
+			break
+		}
+		seen[next] = true
+		chain = append([]string{next.Artifact.String()}, chain...)
+		pom = next
+	}
+	return chain
+}
@@ -0,0 +1,34 @@
+package maven
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribeConflict(t *testing.T) {
+	root1 := pom("com.example:root1:1.0")
+	root2 := pom("com.example:root2:1.0")
+	mid := pom("com.example:mid:2.0", root2)
+	dep1 := pom("com.example:dep:1.0", root1)
+	dep2 := pom("com.example:dep:1.1", mid)
+	r := NewResolver(nil)
+	assert.Equal(t, "\n  1.0 via com.example:root1:1.0 > com.example:dep:1.0"+
+		"\n  1.1 via com.example:root2:1.0 > com.example:mid:2.0 > com.example:dep:1.1",
+		r.describeConflict([]*PomXML{dep1, dep2}))
+	assert.Equal(t, "", r.describeConflict([]*PomXML{dep1, pom("com.example:dep:1.0", root2)}))
+}
+
+func TestDependencyChainCycle(t *testing.T) {
+	a := pom("com.example:a:1.0")
+	b := pom("com.example:b:1.0", a)
+	a.Dependors = []*PomXML{b}
+	assert.Equal(t, []string{"com.example:a:1.0", "com.example:b:1.0"}, NewResolver(nil).dependencyChain(b))
+}
+
+func pom(id string, dependors ...*PomXML) *PomXML {
+	p := &PomXML{Dependors: dependors}
+	p.Artifact.FromID(id)
+	p.OriginalArtifact = p.Artifact
+	return p
+}
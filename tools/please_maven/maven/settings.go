@@ -0,0 +1,122 @@
+package maven
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Settings models the parts of a Maven settings.xml file that we understand; currently
+// that's mirrors and the credentials for servers.
+type Settings struct {
+	Servers []struct {
+		ID       string `xml:"id"`
+		Username string `xml:"username"`
+		Password string `xml:"password"`
+	} `xml:"servers>server"`
+	Mirrors []struct {
+		ID       string `xml:"id"`
+		URL      string `xml:"url"`
+		MirrorOf string `xml:"mirrorOf"`
+	} `xml:"mirrors>mirror"`
+}
+
+// envRegex matches environment variable references in settings.xml, e.g. ${env.NEXUS_PASSWORD}
+var envRegex = regexp.MustCompile(`\$\{env\.([^}]+)\}`)
+
+// ReadSettings reads a Maven settings file.
+func ReadSettings(filename string) (*Settings, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	settings := &Settings{}
+	if err := xml.Unmarshal(b, settings); err != nil {
+		return nil, err
+	}
+	for i, server := range settings.Servers {
+		settings.Servers[i].Username = expandEnv(server.Username)
+		settings.Servers[i].Password = expandEnv(server.Password)
+	}
+	return settings, nil
+}
+
+// expandEnv replaces any environment variable references in the given string.
+func expandEnv(s string) string {
+	return envRegex.ReplaceAllStringFunc(s, func(match string) string {
+		return os.Getenv(envRegex.FindStringSubmatch(match)[1])
+	})
+}
+
+// mirror returns the id & URL of the mirror for the given repo, or the repo itself if
+// it isn't mirrored.
+func (settings *Settings) mirror(r *repo) (string, string) {
+	for _, mirror := range settings.Mirrors {
+		if mirrorOf(mirror.MirrorOf, r) {
+			return mirror.ID, mirror.URL
+		}
+	}
+	return r.ID, r.URL
+}
+
+// credentials returns the username & password for the repo with the given id.
+func (settings *Settings) credentials(id string) (string, string) {
+	for _, server := range settings.Servers {
+		if server.ID == id && id != "" {
+			return server.Username, server.Password
+		}
+	}
+	return "", ""
+}
+
+// mirrorOf returns true if the given mirrorOf specification matches a repo.
+// This follows Maven's rules; it's a comma-separated list of repo ids, where * matches
+// all repos, external:* matches any that aren't local, and a leading ! excludes a repo.
+// For convenience we also allow the repo's URL instead of its id.
+func mirrorOf(spec string, r *repo) bool {
+	matched := false
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if strings.HasPrefix(s, "!") {
+			if r.matches(s[1:]) {
+				return false
+			}
+		} else if s == "*" || (s == "external:*" && !r.isLocal()) || r.matches(s) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// A repo is a single Maven repository that we fetch from.
+type repo struct {
+	ID, URL            string
+	Username, Password string
+}
+
+// newRepo creates a new repo from the given description, which is either a URL or
+// id::url, where the id identifies it in settings.xml.
+func newRepo(s string) *repo {
+	r := &repo{URL: s}
+	if idx := strings.Index(s, "::"); idx != -1 {
+		r.ID = s[:idx]
+		r.URL = s[idx+2:]
+	} else if u, err := url.Parse(s); err == nil && (u.Host == "repo1.maven.org" || u.Host == "repo.maven.apache.org") {
+		r.ID = "central" // This is what Maven calls it, so mirrors will often refer to it that way.
+	}
+	return r
+}
+
+// matches returns true if this repo matches the given id or URL.
+func (r *repo) matches(s string) bool {
+	return s == r.ID || strings.TrimSuffix(s, "/") == strings.TrimSuffix(r.URL, "/")
+}
+
+// isLocal returns true if this repo is on the local machine.
+func (r *repo) isLocal() bool {
+	u, err := url.Parse(r.URL)
+	return err == nil && (u.Scheme == "file" || u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1")
+}
@@ -0,0 +1,58 @@
+package maven
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSettings(t *testing.T) {
+	os.Setenv("NEXUS_PASSWORD", "s3cr3t")
+	settings, err := ReadSettings("tools/please_maven/maven/test_data/settings.xml")
+	require.NoError(t, err)
+	username, password := settings.credentials("nexus")
+	assert.Equal(t, "please", username)
+	assert.Equal(t, "s3cr3t", password)
+	username, password = settings.credentials("central")
+	assert.Equal(t, "", username)
+	assert.Equal(t, "", password)
+}
+
+func TestApplySettings(t *testing.T) {
+	settings, err := ReadSettings("tools/please_maven/maven/test_data/settings.xml")
+	require.NoError(t, err)
+	f := NewFetch([]string{
+		"https://repo1.maven.org/maven2",
+		"https://maven.google.com",
+		"private::https://private.example.com/maven",
+		"file:///home/me/.m2/repository",
+	}, nil, nil)
+	f.ApplySettings(settings)
+	require.Equal(t, 3, len(f.repos))
+	// The first two are both mirrored by nexus, so only appear once.
+	assert.Equal(t, "nexus", f.repos[0].ID)
+	assert.Equal(t, "https://nexus.example.com/repository/maven-public/", f.repos[0].URL)
+	assert.Equal(t, "please", f.repos[0].Username)
+	assert.Equal(t, &repo{
+		ID:       "private",
+		URL:      "https://private.example.com/maven/",
+		Username: "private-user",
+		Password: "hunter2",
+	}, f.repos[1])
+	assert.Equal(t, "file:///home/me/.m2/repository/", f.repos[2].URL)
+}
+
+func TestMirrorOf(t *testing.T) {
+	central := newRepo("https://repo1.maven.org/maven2")
+	local := newRepo("http://localhost:8080/maven")
+	assert.Equal(t, "central", central.ID)
+	assert.True(t, mirrorOf("*", central))
+	assert.True(t, mirrorOf("central", central))
+	assert.True(t, mirrorOf("https://repo1.maven.org/maven2/", central))
+	assert.False(t, mirrorOf("*,!central", central))
+	assert.True(t, mirrorOf("*", local))
+	assert.False(t, mirrorOf("external:*", local))
+	assert.False(t, mirrorOf("google", central))
+}
@@ -6,8 +6,12 @@ package pex
 
 import (
 	"bytes"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"tools/jarcat/zip"
@@ -21,13 +25,20 @@ type Writer struct {
 	testSrcs                   []string
 	testIncludes, testExcludes []string
 	testRunner                 string
+	// Platform tags available for each native package, keyed by the package's path.
+	platforms map[string][]string
 }
 
+// platformDir is the name of the directories that per-platform variants of native packages
+// are found in; pkg/.platforms/manylinux1_x86_64/x is the variant of pkg/x for that platform.
+const platformDir = ".platforms"
+
 // NewWriter constructs a new Writer.
 func NewWriter(entryPoint, interpreter string, zipSafe bool) *Writer {
 	pw := &Writer{
 		zipSafe:        zipSafe,
 		realEntryPoint: toPythonPath(entryPoint),
+		platforms:      map[string][]string{},
 	}
 	pw.SetShebang(interpreter)
 	return pw
@@ -64,6 +75,34 @@ func (pw *Writer) SetTest(srcs []string, usePyTest bool) {
 	}
 }
 
+// AddPlatforms finds per-platform variants of native packages under the given directory and
+// records them so the right one can be selected at runtime.
+func (pw *Writer) AddPlatforms(root string) error {
+	return filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if !info.IsDir() || info.Name() != platformDir {
+			return nil
+		}
+		tags, err := ioutil.ReadDir(name)
+		if err != nil {
+			return err
+		}
+		pkgDir, _ := filepath.Rel(root, filepath.Dir(name))
+		for _, tag := range tags {
+			pkgs, err := ioutil.ReadDir(filepath.Join(name, tag.Name()))
+			if err != nil {
+				return err
+			}
+			for _, pkg := range pkgs {
+				p := filepath.Join(pkgDir, pkg.Name())
+				pw.platforms[p] = append(pw.platforms[p], tag.Name())
+			}
+		}
+		return filepath.SkipDir
+	})
+}
+
 // Write writes the pex to the given output file.
 func (pw *Writer) Write(out, moduleDir string) error {
 	f := zip.NewFile(out, true)
@@ -89,6 +128,7 @@ func (pw *Writer) Write(out, moduleDir string) error {
 	b = bytes.Replace(b, []byte("__MODULE_DIR__"), []byte(moduleDir), 1)
 	b = bytes.Replace(b, []byte("__ENTRY_POINT__"), []byte(pw.realEntryPoint), 1)
 	b = bytes.Replace(b, []byte("__ZIP_SAFE__"), []byte(pythonBool(pw.zipSafe)), 1)
+	b = bytes.Replace(b, []byte("__PLATFORMS__"), []byte(pythonPlatforms(pw.platforms)), 1)
 
 	if len(pw.testSrcs) != 0 {
 		// If we're writing a test, we append test_main.py to it.
@@ -111,6 +151,25 @@ func pythonBool(b bool) string {
 	return "False"
 }
 
+// pythonPlatforms returns a Python dict literal for a set of platform tags.
+func pythonPlatforms(platforms map[string][]string) string {
+	pkgs := make([]string, 0, len(platforms))
+	for pkg := range platforms {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	entries := make([]string, len(pkgs))
+	for i, pkg := range pkgs {
+		tags := make([]string, len(platforms[pkg]))
+		for j, tag := range platforms[pkg] {
+			tags[j] = fmt.Sprintf("'%s'", tag)
+		}
+		sort.Strings(tags)
+		entries[i] = fmt.Sprintf("'%s': [%s]", pkg, strings.Join(tags, ", "))
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
 // toPythonPath converts a normal path to a Python import path.
 func toPythonPath(p string) string {
 	ext := path.Ext(p)
@@ -43,6 +43,10 @@ func main() {
 	if opts.Test {
 		w.SetTest(opts.TestSrcs, opts.TestRunner == "pytest")
 	}
+	// Our transitive dependencies are all in the current directory.
+	if err := w.AddPlatforms("."); err != nil {
+		log.Fatalf("Failed to find native packages: %s", err)
+	}
 	if err := w.Write(opts.Out, opts.ModuleDir); err != nil {
 		log.Fatalf("%s", err)
 	}
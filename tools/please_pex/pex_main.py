@@ -17,6 +17,8 @@ sys.path = [PEX_PATH] + sys.path
 MODULE_DIR = '__MODULE_DIR__'
 ENTRY_POINT = '__ENTRY_POINT__'
 ZIP_SAFE = __ZIP_SAFE__
+# Platform tags available for each native package that has per-platform variants.
+PLATFORMS = __PLATFORMS__
 
 
 class ModuleDirImport(object):
@@ -45,6 +47,9 @@ class ModuleDirImport(object):
         with zipfile.ZipFile(PEX, 'r') as zf:
             for name in zf.namelist():
                 if name.startswith(dirname):
+                    variant = platform_variant(name)
+                    if variant:
+                        name = variant[2]
                     path, _ = self.splitext(name[len(dirname)+1:], suffixes)
                     if path:
                         path, _, _ = path.partition('/')
@@ -72,7 +77,7 @@ class SoImport(object):
             zf = zipfile.ZipFile(sys.argv[0])
             for name in zf.namelist():
                 path, _ = self.splitext(name)
-                if path:
+                if path and not platform_variant(name):  # These are handled by NativeImport.
                     if path.startswith('.bootstrap/'):
                         path = path[len('.bootstrap/'):]
                     self.modules.setdefault(path.replace('/', '.'), name)
@@ -107,6 +112,128 @@ class SoImport(object):
         return None, None
 
 
+class NativeImport(object):
+    """Imports native packages from the directory that we've extracted them to."""
+
+    def __init__(self, dirname, selected):
+        self.dirname = dirname
+        self.modules = set()
+        for pkg in selected:
+            parent, _, name = pkg.rpartition('/')
+            self.modules.add(os.path.join(parent, name.partition('.')[0]).replace('/', '.'))
+
+    def find_module(self, fullname, path=None):
+        """Attempt to locate module. Returns self if found, None if not."""
+        if fullname in self.modules:
+            return self
+
+    def load_module(self, fullname):
+        """Loads the module from the extracted directory."""
+        parent, _, name = fullname.rpartition('.')
+        f, pathname, desc = imp.find_module(name, [os.path.join(self.dirname, parent.replace('.', '/'))])
+        try:
+            return imp.load_module(fullname, f, pathname, desc)
+        finally:
+            if f:
+                f.close()
+
+
+class PlatformError(Exception):
+    """Raised when a native package isn't available for the platform we're running on."""
+
+
+def platform_variant(name):
+    """Identifies a file that's part of a per-platform variant of a native package.
+
+    Returns a tuple of (package, platform tag, path it should be at) or None if it isn't one.
+    For example third_party/python/.platforms/manylinux1_x86_64/numpy/core.so is part of
+    third_party/python/numpy for manylinux1_x86_64, and belongs at third_party/python/numpy/core.so.
+    """
+    before, sep, after = ('/' + name).partition('/.platforms/')
+    tag, _, rest = after.partition('/')
+    if not sep or not rest:
+        return None
+    before = before[1:]
+    return os.path.join(before, rest.partition('/')[0]), tag, os.path.join(before, rest)
+
+
+def platform_tags():
+    """Returns the platform tags that native code can use on this machine, most preferred first."""
+    import platform, sysconfig
+
+    plat = sysconfig.get_platform().replace('-', '_').replace('.', '_')
+    if plat.startswith('linux_'):
+        arch = plat[len('linux_'):]
+        if arch == 'x86_64' and sys.maxsize <= 2**32:
+            arch = 'i686'  # 32-bit interpreter on a 64-bit kernel.
+        tags = ['linux_' + arch]
+        try:
+            glibc = os.confstr('CS_GNU_LIBC_VERSION').split()[1].split('.')
+        except (AttributeError, ValueError, OSError, IndexError):
+            return tags  # Not glibc, so no manylinux wheels will work.
+        # manylinux tags are compatible with any glibc at least as new as the one they name.
+        legacy = {17: 'manylinux2014_', 12: 'manylinux2010_', 5: 'manylinux1_'}
+        for minor in range(int(glibc[1]) if glibc[0] == '2' else 0, 4, -1):
+            tags.append('manylinux_2_%d_%s' % (minor, arch))
+            if minor in legacy:
+                tags.append(legacy[minor] + arch)
+        return tags
+    elif plat.startswith('macosx_'):
+        release = [int(x) for x in platform.mac_ver()[0].split('.')[:2]]
+        arch = platform.machine()
+        arches = [arch, 'universal2'] if arch == 'arm64' else [arch, 'universal2', 'intel', 'fat64', 'universal']
+        # macOS 11 onwards only have major versions that matter; before that it was 10.x.
+        versions = [(major, 0) for major in range(release[0], 10, -1)]
+        versions += [(10, minor) for minor in range(release[1] if release[0] == 10 else 16, -1, -1)]
+        return ['macosx_%d_%d_%s' % (major, minor, a) for major, minor in versions for a in arches]
+    return [plat]
+
+
+def select_platforms(platforms=None, tags=None):
+    """Chooses which variant of each native package to use on this platform.
+
+    Returns a dict of package -> platform tag, or raises a PlatformError if there's a package
+    that isn't available for it at all.
+    """
+    platforms = PLATFORMS if platforms is None else platforms
+    if not platforms:
+        return {}
+    tags = tags or platform_tags()
+    selected = {}
+    for pkg, available in sorted(platforms.items()):
+        for tag in tags:
+            if tag in available:
+                selected[pkg] = tag
+                break
+        else:
+            raise PlatformError('%s contains native code that is not available for this platform (%s); '
+                                'it was built for %s' % (pkg, tags[0], ', '.join(sorted(available))))
+    return selected
+
+
+def extract(zf, dest, selected, native_only=False):
+    """Extracts files from the pex to the given directory.
+
+    Only the selected variant of each native package is extracted, to the location it'd have been at
+    normally. If native_only is True then nothing else is extracted.
+    """
+    for name in zf.namelist():
+        variant = platform_variant(name)
+        if not variant:
+            if not native_only and '/.platforms/' not in '/' + name:
+                zf.extract(name, dest)
+        elif selected.get(variant[0]) == variant[1]:
+            target = os.path.join(dest, variant[2])
+            if name.endswith('/'):
+                if not os.path.isdir(target):
+                    os.makedirs(target)
+                continue
+            if not os.path.isdir(os.path.dirname(target)):
+                os.makedirs(os.path.dirname(target))
+            with open(target, 'wb') as f:
+                f.write(zf.read(name))
+
+
 def override_import(package=MODULE_DIR):
     """Augments system importer to allow importing from the given module as though it were at the top level."""
     sys.meta_path.insert(0, ModuleDirImport(package))
@@ -124,11 +251,11 @@ def clean_sys_path():
     sys.path = [x for x in sys.path if not any(x.startswith(pkg) for pkg in site_packages)]
 
 
-def explode_zip():
+def explode_zip(selected):
     """Extracts the current pex to a temp directory where we can import everything from.
 
     This is primarily used for binary extensions which can't be imported directly from
-    inside a zipfile.
+    inside a zipfile. Only the selected variant of any per-platform native packages is extracted.
     """
     import contextlib, shutil, tempfile, zipfile
 
@@ -139,7 +266,7 @@ def explode_zip():
         global PEX_PATH
         PEX_PATH = tempfile.mkdtemp(dir=os.environ.get('TEMP_DIR'), prefix='pex_')
         with zipfile.ZipFile(PEX, 'r') as zf:
-            zf.extractall(PEX_PATH)
+            extract(zf, PEX_PATH, selected)
         # Strip the pex paths so nothing accidentally imports from there.
         sys.path = [PEX_PATH] + [x for x in sys.path if x != PEX]
         yield
@@ -148,6 +275,25 @@ def explode_zip():
     return _explode_zip
 
 
+def extract_platforms(selected):
+    """Extracts only the selected variants of native packages to a temp directory.
+
+    This is used for zip-safe pexes, where everything else can still be imported from the zipfile.
+    """
+    import contextlib, shutil, tempfile, zipfile
+
+    @contextlib.contextmanager
+    def _extract_platforms():
+        dirname = tempfile.mkdtemp(dir=os.environ.get('TEMP_DIR'), prefix='pex_native_')
+        with zipfile.ZipFile(PEX, 'r') as zf:
+            extract(zf, dirname, selected, native_only=True)
+        sys.meta_path.insert(0, NativeImport(dirname, selected))
+        yield
+        shutil.rmtree(dirname)
+
+    return _extract_platforms
+
+
 def profile(filename):
     """Returns a context manager to perform profiling while the program runs.
 
@@ -0,0 +1,47 @@
+"""Tests for selecting per-platform variants of native packages in a pex."""
+
+import unittest
+
+from __main__ import platform_tags, platform_variant, select_platforms, PlatformError
+
+
+class PexPlatformTest(unittest.TestCase):
+
+    def test_platform_variant(self):
+        self.assertEqual(('third_party/python/numpy', 'manylinux1_x86_64', 'third_party/python/numpy/core.so'),
+                         platform_variant('third_party/python/.platforms/manylinux1_x86_64/numpy/core.so'))
+        self.assertEqual(('numpy', 'macosx_10_9_x86_64', 'numpy/'),
+                         platform_variant('.platforms/macosx_10_9_x86_64/numpy/'))
+        self.assertIsNone(platform_variant('third_party/python/numpy/core.so'))
+        self.assertIsNone(platform_variant('third_party/python/.platforms/manylinux1_x86_64/'))
+
+    def test_platform_tags(self):
+        tags = platform_tags()
+        self.assertTrue(tags)
+        self.assertEqual(len(tags), len(set(tags)))
+
+    def test_select_platforms(self):
+        platforms = {
+            'third_party/python/numpy': ['macosx_10_9_x86_64', 'manylinux1_x86_64', 'manylinux2014_x86_64'],
+            'third_party/python/grpc': ['manylinux1_x86_64'],
+        }
+        tags = ['linux_x86_64', 'manylinux_2_17_x86_64', 'manylinux2014_x86_64', 'manylinux1_x86_64']
+        self.assertEqual({
+            'third_party/python/numpy': 'manylinux2014_x86_64',
+            'third_party/python/grpc': 'manylinux1_x86_64',
+        }, select_platforms(platforms, tags))
+
+    def test_select_platforms_no_match(self):
+        platforms = {'third_party/python/numpy': ['macosx_10_9_x86_64', 'manylinux1_x86_64']}
+        with self.assertRaises(PlatformError) as cm:
+            select_platforms(platforms, ['linux_aarch64'])
+        self.assertIn('third_party/python/numpy', str(cm.exception))
+        self.assertIn('linux_aarch64', str(cm.exception))
+        self.assertIn('macosx_10_9_x86_64, manylinux1_x86_64', str(cm.exception))
+
+    def test_select_platforms_empty(self):
+        self.assertEqual({}, select_platforms({}))
+
+
+if __name__ == '__main__':
+    unittest.main()
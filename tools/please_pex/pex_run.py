@@ -3,8 +3,16 @@ def run():
         override_import(MODULE_DIR)
         sys.meta_path.append(SoImport())
     clean_sys_path()
+    try:
+        selected = select_platforms()
+    except PlatformError as err:
+        sys.stderr.write('%s\n' % err)
+        return 1
     if not ZIP_SAFE:
-        with explode_zip()():
+        with explode_zip(selected)():
+            return main()
+    elif selected:
+        with extract_platforms(selected)():
             return main()
     else:
         return main()
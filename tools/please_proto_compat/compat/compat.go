@@ -0,0 +1,278 @@
+// Package compat implements checking of protocol buffer definitions for changes that
+// are incompatible on the wire with a previous version of them.
+//
+// It operates on FileDescriptorSets, as written by protoc --descriptor_set_out, so it
+// doesn't need to parse .proto files itself. Types are matched between the two sets by
+// their fully qualified names and fields by their numbers, since that's what matters on
+// the wire; it doesn't matter which file a message is defined in.
+package compat
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// A Problem describes a single incompatible change between two versions of a set of protos.
+type Problem struct {
+	// Fully qualified name of the message, field, enum or service that has changed.
+	Name string
+	// Description of what has changed.
+	Message string
+}
+
+// String implements the fmt.Stringer interface.
+func (problem Problem) String() string {
+	return problem.Name + ": " + problem.Message
+}
+
+// ReadDescriptorSets reads and combines any number of FileDescriptorSets from files.
+func ReadDescriptorSets(filenames ...string) (*descriptor.FileDescriptorSet, error) {
+	set := &descriptor.FileDescriptorSet{}
+	for _, filename := range filenames {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		s := &descriptor.FileDescriptorSet{}
+		if err := proto.Unmarshal(b, s); err != nil {
+			return nil, fmt.Errorf("Failed to parse descriptor set from %s: %s", filename, err)
+		}
+		set.File = append(set.File, s.File...)
+	}
+	return set, nil
+}
+
+// Compare compares two sets of descriptors and returns any changes in current that are
+// incompatible with the baseline. These are:
+//   - Messages, enums, services or methods that have been removed.
+//   - Fields that have been removed, unless their number has been reserved.
+//   - Field numbers that have been reused by a field of a different name and an incompatible
+//     type or label (renaming a field is fine, since names aren't sent on the wire).
+//   - Fields that have changed type (unless the types are compatible on the wire) or label.
+//   - Newly added required fields.
+//   - Enum values that have been removed.
+//   - Methods that have changed their request or response types, or whether they stream.
+//
+// The returned problems are sorted by name.
+func Compare(baseline, current *descriptor.FileDescriptorSet) []Problem {
+	before := index(baseline)
+	after := index(current)
+	problems := []Problem{}
+	add := func(name, format string, args ...interface{}) {
+		problems = append(problems, Problem{Name: name, Message: fmt.Sprintf(format, args...)})
+	}
+	for name, msg := range before.Messages {
+		if msg2, present := after.Messages[name]; !present {
+			add(name, "message removed")
+		} else {
+			compareMessages(name, msg, msg2, add)
+		}
+	}
+	for name, enum := range before.Enums {
+		if enum2, present := after.Enums[name]; !present {
+			add(name, "enum removed")
+		} else {
+			compareEnums(name, enum, enum2, add)
+		}
+	}
+	for name, service := range before.Services {
+		if service2, present := after.Services[name]; !present {
+			add(name, "service removed")
+		} else {
+			compareServices(name, service, service2, add)
+		}
+	}
+	sort.Slice(problems, func(i, j int) bool {
+		if problems[i].Name != problems[j].Name {
+			return problems[i].Name < problems[j].Name
+		}
+		return problems[i].Message < problems[j].Message
+	})
+	return problems
+}
+
+// compareMessages compares two versions of a message.
+func compareMessages(name string, before, after *descriptor.DescriptorProto, add func(string, string, ...interface{})) {
+	fields := map[int32]*descriptor.FieldDescriptorProto{}
+	for _, field := range after.Field {
+		fields[field.GetNumber()] = field
+	}
+	for _, field := range before.Field {
+		fieldName := name + "." + field.GetName()
+		field2, present := fields[field.GetNumber()]
+		if !present {
+			if !isReserved(after, field.GetNumber()) {
+				add(fieldName, "field %d removed (reserve its number if it's no longer needed)", field.GetNumber())
+			}
+		} else {
+			compatible := compatibleTypes(field, field2)
+			sameLabel := field.GetLabel() == field2.GetLabel()
+			if field.GetName() != field2.GetName() {
+				// A rename is fine since names aren't sent on the wire, but not if it's a different field now.
+				if !compatible || !sameLabel {
+					add(fieldName, "field number %d reused by %s %s %s", field.GetNumber(), labelName(field2.GetLabel()), typeName(field2), field2.GetName())
+				}
+			} else {
+				if !compatible {
+					add(fieldName, "type changed from %s to %s", typeName(field), typeName(field2))
+				}
+				if !sameLabel {
+					add(fieldName, "label changed from %s to %s", labelName(field.GetLabel()), labelName(field2.GetLabel()))
+				}
+			}
+		}
+		delete(fields, field.GetNumber())
+	}
+	// Anything left is new; that's fine unless it's required since old senders won't set it.
+	for _, field := range fields {
+		if field.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REQUIRED {
+			add(name+"."+field.GetName(), "new required field %d added", field.GetNumber())
+		}
+	}
+}
+
+// compareEnums compares two versions of an enum.
+func compareEnums(name string, before, after *descriptor.EnumDescriptorProto, add func(string, string, ...interface{})) {
+	values := map[int32]bool{}
+	for _, value := range after.Value {
+		values[value.GetNumber()] = true
+	}
+	for _, value := range before.Value {
+		if !values[value.GetNumber()] {
+			add(name+"."+value.GetName(), "enum value %d removed", value.GetNumber())
+		}
+	}
+}
+
+// compareServices compares two versions of a service.
+func compareServices(name string, before, after *descriptor.ServiceDescriptorProto, add func(string, string, ...interface{})) {
+	methods := map[string]*descriptor.MethodDescriptorProto{}
+	for _, method := range after.Method {
+		methods[method.GetName()] = method
+	}
+	for _, method := range before.Method {
+		methodName := name + "." + method.GetName()
+		method2, present := methods[method.GetName()]
+		if !present {
+			add(methodName, "method removed")
+			continue
+		}
+		if method.GetInputType() != method2.GetInputType() {
+			add(methodName, "request type changed from %s to %s", trimDot(method.GetInputType()), trimDot(method2.GetInputType()))
+		}
+		if method.GetOutputType() != method2.GetOutputType() {
+			add(methodName, "response type changed from %s to %s", trimDot(method.GetOutputType()), trimDot(method2.GetOutputType()))
+		}
+		if method.GetClientStreaming() != method2.GetClientStreaming() {
+			add(methodName, "client streaming changed from %t to %t", method.GetClientStreaming(), method2.GetClientStreaming())
+		}
+		if method.GetServerStreaming() != method2.GetServerStreaming() {
+			add(methodName, "server streaming changed from %t to %t", method.GetServerStreaming(), method2.GetServerStreaming())
+		}
+	}
+}
+
+// isReserved returns true if the given field number is reserved in a message.
+func isReserved(msg *descriptor.DescriptorProto, number int32) bool {
+	for _, r := range msg.ReservedRange {
+		if number >= r.GetStart() && number < r.GetEnd() { // End is exclusive.
+			return true
+		}
+	}
+	return false
+}
+
+// wireTypes groups together the field types that can be changed between each other
+// without breaking compatibility, as described in the protobuf language guide.
+// Types that aren't in here can't be changed at all.
+var wireTypes = map[descriptor.FieldDescriptorProto_Type]string{
+	descriptor.FieldDescriptorProto_TYPE_INT32:    "varint",
+	descriptor.FieldDescriptorProto_TYPE_INT64:    "varint",
+	descriptor.FieldDescriptorProto_TYPE_UINT32:   "varint",
+	descriptor.FieldDescriptorProto_TYPE_UINT64:   "varint",
+	descriptor.FieldDescriptorProto_TYPE_BOOL:     "varint",
+	descriptor.FieldDescriptorProto_TYPE_SINT32:   "zigzag",
+	descriptor.FieldDescriptorProto_TYPE_SINT64:   "zigzag",
+	descriptor.FieldDescriptorProto_TYPE_FIXED32:  "fixed32",
+	descriptor.FieldDescriptorProto_TYPE_SFIXED32: "fixed32",
+	descriptor.FieldDescriptorProto_TYPE_FIXED64:  "fixed64",
+	descriptor.FieldDescriptorProto_TYPE_SFIXED64: "fixed64",
+}
+
+// compatibleTypes returns true if two versions of a field have compatible types.
+func compatibleTypes(before, after *descriptor.FieldDescriptorProto) bool {
+	if before.GetType() == after.GetType() {
+		// For messages & enums they must also be the same message or enum.
+		return before.GetTypeName() == after.GetTypeName()
+	}
+	group, present := wireTypes[before.GetType()]
+	return present && wireTypes[after.GetType()] == group
+}
+
+// typeName returns a readable description of the type of a field.
+func typeName(field *descriptor.FieldDescriptorProto) string {
+	if field.GetTypeName() != "" {
+		return trimDot(field.GetTypeName())
+	}
+	return strings.ToLower(strings.TrimPrefix(field.GetType().String(), "TYPE_"))
+}
+
+// labelName returns a readable description of a field label.
+func labelName(label descriptor.FieldDescriptorProto_Label) string {
+	return strings.ToLower(strings.TrimPrefix(label.String(), "LABEL_"))
+}
+
+// trimDot strips the leading dot that protoc puts on fully qualified type names.
+func trimDot(name string) string {
+	return strings.TrimPrefix(name, ".")
+}
+
+// A descriptorIndex indexes all the types in a descriptor set by their fully qualified names.
+type descriptorIndex struct {
+	Messages map[string]*descriptor.DescriptorProto
+	Enums    map[string]*descriptor.EnumDescriptorProto
+	Services map[string]*descriptor.ServiceDescriptorProto
+}
+
+// index builds an index of a descriptor set.
+func index(set *descriptor.FileDescriptorSet) *descriptorIndex {
+	idx := &descriptorIndex{
+		Messages: map[string]*descriptor.DescriptorProto{},
+		Enums:    map[string]*descriptor.EnumDescriptorProto{},
+		Services: map[string]*descriptor.ServiceDescriptorProto{},
+	}
+	for _, file := range set.File {
+		prefix := ""
+		if file.GetPackage() != "" {
+			prefix = file.GetPackage() + "."
+		}
+		idx.addMessages(prefix, file.MessageType)
+		idx.addEnums(prefix, file.EnumType)
+		for _, service := range file.Service {
+			idx.Services[prefix+service.GetName()] = service
+		}
+	}
+	return idx
+}
+
+// addMessages adds a set of messages to the index, recursing into any nested types.
+func (idx *descriptorIndex) addMessages(prefix string, messages []*descriptor.DescriptorProto) {
+	for _, msg := range messages {
+		name := prefix + msg.GetName()
+		idx.Messages[name] = msg
+		idx.addMessages(name+".", msg.NestedType)
+		idx.addEnums(name+".", msg.EnumType)
+	}
+}
+
+// addEnums adds a set of enums to the index.
+func (idx *descriptorIndex) addEnums(prefix string, enums []*descriptor.EnumDescriptorProto) {
+	for _, enum := range enums {
+		idx.Enums[prefix+enum.GetName()] = enum
+	}
+}
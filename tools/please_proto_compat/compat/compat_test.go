@@ -0,0 +1,110 @@
+package compat
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	v1, err := ReadDescriptorSets("tools/please_proto_compat/compat/test_data/v1.fds")
+	require.NoError(t, err)
+	v2, err := ReadDescriptorSets("tools/please_proto_compat/compat/test_data/v2.fds")
+	require.NoError(t, err)
+	assert.Equal(t, []Problem{
+		{Name: "compat.test.Api.Delete", Message: "method removed"},
+		{Name: "compat.test.Api.Get", Message: "response type changed from compat.test.Response to compat.test.Request"},
+		{Name: "compat.test.Api.Watch", Message: "server streaming changed from true to false"},
+		{Name: "compat.test.Colour.BLUE", Message: "enum value 2 removed"},
+		{Name: "compat.test.Request.changed_type", Message: "type changed from int32 to string"},
+		{Name: "compat.test.Request.deleted", Message: "field 8 removed (reserve its number if it's no longer needed)"},
+		{Name: "compat.test.Request.tags", Message: "label changed from repeated to optional"},
+		{Name: "compat.test.Unused", Message: "message removed"},
+	}, Compare(v1, v2))
+}
+
+func TestCompareIdentical(t *testing.T) {
+	v1, err := ReadDescriptorSets("tools/please_proto_compat/compat/test_data/v1.fds")
+	require.NoError(t, err)
+	assert.Equal(t, []Problem{}, Compare(v1, v1))
+}
+
+func TestCompareReversed(t *testing.T) {
+	// Going backwards flags everything that was added, since it's now missing.
+	v1, err := ReadDescriptorSets("tools/please_proto_compat/compat/test_data/v1.fds")
+	require.NoError(t, err)
+	v2, err := ReadDescriptorSets("tools/please_proto_compat/compat/test_data/v2.fds")
+	require.NoError(t, err)
+	problems := Compare(v2, v1)
+	assert.Contains(t, problems, Problem{Name: "compat.test.Api.Create", Message: "method removed"})
+	assert.Contains(t, problems, Problem{Name: "compat.test.Request.added", Message: "field 9 removed (reserve its number if it's no longer needed)"})
+}
+
+func TestRequiredFieldAdded(t *testing.T) {
+	before := &descriptor.FileDescriptorSet{File: []*descriptor.FileDescriptorProto{{
+		Name:    proto.String("test.proto"),
+		Package: proto.String("test"),
+		MessageType: []*descriptor.DescriptorProto{{
+			Name: proto.String("Msg"),
+		}},
+	}}}
+	after := proto.Clone(before).(*descriptor.FileDescriptorSet)
+	after.File[0].MessageType[0].Field = []*descriptor.FieldDescriptorProto{{
+		Name:   proto.String("id"),
+		Number: proto.Int32(1),
+		Label:  descriptor.FieldDescriptorProto_LABEL_REQUIRED.Enum(),
+		Type:   descriptor.FieldDescriptorProto_TYPE_INT64.Enum(),
+	}}
+	assert.Equal(t, []Problem{
+		{Name: "test.Msg.id", Message: "new required field 1 added"},
+	}, Compare(before, after))
+}
+
+func TestFieldRenamed(t *testing.T) {
+	before, after := fieldChange(descriptor.FieldDescriptorProto_TYPE_STRING, descriptor.FieldDescriptorProto_LABEL_OPTIONAL)
+	// Names aren't sent on the wire so this is fine.
+	assert.Equal(t, []Problem{}, Compare(before, after))
+}
+
+func TestFieldNumberReused(t *testing.T) {
+	before, after := fieldChange(descriptor.FieldDescriptorProto_TYPE_BYTES, descriptor.FieldDescriptorProto_LABEL_OPTIONAL)
+	assert.Equal(t, []Problem{
+		{Name: "test.Msg.old_name", Message: "field number 1 reused by optional bytes new_name"},
+	}, Compare(before, after))
+	before, after = fieldChange(descriptor.FieldDescriptorProto_TYPE_STRING, descriptor.FieldDescriptorProto_LABEL_REPEATED)
+	assert.Equal(t, []Problem{
+		{Name: "test.Msg.old_name", Message: "field number 1 reused by repeated string new_name"},
+	}, Compare(before, after))
+}
+
+// fieldChange returns two descriptor sets, the first with an optional string field called old_name
+// and the second with a field of the same number called new_name, with the given type and label.
+func fieldChange(typ descriptor.FieldDescriptorProto_Type, label descriptor.FieldDescriptorProto_Label) (*descriptor.FileDescriptorSet, *descriptor.FileDescriptorSet) {
+	before := &descriptor.FileDescriptorSet{File: []*descriptor.FileDescriptorProto{{
+		Name:    proto.String("test.proto"),
+		Package: proto.String("test"),
+		MessageType: []*descriptor.DescriptorProto{{
+			Name: proto.String("Msg"),
+			Field: []*descriptor.FieldDescriptorProto{{
+				Name:   proto.String("old_name"),
+				Number: proto.Int32(1),
+				Label:  descriptor.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:   descriptor.FieldDescriptorProto_TYPE_STRING.Enum(),
+			}},
+		}},
+	}}}
+	after := proto.Clone(before).(*descriptor.FileDescriptorSet)
+	field := after.File[0].MessageType[0].Field[0]
+	field.Name = proto.String("new_name")
+	field.Type = typ.Enum()
+	field.Label = label.Enum()
+	return before, after
+}
+
+func TestReadDescriptorSetsMissing(t *testing.T) {
+	_, err := ReadDescriptorSets("tools/please_proto_compat/compat/test_data/v3.fds")
+	assert.Error(t, err)
+}
@@ -0,0 +1,57 @@
+// Package main implements please_proto_compat, which checks protocol buffer definitions
+// for changes that are incompatible with a previous version of them.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/op/go-logging.v1"
+
+	"cli"
+	"tools/please_proto_compat/compat"
+)
+
+var log = logging.MustGetLogger("please_proto_compat")
+
+var opts = struct {
+	Usage     string
+	Verbosity int      `short:"v" long:"verbose" default:"1" description:"Verbosity of output (higher number = more output, default 1 -> warnings and errors only)"`
+	Baseline  []string `short:"b" long:"baseline" required:"true" description:"Descriptor set(s) for the previous version of the protos"`
+	Current   []string `short:"c" long:"current" required:"true" description:"Descriptor set(s) for the current version of the protos"`
+}{
+	Usage: `
+please_proto_compat is a tool shipped with Please that checks protocol buffers for breaking changes.
+
+It compares two sets of FileDescriptorSets (as written by protoc --descriptor_set_out, which
+proto_library does for you) and reports any changes that would break compatibility on the wire
+with clients or servers using the older version; for example removing fields, changing their types
+or reusing field numbers. For example:
+
+please_proto_compat --baseline api_v1.fds --current plz-out/gen/api/api.fds
+
+It exits with a nonzero code if there are any incompatible changes, so it's convenient to use as
+a test; the proto_compat_test rule does exactly that.
+`,
+}
+
+func main() {
+	cli.ParseFlagsOrDie("please_proto_compat", "12.0.0", &opts)
+	cli.InitLogging(opts.Verbosity)
+	baseline, err := compat.ReadDescriptorSets(opts.Baseline...)
+	if err != nil {
+		log.Fatalf("Failed to read baseline: %s", err)
+	}
+	current, err := compat.ReadDescriptorSets(opts.Current...)
+	if err != nil {
+		log.Fatalf("Failed to read current descriptors: %s", err)
+	}
+	problems := compat.Compare(baseline, current)
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%d incompatible changes found\n", len(problems))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,90 @@
+// Package main implements please_pypi, which resolves Python requirements against a package
+// index and generates python_wheel rules for them.
+package main
+
+import (
+	"os"
+
+	"gopkg.in/op/go-logging.v1"
+
+	"cli"
+	"tools/please_pypi/pypi"
+)
+
+var log = logging.MustGetLogger("please_pypi")
+
+var opts = struct {
+	Usage         string
+	Verbosity     int      `short:"v" long:"verbose" default:"1" description:"Verbosity of output (higher number = more output, default 1 -> warnings and errors only)"`
+	Index         string   `short:"i" long:"index" default:"https://pypi.org/simple" env:"PIP_INDEX_URL" description:"Package index to resolve against. Can be a URL or a local directory in the same layout."`
+	PythonVersion string   `long:"python_version" default:"3.6" description:"Version of Python to resolve packages for"`
+	Platform      string   `long:"platform" default:"linux_x86_64" description:"Platform tag to resolve packages for"`
+	Requirements  []string `short:"r" long:"requirements" description:"requirements.txt file to read requirements from"`
+	Pyproject     []string `short:"p" long:"pyproject" description:"pyproject.toml file to read requirements from"`
+	Existing      string   `short:"e" long:"existing" description:"File containing rules previously generated by this tool. Versions in it are kept where they still satisfy the requirements, so the output changes as little as possible."`
+	Args          struct {
+		Requirements []string `positional-arg-name:"requirements" description:"Additional requirements, e.g. requests>=2.0"`
+	} `positional-args:"true"`
+}{
+	Usage: `
+please_pypi is a tool shipped with Please that generates python_wheel rules from Python requirements.
+
+It reads requirements from requirements.txt or pyproject.toml files (or the command line), resolves
+them and all their dependencies against a package index that implements PEP 503's simple API, and
+prints a python_wheel rule for each package with its hash, licences and dependencies. For example:
+
+please_pypi -r requirements.txt > third_party/python/BUILD
+
+Passing the previous output with --existing keeps the versions in it where possible, so the
+rules only change where they need to.
+
+The index can also be a local directory in the same layout as the simple API (or just with a
+directory of wheels for each package), which allows running it offline. The generated
+rules then refer to the wheels by absolute file:// URLs.
+`,
+}
+
+func main() {
+	cli.ParseFlagsOrDie("please_pypi", "12.0.0", &opts)
+	cli.InitLogging(opts.Verbosity)
+	reqs := []*pypi.Requirement{}
+	for _, filename := range opts.Requirements {
+		r, err := pypi.ReadRequirementsFile(filename)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %s", filename, err)
+		}
+		reqs = append(reqs, r...)
+	}
+	for _, filename := range opts.Pyproject {
+		r, err := pypi.ReadPyproject(filename)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %s", filename, err)
+		}
+		reqs = append(reqs, r...)
+	}
+	for _, s := range opts.Args.Requirements {
+		req, err := pypi.ParseRequirement(s)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		reqs = append(reqs, req)
+	}
+	if len(reqs) == 0 {
+		log.Fatalf("No requirements given")
+	}
+	r := pypi.NewResolver(pypi.NewIndex(opts.Index), opts.PythonVersion, opts.Platform)
+	if opts.Existing != "" {
+		versions, err := pypi.ReadExisting(opts.Existing)
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatalf("Failed to read %s: %s", opts.Existing, err)
+		}
+		r.Prefer(versions)
+	}
+	pkgs, err := r.Resolve(reqs)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	if err := pypi.WriteRules(os.Stdout, pkgs); err != nil {
+		log.Fatalf("%s", err)
+	}
+}
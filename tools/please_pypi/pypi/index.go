@@ -0,0 +1,155 @@
+package pypi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// An Index is a Python package index implementing the "simple" API from PEP 503, for example
+// https://pypi.org/simple. It can also be a local directory in the same layout.
+type Index struct {
+	url    string
+	client *http.Client
+}
+
+// A File is a single file of a package available from the index.
+type File struct {
+	Filename, URL string
+	// SHA-256 of the file, if the index told us it.
+	Sha256         string
+	RequiresPython Specifiers
+	Yanked         bool
+	// Parsed form of the filename, once we've established it's a wheel.
+	wheel *Wheel
+}
+
+// NewIndex returns a new Index for the given URL or local directory.
+func NewIndex(u string) *Index {
+	if !strings.Contains(u, "://") {
+		if !path.IsAbs(u) {
+			wd, _ := os.Getwd()
+			u = path.Join(wd, u)
+		}
+		u = "file://" + u
+	}
+	return &Index{
+		url:    strings.TrimSuffix(u, "/") + "/",
+		client: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// anchorRegex matches links in the HTML pages from the index.
+var anchorRegex = regexp.MustCompile(`(?is)<a\s([^>]*)>(.*?)</a>`)
+
+// attributeRegex matches attributes on those links.
+var attributeRegex = regexp.MustCompile(`([a-zA-Z-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+// Files returns all the files available for the given package.
+func (i *Index) Files(name string) ([]*File, error) {
+	base := i.url + NormaliseName(name) + "/"
+	b, err := i.fetch(base)
+	if os.IsNotExist(err) {
+		// Allow local directories without index pages; we just use the files in them.
+		return i.localFiles(base)
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to get package %s: %s", name, err)
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	files := []*File{}
+	for _, m := range anchorRegex.FindAllStringSubmatch(string(b), -1) {
+		f := &File{Filename: strings.TrimSpace(html.UnescapeString(m[2]))}
+		for _, attr := range attributeRegex.FindAllStringSubmatch(m[1], -1) {
+			value := html.UnescapeString(attr[2] + attr[3])
+			switch strings.ToLower(attr[1]) {
+			case "href":
+				u, err := baseURL.Parse(value)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid link for %s: %s", f.Filename, err)
+				}
+				if strings.HasPrefix(u.Fragment, "sha256=") {
+					f.Sha256 = strings.TrimPrefix(u.Fragment, "sha256=")
+				}
+				u.Fragment = ""
+				f.URL = u.String()
+			case "data-requires-python":
+				if specs, err := ParseSpecifiers(value); err == nil {
+					f.RequiresPython = specs
+				} else {
+					log.Warning("Ignoring invalid Requires-Python for %s: %s", f.Filename, err)
+				}
+			case "data-yanked":
+				f.Yanked = true
+			}
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// localFiles returns the files in a local directory for a package, when it has no index page.
+func (i *Index) localFiles(base string) ([]*File, error) {
+	u, _ := url.Parse(base)
+	infos, err := ioutil.ReadDir(u.Path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get package %s: %s", path.Base(u.Path), err)
+	}
+	files := make([]*File, 0, len(infos))
+	for _, info := range infos {
+		if !info.IsDir() {
+			files = append(files, &File{Filename: info.Name(), URL: base + info.Name()})
+		}
+	}
+	return files, nil
+}
+
+// Download downloads the given file, verifying it against its hash if we know it.
+func (i *Index) Download(f *File) ([]byte, error) {
+	log.Notice("Downloading %s...", f.URL)
+	b, err := i.fetch(f.URL)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to download %s: %s", f.URL, err)
+	} else if f.Sha256 != "" {
+		if h := sha256.Sum256(b); hex.EncodeToString(h[:]) != strings.ToLower(f.Sha256) {
+			return nil, fmt.Errorf("Hash mismatch for %s: expected %s, was %s", f.URL, f.Sha256, hex.EncodeToString(h[:]))
+		}
+	}
+	return b, nil
+}
+
+// fetch fetches a single URL. For local directories it reads index.html from any directory.
+func (i *Index) fetch(u string) ([]byte, error) {
+	if strings.HasPrefix(u, "file://") {
+		p, err := url.Parse(u)
+		if err != nil {
+			return nil, err
+		} else if strings.HasSuffix(u, "/") {
+			return ioutil.ReadFile(path.Join(p.Path, "index.html"))
+		}
+		return ioutil.ReadFile(p.Path)
+	}
+	log.Debug("Fetching %s...", u)
+	resp, err := i.client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s not found", u)
+	} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("Bad response code from %s: %s", u, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
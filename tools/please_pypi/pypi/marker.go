@@ -0,0 +1,280 @@
+package pypi
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// An Environment describes the target that we're resolving packages for, in terms of the
+// variables available to environment markers (e.g. python_version, sys_platform).
+type Environment map[string]string
+
+// NewEnvironment returns the environment for the given Python version and platform tag
+// (e.g. 3.6 and linux_x86_64).
+func NewEnvironment(pythonVersion, platform string) Environment {
+	env := Environment{
+		"python_version":                 pythonVersion,
+		"python_full_version":            pythonVersion + ".0",
+		"implementation_name":            "cpython",
+		"platform_python_implementation": "CPython",
+		"platform_release":               "",
+		"platform_version":               "",
+		"implementation_version":         pythonVersion + ".0",
+		"os_name":                        "posix",
+		"extra":                          "",
+	}
+	if parts := strings.Split(pythonVersion, "."); len(parts) > 2 {
+		env["python_version"] = strings.Join(parts[:2], ".")
+		env["python_full_version"] = pythonVersion
+		env["implementation_version"] = pythonVersion
+	}
+	switch {
+	case strings.HasPrefix(platform, "macosx"):
+		env["sys_platform"] = "darwin"
+		env["platform_system"] = "Darwin"
+	case strings.HasPrefix(platform, "win"):
+		env["sys_platform"] = "win32"
+		env["platform_system"] = "Windows"
+		env["os_name"] = "nt"
+	default:
+		env["sys_platform"] = "linux"
+		env["platform_system"] = "Linux"
+	}
+	switch {
+	case strings.HasSuffix(platform, "x86_64") || strings.HasSuffix(platform, "amd64"):
+		env["platform_machine"] = "x86_64"
+	case strings.HasSuffix(platform, "aarch64") || strings.HasSuffix(platform, "arm64"):
+		env["platform_machine"] = "aarch64"
+	case strings.HasSuffix(platform, "i686") || strings.HasSuffix(platform, "win32"):
+		env["platform_machine"] = "i686"
+	}
+	return env
+}
+
+// A Marker is a parsed environment marker, as described in PEP 508, e.g.
+// python_version < "3.4" and sys_platform == "win32"
+type Marker struct {
+	// Either op is 'and' / 'or' and children are set, or it's a comparison between lhs and rhs.
+	op         string
+	children   []*Marker
+	lhs, rhs   markerValue
+	comparison string
+}
+
+// A markerValue is either a variable or a literal string.
+type markerValue struct {
+	value    string
+	variable bool
+}
+
+// ParseMarker parses an environment marker.
+func ParseMarker(s string) (*Marker, error) {
+	p := &markerParser{tokens: tokeniseMarker(s)}
+	m, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid marker %s: %s", s, err)
+	} else if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("Invalid marker %s: unexpected %s", s, p.tokens[p.pos])
+	}
+	return m, nil
+}
+
+// Evaluate evaluates this marker in the given environment.
+func (m *Marker) Evaluate(env Environment) bool {
+	switch m.op {
+	case "and":
+		for _, child := range m.children {
+			if !child.Evaluate(env) {
+				return false
+			}
+		}
+		return true
+	case "or":
+		for _, child := range m.children {
+			if child.Evaluate(env) {
+				return true
+			}
+		}
+		return false
+	}
+	lhs := m.lhs.evaluate(env)
+	rhs := m.rhs.evaluate(env)
+	if (m.lhs.variable && m.lhs.value == "extra") || (m.rhs.variable && m.rhs.value == "extra") {
+		lhs = NormaliseName(lhs)
+		rhs = NormaliseName(rhs)
+	}
+	switch m.comparison {
+	case "in":
+		return strings.Contains(rhs, lhs)
+	case "not in":
+		return !strings.Contains(rhs, lhs)
+	}
+	if v, err := ParseVersion(lhs); err == nil {
+		if specs, err := ParseSpecifiers(m.comparison + rhs); err == nil {
+			return specs.Matches(v)
+		}
+	}
+	switch m.comparison {
+	case "==", "===":
+		return lhs == rhs
+	case "!=":
+		return lhs != rhs
+	case "<":
+		return lhs < rhs
+	case "<=":
+		return lhs <= rhs
+	case ">":
+		return lhs > rhs
+	case ">=":
+		return lhs >= rhs
+	}
+	return false
+}
+
+func (v markerValue) evaluate(env Environment) string {
+	if v.variable {
+		return env[v.value]
+	}
+	return v.value
+}
+
+// tokeniseMarker splits a marker into tokens; quoted strings retain their quotes so we can
+// tell them apart from variables.
+func tokeniseMarker(s string) []string {
+	tokens := []string{}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end == -1 {
+				return append(tokens, s[i:])
+			}
+			tokens = append(tokens, s[i:i+end+2])
+			i += end + 2
+		case strings.IndexByte("<>=!~", c) != -1:
+			j := i
+			for j < len(s) && strings.IndexByte("<>=!~", s[j]) != -1 {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		default:
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_' || s[j] == '.') {
+				j++
+			}
+			if j == i {
+				j++ // Unknown character; let the parser complain about it.
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+type markerParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *markerParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *markerParser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *markerParser) parseOr() (*Marker, error) {
+	return p.parseBinary("or", p.parseAnd)
+}
+
+func (p *markerParser) parseAnd() (*Marker, error) {
+	return p.parseBinary("and", p.parseExpr)
+}
+
+func (p *markerParser) parseBinary(op string, parse func() (*Marker, error)) (*Marker, error) {
+	m, err := parse()
+	if err != nil {
+		return nil, err
+	}
+	children := []*Marker{m}
+	for p.peek() == op {
+		p.next()
+		m, err := parse()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, m)
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &Marker{op: op, children: children}, nil
+}
+
+func (p *markerParser) parseExpr() (*Marker, error) {
+	if p.peek() == "(" {
+		p.next()
+		m, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		} else if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return m, nil
+	}
+	lhs, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	comparison := p.next()
+	if comparison == "not" {
+		if p.next() != "in" {
+			return nil, fmt.Errorf("expected 'in' after 'not'")
+		}
+		comparison = "not in"
+	} else if comparison != "in" && specifierRegex.FindString(comparison+"1") == "" {
+		return nil, fmt.Errorf("unknown comparison %s", comparison)
+	}
+	rhs, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return &Marker{lhs: lhs, rhs: rhs, comparison: comparison}, nil
+}
+
+func (p *markerParser) parseValue() (markerValue, error) {
+	tok := p.next()
+	if tok == "" {
+		return markerValue{}, fmt.Errorf("unexpected end of marker")
+	} else if tok[0] == '"' || tok[0] == '\'' {
+		if len(tok) < 2 || tok[len(tok)-1] != tok[0] {
+			return markerValue{}, fmt.Errorf("unterminated string %s", tok)
+		}
+		return markerValue{value: tok[1 : len(tok)-1]}, nil
+	}
+	switch tok {
+	case "python_version", "python_full_version", "os_name", "sys_platform", "platform_release",
+		"platform_system", "platform_version", "platform_machine", "platform_python_implementation",
+		"implementation_name", "implementation_version", "extra", "os.name", "sys.platform",
+		"platform.version", "platform.machine", "platform.python_implementation":
+		return markerValue{value: strings.Replace(tok, ".", "_", 1), variable: true}, nil
+	case "python_implementation":
+		return markerValue{value: "platform_python_implementation", variable: true}, nil
+	}
+	return markerValue{}, fmt.Errorf("unknown variable %s", tok)
+}
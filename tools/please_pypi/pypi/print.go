@@ -0,0 +1,72 @@
+package pypi
+
+import (
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+const pythonWheelTemplate = `{{ range . }}python_wheel(
+    name = '{{ .RuleName }}',
+    version = '{{ .Version }}',
+    url = '{{ .File.URL }}',
+    wheel_hash = '{{ .Hash }}',{{ if .Outs }}
+    outs = [
+{{ range .Outs }}        '{{ quote . }}',
+{{ end }}    ],{{ end }}{{ if .Metadata.Licences }}
+    licences = [
+{{ range .Metadata.Licences }}        '{{ quote . }}',
+{{ end }}    ],{{ end }}{{ if .Deps }}
+    deps = [
+{{ range .Deps }}        ':{{ ruleName . }}',
+{{ end }}    ],{{ end }}
+)
+
+{{ end }}`
+
+// WriteRules writes python_wheel rules for the given packages, in a format suitable for
+// pasting into a BUILD file.
+func WriteRules(w io.Writer, pkgs []*Package) error {
+	return template.Must(template.New("python_wheel").Funcs(template.FuncMap{
+		"quote":    func(s string) string { return strings.Replace(s, "'", `\'`, -1) },
+		"ruleName": ruleName,
+	}).Parse(pythonWheelTemplate)).Execute(w, pkgs)
+}
+
+// RuleName returns the name of the rule for this package.
+func (pkg *Package) RuleName() string {
+	return ruleName(pkg.Name)
+}
+
+// Outs returns the outputs of the rule for this package, or nil if they're the default
+// (i.e. a single directory with the same name as the rule).
+func (pkg *Package) Outs() []string {
+	if len(pkg.Metadata.TopLevel) == 1 && pkg.Metadata.TopLevel[0] == pkg.RuleName() {
+		return nil
+	}
+	return pkg.Metadata.TopLevel
+}
+
+// ruleName returns the name of the rule for a package.
+func ruleName(name string) string {
+	return strings.Replace(NormaliseName(name), "-", "_", -1)
+}
+
+// existingRuleRegex matches python_wheel rules that we've previously written.
+var existingRuleRegex = regexp.MustCompile(`python_wheel\(\s*name\s*=\s*'([^']+)',\s*version\s*=\s*'([^']+)'`)
+
+// ReadExisting reads the versions of packages from a file containing rules that we've previously
+// written, so they can be passed to Prefer.
+func ReadExisting(filename string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	versions := map[string]string{}
+	for _, m := range existingRuleRegex.FindAllStringSubmatch(string(b), -1) {
+		versions[m[1]] = m[2]
+	}
+	return versions, nil
+}
@@ -0,0 +1,125 @@
+package pypi
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDir = "tools/please_pypi/pypi/test_data"
+
+func TestResolve(t *testing.T) {
+	reqs, err := ReadRequirementsFile(path.Join(testDir, "requirements.txt"))
+	require.NoError(t, err)
+	pkgs, err := newResolver().Resolve(reqs)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, WriteRules(&buf, pkgs))
+	expected, err := ioutil.ReadFile(path.Join(testDir, "expected_rules.build"))
+	require.NoError(t, err)
+	// The URLs are absolute file:// URLs so they can be fetched from anywhere, which means
+	// they contain the working directory; the expected rules have $WD in its place.
+	wd, _ := os.Getwd()
+	assert.Equal(t, string(expected), strings.Replace(buf.String(), "file://"+wd+"/", "file://$WD/", -1))
+}
+
+func TestResolveExisting(t *testing.T) {
+	existing, err := ReadExisting(path.Join(testDir, "existing_rules.build"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"six": "1.11.0", "web_lib": "1.0.0"}, existing)
+	r := newResolver()
+	r.Prefer(existing)
+	reqs, err := ReadRequirementsFile(path.Join(testDir, "requirements.txt"))
+	require.NoError(t, err)
+	pkgs, err := r.Resolve(reqs)
+	require.NoError(t, err)
+	// web-lib 1.0.0 constrains python-dateutil, and has no json extra so fancy-json isn't needed.
+	assert.Equal(t, map[string]string{
+		"python-dateutil": "2.6.0",
+		"six":             "1.11.0",
+		"web-lib":         "1.0.0",
+	}, versions(pkgs))
+}
+
+func TestResolvePrerelease(t *testing.T) {
+	pkgs, err := newResolver().Resolve(requirements(t, "web-lib>=2.0.0rc1"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"six": "1.12.0", "web-lib": "2.0.0rc1"}, versions(pkgs))
+}
+
+func TestResolveYanked(t *testing.T) {
+	pkgs, err := newResolver().Resolve(requirements(t, "python-dateutil==2.7.1"))
+	require.NoError(t, err)
+	assert.Equal(t, "2.7.1", versions(pkgs)["python-dateutil"])
+	// It's not picked unless it's pinned.
+	_, err = newResolver().Resolve(requirements(t, "python-dateutil>2.7.0"))
+	assert.Error(t, err)
+}
+
+func TestResolveConflict(t *testing.T) {
+	_, err := newResolver().Resolve(requirements(t, "web-lib==1.0.0", "python-dateutil>=2.7"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "python-dateutil>=2.7 (from requirements)")
+	assert.Contains(t, err.Error(), "python-dateutil<2.7 (from web-lib==1.0.0)")
+}
+
+func TestResolveNoCompatibleWheel(t *testing.T) {
+	_, err := NewResolver(NewIndex(path.Join(testDir, "index")), "3.7", "linux_x86_64").Resolve(requirements(t, "fast-parse"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pip_library")
+}
+
+func TestWheelCompatible(t *testing.T) {
+	w, err := ParseWheelFilename("fast_parse-0.3-cp36-cp36m-manylinux1_x86_64.whl")
+	require.NoError(t, err)
+	assert.Equal(t, &Wheel{Name: "fast-parse", Version: "0.3", Python: "cp36", ABI: "cp36m", Platform: "manylinux1_x86_64"}, w)
+	assert.False(t, w.IsPure())
+	assert.True(t, w.Compatible("3.6", "linux_x86_64"))
+	assert.False(t, w.Compatible("3.6", "linux_aarch64"))
+	assert.False(t, w.Compatible("3.7", "linux_x86_64"))
+	w, err = ParseWheelFilename("six-1.12.0-1-py2.py3-none-any.whl")
+	require.NoError(t, err)
+	assert.True(t, w.IsPure())
+	assert.True(t, w.Compatible("2.7", "macosx_10_9_x86_64"))
+	_, err = ParseWheelFilename("web-lib-1.1.0.tar.gz")
+	assert.Error(t, err)
+}
+
+func TestReadWheel(t *testing.T) {
+	b, err := ioutil.ReadFile(path.Join(testDir, "index/python-dateutil/python_dateutil-2.6.0-py2.py3-none-any.whl"))
+	require.NoError(t, err)
+	m, err := ReadWheel(b)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BSD License", "Apache Software License"}, m.Licences)
+	assert.Equal(t, []string{"dateutil"}, m.TopLevel)
+	require.Equal(t, 1, len(m.Requirements))
+	assert.Equal(t, "six>=1.5", m.Requirements[0].String())
+}
+
+func newResolver() *Resolver {
+	return NewResolver(NewIndex(path.Join(testDir, "index")), "3.6", "linux_x86_64")
+}
+
+func requirements(t *testing.T, reqs ...string) []*Requirement {
+	ret := make([]*Requirement, len(reqs))
+	for i, s := range reqs {
+		req, err := ParseRequirement(s)
+		require.NoError(t, err)
+		ret[i] = req
+	}
+	return ret
+}
+
+func versions(pkgs []*Package) map[string]string {
+	ret := map[string]string{}
+	for _, pkg := range pkgs {
+		ret[pkg.Name] = pkg.Version.String()
+	}
+	return ret
+}
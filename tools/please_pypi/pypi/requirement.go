@@ -0,0 +1,227 @@
+package pypi
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A Requirement is a single requirement on a package, as described in PEP 508, e.g.
+// requests[security]>=2.8.1,==2.8.*; python_version < "2.7"
+type Requirement struct {
+	// Name of the package, normalised.
+	Name       string
+	Extras     []string
+	Specifiers Specifiers
+	Marker     *Marker
+}
+
+// requirementRegex matches the parts of a requirement before any marker.
+var requirementRegex = regexp.MustCompile(`^\s*([A-Za-z0-9][A-Za-z0-9._-]*)\s*(?:\[([^\]]*)\])?\s*(.*?)\s*$`)
+
+// nameRegex matches the separators in package names that are normalised.
+var nameRegex = regexp.MustCompile(`[-_.]+`)
+
+// NormaliseName normalises a package name as described in PEP 503.
+func NormaliseName(name string) string {
+	return strings.ToLower(nameRegex.ReplaceAllString(name, "-"))
+}
+
+// ParseRequirement parses a single requirement.
+func ParseRequirement(s string) (*Requirement, error) {
+	req := &Requirement{}
+	if idx := strings.IndexByte(s, ';'); idx != -1 {
+		m, err := ParseMarker(s[idx+1:])
+		if err != nil {
+			return nil, err
+		}
+		req.Marker = m
+		s = s[:idx]
+	}
+	m := requirementRegex.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("Invalid requirement: %s", s)
+	} else if strings.HasPrefix(m[3], "@") {
+		return nil, fmt.Errorf("Unsupported requirement %s: URL requirements aren't supported", s)
+	}
+	req.Name = NormaliseName(m[1])
+	for _, extra := range strings.Split(m[2], ",") {
+		if extra = strings.TrimSpace(extra); extra != "" {
+			req.Extras = append(req.Extras, NormaliseName(extra))
+		}
+	}
+	specs, err := ParseSpecifiers(strings.TrimSuffix(strings.TrimPrefix(m[3], "("), ")"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid requirement %s: %s", s, err)
+	}
+	req.Specifiers = specs
+	return req, nil
+}
+
+// Applies returns true if this requirement applies in the given environment with the given extras.
+func (req *Requirement) Applies(env Environment, extras []string) bool {
+	if req.Marker == nil {
+		return true
+	} else if req.Marker.Evaluate(env) {
+		return true // n.b. extra is the empty string in env
+	}
+	for _, extra := range extras {
+		env["extra"] = extra
+		applies := req.Marker.Evaluate(env)
+		env["extra"] = ""
+		if applies {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns a description of this requirement.
+func (req *Requirement) String() string {
+	s := req.Name
+	if len(req.Extras) > 0 {
+		s += "[" + strings.Join(req.Extras, ",") + "]"
+	}
+	return s + req.Specifiers.String()
+}
+
+// ReadRequirementsFile reads a requirements.txt file, as understood by pip. Options other than
+// -r (to include another file) are ignored.
+func ReadRequirementsFile(filename string) ([]*Requirement, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reqs := []*Requirement{}
+	scanner := bufio.NewScanner(f)
+	line := ""
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line += scanner.Text()
+		if strings.HasSuffix(line, "\\") {
+			line = strings.TrimSuffix(line, "\\")
+			continue
+		}
+		// Strip comments; they must be at the start of a line or preceded by whitespace.
+		if strings.HasPrefix(line, "#") {
+			line = ""
+		} else if idx := strings.Index(line, " #"); idx != -1 {
+			line = line[:idx]
+		}
+		// Options to individual requirements (e.g. --hash) come after them.
+		if idx := strings.Index(line, " --"); idx != -1 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "-r ") || strings.HasPrefix(line, "--requirement ") {
+			included := strings.TrimSpace(line[strings.IndexByte(line, ' '):])
+			r, err := ReadRequirementsFile(path.Join(path.Dir(filename), included))
+			if err != nil {
+				return nil, err
+			}
+			reqs = append(reqs, r...)
+		} else if strings.HasPrefix(line, "-") {
+			log.Warning("%s:%d: ignoring unsupported option %s", filename, lineno, line)
+		} else if line != "" {
+			req, err := ParseRequirement(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %s", filename, lineno, err)
+			}
+			reqs = append(reqs, req)
+		}
+		line = ""
+	}
+	return reqs, scanner.Err()
+}
+
+// ReadPyproject reads the dependencies of a project from a pyproject.toml file, as described
+// in PEP 621. We don't attempt to understand any other part of it.
+func ReadPyproject(filename string) ([]*Requirement, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	table := ""
+	reqs := []*Requirement{}
+	lines := strings.Split(string(b), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(stripTOMLComment(lines[i]))
+		if strings.HasPrefix(line, "[") && !strings.HasPrefix(line, "[[") {
+			table = strings.TrimSpace(strings.Trim(line, "[]"))
+			continue
+		} else if table != "project" || !strings.HasPrefix(line, "dependencies") {
+			continue
+		} else if parts := strings.SplitN(line, "=", 2); len(parts) != 2 || strings.TrimSpace(parts[0]) != "dependencies" {
+			continue
+		}
+		// Collect the whole array, which may span several lines.
+		value := line[strings.IndexByte(line, '=')+1:]
+		// Brackets inside strings (e.g. for extras) don't end it.
+		for !strings.Contains(tomlStringRegex.ReplaceAllString(value, ""), "]") && i+1 < len(lines) {
+			i++
+			value += "\n" + stripTOMLComment(lines[i])
+		}
+		for _, s := range tomlStrings(value) {
+			req, err := ParseRequirement(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", filename, err)
+			}
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs, nil
+}
+
+// tomlStringRegex matches basic & literal strings in TOML.
+var tomlStringRegex = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"|'([^']*)'`)
+
+// tomlStrings returns all the strings in the given TOML value.
+func tomlStrings(value string) []string {
+	ret := []string{}
+	for _, m := range tomlStringRegex.FindAllStringSubmatch(value, -1) {
+		if strings.HasPrefix(m[0], "'") {
+			ret = append(ret, m[2])
+		} else {
+			ret = append(ret, strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(m[1]))
+		}
+	}
+	return ret
+}
+
+// stripTOMLComment removes any comment from a line of TOML.
+func stripTOMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		if c := line[i]; quote != 0 {
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		} else if c == '"' || c == '\'' {
+			quote = c
+		} else if c == '#' {
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// mergeExtras returns the union of two lists of extras, sorted.
+func mergeExtras(a, b []string) []string {
+	m := map[string]bool{}
+	for _, extra := range append(a, b...) {
+		m[extra] = true
+	}
+	ret := make([]string, 0, len(m))
+	for extra := range m {
+		ret = append(ret, extra)
+	}
+	sort.Strings(ret)
+	return ret
+}
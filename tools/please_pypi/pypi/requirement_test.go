@@ -0,0 +1,70 @@
+package pypi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRequirement(t *testing.T) {
+	req, err := ParseRequirement("Web_Lib[JSON, speedups] >=1.0,<2 ; python_version >= '3'")
+	require.NoError(t, err)
+	assert.Equal(t, "web-lib", req.Name)
+	assert.Equal(t, []string{"json", "speedups"}, req.Extras)
+	assert.Equal(t, Specifiers{{Op: ">=", Version: "1.0"}, {Op: "<", Version: "2"}}, req.Specifiers)
+	assert.NotNil(t, req.Marker)
+	// Old-style parenthesised specifiers, as found in some METADATA files.
+	req, err = ParseRequirement("python-dateutil (<2.7)")
+	require.NoError(t, err)
+	assert.Equal(t, Specifiers{{Op: "<", Version: "2.7"}}, req.Specifiers)
+	_, err = ParseRequirement("web-lib @ https://example.com/web_lib-1.0.0-py3-none-any.whl")
+	assert.Error(t, err)
+	_, err = ParseRequirement("web-lib >= 1.0; python_version >")
+	assert.Error(t, err)
+}
+
+func TestMarkers(t *testing.T) {
+	env := NewEnvironment("3.6", "linux_x86_64")
+	evaluate := func(s string) bool {
+		m, err := ParseMarker(s)
+		require.NoError(t, err)
+		return m.Evaluate(env)
+	}
+	assert.True(t, evaluate(`python_version >= "3"`))
+	assert.True(t, evaluate(`python_version < "3.10"`)) // Compared as versions, not strings.
+	assert.False(t, evaluate(`sys_platform == "win32"`))
+	assert.True(t, evaluate(`sys_platform == "win32" or (os_name == "posix" and platform_machine == "x86_64")`))
+	assert.True(t, evaluate(`"linux" in sys_platform`))
+	assert.False(t, evaluate(`platform_system not in "Linux Darwin"`))
+	assert.False(t, evaluate(`extra == "json"`))
+}
+
+func TestApplies(t *testing.T) {
+	env := NewEnvironment("3.6", "linux_x86_64")
+	req, err := ParseRequirement(`fancy-json[speedups]>=1.0; extra == "JSON"`)
+	require.NoError(t, err)
+	assert.False(t, req.Applies(env, nil))
+	assert.True(t, req.Applies(env, []string{"json"}))
+	assert.False(t, req.Applies(env, []string{"yaml"}))
+	req, err = ParseRequirement(`win-thing; sys_platform == "win32"`)
+	require.NoError(t, err)
+	assert.False(t, req.Applies(env, nil))
+	assert.True(t, req.Applies(NewEnvironment("3.6", "win_amd64"), nil))
+}
+
+func TestReadRequirementsFile(t *testing.T) {
+	reqs, err := ReadRequirementsFile("tools/please_pypi/pypi/test_data/requirements.txt")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(reqs))
+	assert.Equal(t, "web-lib[json]>=1.0", reqs[0].String())
+	assert.Equal(t, "six>=1.10", reqs[1].String())
+}
+
+func TestReadPyproject(t *testing.T) {
+	reqs, err := ReadPyproject("tools/please_pypi/pypi/test_data/pyproject.toml")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(reqs))
+	assert.Equal(t, "web-lib[json]>=1.0", reqs[0].String())
+	assert.Equal(t, "six>=1.10", reqs[1].String())
+}
@@ -0,0 +1,291 @@
+package pypi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/op/go-logging.v1"
+
+	"rulehash"
+)
+
+var log = logging.MustGetLogger("pypi")
+
+// maxRounds is the number of rounds of resolution we'll try before giving up.
+const maxRounds = 100
+
+// A Package is a single resolved package.
+type Package struct {
+	Name    string
+	Version Version
+	File    *File
+	// Please rule hash of the downloaded wheel.
+	Hash     string
+	Metadata *Metadata
+	// Extras of this package that something requires.
+	Extras []string
+	// Names of the packages that this one depends on.
+	Deps []string
+}
+
+// A Resolver resolves a set of requirements to specific versions of packages.
+type Resolver struct {
+	index                   *Index
+	env                     Environment
+	pythonVersion, platform string
+	// Versions that we'd prefer to select if possible, typically from a previous run.
+	preferred map[string]string
+	// Packages we've resolved so far.
+	packages map[string]*Package
+	// Cache of file lists from the index.
+	files map[string][]*File
+}
+
+// NewResolver returns a new Resolver using the given index, for the given Python version
+// and platform tag.
+func NewResolver(index *Index, pythonVersion, platform string) *Resolver {
+	return &Resolver{
+		index:         index,
+		env:           NewEnvironment(pythonVersion, platform),
+		pythonVersion: pythonVersion,
+		platform:      platform,
+		preferred:     map[string]string{},
+		packages:      map[string]*Package{},
+		files:         map[string][]*File{},
+	}
+}
+
+// Prefer sets versions that will be selected in preference to newer ones as long as they
+// still satisfy all the requirements. This keeps changes minimal when re-resolving.
+func (r *Resolver) Prefer(versions map[string]string) {
+	for name, version := range versions {
+		r.preferred[NormaliseName(name)] = version
+	}
+}
+
+// A constraint is a requirement on a package and where it came from.
+type constraint struct {
+	req  *Requirement
+	from string
+}
+
+// Resolve resolves the given requirements and returns all the packages needed to satisfy them,
+// sorted by name.
+//
+// This doesn't do full backtracking; it picks the best version of each package given the
+// requirements currently on it, and repeats until nothing changes. That's enough for most
+// sets of requirements and gives an error describing the conflict for the rest.
+func (r *Resolver) Resolve(reqs []*Requirement) ([]*Package, error) {
+	for round := 0; round < maxRounds; round++ {
+		constraints := r.constraints(reqs)
+		changed := false
+		names := make([]string, 0, len(constraints))
+		for name := range constraints {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			extras := []string{}
+			for _, c := range constraints[name] {
+				extras = mergeExtras(extras, c.req.Extras)
+			}
+			pkg := r.packages[name]
+			if pkg != nil && satisfies(pkg.Version, constraints[name]) {
+				if strings.Join(pkg.Extras, ",") != strings.Join(extras, ",") {
+					pkg.Extras = extras
+					changed = true
+				}
+				continue
+			}
+			pkg, err := r.choose(name, constraints[name])
+			if err != nil {
+				return nil, err
+			}
+			pkg.Extras = extras
+			r.packages[name] = pkg
+			changed = true
+		}
+		// Drop anything that's no longer needed.
+		for name := range r.packages {
+			if _, present := constraints[name]; !present {
+				delete(r.packages, name)
+				changed = true
+			}
+		}
+		if !changed {
+			return r.result(), nil
+		}
+	}
+	return nil, fmt.Errorf("Failed to resolve requirements after %d rounds", maxRounds)
+}
+
+// constraints returns all the current constraints on each package that's reachable from
+// the original requirements.
+func (r *Resolver) constraints(reqs []*Requirement) map[string][]constraint {
+	constraints := map[string][]constraint{}
+	queue := []string{}
+	add := func(req *Requirement, from string) {
+		if _, present := constraints[req.Name]; !present {
+			queue = append(queue, req.Name)
+		}
+		constraints[req.Name] = append(constraints[req.Name], constraint{req: req, from: from})
+	}
+	for _, req := range reqs {
+		if req.Applies(r.env, nil) {
+			add(req, "requirements")
+		}
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if pkg := r.packages[name]; pkg != nil {
+			for _, req := range r.requirements(pkg) {
+				add(req, pkg.Name+"=="+pkg.Version.String())
+			}
+		}
+	}
+	return constraints
+}
+
+// requirements returns the requirements of a package that apply for us.
+func (r *Resolver) requirements(pkg *Package) []*Requirement {
+	reqs := []*Requirement{}
+	for _, req := range pkg.Metadata.Requirements {
+		if req.Applies(r.env, pkg.Extras) {
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs
+}
+
+// satisfies returns true if the given version satisfies all the given constraints.
+func satisfies(v Version, constraints []constraint) bool {
+	for _, c := range constraints {
+		if !c.req.Specifiers.Matches(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// choose chooses the best version of a package for the given constraints.
+func (r *Resolver) choose(name string, constraints []constraint) (*Package, error) {
+	files, err := r.candidates(name)
+	if err != nil {
+		return nil, err
+	}
+	allowPrereleases := false
+	for _, c := range constraints {
+		allowPrereleases = allowPrereleases || c.req.Specifiers.AllowsPrereleases()
+	}
+	var best *File
+	var bestVersion Version
+	for _, f := range files {
+		v := MustParseVersion(f.wheel.Version)
+		if !satisfies(v, constraints) || (v.IsPrerelease() && !allowPrereleases) || (f.Yanked && !pinned(constraints)) {
+			continue
+		} else if preferred, present := r.preferred[name]; present && preferred == v.String() {
+			best = f
+			bestVersion = v
+			break
+		} else if best == nil || v.Compare(bestVersion) > 0 {
+			best = f
+			bestVersion = v
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("No version of %s satisfies all requirements:\n%s", name, describeConstraints(constraints))
+	}
+	log.Notice("Selected %s %s", name, bestVersion)
+	b, err := r.index.Download(best)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := ReadWheel(b)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %s", best.Filename, err)
+	}
+	return &Package{
+		Name:     name,
+		Version:  bestVersion,
+		File:     best,
+		Hash:     rulehash.Contents(b),
+		Metadata: metadata,
+	}, nil
+}
+
+// candidates returns the usable wheels for a package, sorted so that for each version the
+// one we'd prefer (pure Python over platform-specific) comes first.
+func (r *Resolver) candidates(name string) ([]*File, error) {
+	if files, present := r.files[name]; present {
+		return files, nil
+	}
+	all, err := r.index.Files(name)
+	if err != nil {
+		return nil, err
+	}
+	files := []*File{}
+	for _, f := range all {
+		if w, err := ParseWheelFilename(f.Filename); err != nil {
+			log.Debug("Ignoring %s: %s", f.Filename, err)
+		} else if _, err := ParseVersion(w.Version); err != nil {
+			log.Debug("Ignoring %s: %s", f.Filename, err)
+		} else if !w.Compatible(r.pythonVersion, r.platform) {
+			log.Debug("Ignoring incompatible wheel %s", f.Filename)
+		} else if len(f.RequiresPython) > 0 && !f.RequiresPython.Matches(MustParseVersion(r.env["python_full_version"])) {
+			log.Debug("Ignoring %s, requires Python %s", f.Filename, f.RequiresPython)
+		} else {
+			f.wheel = w
+			files = append(files, f)
+		}
+	}
+	if len(files) == 0 && len(all) > 0 {
+		return nil, fmt.Errorf("No compatible wheels found for %s; you may need a pip_library for it instead", name)
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].wheel.IsPure() && !files[j].wheel.IsPure() })
+	r.files[name] = files
+	return files, nil
+}
+
+// pinned returns true if any of the given constraints pins an exact version.
+func pinned(constraints []constraint) bool {
+	for _, c := range constraints {
+		for _, spec := range c.req.Specifiers {
+			if (spec.Op == "==" && !strings.HasSuffix(spec.Version, ".*")) || spec.Op == "===" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// describeConstraints returns a description of a set of constraints, for error messages.
+func describeConstraints(constraints []constraint) string {
+	lines := make([]string, len(constraints))
+	for i, c := range constraints {
+		lines[i] = fmt.Sprintf("  %s (from %s)", c.req, c.from)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// result returns the final set of resolved packages, sorted by name.
+func (r *Resolver) result() []*Package {
+	pkgs := make([]*Package, 0, len(r.packages))
+	for _, pkg := range r.packages {
+		deps := map[string]bool{}
+		for _, req := range r.requirements(pkg) {
+			if req.Name != pkg.Name {
+				deps[req.Name] = true
+			}
+		}
+		pkg.Deps = pkg.Deps[:0]
+		for dep := range deps {
+			pkg.Deps = append(pkg.Deps, dep)
+		}
+		sort.Strings(pkg.Deps)
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Name < pkgs[j].Name })
+	return pkgs
+}
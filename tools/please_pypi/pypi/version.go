@@ -0,0 +1,334 @@
+package pypi
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A Version is a Python package version, as described by PEP 440.
+type Version struct {
+	Epoch   int
+	Release []int
+	// Prerelease kind (one of a, b or rc) and number. Kind is empty if it's not a prerelease.
+	PreKind string
+	Pre     int
+	// Post & dev release numbers, or -1 if they aren't set.
+	Post, Dev int
+	Local     string
+}
+
+// versionRegex matches a PEP 440 version. It's taken more or less straight from the PEP.
+var versionRegex = regexp.MustCompile(`^v?(?:(?:([0-9]+)!)?([0-9]+(?:\.[0-9]+)*)([-_.]?(a|b|c|rc|alpha|beta|pre|preview)[-_.]?([0-9]+)?)?((?:-([0-9]+))|(?:[-_.]?(post|rev|r)[-_.]?([0-9]+)?))?([-_.]?(dev)[-_.]?([0-9]+)?)?)(?:\+([a-z0-9]+(?:[-_.][a-z0-9]+)*))?$`)
+
+// ParseVersion parses a version string.
+func ParseVersion(s string) (Version, error) {
+	m := versionRegex.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil {
+		return Version{}, fmt.Errorf("Invalid version: %s", s)
+	}
+	v := Version{Epoch: atoi(m[1], 0), Pre: atoi(m[5], 0), Post: -1, Dev: -1, Local: m[13]}
+	for _, part := range strings.Split(m[2], ".") {
+		v.Release = append(v.Release, atoi(part, 0))
+	}
+	switch m[4] {
+	case "a", "alpha":
+		v.PreKind = "a"
+	case "b", "beta":
+		v.PreKind = "b"
+	case "c", "rc", "pre", "preview":
+		v.PreKind = "rc"
+	}
+	if m[7] != "" {
+		v.Post = atoi(m[7], 0)
+	} else if m[8] != "" {
+		v.Post = atoi(m[9], 0)
+	}
+	if m[11] != "" {
+		v.Dev = atoi(m[12], 0)
+	}
+	return v, nil
+}
+
+// MustParseVersion is like ParseVersion but panics on errors.
+func MustParseVersion(s string) Version {
+	v, err := ParseVersion(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func atoi(s string, def int) int {
+	if i, err := strconv.Atoi(s); err == nil {
+		return i
+	}
+	return def
+}
+
+// String returns the normalised form of this version.
+func (v Version) String() string {
+	var b strings.Builder
+	if v.Epoch != 0 {
+		fmt.Fprintf(&b, "%d!", v.Epoch)
+	}
+	for i, r := range v.Release {
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(strconv.Itoa(r))
+	}
+	if v.PreKind != "" {
+		fmt.Fprintf(&b, "%s%d", v.PreKind, v.Pre)
+	}
+	if v.Post != -1 {
+		fmt.Fprintf(&b, ".post%d", v.Post)
+	}
+	if v.Dev != -1 {
+		fmt.Fprintf(&b, ".dev%d", v.Dev)
+	}
+	if v.Local != "" {
+		b.WriteString("+" + v.Local)
+	}
+	return b.String()
+}
+
+// IsPrerelease returns true if this is a prerelease or development release.
+func (v Version) IsPrerelease() bool {
+	return v.PreKind != "" || v.Dev != -1
+}
+
+// Compare compares this version to another, returning -1, 0 or 1 if it's respectively
+// less than, equal to or greater than it.
+func (v Version) Compare(v2 Version) int {
+	if c := compareInts(v.Epoch, v2.Epoch); c != 0 {
+		return c
+	} else if c := compareRelease(v.Release, v2.Release); c != 0 {
+		return c
+	} else if c := compareInts(v.preKey(), v2.preKey()); c != 0 {
+		return c
+	} else if v.PreKind != "" && v2.PreKind != "" {
+		if c := compareInts(v.Pre, v2.Pre); c != 0 {
+			return c
+		}
+	}
+	if c := compareInts(v.Post, v2.Post); c != 0 {
+		return c
+	} else if c := compareInts(v.devKey(), v2.devKey()); c != 0 {
+		return c
+	}
+	return compareLocal(v.Local, v2.Local)
+}
+
+// preKey returns a key for sorting this version's prerelease component.
+// A dev release of a final version sorts before any of its prereleases, and the final version
+// sorts after all of them.
+func (v Version) preKey() int {
+	switch v.PreKind {
+	case "a":
+		return 1
+	case "b":
+		return 2
+	case "rc":
+		return 3
+	}
+	if v.Post == -1 && v.Dev != -1 {
+		return 0
+	}
+	return 4
+}
+
+// devKey returns a key for sorting this version's dev component; not being a dev release
+// sorts after being one.
+func (v Version) devKey() int {
+	if v.Dev == -1 {
+		return int(^uint(0) >> 1)
+	}
+	return v.Dev
+}
+
+// release returns this version without any local part.
+func (v Version) release() Version {
+	v.Local = ""
+	return v
+}
+
+func compareRelease(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		if c := compareInts(element(a, i), element(b, i)); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func element(s []int, i int) int {
+	if i < len(s) {
+		return s[i]
+	}
+	return 0
+}
+
+// compareLocal compares two local version labels. Numeric segments sort after alphanumeric
+// ones and are compared numerically.
+func compareLocal(a, b string) int {
+	if a == b {
+		return 0
+	} else if a == "" {
+		return -1
+	} else if b == "" {
+		return 1
+	}
+	as := strings.FieldsFunc(a, isSeparator)
+	bs := strings.FieldsFunc(b, isSeparator)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		ai, aErr := strconv.Atoi(as[i])
+		bi, bErr := strconv.Atoi(bs[i])
+		if aErr == nil && bErr == nil {
+			if c := compareInts(ai, bi); c != 0 {
+				return c
+			}
+		} else if aErr == nil {
+			return 1
+		} else if bErr == nil {
+			return -1
+		} else if c := strings.Compare(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(as), len(bs))
+}
+
+func isSeparator(r rune) bool {
+	return r == '.' || r == '-' || r == '_'
+}
+
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// A Specifier is a single version constraint, for example >=1.2.
+type Specifier struct {
+	Op      string
+	Version string
+}
+
+// Specifiers is a set of version constraints, all of which must be satisfied.
+type Specifiers []Specifier
+
+// specifierRegex matches a single version specifier.
+var specifierRegex = regexp.MustCompile(`^\s*(~=|===|==|!=|<=|>=|<|>)\s*([^\s,;]+)\s*$`)
+
+// ParseSpecifiers parses a comma-separated list of version specifiers.
+func ParseSpecifiers(s string) (Specifiers, error) {
+	ret := Specifiers{}
+	if strings.TrimSpace(s) == "" {
+		return ret, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		m := specifierRegex.FindStringSubmatch(part)
+		if m == nil {
+			return nil, fmt.Errorf("Invalid version specifier: %s", part)
+		} else if m[1] != "===" {
+			if _, err := ParseVersion(strings.TrimSuffix(m[2], ".*")); err != nil {
+				return nil, err
+			} else if strings.HasSuffix(m[2], ".*") && m[1] != "==" && m[1] != "!=" {
+				return nil, fmt.Errorf("Invalid version specifier: %s", part)
+			}
+		}
+		ret = append(ret, Specifier{Op: m[1], Version: m[2]})
+	}
+	return ret, nil
+}
+
+// String returns the string form of these specifiers.
+func (specs Specifiers) String() string {
+	parts := make([]string, len(specs))
+	for i, s := range specs {
+		parts[i] = s.Op + s.Version
+	}
+	return strings.Join(parts, ",")
+}
+
+// Matches returns true if the given version satisfies all these specifiers.
+func (specs Specifiers) Matches(v Version) bool {
+	for _, s := range specs {
+		if !s.Matches(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowsPrereleases returns true if any of these specifiers explicitly mention a prerelease,
+// in which case prereleases can be selected. Otherwise they're not.
+func (specs Specifiers) AllowsPrereleases() bool {
+	for _, s := range specs {
+		if v, err := ParseVersion(strings.TrimSuffix(s.Version, ".*")); err == nil && v.IsPrerelease() && s.Op != "!=" {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns true if the given version satisfies this specifier.
+func (s Specifier) Matches(v Version) bool {
+	switch s.Op {
+	case "===":
+		return v.String() == s.Version
+	case "==":
+		return s.equal(v)
+	case "!=":
+		return !s.equal(v)
+	case "~=":
+		sv := MustParseVersion(s.Version)
+		prefix := Version{Epoch: sv.Epoch, Release: sv.Release[:len(sv.Release)-1], Post: -1, Dev: -1}
+		return len(sv.Release) > 1 && v.release().Compare(sv) >= 0 && prefixMatch(prefix, v)
+	}
+	sv := MustParseVersion(s.Version)
+	c := v.release().Compare(sv)
+	switch s.Op {
+	case "<=":
+		return c <= 0
+	case ">=":
+		return c >= 0
+	case "<":
+		// Prereleases of the given version don't count as less than it, unless it's one itself.
+		return c < 0 && (sv.IsPrerelease() || !v.IsPrerelease() || compareRelease(v.Release, sv.Release) != 0)
+	case ">":
+		// Similarly post-releases of the given version aren't greater than it.
+		return c > 0 && (sv.Post != -1 || v.Post == -1 || compareRelease(v.Release, sv.Release) != 0)
+	}
+	return false
+}
+
+// equal implements the == operator, including prefix matching.
+func (s Specifier) equal(v Version) bool {
+	if strings.HasSuffix(s.Version, ".*") {
+		return prefixMatch(MustParseVersion(strings.TrimSuffix(s.Version, ".*")), v)
+	}
+	sv := MustParseVersion(s.Version)
+	if sv.Local == "" {
+		v = v.release()
+	}
+	return v.Compare(sv) == 0
+}
+
+// prefixMatch returns true if the given version starts with the given prefix.
+func prefixMatch(prefix, v Version) bool {
+	if prefix.Epoch != v.Epoch {
+		return false
+	}
+	for i, r := range prefix.Release {
+		if element(v.Release, i) != r {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package pypi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	v, err := ParseVersion("1!2.3.4rc1.post2.dev3+ubuntu.1")
+	require.NoError(t, err)
+	assert.Equal(t, Version{Epoch: 1, Release: []int{2, 3, 4}, PreKind: "rc", Pre: 1, Post: 2, Dev: 3, Local: "ubuntu.1"}, v)
+	assert.Equal(t, "1!2.3.4rc1.post2.dev3+ubuntu.1", v.String())
+	// Alternative spellings are normalised.
+	assert.Equal(t, "1.0a2", MustParseVersion("1.0-alpha.2").String())
+	assert.Equal(t, "1.0rc0", MustParseVersion("1.0c").String())
+	assert.Equal(t, "1.0.post1", MustParseVersion("1.0-1").String())
+	assert.Equal(t, "1.0", MustParseVersion("v1.0").String())
+	_, err = ParseVersion("1.0-wibble")
+	assert.Error(t, err)
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 0, MustParseVersion("1.0").Compare(MustParseVersion("1.0.0")))
+	assert.Equal(t, -1, MustParseVersion("1.2").Compare(MustParseVersion("1.10")))
+	assert.Equal(t, -1, MustParseVersion("1.0.dev1").Compare(MustParseVersion("1.0a1")))
+	assert.Equal(t, -1, MustParseVersion("1.0a1").Compare(MustParseVersion("1.0b1")))
+	assert.Equal(t, -1, MustParseVersion("1.0rc1").Compare(MustParseVersion("1.0")))
+	assert.Equal(t, -1, MustParseVersion("1.0").Compare(MustParseVersion("1.0+local")))
+	assert.Equal(t, -1, MustParseVersion("1.0+local").Compare(MustParseVersion("1.0.post1")))
+	assert.Equal(t, 1, MustParseVersion("1!0.1").Compare(MustParseVersion("2.0")))
+	assert.True(t, MustParseVersion("2.0.0rc1").IsPrerelease())
+	assert.True(t, MustParseVersion("2.0.dev1").IsPrerelease())
+	assert.False(t, MustParseVersion("2.0.post1").IsPrerelease())
+}
+
+func TestSpecifiers(t *testing.T) {
+	specs, err := ParseSpecifiers(">=1.2, !=1.3.*, <2")
+	require.NoError(t, err)
+	assert.True(t, specs.Matches(MustParseVersion("1.2")))
+	assert.False(t, specs.Matches(MustParseVersion("1.3.1")))
+	assert.True(t, specs.Matches(MustParseVersion("1.4")))
+	assert.False(t, specs.Matches(MustParseVersion("2.0")))
+	assert.False(t, specs.AllowsPrereleases())
+	// Compatible releases.
+	specs, err = ParseSpecifiers("~=2.2.1")
+	require.NoError(t, err)
+	assert.True(t, specs.Matches(MustParseVersion("2.2.5")))
+	assert.False(t, specs.Matches(MustParseVersion("2.3")))
+	assert.False(t, specs.Matches(MustParseVersion("2.2.0")))
+	// Mentioning a prerelease allows them.
+	specs, err = ParseSpecifiers(">=2.0.0rc1")
+	require.NoError(t, err)
+	assert.True(t, specs.AllowsPrereleases())
+	_, err = ParseSpecifiers(">=1.*")
+	assert.Error(t, err)
+	_, err = ParseSpecifiers("=>1.0")
+	assert.Error(t, err)
+}
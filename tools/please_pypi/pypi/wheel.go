@@ -0,0 +1,141 @@
+package pypi
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// A Wheel describes a wheel file, from the information in its filename as described in PEP 427.
+type Wheel struct {
+	Name, Version string
+	// Compatibility tags; each of these can have several values, separated by dots.
+	Python, ABI, Platform string
+}
+
+// ParseWheelFilename parses the filename of a wheel.
+func ParseWheelFilename(filename string) (*Wheel, error) {
+	if !strings.HasSuffix(filename, ".whl") {
+		return nil, fmt.Errorf("%s is not a wheel", filename)
+	}
+	parts := strings.Split(strings.TrimSuffix(filename, ".whl"), "-")
+	if len(parts) != 5 && len(parts) != 6 { // The sixth is an optional build tag.
+		return nil, fmt.Errorf("Invalid wheel filename %s", filename)
+	}
+	n := len(parts)
+	return &Wheel{
+		Name:     NormaliseName(parts[0]),
+		Version:  parts[1],
+		Python:   parts[n-3],
+		ABI:      parts[n-2],
+		Platform: parts[n-1],
+	}, nil
+}
+
+// IsPure returns true if this wheel is platform-independent.
+func (w *Wheel) IsPure() bool {
+	return w.Platform == "any"
+}
+
+// Compatible returns true if this wheel can be used for the given Python version and platform.
+func (w *Wheel) Compatible(pythonVersion, platform string) bool {
+	parts := strings.Split(pythonVersion, ".")
+	major := parts[0]
+	minor := major
+	if len(parts) > 1 {
+		minor += parts[1]
+	}
+	return anyTag(w.Python, func(tag string) bool {
+		return tag == "py"+major || tag == "py"+minor || tag == "cp"+minor || (tag == "cp"+major && w.ABI == "abi3")
+	}) && anyTag(w.ABI, func(tag string) bool {
+		return tag == "none" || tag == "abi3" || tag == "cp"+minor || tag == "cp"+minor+"m"
+	}) && anyTag(w.Platform, func(tag string) bool {
+		return tag == "any" || tag == platform || (strings.HasPrefix(platform, "linux_") && strings.HasPrefix(tag, "manylinux") && strings.HasSuffix(tag, strings.TrimPrefix(platform, "linux")))
+	})
+}
+
+// anyTag returns true if the given function is true for any of a set of dot-separated tags.
+func anyTag(tags string, f func(string) bool) bool {
+	for _, tag := range strings.Split(tags, ".") {
+		if f(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Metadata is the metadata about a package that we read from a wheel.
+type Metadata struct {
+	Requirements []*Requirement
+	Licences     []string
+	// Top-level files & directories in the wheel, other than its metadata.
+	TopLevel []string
+}
+
+// ReadWheel reads the metadata from the contents of a wheel.
+func ReadWheel(b []byte) (*Metadata, error) {
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+	m := &Metadata{}
+	topLevel := map[string]bool{}
+	for _, f := range r.File {
+		name := strings.SplitN(f.Name, "/", 2)[0]
+		if strings.HasSuffix(name, ".dist-info") {
+			if f.Name == name+"/METADATA" {
+				if err := m.read(f); err != nil {
+					return nil, err
+				}
+			}
+		} else if !strings.HasSuffix(name, ".data") {
+			topLevel[name] = true
+		}
+	}
+	for name := range topLevel {
+		m.TopLevel = append(m.TopLevel, name)
+	}
+	sort.Strings(m.TopLevel)
+	return m, nil
+}
+
+// read reads the METADATA file from a wheel.
+func (m *Metadata) read(f *zip.File) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	// This is in the same format as email headers, followed by the description.
+	headers, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(b))).ReadMIMEHeader()
+	if err != nil && len(headers) == 0 {
+		return fmt.Errorf("Invalid METADATA in %s: %s", f.Name, err)
+	}
+	for _, s := range headers["Requires-Dist"] {
+		req, err := ParseRequirement(s)
+		if err != nil {
+			return fmt.Errorf("Invalid METADATA in %s: %s", f.Name, err)
+		}
+		m.Requirements = append(m.Requirements, req)
+	}
+	for _, classifier := range headers["Classifier"] {
+		if parts := strings.Split(classifier, " :: "); len(parts) > 2 && parts[0] == "License" {
+			m.Licences = append(m.Licences, parts[len(parts)-1])
+		}
+	}
+	// Fall back to the License field if there are no classifiers, as long as it's a
+	// sensible name and not the entire text of the licence.
+	if licence := strings.TrimSpace(headers.Get("License")); len(m.Licences) == 0 && licence != "" && licence != "UNKNOWN" && len(licence) < 50 && !strings.Contains(licence, "\n") {
+		m.Licences = []string{licence}
+	}
+	return nil
+}